@@ -13,7 +13,10 @@ import (
 	"net/http"
 	"os"
 	"sort"
+	"sync"
+	"time"
 
+	"github.com/bzz/scholar-alert-digest/feedback"
 	"github.com/bzz/scholar-alert-digest/gmailutils"
 	"github.com/bzz/scholar-alert-digest/gmailutils/token"
 	js "github.com/bzz/scholar-alert-digest/json"
@@ -52,6 +55,7 @@ var ( // templates
 var ( // configuration
 	addr      = "localhost:8080"
 	concurReq = 10
+	batchSize = 50
 	oauthCfg  = &oauth2.Config{
 		// from https://console.developers.google.com/project/<your-project-id>/apiui/credential
 		ClientID:     os.Getenv("SAD_GOOGLE_ID"),
@@ -63,9 +67,10 @@ var ( // configuration
 )
 
 var ( // CLI
-	compact = flag.Bool("compact", false, "output report in compact format (>100 papers)")
+	compact = flag.Bool("compact", false, "output only paper titles, links and counts")
 	test    = flag.Bool("test", false, "read emails from ./fixtures/* instead of real Gmail")
 	dev     = flag.Bool("dev", false, "development mode where /login/auth redirects to :9000 and CORS is enabled")
+	fbFile  = flag.String("feedback", "feedback.json", "path to a file with papers, marked as interesting or not")
 	// TODO(bzz): add -read support + equivalent per-user config option (cookies)
 )
 
@@ -115,6 +120,7 @@ func main() {
 
 		j.Get("/labels", listLabels)
 		j.With(labelCtx).Post("/messages", listMessages)
+		j.Post("/feedback", markPaper)
 		// j.Get("/papers", listPapers)
 	})
 
@@ -141,9 +147,10 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
 	var rMsgs, urMsgs []*gmail.Message
 	if !*test { // TODO(bzz): refactor, replace \w polymorphism though interface for fetching messages
 		var err error
-		srv, _ := gmail.New(oauthCfg.Client(r.Context(), tok)) // ignore err as client != nil
-		query := fmt.Sprintf("label:%s is:unread", gmailLabel)
-		urMsgs, err = gmailutils.FetchConcurent(r.Context(), srv, user, query, concurReq)
+		client := gmailClient(r.Context(), tok)
+		srv, _ := gmail.New(client) // ignore err as client != nil
+		fetcher := &gmailutils.Fetcher{Srv: srv, Client: client, User: user, Concurrency: concurReq, BatchSize: batchSize}
+		urMsgs, err = fetcher.Fetch(r.Context(), fmt.Sprintf("label:%s is:unread", gmailLabel))
 		if err != nil {
 			// TODO(bzz): token expiration looks ugly here and must be handled elsewhere
 			w.WriteHeader(http.StatusServiceUnavailable)
@@ -166,6 +173,8 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
 		log.Printf("%d errors found, extracting the papers", rStats.Errs)
 	}
 
+	rankPapers(urTitles, rTitles)
+
 	// render
 	if _, ok := r.URL.Query()["json"]; ok {
 		w.Header().Set("Content-Type", "application/json")
@@ -175,6 +184,17 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// gmailClient returns an authorized client for Gmail API, limited to the per-user quota, retrying failed requests
+// and canceling the ones that take too long.
+func gmailClient(ctx context.Context, tok *oauth2.Token) *http.Client {
+	limiter, _ := limiters.LoadOrStore(tok.AccessToken, gmailutils.NewLimiter(gmailutils.DefaultQuota))
+	client := gmailutils.WithTimeout(oauthCfg.Client(ctx, tok), gmailutils.CallTimeout)
+	return gmailutils.WithRetries(gmailutils.WithQuota(client, limiter.(*gmailutils.Limiter)))
+}
+
+// limiters of Gmail API quota, shared by all the requests of a user, by the access token.
+var limiters sync.Map
+
 func handleLabelsRead(w http.ResponseWriter, r *http.Request) {
 	var gmLabels []*gmail.Label
 	if !*test {
@@ -184,7 +204,7 @@ func handleLabelsRead(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		client := oauthCfg.Client(r.Context(), tok)
+		client := gmailClient(r.Context(), tok)
 		labelsResp, err := gmailutils.FetchLabels(r.Context(), client)
 		if err != nil {
 			log.Printf("Unable to retrieve all labels: %v", err)
@@ -315,7 +335,7 @@ func listLabels(w http.ResponseWriter, r *http.Request) {
 	var gmLabels []*gmail.Label
 	if !*test {
 		tok := r.Context().Value(tokenKey).(*oauth2.Token)
-		client := oauthCfg.Client(r.Context(), tok)
+		client := gmailClient(r.Context(), tok)
 		labelsResp, err := gmailutils.FetchLabels(r.Context(), client)
 		if err != nil {
 			js.ErrNotFound(w, err, "Unable to retrieve labels from Gmail")
@@ -347,9 +367,10 @@ func listMessages(w http.ResponseWriter, r *http.Request) {
 	var urMsgs, rMsgs []*gmail.Message
 	if !*test { // TODO(bzz): refactor, replace \w polymorphism though interface for fetching messages
 		tok := r.Context().Value(tokenKey).(*oauth2.Token)
-		srv, _ := gmail.New(oauthCfg.Client(r.Context(), tok)) // ignore err as client != nil
-		query := fmt.Sprintf("label:%s is:unread", label)
-		urMsgs, err = gmailutils.FetchConcurent(r.Context(), srv, user, query, concurReq)
+		client := gmailClient(r.Context(), tok)
+		srv, _ := gmail.New(client) // ignore err as client != nil
+		fetcher := &gmailutils.Fetcher{Srv: srv, Client: client, User: user, Concurrency: concurReq, BatchSize: batchSize}
+		urMsgs, err = fetcher.Fetch(r.Context(), fmt.Sprintf("label:%s is:unread", label))
 		if err != nil {
 			js.ErrFailedDependency(w, err, "failed to fetch messages from Gmail")
 			return
@@ -370,9 +391,57 @@ func listMessages(w http.ResponseWriter, r *http.Request) {
 		log.Printf("%d errors found, extracting the papers", urStats.Errs)
 	}
 
+	rankPapers(urTitles, rTitles)
 	jsonRn.Render(w, urStats, urTitles, rTitles)
 }
 
+// rankPapers sorts papers by the probability to be interesting, judging by the feedback, if there is any.
+func rankPapers(aggPapers ...papers.AggPapers) {
+	fbMu.Lock()
+	defer fbMu.Unlock()
+	fb, err := feedback.Open(*fbFile)
+	if err != nil {
+		log.Printf("Unable to read feedback from %s: %v", *fbFile, err)
+		return
+	}
+	if c := fb.Classifier(); c.Trained() {
+		for _, ap := range aggPapers {
+			papers.ScoreRelevance(ap, c)
+		}
+	}
+}
+
+// fbMu serializes access to the feedback file.
+var fbMu sync.Mutex
+
+// markPaper saves the paper from request body e.g {"paper": {"Title": ...}, "interesting": true} to the feedback.
+func markPaper(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Paper       *papers.Paper `json:"paper"`
+		Interesting bool          `json:"interesting"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Paper == nil {
+		if err == nil {
+			err = fmt.Errorf("no paper")
+		}
+		js.ErrUnprocessable(w, err, "Unable to decode JSON feedback")
+		return
+	}
+
+	fbMu.Lock()
+	defer fbMu.Unlock()
+	fb, err := feedback.Open(*fbFile)
+	if err == nil {
+		fb.Mark(req.Paper, req.Interesting, time.Now())
+		err = fb.Save()
+	}
+	if err != nil {
+		js.ErrFailedDependency(w, err, "Failed to save feedback")
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"labels": len(fb.Labels)})
+}
+
 func tokenCtx(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -0,0 +1,70 @@
+package enrich
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/bzz/scholar-alert-digest/papers"
+)
+
+// AltmetricURL is the endpoint of the Altmetric API.
+const AltmetricURL = "https://api.altmetric.com/v1"
+
+// Altmetric looks up the papers, by the DOI or the arXiv ID, in Altmetric and adds the attention score,
+// that is the weighted number of mentions in the news, blogs, social media, etc.
+type Altmetric struct {
+	opts Options
+	url  string
+}
+
+// NewAltmetric returns an Enricher, using the Altmetric API.
+func NewAltmetric(opts Options) *Altmetric {
+	return &Altmetric{opts, AltmetricURL}
+}
+
+// Name of the service.
+func (a *Altmetric) Name() string {
+	return "altmetric"
+}
+
+// altmetricCitation is a part of the attention data of a paper in Altmetric.
+type altmetricCitation struct {
+	Score      float64 `json:"score"`
+	DetailsURL string  `json:"details_url"`
+}
+
+// Enrich adds the attention score of the paper \w the DOI or the arXiv ID. Papers \wo either,
+// or \wo any attention, are ErrNotFound.
+func (a *Altmetric) Enrich(ctx context.Context, p *papers.Paper) error {
+	var path string
+	switch {
+	case p.DOI != "":
+		path = "/doi/" + p.DOI
+	case strings.HasPrefix(p.ID, "doi:"):
+		path = "/doi/" + strings.TrimPrefix(p.ID, "doi:")
+	case strings.HasPrefix(p.ID, "arxiv:"):
+		path = "/arxiv/" + strings.TrimPrefix(p.ID, "arxiv:")
+	default:
+		return ErrNotFound
+	}
+
+	q := url.Values{}
+	if a.opts.AltmetricKey != "" {
+		q.Set("key", a.opts.AltmetricKey)
+	}
+	u := a.url + (&url.URL{Path: path}).EscapedPath() // DOIs keep the slashes
+	if len(q) != 0 {
+		u += "?" + q.Encode()
+	}
+
+	var c altmetricCitation
+	if err := a.opts.Cache.lookup(a.Name(), cacheKey(p), &c, func() error {
+		return getJSON(ctx, a.opts.Client, u, &c)
+	}); err != nil {
+		return err
+	}
+	p.Attention = c.Score
+	p.AttentionURL = c.DetailsURL
+	return nil
+}
@@ -0,0 +1,51 @@
+package enrich
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bzz/scholar-alert-digest/papers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAltmetric(t *testing.T) {
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RequestURI())
+		assert.Equal(t, "secret", r.URL.Query().Get("key"))
+		switch r.URL.Path {
+		case "/doi/10.1145/3290353":
+			w.Write([]byte(`{"title": "code2vec", "doi": "10.1145/3290353", "score": 42.5,
+				"details_url": "https://www.altmetric.com/details.php?citation_id=1"}`))
+		case "/arxiv/1711.00740":
+			w.Write([]byte(`{"title": "Learning to represent programs with graphs", "score": 3}`))
+		default: // no attention
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	a := NewAltmetric(Options{Client: srv.Client(), AltmetricKey: "secret"})
+	a.url = srv.URL
+
+	p := &papers.Paper{Title: "code2vec", ID: "doi:10.1145/3290353"}
+	require.NoError(t, a.Enrich(context.Background(), p))
+	assert.Equal(t, 42.5, p.Attention)
+	assert.Equal(t, "https://www.altmetric.com/details.php?citation_id=1", p.AttentionURL)
+
+	p = &papers.Paper{Title: "Learning to represent programs with graphs", ID: "arxiv:1711.00740"}
+	require.NoError(t, a.Enrich(context.Background(), p))
+	assert.Equal(t, 3.0, p.Attention)
+
+	p = &papers.Paper{Title: "Unknown", DOI: "10.3/unknown"}
+	assert.Equal(t, ErrNotFound, a.Enrich(context.Background(), p))
+	p = &papers.Paper{Title: "Neural code search"}
+	assert.Equal(t, ErrNotFound, a.Enrich(context.Background(), p), "no DOI or arXiv ID")
+
+	assert.Equal(t, []string{
+		"/doi/10.1145/3290353?key=secret", "/arxiv/1711.00740?key=secret", "/doi/10.3/unknown?key=secret",
+	}, queries)
+}
@@ -0,0 +1,143 @@
+package enrich
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bzz/scholar-alert-digest/papers"
+)
+
+// ArXivURL is the endpoint of the arXiv API.
+const ArXivURL = "https://export.arxiv.org/api/query"
+
+// arXivInterval is the min time between the requests, that the arXiv API terms of use ask for.
+const arXivInterval = 3 * time.Second
+
+// ArXiv replaces the title, authors and abstract of the papers on arXiv, that may be truncated in the alerts,
+// by the ones in arXiv and adds the categories. Links to the PDF are replaced by the abstract page.
+type ArXiv struct {
+	opts Options
+	url  string
+}
+
+// NewArXiv returns an Enricher, using the arXiv API.
+func NewArXiv(opts Options) *ArXiv {
+	return &ArXiv{opts, ArXivURL}
+}
+
+// Name of the service.
+func (a *ArXiv) Name() string {
+	return "arxiv"
+}
+
+// arXivFeed is a part of the Atom feed, returned by the arXiv API.
+type arXivFeed struct {
+	Entries []arXivPaper `xml:"entry"`
+}
+
+// arXivPaper is a part of the metadata of a paper in arXiv, the paper is enriched \w.
+type arXivPaper struct {
+	ID        string `xml:"id"`
+	Title     string `xml:"title"`
+	Summary   string `xml:"summary"`
+	Published string `xml:"published"`
+	DOI       string `xml:"doi"`
+	Authors   []struct {
+		Name string `xml:"name"`
+	} `xml:"author"`
+	Primary struct {
+		Term string `xml:"term,attr"`
+	} `xml:"primary_category"`
+	Categories []struct {
+		Term string `xml:"term,attr"`
+	} `xml:"category"`
+}
+
+// Enrich replaces the metadata of a paper \w an arXiv ID.
+func (a *ArXiv) Enrich(ctx context.Context, p *papers.Paper) error {
+	if !strings.HasPrefix(p.ID, "arxiv:") {
+		return ErrNotFound
+	}
+	id := strings.TrimPrefix(p.ID, "arxiv:")
+
+	var e arXivPaper
+	if err := a.opts.Cache.lookup(a.Name(), p.ID, &e, func() (err error) {
+		e, err = a.find(ctx, id)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if title := strings.Join(strings.Fields(e.Title), " "); title != "" {
+		p.Title = title
+	}
+	if len(e.Authors) != 0 {
+		p.Authors = nil
+		for _, author := range e.Authors {
+			p.Authors = append(p.Authors, strings.TrimSpace(author.Name))
+		}
+		p.Author = strings.Join(p.Authors, ", ")
+	}
+	if summary := strings.Join(strings.Fields(e.Summary), " "); summary != "" {
+		p.Abstract = papers.NewAbstract(summary)
+	}
+
+	p.Categories = nil
+	if e.Primary.Term != "" {
+		p.Categories = append(p.Categories, e.Primary.Term)
+	}
+	for _, c := range e.Categories {
+		if c.Term != e.Primary.Term {
+			p.Categories = append(p.Categories, c.Term)
+		}
+	}
+
+	if p.Published == "" && len(e.Published) >= len("2006-01-02") {
+		p.Published = e.Published[:len("2006-01-02")]
+	}
+	if p.Year == 0 {
+		fmt.Sscanf(p.Published, "%d", &p.Year)
+	}
+	if p.DOI == "" {
+		p.DOI = strings.ToLower(strings.TrimSpace(e.DOI))
+	}
+
+	if u, err := url.Parse(p.URL); err == nil && strings.HasSuffix(u.Hostname(), "arxiv.org") && strings.HasPrefix(u.Path, "/pdf/") {
+		p.URL = "https://arxiv.org/abs/" + id
+		if p.Kind == papers.KindPDF {
+			p.Kind = ""
+		}
+	}
+	return nil
+}
+
+// find returns the entry of the paper \w a given arXiv ID.
+func (a *ArXiv) find(ctx context.Context, id string) (arXivPaper, error) {
+	req, err := http.NewRequest(http.MethodGet, a.url+"?"+url.Values{"id_list": {id}}.Encode(), nil)
+	if err != nil {
+		return arXivPaper{}, err
+	}
+	resp, err := a.opts.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return arXivPaper{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return arXivPaper{}, fmt.Errorf("GET %s: %s", req.URL, resp.Status)
+	}
+
+	var feed arXivFeed
+	if err := xml.NewDecoder(resp.Body).Decode(&feed); err != nil {
+		return arXivPaper{}, err
+	}
+	// unknown IDs are an error entry, or no entry at all
+	if len(feed.Entries) == 0 || strings.Contains(feed.Entries[0].ID, "/api/errors") {
+		return arXivPaper{}, ErrNotFound
+	}
+	return feed.Entries[0], nil
+}
@@ -0,0 +1,77 @@
+package enrich
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bzz/scholar-alert-digest/papers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const arXivEntry = `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xmlns:arxiv="http://arxiv.org/schemas/atom">
+  <entry>
+    <id>http://arxiv.org/abs/1711.00740v3</id>
+    <published>2017-11-01T12:23:31Z</published>
+    <title>Learning to Represent Programs
+  with Graphs</title>
+    <summary>  Learning tasks on source code (i.e., formal languages) have been considered
+recently, but most work has tried to transfer natural language methods.
+</summary>
+    <author><name>Miltiadis Allamanis</name></author>
+    <author><name>Marc Brockschmidt</name></author>
+    <author><name>Mahmoud Khademi</name></author>
+    <arxiv:primary_category term="cs.LG" scheme="http://arxiv.org/schemas/atom"/>
+    <category term="cs.AI" scheme="http://arxiv.org/schemas/atom"/>
+    <category term="cs.LG" scheme="http://arxiv.org/schemas/atom"/>
+  </entry>
+</feed>`
+
+const arXivError = `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <entry>
+    <id>http://arxiv.org/api/errors#incorrect_id_format_for_9999.99999</id>
+    <title>Error</title>
+  </entry>
+</feed>`
+
+func TestArXiv(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("id_list") == "1711.00740" {
+			w.Write([]byte(arXivEntry))
+		} else {
+			w.Write([]byte(arXivError))
+		}
+	}))
+	defer srv.Close()
+
+	a := NewArXiv(Options{Client: srv.Client()})
+	a.url = srv.URL
+
+	p := &papers.Paper{
+		Title: "Learning to represent programs with graphs", URL: "https://arxiv.org/pdf/1711.00740v2", ID: "arxiv:1711.00740",
+		Author: "M Allamanis, M Brockschmidt…", Kind: papers.KindPDF,
+		Abstract: papers.Abstract{FirstLine: "Learning tasks on source code (i.e., formal languages) have been considered", Rest: "recently …"},
+	}
+	require.NoError(t, a.Enrich(context.Background(), p))
+	assert.Equal(t, "Learning to Represent Programs with Graphs", p.Title)
+	assert.Equal(t, []string{"Miltiadis Allamanis", "Marc Brockschmidt", "Mahmoud Khademi"}, p.Authors)
+	assert.Equal(t, "Miltiadis Allamanis, Marc Brockschmidt, Mahmoud Khademi", p.Author)
+	assert.Equal(t, "Learning tasks on source code (i.e., formal languages) have been considered recently, "+
+		"but most work has tried to transfer natural language methods.", p.Abstract.FirstLine+" "+p.Abstract.Rest)
+	assert.Equal(t, []string{"cs.LG", "cs.AI"}, p.Categories, "primary first")
+	assert.Equal(t, "2017-11-01", p.Published)
+	assert.Equal(t, 2017, p.Year)
+	assert.Equal(t, "https://arxiv.org/abs/1711.00740", p.URL, "abstract page instead of the PDF")
+	assert.Empty(t, p.Kind)
+
+	p = &papers.Paper{Title: "Unknown", URL: "https://arxiv.org/abs/9999.99999", ID: "arxiv:9999.99999"}
+	assert.Equal(t, ErrNotFound, a.Enrich(context.Background(), p))
+	assert.Equal(t, "Unknown", p.Title)
+
+	p = &papers.Paper{Title: "code2vec", URL: "https://dl.acm.org/1"}
+	assert.Equal(t, ErrNotFound, a.Enrich(context.Background(), p), "not on arXiv")
+}
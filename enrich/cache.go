@@ -0,0 +1,141 @@
+package enrich
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bzz/scholar-alert-digest/fileutils"
+	"github.com/bzz/scholar-alert-digest/papers"
+)
+
+// DefaultCacheTTL is the max age of the cached results, as the number of citations etc. change over time.
+const DefaultCacheTTL = 7 * 24 * time.Hour
+
+// Cache keeps the results of the lookups of the papers in the services and of the resolved URLs,
+// by the paper identity e.g the DOI, so the repeated runs and the overlapping digests do not query
+// the services again. Papers, unknown to a service, are cached too, failures are not.
+// It is saved as a JSON file. A nil Cache caches nothing.
+type Cache struct {
+	path string
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	results map[string]cached // by the service and the key
+	changed bool
+}
+
+type cached struct {
+	Result  json.RawMessage `json:",omitempty"` // nil if not found
+	Fetched time.Time
+}
+
+// OpenCache reads the cache from a given file, \wo the results older than the TTL.
+// Missing file is an empty cache.
+func OpenCache(path string, ttl time.Duration) (*Cache, error) {
+	c := &Cache{path: path, ttl: ttl, results: map[string]cached{}}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(&c.results); err != nil {
+		return nil, err
+	}
+	for k, r := range c.results {
+		if time.Since(r.Fetched) > ttl {
+			delete(c.results, k)
+			c.changed = true
+		}
+	}
+	return c, nil
+}
+
+// cacheKey returns the identity of a paper, the lookups are cached by: the DOI, if known, or the Key.
+func cacheKey(p *papers.Paper) string {
+	if p.DOI != "" {
+		return "doi:" + strings.ToLower(p.DOI)
+	}
+	return p.Key()
+}
+
+// lookup decodes the cached result of a given service and key into v, if any and not expired.
+// Otherwise it calls fetch, that must set v or return ErrNotFound, and caches the result.
+func (c *Cache) lookup(service, key string, v interface{}, fetch func() error) error {
+	if ok, err := c.get(service, key, v); ok {
+		return err
+	}
+	err := fetch()
+	switch err {
+	case nil:
+		return c.put(service, key, v)
+	case ErrNotFound:
+		c.put(service, key, nil)
+	}
+	return err
+}
+
+// get decodes the cached result of a given service and key into v and returns true, if there is one
+// and it is not expired. The error is ErrNotFound for the papers, unknown to the service.
+func (c *Cache) get(service, key string, v interface{}) (bool, error) {
+	if c == nil {
+		return false, nil
+	}
+	c.mu.Lock()
+	r, ok := c.results[service+" "+key]
+	c.mu.Unlock()
+	if !ok || time.Since(r.Fetched) > c.ttl {
+		return false, nil
+	}
+	if r.Result == nil {
+		return true, ErrNotFound
+	}
+	// results of an incompatible format are fetched again
+	return json.Unmarshal(r.Result, v) == nil, nil
+}
+
+// put caches a result of a given service and key, nil for the papers, unknown to the service.
+func (c *Cache) put(service, key string, v interface{}) error {
+	if c == nil {
+		return nil
+	}
+	r := cached{Fetched: time.Now()}
+	if v != nil {
+		var err error
+		if r.Result, err = json.Marshal(v); err != nil {
+			return err
+		}
+	}
+	c.mu.Lock()
+	c.results[service+" "+key] = r
+	c.changed = true
+	c.mu.Unlock()
+	return nil
+}
+
+// Save writes the cache to the file it was opened from, if anything changed.
+func (c *Cache) Save() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.changed {
+		return nil
+	}
+
+	if err := fileutils.AtomicWrite(c.path, 0600, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(c.results)
+	}); err != nil {
+		return err
+	}
+	c.changed = false
+	return nil
+}
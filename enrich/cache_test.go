@@ -0,0 +1,77 @@
+package enrich
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bzz/scholar-alert-digest/papers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.EscapedPath())
+		switch r.URL.EscapedPath() {
+		case "/works/10.2%2Fcode2vec":
+			w.Write([]byte(`{"message": {"DOI": "10.2/code2vec", "title": ["code2vec"], "container-title": ["POPL"],
+				"is-referenced-by-count": 7}}`))
+		case "/works/10.3%2Ffailed":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "enrich")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "enrich.json")
+
+	cache, err := OpenCache(path, time.Hour)
+	require.NoError(t, err, "missing file is an empty cache")
+	c := NewCrossref(Options{Client: srv.Client(), Cache: cache})
+	c.url = srv.URL
+
+	enrich := func() {
+		p := &papers.Paper{Title: "code2vec", ID: "doi:10.2/code2vec"}
+		require.NoError(t, c.Enrich(context.Background(), p))
+		assert.Equal(t, "POPL", p.Venue)
+		assert.Equal(t, 7, p.Citations)
+
+		p = &papers.Paper{Title: "Unknown", DOI: "10.3/unknown"}
+		assert.Equal(t, ErrNotFound, c.Enrich(context.Background(), p))
+		assert.Error(t, c.Enrich(context.Background(), &papers.Paper{Title: "Failed", DOI: "10.3/failed"}))
+	}
+	enrich()
+	enrich()
+	assert.Equal(t, []string{"/works/10.2%2Fcode2vec", "/works/10.3%2Funknown", "/works/10.3%2Ffailed", "/works/10.3%2Ffailed"},
+		queries, "unknown papers are cached, failures are not")
+
+	require.NoError(t, cache.Save())
+	c.opts.Cache, err = OpenCache(path, time.Hour)
+	require.NoError(t, err)
+	queries = nil
+	enrich()
+	assert.Equal(t, []string{"/works/10.3%2Ffailed"}, queries, "results are saved")
+
+	c.opts.Cache, err = OpenCache(path, time.Nanosecond)
+	require.NoError(t, err)
+	queries = nil
+	enrich()
+	assert.Len(t, queries, 3, "expired results are fetched again")
+
+	var nilCache *Cache
+	fetched := errors.New("fetched")
+	assert.Equal(t, fetched, nilCache.lookup("crossref", "doi:10.2/code2vec", new(crossrefWork), func() error { return fetched }))
+	assert.NoError(t, nilCache.Save())
+}
@@ -0,0 +1,145 @@
+package enrich
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/bzz/scholar-alert-digest/papers"
+)
+
+// CrossrefURL is the endpoint of the Crossref REST API.
+const CrossrefURL = "https://api.crossref.org"
+
+// crossrefCandidates is the number of the works, searched by the title, one of which must have the same title.
+const crossrefCandidates = 5
+
+// Crossref looks up the DOI of the papers, by the DOI in the URL or by the title, in Crossref and adds it
+// \w the date of the publication, the journal, the publisher and the number of citations.
+type Crossref struct {
+	opts Options
+	url  string
+}
+
+// NewCrossref returns an Enricher, using the Crossref API.
+func NewCrossref(opts Options) *Crossref {
+	return &Crossref{opts, CrossrefURL}
+}
+
+// Name of the service.
+func (c *Crossref) Name() string {
+	return "crossref"
+}
+
+// crossrefWork is a part of the metadata of a work in Crossref, the paper is enriched \w.
+type crossrefWork struct {
+	DOI            string   `json:"DOI"`
+	Title          []string `json:"title"`
+	ContainerTitle []string `json:"container-title"`
+	Publisher      string   `json:"publisher"`
+	Published      struct {
+		DateParts [][]int `json:"date-parts"`
+	} `json:"published"`
+	Issued struct {
+		DateParts [][]int `json:"date-parts"`
+	} `json:"issued"`
+	Citations int `json:"is-referenced-by-count"`
+}
+
+// Enrich adds metadata of the work \w the DOI of the paper, if known, or the same title.
+func (c *Crossref) Enrich(ctx context.Context, p *papers.Paper) error {
+	doi := p.DOI
+	if doi == "" && strings.HasPrefix(p.ID, "doi:") {
+		doi = strings.TrimPrefix(p.ID, "doi:")
+	}
+
+	var work crossrefWork
+	if err := c.opts.Cache.lookup(c.Name(), cacheKey(p), &work, func() (err error) {
+		work, err = c.find(ctx, doi, p.Title)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	p.DOI = strings.ToLower(work.DOI)
+	date := work.Published.DateParts
+	if len(date) == 0 || len(date[0]) == 0 || date[0][0] == 0 {
+		date = work.Issued.DateParts
+	}
+	if len(date) != 0 && p.Published == "" {
+		p.Published = formatDateParts(date[0])
+	}
+	if len(date) != 0 && len(date[0]) != 0 && p.Year == 0 {
+		p.Year = date[0][0]
+	}
+	if len(work.ContainerTitle) != 0 && p.Venue == "" {
+		p.Venue = work.ContainerTitle[0]
+	}
+	if p.Publisher == "" {
+		p.Publisher = work.Publisher
+	}
+	if work.Citations > p.Citations {
+		p.Citations = work.Citations
+	}
+	return nil
+}
+
+// find returns the work \w a given DOI, if known, or the same title.
+func (c *Crossref) find(ctx context.Context, doi, title string) (crossrefWork, error) {
+	if doi != "" {
+		var resp struct{ Message crossrefWork }
+		if err := getJSON(ctx, c.opts.Client, c.query("/works/"+url.PathEscape(doi), url.Values{}), &resp); err != nil {
+			return crossrefWork{}, err
+		}
+		if resp.Message.DOI == "" {
+			return crossrefWork{}, ErrNotFound
+		}
+		return resp.Message, nil
+	}
+
+	var resp struct {
+		Message struct{ Items []crossrefWork }
+	}
+	q := url.Values{
+		"query.bibliographic": {title},
+		"rows":                {fmt.Sprint(crossrefCandidates)},
+		"select":              {"DOI,title,container-title,publisher,published,issued,is-referenced-by-count"},
+	}
+	if err := getJSON(ctx, c.opts.Client, c.query("/works", q), &resp); err != nil {
+		return crossrefWork{}, err
+	}
+	for _, w := range resp.Message.Items {
+		if len(w.Title) != 0 && papers.SameTitle(w.Title[0], title) {
+			if w.DOI == "" {
+				break
+			}
+			return w, nil
+		}
+	}
+	return crossrefWork{}, ErrNotFound
+}
+
+// query returns the URL of a given API path and query, \w the contact email, if any.
+func (c *Crossref) query(path string, q url.Values) string {
+	if c.opts.Mailto != "" {
+		q.Set("mailto", c.opts.Mailto)
+	}
+	if len(q) == 0 {
+		return c.url + path
+	}
+	return c.url + path + "?" + q.Encode()
+}
+
+// formatDateParts formats the year, month and day, as many as known, e.g "2020-03-02", "2020-03" or "2020".
+func formatDateParts(parts []int) string {
+	switch {
+	case len(parts) == 0 || parts[0] == 0:
+		return ""
+	case len(parts) == 1 || parts[1] == 0:
+		return fmt.Sprintf("%04d", parts[0])
+	case len(parts) == 2 || parts[2] == 0:
+		return fmt.Sprintf("%04d-%02d", parts[0], parts[1])
+	}
+	return fmt.Sprintf("%04d-%02d-%02d", parts[0], parts[1], parts[2])
+}
@@ -0,0 +1,68 @@
+package enrich
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bzz/scholar-alert-digest/papers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCrossref(t *testing.T) {
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RequestURI())
+		assert.Equal(t, "me@example.com", r.URL.Query().Get("mailto"))
+		switch r.URL.EscapedPath() {
+		case "/works":
+			w.Write([]byte(`{"message": {"items": [
+				{"DOI": "10.1/other", "title": ["Learning to represent programs with graphs and more"]},
+				{"DOI": "10.1/ABC", "title": ["Learning to Represent Programs with Graphs"], "container-title": ["ICLR"],
+				 "publisher": "OpenReview", "published": {"date-parts": [[2018, 2]]}, "is-referenced-by-count": 42}
+			]}}`))
+		case "/works/10.2%2Fcode2vec":
+			w.Write([]byte(`{"message": {"DOI": "10.2/code2vec", "title": ["code2vec"], "container-title": ["POPL"],
+				"published": {"date-parts": [[null]]}, "issued": {"date-parts": [[2019, 1, 2]]}, "is-referenced-by-count": 7}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewCrossref(Options{Client: srv.Client(), Mailto: "me@example.com"})
+	c.url = srv.URL
+
+	p := &papers.Paper{Title: "Learning to represent programs with graphs", Citations: 50}
+	require.NoError(t, c.Enrich(context.Background(), p))
+	assert.Equal(t, &papers.Paper{
+		Title: "Learning to represent programs with graphs", DOI: "10.1/abc", Published: "2018-02", Year: 2018,
+		Venue: "ICLR", Publisher: "OpenReview", Citations: 50,
+	}, p, "by the same title, more citations are kept")
+
+	p = &papers.Paper{Title: "code2vec", ID: "doi:10.2/code2vec", Venue: "PACMPL"}
+	require.NoError(t, c.Enrich(context.Background(), p))
+	assert.Equal(t, "10.2/code2vec", p.DOI)
+	assert.Equal(t, "2019-01-02", p.Published, "issued, if not published")
+	assert.Equal(t, "PACMPL", p.Venue, "known venue is kept")
+	assert.Equal(t, 7, p.Citations)
+
+	p = &papers.Paper{Title: "Unknown", DOI: "10.3/unknown"}
+	assert.Equal(t, ErrNotFound, c.Enrich(context.Background(), p))
+	p = &papers.Paper{Title: "Neural code search"}
+	assert.Equal(t, ErrNotFound, c.Enrich(context.Background(), p), "no work with the same title")
+	assert.Empty(t, p.DOI)
+
+	assert.Len(t, queries, 4)
+	assert.Contains(t, queries[0], "query.bibliographic=Learning+to+represent+programs+with+graphs")
+}
+
+func TestFormatDateParts(t *testing.T) {
+	assert.Equal(t, "2020-03-02", formatDateParts([]int{2020, 3, 2}))
+	assert.Equal(t, "2020-03", formatDateParts([]int{2020, 3}))
+	assert.Equal(t, "2020", formatDateParts([]int{2020}))
+	assert.Equal(t, "", formatDateParts([]int{0}))
+	assert.Equal(t, "", formatDateParts(nil))
+}
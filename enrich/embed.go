@@ -0,0 +1,107 @@
+package enrich
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/bzz/scholar-alert-digest/papers"
+)
+
+// DefaultEmbeddingBatch is the number of the papers, embedded by a single request, unless set by the LLMOptions.
+const DefaultEmbeddingBatch = 100
+
+// embeddingModels are the default models of the well-known endpoints, by name.
+var embeddingModels = map[string]string{
+	"openai": "text-embedding-3-small",
+	"ollama": "nomic-embed-text",
+}
+
+// Embedder returns the embeddings of the titles and abstracts of the papers, to cluster them by topic,
+// from an OpenAI-compatible embeddings API e.g of OpenAI or a local Ollama.
+type Embedder struct {
+	opts LLMOptions
+}
+
+// NewEmbedder returns an Embedder. Endpoints, other than the well-known ones, must set the Model.
+func NewEmbedder(opts LLMOptions) (*Embedder, error) {
+	opts, err := opts.resolve(embeddingModels, DefaultEmbeddingBatch)
+	if err != nil {
+		return nil, err
+	}
+	return &Embedder{opts}, nil
+}
+
+// Papers returns the embeddings of all the papers, by title, Batch papers in a single request, one request
+// at a time. Papers of the failed requests have none. It stops \w an error once the context is done.
+func (e *Embedder) Papers(ctx context.Context, aggPapers papers.AggPapers) (map[string][]float64, error) {
+	service := "embedding " + e.opts.Model // embeddings of different models are not comparable
+	vectors := map[string][]float64{}
+	var todo []string
+	for title, p := range aggPapers {
+		var v []float64
+		if ok, _ := e.opts.Cache.get(service, cacheKey(p), &v); ok {
+			vectors[title] = v
+			continue
+		}
+		todo = append(todo, title)
+	}
+	cached := len(vectors)
+
+	for len(todo) != 0 {
+		n := e.opts.Batch
+		if n > len(todo) {
+			n = len(todo)
+		}
+		batch := todo[:n]
+		todo = todo[n:]
+
+		embeddings, err := e.embed(ctx, aggPapers, batch)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		} else if err != nil {
+			log.Printf("failed to embed %d papers: %v", len(batch), err)
+			continue
+		}
+		for i, title := range batch {
+			vectors[title] = embeddings[i]
+			e.opts.Cache.put(service, cacheKey(aggPapers[title]), embeddings[i])
+		}
+	}
+	log.Printf("embedded %d papers, %d of them cached, by %s", len(vectors), cached, e.opts.Model)
+	return vectors, nil
+}
+
+// embed returns the embeddings of the papers \w given titles, in the same order.
+func (e *Embedder) embed(ctx context.Context, aggPapers papers.AggPapers, titles []string) ([][]float64, error) {
+	var input []string
+	for _, title := range titles {
+		input = append(input, papers.Text(aggPapers[title]))
+	}
+	body := struct {
+		Model string   `json:"model"`
+		Input []string `json:"input"`
+	}{e.opts.Model, input}
+	var resp struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float64 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := e.opts.postJSON(ctx, "/embeddings", body, &resp); err != nil {
+		return nil, err
+	}
+
+	embeddings := make([][]float64, len(titles))
+	for _, d := range resp.Data {
+		if d.Index >= 0 && d.Index < len(embeddings) {
+			embeddings[d.Index] = d.Embedding
+		}
+	}
+	for i, v := range embeddings {
+		if len(v) == 0 {
+			return nil, fmt.Errorf("no embedding of %q", titles[i])
+		}
+	}
+	return embeddings, nil
+}
@@ -0,0 +1,55 @@
+package enrich
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bzz/scholar-alert-digest/papers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbedder(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "/v1/embeddings", r.URL.Path)
+		var req struct {
+			Model string
+			Input []string
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "nomic-embed-text", req.Model)
+
+		// embeddings in the reverse order, by the index
+		var data []map[string]interface{}
+		for i, text := range req.Input {
+			data = append([]map[string]interface{}{{"index": i, "embedding": []float64{float64(len(text)), 1}}}, data...)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+	defer srv.Close()
+
+	cache, err := OpenCache(filepath.Join(os.TempDir(), "missing", "enrich.json"), time.Hour)
+	require.NoError(t, err)
+	e, err := NewEmbedder(LLMOptions{Endpoint: "ollama", Client: srv.Client(), Cache: cache})
+	require.NoError(t, err)
+	assert.Equal(t, DefaultEmbeddingBatch, e.opts.Batch)
+	e.opts.Endpoint = srv.URL + "/v1"
+
+	aggPapers := papers.AggPapers{"a": {Title: "a"}, "bb": {Title: "bb"}}
+	vectors, err := e.Papers(context.Background(), aggPapers)
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]float64{"a": {3, 1}, "bb": {4, 1}}, vectors)
+
+	vectors, err = e.Papers(context.Background(), aggPapers)
+	require.NoError(t, err)
+	assert.Len(t, vectors, 2)
+	assert.Equal(t, 1, requests, "cached embeddings are not requested again")
+}
@@ -0,0 +1,204 @@
+// Package enrich adds metadata of the papers e.g a DOI or the number of citations, from external services.
+package enrich
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bzz/scholar-alert-digest/papers"
+)
+
+// DefaultTimeout is the max duration of a request to a service, unless the Options set a Client.
+const DefaultTimeout = 30 * time.Second
+
+// Concurrency is the number of the papers, enriched or resolved at the same time. Enrichers must be safe
+// for concurrent use.
+var Concurrency = 4
+
+// Intervals returns the min time between the requests to the hosts of the services \w documented rate limits,
+// by host name, for the polite.Options of the Client. Otherwise, concurrent enrichment makes them fail \w 429.
+func Intervals() map[string]time.Duration {
+	intervals := map[string]time.Duration{}
+	for endpoint, d := range map[string]time.Duration{
+		ArXivURL:           arXivInterval,
+		SemanticScholarURL: semanticScholarInterval,
+	} {
+		u, _ := url.Parse(endpoint)
+		intervals[u.Hostname()] = d
+	}
+	return intervals
+}
+
+// ErrNotFound is returned by an Enricher, if the service does not know the paper.
+var ErrNotFound = errors.New("paper not found")
+
+// Enricher adds metadata to a paper, from a single service.
+type Enricher interface {
+	Name() string
+	Enrich(ctx context.Context, p *papers.Paper) error
+}
+
+// Options configures the enrichers, created by New.
+type Options struct {
+	Client *http.Client // nil for a client \w the DefaultTimeout
+	Mailto string       // contact email, sent to the services that ask for one e.g Crossref or OpenAlex
+	Cache  *Cache       // of the results of the services, nil to query them every time
+
+	SemanticScholarKey string // key of the Semantic Scholar API, for a higher rate limit, if any
+	AltmetricKey       string // key of the Altmetric API, for a higher rate limit, if any
+}
+
+// sources are factories of Enricher for each supported service.
+var sources = map[string]func(Options) Enricher{
+	"crossref":        func(o Options) Enricher { return NewCrossref(o) },
+	"arxiv":           func(o Options) Enricher { return NewArXiv(o) },
+	"openalex":        func(o Options) Enricher { return NewOpenAlex(o) },
+	"semanticscholar": func(o Options) Enricher { return NewSemanticScholar(o) },
+	"altmetric":       func(o Options) Enricher { return NewAltmetric(o) },
+}
+
+// Sources returns names of all supported services, sorted.
+func Sources() []string {
+	var names []string
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New returns the enrichers for the services \w given names, in the same order.
+func New(names []string, opts Options) ([]Enricher, error) {
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: DefaultTimeout}
+	}
+	var enrichers []Enricher
+	for _, name := range names {
+		factory, ok := sources[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown enrichment source %q, must be one of: %s", name, strings.Join(Sources(), ", "))
+		}
+		enrichers = append(enrichers, factory(opts))
+	}
+	return enrichers, nil
+}
+
+// Papers enriches all the papers by every enricher, in order, Concurrency papers at a time.
+// Papers, unknown to a service or failed to be enriched, are left as they are.
+// It stops \w an error once the context is done.
+func Papers(ctx context.Context, enrichers []Enricher, aggPapers ...papers.AggPapers) error {
+	for _, e := range enrichers {
+		var enriched, total int32
+		err := forEach(ctx, aggPapers, func(title string, p *papers.Paper) {
+			atomic.AddInt32(&total, 1)
+			err := e.Enrich(ctx, p)
+			if err == nil {
+				atomic.AddInt32(&enriched, 1)
+			} else if err != ErrNotFound && ctx.Err() == nil {
+				log.Printf("%s: failed to enrich %q: %v", e.Name(), title, err)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		log.Printf("%s: enriched %d of %d papers", e.Name(), enriched, total)
+	}
+	return nil
+}
+
+// forEach calls a given function for all the papers, Concurrency at a time, and waits for all the calls to return.
+// Once the context is done, it makes no more calls and returns its error.
+func forEach(ctx context.Context, aggPapers []papers.AggPapers, fn func(title string, p *papers.Paper)) error {
+	n := Concurrency
+	if n < 1 {
+		n = 1
+	}
+	var (
+		throttle = make(chan int, n)
+		wg       sync.WaitGroup
+	)
+	for _, ps := range aggPapers {
+		for _, title := range papers.SortedKeys(ps) {
+			throttle <- 1
+			if ctx.Err() != nil {
+				<-throttle
+				break
+			}
+			title, p := title, ps[title]
+			wg.Add(1)
+			go func() {
+				defer func() { <-throttle; wg.Done() }()
+				fn(title, p)
+			}()
+		}
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// getJSON decodes the JSON response of a GET request to a given URL.
+// Response \w the status 404 is ErrNotFound.
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	return getJSONWithHeader(ctx, client, url, nil, v)
+}
+
+// getJSONWithHeader is getJSON, that also sets the given headers of the request.
+func getJSONWithHeader(ctx context.Context, client *http.Client, url string, header http.Header, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// postJSON sends a POST request \w a given JSON body and headers to a given URL and decodes the JSON response.
+func postJSON(ctx context.Context, client *http.Client, url string, header http.Header, body, v interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("POST %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
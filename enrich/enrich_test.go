@@ -0,0 +1,101 @@
+package enrich
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bzz/scholar-alert-digest/papers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeEnricher sets the DOI of the papers, except the unknown ones.
+type fakeEnricher map[string]error
+
+func (f fakeEnricher) Name() string { return "fake" }
+
+func (f fakeEnricher) Enrich(ctx context.Context, p *papers.Paper) error {
+	if err := f[p.Title]; err != nil {
+		return err
+	}
+	p.DOI = "10.1/" + p.Title
+	return nil
+}
+
+func TestNew(t *testing.T) {
+	enrichers, err := New([]string{"crossref"}, Options{})
+	require.NoError(t, err)
+	require.Len(t, enrichers, 1)
+	assert.Equal(t, "crossref", enrichers[0].Name())
+
+	_, err = New([]string{"crossref", "scopus"}, Options{})
+	assert.EqualError(t, err, `unknown enrichment source "scopus", must be one of: altmetric, arxiv, crossref, openalex, semanticscholar`)
+}
+
+func TestIntervals(t *testing.T) {
+	intervals := Intervals()
+	assert.Equal(t, 3*time.Second, intervals["export.arxiv.org"])
+	assert.Equal(t, time.Second, intervals["api.semanticscholar.org"])
+	assert.NotContains(t, intervals, "api.crossref.org", "the default one")
+}
+
+func TestPapers(t *testing.T) {
+	unread := papers.AggPapers{"a": {Title: "a"}, "unknown": {Title: "unknown"}}
+	read := papers.AggPapers{"failed": {Title: "failed"}}
+	f := fakeEnricher{"unknown": ErrNotFound, "failed": errors.New("503 Service Unavailable")}
+
+	require.NoError(t, Papers(context.Background(), []Enricher{f}, unread, read))
+	assert.Equal(t, "10.1/a", unread["a"].DOI)
+	assert.Empty(t, unread["unknown"].DOI)
+	assert.Empty(t, read["failed"].DOI)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, Papers(ctx, []Enricher{f}, unread))
+}
+
+// slowEnricher counts the max number of the papers, enriched at the same time.
+type slowEnricher struct {
+	mu            sync.Mutex
+	running, peak int
+}
+
+func (s *slowEnricher) Name() string { return "slow" }
+
+func (s *slowEnricher) Enrich(ctx context.Context, p *papers.Paper) error {
+	s.mu.Lock()
+	s.running++
+	if s.running > s.peak {
+		s.peak = s.running
+	}
+	s.mu.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+	p.DOI = "10.1/" + p.Title
+
+	s.mu.Lock()
+	s.running--
+	s.mu.Unlock()
+	return nil
+}
+
+func TestPapersConcurrency(t *testing.T) {
+	defer func(n int) { Concurrency = n }(Concurrency)
+	Concurrency = 3
+
+	aggPapers := papers.AggPapers{}
+	for i := 0; i < 10; i++ {
+		title := fmt.Sprint(i)
+		aggPapers[title] = &papers.Paper{Title: title}
+	}
+	s := &slowEnricher{}
+	require.NoError(t, Papers(context.Background(), []Enricher{s}, aggPapers))
+	assert.Equal(t, 3, s.peak)
+	for title, p := range aggPapers {
+		assert.Equal(t, "10.1/"+title, p.DOI)
+	}
+}
@@ -0,0 +1,72 @@
+package enrich
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Endpoints of the well-known OpenAI-compatible APIs.
+const (
+	OpenAIURL = "https://api.openai.com/v1"
+	OllamaURL = "http://localhost:11434/v1" // of a local Ollama server
+)
+
+// DefaultLLMTimeout is the max duration of a request to an LLM, unless the LLMOptions set a Client,
+// as LLMs, especially the local ones, are slow.
+const DefaultLLMTimeout = 2 * time.Minute
+
+// llmEndpoints are the URLs of the well-known APIs, by name.
+var llmEndpoints = map[string]string{
+	"openai": OpenAIURL,
+	"ollama": OllamaURL,
+}
+
+// LLMOptions configures the Summarizer and the Embedder.
+type LLMOptions struct {
+	Endpoint string       // URL of an OpenAI-compatible API, or the name of a well-known one: "openai" or "ollama"
+	Model    string       // the default one of the well-known endpoint, if empty
+	APIKey   string       // sent as a bearer token, if any, local servers need none
+	Batch    int          // number of the papers in a single request, the default one of the user if zero
+	Client   *http.Client // nil for a client \w the DefaultLLMTimeout
+	Cache    *Cache       // of the results, nil to send the same papers every time
+}
+
+// resolve returns the options \w the URL of the endpoint, the default model of the well-known ones
+// from a given map by the endpoint name, and the default batch and client, if not set.
+// Endpoints, other than the well-known ones, must set the Model.
+func (o LLMOptions) resolve(models map[string]string, batch int) (LLMOptions, error) {
+	name := strings.TrimSuffix(o.Endpoint, "/")
+	if url, ok := llmEndpoints[name]; ok {
+		o.Endpoint = url
+		if o.Model == "" {
+			o.Model = models[name]
+		}
+	} else if strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://") {
+		o.Endpoint = name
+	} else {
+		return o, fmt.Errorf("unknown endpoint %q, must be a URL, 'openai' or 'ollama'", o.Endpoint)
+	}
+	if o.Model == "" {
+		return o, fmt.Errorf("no model of the endpoint %s", o.Endpoint)
+	}
+	if o.Batch < 1 {
+		o.Batch = batch
+	}
+	if o.Client == nil {
+		o.Client = &http.Client{Timeout: DefaultLLMTimeout}
+	}
+	return o, nil
+}
+
+// postJSON sends a POST request \w a given JSON body to a given path of the endpoint, authorized
+// by the API key, if any, and decodes the JSON response.
+func (o LLMOptions) postJSON(ctx context.Context, path string, body, v interface{}) error {
+	header := http.Header{}
+	if o.APIKey != "" {
+		header.Set("Authorization", "Bearer "+o.APIKey)
+	}
+	return postJSON(ctx, o.Client, o.Endpoint+path, header, body, v)
+}
@@ -0,0 +1,144 @@
+package enrich
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/bzz/scholar-alert-digest/papers"
+)
+
+// OpenAlexURL is the endpoint of the OpenAlex API.
+const OpenAlexURL = "https://api.openalex.org"
+
+const (
+	// openAlexCandidates is the number of the works, searched by the title, one of which must have the same title.
+	openAlexCandidates = 5
+	// maxConcepts is the max number of the concepts of a paper, the most relevant ones.
+	maxConcepts = 5
+	// minConceptScore is the min relevance of a concept to the paper, in [0, 1].
+	minConceptScore = 0.3
+)
+
+// openAlexFields are the fields of a work in OpenAlex, the paper is enriched \w.
+const openAlexFields = "doi,display_name,publication_date,primary_location,concepts,open_access,cited_by_count"
+
+// OpenAlex looks up the papers, by the DOI, if known, or by the title, in OpenAlex and adds the venue,
+// the date of the publication, the concepts, the open access status and the number of citations.
+type OpenAlex struct {
+	opts Options
+	url  string
+}
+
+// NewOpenAlex returns an Enricher, using the OpenAlex API.
+func NewOpenAlex(opts Options) *OpenAlex {
+	return &OpenAlex{opts, OpenAlexURL}
+}
+
+// Name of the service.
+func (o *OpenAlex) Name() string {
+	return "openalex"
+}
+
+// openAlexWork is a part of the metadata of a work in OpenAlex, the paper is enriched \w.
+type openAlexWork struct {
+	DOI             string `json:"doi"` // as a URL e.g "https://doi.org/10.1145/3290353"
+	DisplayName     string `json:"display_name"`
+	PublicationDate string `json:"publication_date"`
+	PrimaryLocation struct {
+		Source *struct {
+			DisplayName string `json:"display_name"`
+		} `json:"source"`
+	} `json:"primary_location"`
+	Concepts []struct {
+		DisplayName string  `json:"display_name"`
+		Score       float64 `json:"score"`
+	} `json:"concepts"`
+	OpenAccess struct {
+		Status string `json:"oa_status"`
+		URL    string `json:"oa_url"`
+	} `json:"open_access"`
+	CitedByCount int `json:"cited_by_count"`
+}
+
+// Enrich adds metadata of the work \w the DOI of the paper, if known, or the same title.
+func (o *OpenAlex) Enrich(ctx context.Context, p *papers.Paper) error {
+	doi := p.DOI
+	switch {
+	case doi != "":
+	case strings.HasPrefix(p.ID, "doi:"):
+		doi = strings.TrimPrefix(p.ID, "doi:")
+	case strings.HasPrefix(p.ID, "arxiv:"): // registered by arXiv for all the papers
+		doi = "10.48550/arxiv." + strings.TrimPrefix(p.ID, "arxiv:")
+	}
+
+	var work openAlexWork
+	if err := o.opts.Cache.lookup(o.Name(), cacheKey(p), &work, func() (err error) {
+		work, err = o.find(ctx, doi, p.Title)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if d := strings.ToLower(strings.TrimPrefix(work.DOI, "https://doi.org/")); p.DOI == "" && d != "" {
+		p.DOI = d
+	}
+	if src := work.PrimaryLocation.Source; src != nil && p.Venue == "" {
+		p.Venue = src.DisplayName
+	}
+	if p.Published == "" {
+		p.Published = work.PublicationDate
+	}
+	if p.Year == 0 {
+		fmt.Sscanf(p.Published, "%d", &p.Year)
+	}
+	if work.CitedByCount > p.Citations {
+		p.Citations = work.CitedByCount
+	}
+
+	p.Concepts = nil
+	for _, c := range work.Concepts { // the most relevant first
+		if c.Score < minConceptScore || len(p.Concepts) == maxConcepts {
+			break
+		}
+		p.Concepts = append(p.Concepts, c.DisplayName)
+	}
+	p.OpenAccess = work.OpenAccess.Status
+	p.OpenAccessURL = work.OpenAccess.URL
+	return nil
+}
+
+// find returns the work \w a given DOI, if known, or the same title.
+func (o *OpenAlex) find(ctx context.Context, doi, title string) (openAlexWork, error) {
+	if doi != "" {
+		var resp openAlexWork
+		path := (&url.URL{Path: "/works/doi:" + doi}).EscapedPath() // DOIs keep the slashes
+		err := getJSON(ctx, o.opts.Client, o.query(path, url.Values{"select": {openAlexFields}}), &resp)
+		return resp, err
+	}
+
+	var resp struct{ Results []openAlexWork }
+	q := url.Values{
+		"search":   {title},
+		"per-page": {fmt.Sprint(openAlexCandidates)},
+		"select":   {openAlexFields},
+	}
+	if err := getJSON(ctx, o.opts.Client, o.query("/works", q), &resp); err != nil {
+		return openAlexWork{}, err
+	}
+	for _, w := range resp.Results {
+		if papers.SameTitle(w.DisplayName, title) {
+			return w, nil
+		}
+	}
+	return openAlexWork{}, ErrNotFound
+}
+
+// query returns the URL of a given API path and query, \w the contact email, if any, for the polite pool.
+func (o *OpenAlex) query(path string, q url.Values) string {
+	if o.opts.Mailto != "" {
+		q.Set("mailto", o.opts.Mailto)
+	}
+	return o.url + path + "?" + q.Encode()
+}
@@ -0,0 +1,66 @@
+package enrich
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bzz/scholar-alert-digest/papers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAlex(t *testing.T) {
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RequestURI())
+		assert.Equal(t, "me@example.com", r.URL.Query().Get("mailto"))
+		assert.Equal(t, openAlexFields, r.URL.Query().Get("select"))
+		switch r.URL.Path {
+		case "/works":
+			w.Write([]byte(`{"meta": {"count": 2}, "results": [
+				{"display_name": "Learning to represent programs with graphs and more"},
+				{"doi": "https://doi.org/10.48550/ARXIV.1711.00740", "display_name": "Learning to Represent Programs with Graphs",
+				 "publication_date": "2017-11-01", "primary_location": {"source": {"display_name": "arXiv"}},
+				 "concepts": [{"display_name": "Computer science", "score": 0.8}, {"display_name": "Graph", "score": 0.5},
+				              {"display_name": "Programming language", "score": 0.2}],
+				 "open_access": {"is_oa": true, "oa_status": "green", "oa_url": "https://arxiv.org/pdf/1711.00740"},
+				 "cited_by_count": 600}
+			]}`))
+		case "/works/doi:10.1145/3290353":
+			w.Write([]byte(`{"doi": "https://doi.org/10.1145/3290353", "display_name": "code2vec", "publication_date": "2019-01-02",
+				"primary_location": {"source": null}, "concepts": [],
+				"open_access": {"is_oa": false, "oa_status": "closed", "oa_url": null}, "cited_by_count": 5}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	o := NewOpenAlex(Options{Client: srv.Client(), Mailto: "me@example.com"})
+	o.url = srv.URL
+
+	p := &papers.Paper{Title: "Learning to represent programs with graphs"}
+	require.NoError(t, o.Enrich(context.Background(), p))
+	assert.Equal(t, &papers.Paper{
+		Title: "Learning to represent programs with graphs", DOI: "10.48550/arxiv.1711.00740", Venue: "arXiv",
+		Published: "2017-11-01", Year: 2017, Citations: 600, Concepts: []string{"Computer science", "Graph"},
+		OpenAccess: "green", OpenAccessURL: "https://arxiv.org/pdf/1711.00740",
+	}, p, "relevant concepts only")
+
+	p = &papers.Paper{Title: "code2vec", ID: "doi:10.1145/3290353", Venue: "PACMPL", Citations: 7}
+	require.NoError(t, o.Enrich(context.Background(), p))
+	assert.Equal(t, "PACMPL", p.Venue, "known venue is kept")
+	assert.Equal(t, 7, p.Citations, "more citations are kept")
+	assert.Equal(t, "closed", p.OpenAccess)
+	assert.Empty(t, p.OpenAccessURL)
+	assert.Empty(t, p.Concepts)
+
+	p = &papers.Paper{Title: "Unknown", ID: "arxiv:2001.00001"}
+	assert.Equal(t, ErrNotFound, o.Enrich(context.Background(), p))
+
+	assert.Len(t, queries, 3)
+	assert.Contains(t, queries[0], "search=Learning+to+represent+programs+with+graphs")
+	assert.Contains(t, queries[2], "/works/doi:10.48550/arxiv.2001.00001?")
+}
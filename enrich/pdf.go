@@ -0,0 +1,137 @@
+package enrich
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/bzz/scholar-alert-digest/fileutils"
+	"github.com/bzz/scholar-alert-digest/papers"
+)
+
+// ArXivPDFURL is the prefix of the PDFs of arXiv papers, by the ID.
+const ArXivPDFURL = "https://arxiv.org/pdf/"
+
+// maxFileName is the max length of the name of a downloaded PDF, in runes, \wo the extension.
+const maxFileName = 100
+
+// Downloader saves the freely available PDFs of the papers: of the ones on arXiv, of the open access copies,
+// if known from the enrichment, and of the papers, that link to a PDF.
+type Downloader struct {
+	client *http.Client
+	arXiv  string
+}
+
+// NewDownloader returns a Downloader, that uses the Client of the Options, if any.
+func NewDownloader(opts Options) *Downloader {
+	client := opts.Client
+	if client == nil {
+		client = &http.Client{Timeout: DefaultTimeout}
+	}
+	return &Downloader{client, ArXivPDFURL}
+}
+
+// PDFs saves the PDFs of all the papers to a given directory, creating it if missing, named by the title.
+// Papers, that already have a PDF in the directory, \wo a free PDF or failed to be downloaded, are skipped.
+// It stops \w an error once the context is done.
+func (d *Downloader) PDFs(ctx context.Context, dir string, aggPapers ...papers.AggPapers) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	saved, total := 0, 0
+	for _, ps := range aggPapers {
+		for _, title := range papers.SortedKeys(ps) {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			p := ps[title]
+			path := filepath.Join(dir, FileName(p.Title)+".pdf")
+			if _, err := os.Stat(path); p.Removed || err == nil {
+				continue
+			}
+			total++
+			for _, u := range d.pdfURLs(p) {
+				err := d.save(ctx, u, path)
+				if err == nil {
+					saved++
+					break
+				}
+				log.Printf("failed to download PDF of %q from %s: %v", p.Title, u, err)
+			}
+		}
+	}
+	log.Printf("downloaded %d PDFs of %d papers to %s", saved, total, dir)
+	return nil
+}
+
+// pdfURLs returns the URLs of the free PDFs of the paper, if any, the most likely to be a PDF first.
+func (d *Downloader) pdfURLs(p *papers.Paper) []string {
+	var urls []string
+	if strings.HasPrefix(p.ID, "arxiv:") {
+		urls = append(urls, d.arXiv+strings.TrimPrefix(p.ID, "arxiv:"))
+	}
+	if p.OpenAccessURL != "" {
+		urls = append(urls, p.OpenAccessURL)
+	}
+	if p.Kind == papers.KindPDF && p.URL != p.OpenAccessURL {
+		urls = append(urls, p.URL)
+	}
+	return urls
+}
+
+// save downloads a PDF from a given URL to a given path, atomically.
+// Responses, that are not a PDF e.g a landing page of the publisher, are an error.
+func (d *Downloader) save(ctx context.Context, url, path string) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := d.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+
+	// content type is not reliable, e.g "application/octet-stream", but the magic number is
+	magic := make([]byte, 5)
+	if _, err := io.ReadFull(resp.Body, magic); err != nil || !bytes.Equal(magic, []byte("%PDF-")) {
+		return fmt.Errorf("not a PDF, but %q", resp.Header.Get("Content-Type"))
+	}
+
+	return fileutils.AtomicWrite(path, 0644, func(w io.Writer) error {
+		_, err := io.Copy(w, io.MultiReader(bytes.NewReader(magic), resp.Body))
+		return err
+	})
+}
+
+// FileName returns a title of the paper, safe to be a file name on any OS: \wo punctuation and repeated
+// whitespace, at most maxFileName runes long.
+func FileName(title string) string {
+	var b strings.Builder
+	for _, r := range title {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_':
+			b.WriteRune(r)
+		case unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r):
+			b.WriteRune(' ')
+		}
+	}
+	name := []rune(strings.Join(strings.Fields(b.String()), " "))
+	if len(name) > maxFileName {
+		name = []rune(strings.TrimSpace(string(name[:maxFileName])))
+	}
+	if len(name) == 0 {
+		return "untitled"
+	}
+	return string(name)
+}
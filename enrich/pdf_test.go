@@ -0,0 +1,76 @@
+package enrich
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bzz/scholar-alert-digest/papers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloader(t *testing.T) {
+	var gets []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gets = append(gets, r.URL.Path)
+		switch r.URL.Path {
+		case "/arxiv/1711.00740", "/oa/code2vec.pdf":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write([]byte("%PDF-1.5 " + r.URL.Path))
+		case "/landing":
+			w.Write([]byte("<html>Sign in</html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "pdfs")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	dir = filepath.Join(dir, "reading")
+
+	aggPapers := papers.AggPapers{
+		"Learning to represent programs with graphs": &papers.Paper{
+			Title: "Learning to represent programs with graphs", ID: "arxiv:1711.00740"},
+		"code2vec: learning distributed representations of code": &papers.Paper{
+			Title: "code2vec: learning distributed representations of code", Kind: papers.KindPDF,
+			URL: srv.URL + "/landing", OpenAccessURL: srv.URL + "/oa/code2vec.pdf"},
+		"Paywalled": &papers.Paper{Title: "Paywalled", Kind: papers.KindPDF, URL: srv.URL + "/landing"},
+		"Removed":   &papers.Paper{Title: "Removed", ID: "arxiv:1711.00740", Removed: true},
+		"No PDF":    &papers.Paper{Title: "No PDF", URL: srv.URL + "/html"},
+	}
+
+	d := NewDownloader(Options{Client: srv.Client()})
+	d.arXiv = srv.URL + "/arxiv/"
+	require.NoError(t, d.PDFs(context.Background(), dir, aggPapers))
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "Learning to represent programs with graphs.pdf"),
+		filepath.Join(dir, "code2vec learning distributed representations of code.pdf"),
+	}, files, "no partial downloads")
+	pdf, err := ioutil.ReadFile(files[1])
+	require.NoError(t, err)
+	assert.Equal(t, "%PDF-1.5 /oa/code2vec.pdf", string(pdf))
+
+	gets = nil
+	require.NoError(t, d.PDFs(context.Background(), dir, aggPapers))
+	assert.Equal(t, []string{"/landing"}, gets, "saved PDFs are skipped")
+}
+
+func TestFileName(t *testing.T) {
+	assert.Equal(t, "code2vec learning distributed representations of code",
+		FileName("code2vec: learning distributed\nrepresentations of code"))
+	assert.Equal(t, "Réseaux de neurones - a survey", FileName(`Réseaux de neurones - a "survey"?`))
+	assert.Equal(t, "a b", FileName("a/b"))
+	assert.Equal(t, "untitled", FileName("???"))
+	long := FileName("Learning to represent programs with graphs, and much more of the same, to be cut on the 100th rune exactly")
+	assert.Len(t, []rune(long), maxFileName)
+}
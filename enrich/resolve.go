@@ -0,0 +1,103 @@
+package enrich
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/bzz/scholar-alert-digest/papers"
+)
+
+// canonicalHosts are the hosts of the URLs, that are canonical already and need no resolution.
+var canonicalHosts = map[string]bool{
+	"arxiv.org":  true,
+	"doi.org":    true,
+	"dx.doi.org": true,
+}
+
+// Resolver follows the redirects of the paper URLs e.g by Google or the link resolvers of the publishers,
+// to the final, canonical, ones.
+type Resolver struct {
+	client *http.Client
+	cache  *Cache
+}
+
+// NewResolver returns a Resolver, that uses the Client and the Cache of the Options, if any.
+func NewResolver(opts Options) *Resolver {
+	client := http.Client{Timeout: DefaultTimeout}
+	if opts.Client != nil {
+		client = *opts.Client
+	}
+	if client.Jar == nil { // some publishers redirect in a loop, until a cookie is set
+		client.Jar, _ = cookiejar.New(nil)
+	}
+	return &Resolver{&client, opts.Cache}
+}
+
+// Resolve returns the final URL after all the redirects of a HEAD request,
+// or of a GET one, if the server does not allow HEAD.
+func (r *Resolver) Resolve(ctx context.Context, rawURL string) (string, error) {
+	resp, err := r.do(ctx, http.MethodHead, rawURL)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented {
+		if resp, err = r.do(ctx, http.MethodGet, rawURL); err != nil {
+			return "", err
+		}
+	}
+	return resp.Request.URL.String(), nil
+}
+
+func (r *Resolver) do(ctx context.Context, method, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequest(method, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close() // only the URL is needed
+	return resp, nil
+}
+
+// URLs replaces the URLs of all the papers by the resolved ones, except the canonical ones e.g of arXiv,
+// Concurrency papers at a time. Papers, failed to be resolved, are left as they are. Papers \w the same
+// resolved URL, or the same ID in it, are merged. It stops \w an error once the context is done.
+func (r *Resolver) URLs(ctx context.Context, aggPapers papers.AggPapers) (papers.AggPapers, error) {
+	var resolved, total int32
+	err := forEach(ctx, []papers.AggPapers{aggPapers}, func(_ string, p *papers.Paper) {
+		u, err := url.Parse(p.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") ||
+			canonicalHosts[strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")] {
+			return
+		}
+		atomic.AddInt32(&total, 1)
+		var final string
+		err = r.cache.lookup("resolve", p.URL, &final, func() (err error) {
+			final, err = r.Resolve(ctx, p.URL)
+			return err
+		})
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("failed to resolve %q: %v", p.URL, err)
+			}
+			return
+		}
+		final = papers.StripTracking(final)
+		if final != p.URL {
+			atomic.AddInt32(&resolved, 1)
+			p.URL = final
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("resolved redirects of %d of %d paper URLs", resolved, total)
+	return papers.MergeDuplicates(aggPapers), nil
+}
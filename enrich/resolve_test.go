@@ -0,0 +1,64 @@
+package enrich
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bzz/scholar-alert-digest/papers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolver(t *testing.T) {
+	var gets []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			gets = append(gets, r.URL.Path)
+		}
+		switch r.URL.Path {
+		case "/linkinghub/1", "/linkinghub/2":
+			http.Redirect(w, r, "/article/1", http.StatusMovedPermanently)
+		case "/doi":
+			http.Redirect(w, r, "/article/10.1145/3290353", http.StatusFound)
+		case "/no-head":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			http.Redirect(w, r, "/article/2", http.StatusFound)
+		case "/cookie":
+			if _, err := r.Cookie("session"); err != nil {
+				http.SetCookie(w, &http.Cookie{Name: "session", Value: "1", Path: "/"})
+				http.Redirect(w, r, "/cookie", http.StatusFound)
+				return
+			}
+			http.Redirect(w, r, "/article/3", http.StatusFound)
+		}
+	}))
+	defer srv.Close()
+
+	aggPapers := papers.AggPapers{
+		"Code search":          &papers.Paper{Title: "Code search", Freq: 2, URL: srv.URL + "/linkinghub/1"},
+		"Code search, revised": &papers.Paper{Title: "Code search, revised", Freq: 1, URL: srv.URL + "/linkinghub/2"},
+		"code2vec":             &papers.Paper{Title: "code2vec", Freq: 1, URL: srv.URL + "/doi"},
+		"code2vec: learning":   &papers.Paper{Title: "code2vec: learning", Freq: 1, URL: srv.URL + "/article/10.1145/3290353", ID: "doi:10.1145/3290353"},
+		"Neural code search":   &papers.Paper{Title: "Neural code search", Freq: 1, URL: srv.URL + "/no-head"},
+		"Code2seq":             &papers.Paper{Title: "Code2seq", Freq: 1, URL: srv.URL + "/cookie"},
+		"On arXiv":             &papers.Paper{Title: "On arXiv", Freq: 1, URL: "https://arxiv.org/abs/1711.00740"},
+	}
+
+	r := NewResolver(Options{Client: srv.Client()})
+	aggPapers, err := r.URLs(context.Background(), aggPapers)
+	require.NoError(t, err)
+
+	assert.Len(t, aggPapers, 5)
+	assert.Equal(t, srv.URL+"/article/1", aggPapers["Code search"].URL)
+	assert.Equal(t, 3, aggPapers["Code search"].Freq, "same resolved URL")
+	assert.Equal(t, 2, aggPapers["code2vec"].Freq, "same ID in the resolved URL")
+	assert.Equal(t, srv.URL+"/article/2", aggPapers["Neural code search"].URL, "GET, if HEAD is not allowed")
+	assert.Equal(t, srv.URL+"/article/3", aggPapers["Code2seq"].URL, "with the cookies")
+	assert.Equal(t, "https://arxiv.org/abs/1711.00740", aggPapers["On arXiv"].URL, "canonical URL is not resolved")
+	assert.Equal(t, []string{"/no-head", "/article/2"}, gets, "HEAD, unless not allowed")
+}
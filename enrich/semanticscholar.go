@@ -0,0 +1,120 @@
+package enrich
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bzz/scholar-alert-digest/papers"
+)
+
+// SemanticScholarURL is the endpoint of the Semantic Scholar Graph API.
+const SemanticScholarURL = "https://api.semanticscholar.org/graph/v1"
+
+// semanticScholarInterval is the min time between the requests, the rate limit of the API is about 1 per second.
+const semanticScholarInterval = time.Second
+
+// semanticScholarFields are the fields of a paper in Semantic Scholar, the paper is enriched \w.
+const semanticScholarFields = "title,citationCount,influentialCitationCount,tldr"
+
+// semanticScholarCandidates is the number of the papers, searched by the title, one of which must have the same title.
+const semanticScholarCandidates = 5
+
+// SemanticScholar looks up the papers, by the DOI or the arXiv ID, if known, or by the title,
+// in Semantic Scholar and adds the number of citations, the number of influential ones and the TLDR.
+type SemanticScholar struct {
+	opts Options
+	url  string
+}
+
+// NewSemanticScholar returns an Enricher, using the Semantic Scholar API.
+func NewSemanticScholar(opts Options) *SemanticScholar {
+	return &SemanticScholar{opts, SemanticScholarURL}
+}
+
+// Name of the service.
+func (s *SemanticScholar) Name() string {
+	return "semanticscholar"
+}
+
+// semanticScholarPaper is a part of the metadata of a paper in Semantic Scholar.
+type semanticScholarPaper struct {
+	Title                    string `json:"title"`
+	CitationCount            int    `json:"citationCount"`
+	InfluentialCitationCount int    `json:"influentialCitationCount"`
+	TLDR                     *struct {
+		Text string `json:"text"`
+	} `json:"tldr"`
+}
+
+// Enrich adds the citations and the TLDR of the paper \w the same DOI or arXiv ID, if known, or the same title.
+func (s *SemanticScholar) Enrich(ctx context.Context, p *papers.Paper) error {
+	var id string
+	switch {
+	case p.DOI != "":
+		id = "DOI:" + p.DOI
+	case strings.HasPrefix(p.ID, "doi:"):
+		id = "DOI:" + strings.TrimPrefix(p.ID, "doi:")
+	case strings.HasPrefix(p.ID, "arxiv:"):
+		id = "ARXIV:" + strings.TrimPrefix(p.ID, "arxiv:")
+	}
+
+	var found semanticScholarPaper
+	if err := s.opts.Cache.lookup(s.Name(), cacheKey(p), &found, func() (err error) {
+		found, err = s.find(ctx, id, p.Title)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if found.CitationCount > p.Citations {
+		p.Citations = found.CitationCount
+	}
+	if found.InfluentialCitationCount > p.InfluentialCitations {
+		p.InfluentialCitations = found.InfluentialCitationCount
+	}
+	if found.TLDR != nil && found.TLDR.Text != "" {
+		p.TLDR = strings.TrimSpace(found.TLDR.Text)
+	}
+	return nil
+}
+
+// find returns the paper \w a given ID, if known, or the same title.
+func (s *SemanticScholar) find(ctx context.Context, id, title string) (semanticScholarPaper, error) {
+	if id != "" {
+		var resp semanticScholarPaper
+		q := url.Values{"fields": {semanticScholarFields}}
+		// DOIs keep the slashes in the path, as in the API docs
+		path := (&url.URL{Path: "/paper/" + id}).EscapedPath()
+		err := s.get(ctx, path, q, &resp)
+		return resp, err
+	}
+
+	var resp struct{ Data []semanticScholarPaper }
+	q := url.Values{
+		"query":  {title},
+		"limit":  {fmt.Sprint(semanticScholarCandidates)},
+		"fields": {semanticScholarFields},
+	}
+	if err := s.get(ctx, "/paper/search", q, &resp); err != nil {
+		return semanticScholarPaper{}, err
+	}
+	for _, sp := range resp.Data {
+		if papers.SameTitle(sp.Title, title) {
+			return sp, nil
+		}
+	}
+	return semanticScholarPaper{}, ErrNotFound
+}
+
+// get decodes the response of a given API path and query, authorized by the API key, if any.
+func (s *SemanticScholar) get(ctx context.Context, path string, q url.Values, v interface{}) error {
+	header := http.Header{}
+	if s.opts.SemanticScholarKey != "" {
+		header.Set("x-api-key", s.opts.SemanticScholarKey)
+	}
+	return getJSONWithHeader(ctx, s.opts.Client, s.url+path+"?"+q.Encode(), header, v)
+}
@@ -0,0 +1,57 @@
+package enrich
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bzz/scholar-alert-digest/papers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSemanticScholar(t *testing.T) {
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RequestURI())
+		assert.Equal(t, "secret", r.Header.Get("x-api-key"))
+		assert.Equal(t, semanticScholarFields, r.URL.Query().Get("fields"))
+		switch r.URL.EscapedPath() {
+		case "/paper/search":
+			w.Write([]byte(`{"total": 2, "data": [
+				{"title": "Learning to represent programs with graphs and more", "citationCount": 1},
+				{"title": "Learning to Represent Programs with Graphs", "citationCount": 800, "influentialCitationCount": 90,
+				 "tldr": {"model": "tldr@v2.0.0", "text": " Gated graph neural networks learn on programs. "}}
+			]}`))
+		case "/paper/ARXIV:1803.09473":
+			w.Write([]byte(`{"title": "code2vec", "citationCount": 7, "influentialCitationCount": 2, "tldr": null}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	s := NewSemanticScholar(Options{Client: srv.Client(), SemanticScholarKey: "secret"})
+	s.url = srv.URL
+
+	p := &papers.Paper{Title: "Learning to represent programs with graphs"}
+	require.NoError(t, s.Enrich(context.Background(), p))
+	assert.Equal(t, &papers.Paper{
+		Title: "Learning to represent programs with graphs", Citations: 800, InfluentialCitations: 90,
+		TLDR: "Gated graph neural networks learn on programs.",
+	}, p)
+
+	p = &papers.Paper{Title: "code2vec", ID: "arxiv:1803.09473", Citations: 10}
+	require.NoError(t, s.Enrich(context.Background(), p))
+	assert.Equal(t, 10, p.Citations, "more citations are kept")
+	assert.Equal(t, 2, p.InfluentialCitations)
+	assert.Empty(t, p.TLDR)
+
+	p = &papers.Paper{Title: "Unknown", DOI: "10.3/unknown"}
+	assert.Equal(t, ErrNotFound, s.Enrich(context.Background(), p))
+
+	assert.Len(t, queries, 3)
+	assert.Contains(t, queries[0], "query=Learning+to+represent+programs+with+graphs")
+	assert.Contains(t, queries[2], "/paper/DOI:10.3/unknown?")
+}
@@ -0,0 +1,136 @@
+package enrich
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/bzz/scholar-alert-digest/papers"
+)
+
+// DefaultSummaryBatch is the number of the papers, summarized by a single request, unless set by the LLMOptions.
+const DefaultSummaryBatch = 10
+
+// summaryModels are the default models of the well-known endpoints, by name.
+var summaryModels = map[string]string{
+	"openai": "gpt-4o-mini",
+	"ollama": "llama3.2",
+}
+
+// summaryPrompt is the system prompt, the numbered titles and abstracts of the papers are sent \w.
+const summaryPrompt = `You help a researcher to skim the new papers from their Google Scholar alerts.
+For each of the numbered papers, write a single sentence of at most 30 words on why it matters, judging by its title
+and abstract: the problem and the contribution, not a restatement of the title.
+Reply only with a JSON object {"summaries": [...]}, that has a string for every paper, in the same order.`
+
+// Summarizer adds a one-sentence summary on why the paper matters, by its title and abstract,
+// from an LLM behind an OpenAI-compatible chat completions API e.g of OpenAI or a local Ollama.
+type Summarizer struct {
+	opts LLMOptions
+}
+
+// NewSummarizer returns a Summarizer. Endpoints, other than the well-known ones, must set the Model.
+func NewSummarizer(opts LLMOptions) (*Summarizer, error) {
+	opts, err := opts.resolve(summaryModels, DefaultSummaryBatch)
+	if err != nil {
+		return nil, err
+	}
+	return &Summarizer{opts}, nil
+}
+
+// Papers adds the summaries to all the papers, Batch papers in a single request, one request at a time.
+// Papers of the failed requests are left as they are. It stops \w an error once the context is done.
+func (s *Summarizer) Papers(ctx context.Context, aggPapers ...papers.AggPapers) error {
+	service := "summary " + s.opts.Model // other models summarize differently
+	var todo []*papers.Paper
+	var cached int
+	for _, ps := range aggPapers {
+		for _, title := range papers.SortedKeys(ps) {
+			p := ps[title]
+			if ok, _ := s.opts.Cache.get(service, cacheKey(p), &p.Summary); ok {
+				cached++
+				continue
+			}
+			todo = append(todo, p)
+		}
+	}
+
+	summarized := cached
+	for len(todo) != 0 {
+		n := s.opts.Batch
+		if n > len(todo) {
+			n = len(todo)
+		}
+		batch := todo[:n]
+		todo = todo[n:]
+
+		summaries, err := s.summarize(ctx, batch)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		} else if err != nil {
+			log.Printf("failed to summarize %d papers: %v", len(batch), err)
+			continue
+		}
+		for i, p := range batch {
+			p.Summary = summaries[i]
+			s.opts.Cache.put(service, cacheKey(p), p.Summary)
+		}
+		summarized += len(batch)
+	}
+	log.Printf("summarized %d papers, %d of them cached, by %s", summarized, cached, s.opts.Model)
+	return nil
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// summarize returns the summaries of the papers, in the same order.
+func (s *Summarizer) summarize(ctx context.Context, batch []*papers.Paper) ([]string, error) {
+	var prompt strings.Builder
+	for i, p := range batch {
+		fmt.Fprintf(&prompt, "%d. Title: %s\n", i+1, p.Title)
+		if abstract := strings.TrimSpace(p.Abstract.FirstLine + " " + p.Abstract.Rest); abstract != "" {
+			fmt.Fprintf(&prompt, "Abstract: %s\n", abstract)
+		}
+		prompt.WriteString("\n")
+	}
+	body := struct {
+		Model       string        `json:"model"`
+		Messages    []chatMessage `json:"messages"`
+		Temperature float64       `json:"temperature"`
+	}{s.opts.Model, []chatMessage{{"system", summaryPrompt}, {"user", prompt.String()}}, 0.2}
+	var completion struct {
+		Choices []struct{ Message chatMessage }
+	}
+	if err := s.opts.postJSON(ctx, "/chat/completions", body, &completion); err != nil {
+		return nil, err
+	}
+	if len(completion.Choices) == 0 {
+		return nil, fmt.Errorf("no completion")
+	}
+	return parseSummaries(completion.Choices[0].Message.Content, len(batch))
+}
+
+// parseSummaries returns the summaries from the JSON object in the reply of the LLM, that may be wrapped
+// in a Markdown code block or some text, if there is one for every paper of the batch.
+func parseSummaries(reply string, n int) ([]string, error) {
+	start, end := strings.Index(reply, "{"), strings.LastIndex(reply, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON object in the reply %q", reply)
+	}
+	var result struct{ Summaries []string }
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &result); err != nil {
+		return nil, fmt.Errorf("invalid reply %q: %v", reply, err)
+	}
+	if len(result.Summaries) != n {
+		return nil, fmt.Errorf("got %d summaries of %d papers", len(result.Summaries), n)
+	}
+	for i, summary := range result.Summaries {
+		result.Summaries[i] = strings.Join(strings.Fields(summary), " ")
+	}
+	return result.Summaries, nil
+}
@@ -0,0 +1,106 @@
+package enrich
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bzz/scholar-alert-digest/papers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummarizer(t *testing.T) {
+	var prompts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/chat/completions", r.URL.Path)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		var req struct {
+			Model    string
+			Messages []chatMessage
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "tiny", req.Model)
+		prompt := req.Messages[1].Content
+		prompts = append(prompts, prompt)
+
+		// a summary per numbered title, wrapped in a Markdown code block, as LLMs do
+		var summaries []string
+		for _, line := range strings.Split(prompt, "\n") {
+			if i := strings.Index(line, ". Title: "); i > 0 {
+				summaries = append(summaries, "Why "+line[i+len(". Title: "):]+"\n matters.")
+			}
+		}
+		reply, _ := json.Marshal(map[string][]string{"summaries": summaries})
+		if strings.Contains(prompt, "Broken") {
+			reply = []byte(`{"summaries": []}`)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": chatMessage{"assistant", "```json\n" + string(reply) + "\n```"}}},
+		})
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "enrich")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	cache, err := OpenCache(filepath.Join(dir, "enrich.json"), time.Hour)
+	require.NoError(t, err)
+
+	s, err := NewSummarizer(LLMOptions{Endpoint: srv.URL + "/v1/", Model: "tiny", APIKey: "secret", Batch: 2,
+		Client: srv.Client(), Cache: cache})
+	require.NoError(t, err)
+
+	unread := papers.AggPapers{
+		"a": {Title: "a", Freq: 3, Abstract: papers.NewAbstract("Abstract of a")},
+		"b": {Title: "b", Freq: 2},
+		"c": {Title: "c", Freq: 1, ID: "arxiv:1"},
+	}
+	require.NoError(t, s.Papers(context.Background(), unread))
+	assert.Equal(t, "Why a matters.", unread["a"].Summary)
+	assert.Equal(t, "Why c matters.", unread["c"].Summary)
+	require.Len(t, prompts, 2, "in batches")
+	assert.Equal(t, "1. Title: a\nAbstract: Abstract of a\n\n2. Title: b\n\n", prompts[0])
+
+	read := papers.AggPapers{"c": {Title: "c", ID: "arxiv:1"}, "Broken": {Title: "Broken"}}
+	require.NoError(t, s.Papers(context.Background(), read))
+	assert.Equal(t, "Why c matters.", read["c"].Summary)
+	assert.Empty(t, read["Broken"].Summary, "failed batches are skipped")
+	assert.Len(t, prompts, 3, "cached summaries are not requested again")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, s.Papers(ctx, papers.AggPapers{"d": {Title: "d"}}))
+}
+
+func TestNewSummarizer(t *testing.T) {
+	s, err := NewSummarizer(LLMOptions{Endpoint: "ollama"})
+	require.NoError(t, err)
+	assert.Equal(t, OllamaURL, s.opts.Endpoint)
+	assert.Equal(t, "llama3.2", s.opts.Model)
+	assert.Equal(t, DefaultSummaryBatch, s.opts.Batch)
+
+	_, err = NewSummarizer(LLMOptions{Endpoint: "https://llm.example.com/v1"})
+	assert.Error(t, err, "unknown endpoints must set the model")
+	_, err = NewSummarizer(LLMOptions{Endpoint: "gpt"})
+	assert.Error(t, err)
+}
+
+func TestParseSummaries(t *testing.T) {
+	summaries, err := parseSummaries(`Sure! {"summaries": ["One.", "Two."]}`, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"One.", "Two."}, summaries)
+
+	for _, reply := range []string{"I can not", `{"summaries": ["One."]}`, `{"summaries": [1, 2]}`} {
+		_, err := parseSummaries(reply, 2)
+		assert.Error(t, err, fmt.Sprintf("%q", reply))
+	}
+}
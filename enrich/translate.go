@@ -0,0 +1,138 @@
+package enrich
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/bzz/scholar-alert-digest/papers"
+)
+
+// Endpoints of the well-known translation APIs.
+const (
+	DeepLURL          = "https://api-free.deepl.com/v2" // of the free plan, the paid one is https://api.deepl.com/v2
+	LibreTranslateURL = "https://libretranslate.com"
+)
+
+// translationEndpoints are the URLs of the well-known translation APIs, by name.
+var translationEndpoints = map[string]string{
+	"deepl":          DeepLURL,
+	"libretranslate": LibreTranslateURL,
+}
+
+// TranslatorOptions configures the Translator.
+type TranslatorOptions struct {
+	Endpoint string       // URL of a LibreTranslate or DeepL API, or the name of a well-known one: "libretranslate" or "deepl"
+	APIKey   string       // if any, self-hosted LibreTranslate servers need none
+	Target   string       // ISO 639-1 code of the language of the reader e.g "en"
+	Client   *http.Client // nil for a client \w the DefaultTimeout
+	Cache    *Cache       // of the translations, nil to translate the same papers every time
+}
+
+// Translator translates the abstracts of the papers in other languages, set by papers.DetectLanguages,
+// to the language of the reader, by a LibreTranslate API e.g of a self-hosted server, or by DeepL.
+type Translator struct {
+	opts  TranslatorOptions
+	deepl bool // the endpoint is of DeepL, otherwise of LibreTranslate
+}
+
+// NewTranslator returns a Translator. Endpoints on deepl.com are DeepL APIs, all the others are LibreTranslate ones.
+func NewTranslator(opts TranslatorOptions) (*Translator, error) {
+	name := strings.TrimSuffix(opts.Endpoint, "/")
+	if u, ok := translationEndpoints[name]; ok {
+		opts.Endpoint = u
+	} else if strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://") {
+		opts.Endpoint = name
+	} else {
+		return nil, fmt.Errorf("unknown endpoint %q, must be a URL, 'libretranslate' or 'deepl'", opts.Endpoint)
+	}
+	if opts.Target == "" {
+		return nil, fmt.Errorf("no target language")
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: DefaultTimeout}
+	}
+	u, err := url.Parse(opts.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Hostname()
+	return &Translator{opts, host == "deepl.com" || strings.HasSuffix(host, ".deepl.com")}, nil
+}
+
+// Papers translates the abstracts of all the papers \w a Language, Concurrency papers at a time, and marks them
+// as Translated. Papers of the failed requests are left as they are. It stops \w an error once the context is done.
+func (t *Translator) Papers(ctx context.Context, aggPapers ...papers.AggPapers) error {
+	service := "translation " + t.opts.Target
+	var translated, total int32
+	err := forEach(ctx, aggPapers, func(title string, p *papers.Paper) {
+		abstract := strings.TrimSpace(p.Abstract.FirstLine + " " + p.Abstract.Rest)
+		if p.Language == "" || p.Translated || abstract == "" {
+			return
+		}
+		atomic.AddInt32(&total, 1)
+		var text string
+		err := t.opts.Cache.lookup(service, cacheKey(p), &text, func() (err error) {
+			text, err = t.translate(ctx, abstract, p.Language)
+			return err
+		})
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("failed to translate %q from %s: %v", title, p.Language, err)
+			}
+			return
+		}
+		p.Abstract = papers.NewAbstract(text)
+		p.Translated = true
+		atomic.AddInt32(&translated, 1)
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("translated %d of %d abstracts to %s", translated, total, t.opts.Target)
+	return nil
+}
+
+// translate returns the text, translated from a given language to the target one.
+func (t *Translator) translate(ctx context.Context, text, source string) (string, error) {
+	if t.deepl {
+		body := struct {
+			Text       []string `json:"text"`
+			SourceLang string   `json:"source_lang"`
+			TargetLang string   `json:"target_lang"`
+		}{[]string{text}, strings.ToUpper(source), strings.ToUpper(t.opts.Target)}
+		var resp struct {
+			Translations []struct{ Text string }
+		}
+		header := http.Header{"Authorization": {"DeepL-Auth-Key " + t.opts.APIKey}}
+		if err := postJSON(ctx, t.opts.Client, t.opts.Endpoint+"/translate", header, body, &resp); err != nil {
+			return "", err
+		}
+		if len(resp.Translations) == 0 || resp.Translations[0].Text == "" {
+			return "", fmt.Errorf("no translation")
+		}
+		return resp.Translations[0].Text, nil
+	}
+
+	body := struct {
+		Q      string `json:"q"`
+		Source string `json:"source"`
+		Target string `json:"target"`
+		Format string `json:"format"`
+		APIKey string `json:"api_key,omitempty"`
+	}{text, source, t.opts.Target, "text", t.opts.APIKey}
+	var resp struct {
+		TranslatedText string `json:"translatedText"`
+	}
+	if err := postJSON(ctx, t.opts.Client, t.opts.Endpoint+"/translate", nil, body, &resp); err != nil {
+		return "", err
+	}
+	if resp.TranslatedText == "" {
+		return "", fmt.Errorf("no translation")
+	}
+	return resp.TranslatedText, nil
+}
@@ -0,0 +1,108 @@
+package enrich
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bzz/scholar-alert-digest/papers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranslator(t *testing.T) {
+	var requests int32 // concurrent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		assert.Equal(t, "/translate", r.URL.Path)
+		var req map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "es", req["source"])
+		assert.Equal(t, "en", req["target"])
+		assert.Equal(t, "secret", req["api_key"])
+		if req["q"] == "Roto" {
+			http.Error(w, "unsupported", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"translatedText": "Translated: " + req["q"]})
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "enrich")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	cache, err := OpenCache(filepath.Join(dir, "enrich.json"), time.Hour)
+	require.NoError(t, err)
+
+	tr, err := NewTranslator(TranslatorOptions{Endpoint: srv.URL + "/", APIKey: "secret", Target: "en",
+		Client: srv.Client(), Cache: cache})
+	require.NoError(t, err)
+	assert.False(t, tr.deepl)
+
+	aggPapers := papers.AggPapers{
+		"a": {Title: "a", Language: "es", Abstract: papers.NewAbstract("Un método nuevo")},
+		"b": {Title: "b", Abstract: papers.NewAbstract("A new method")},
+		"c": {Title: "c", Language: "es"},
+		"d": {Title: "d", Language: "es", Abstract: papers.NewAbstract("Roto")},
+	}
+	require.NoError(t, tr.Papers(context.Background(), aggPapers))
+	assert.Equal(t, "Translated: Un método nuevo", aggPapers["a"].Abstract.FirstLine)
+	assert.True(t, aggPapers["a"].Translated)
+	assert.Equal(t, "es", aggPapers["a"].Language, "the original language is kept")
+	assert.False(t, aggPapers["b"].Translated, "in the language of the reader")
+	assert.False(t, aggPapers["c"].Translated, "no abstract")
+	assert.Equal(t, "Roto", aggPapers["d"].Abstract.FirstLine, "failed translations are skipped")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	again := papers.AggPapers{"a": {Title: "a", Language: "es", Abstract: papers.NewAbstract("Un método nuevo")}}
+	require.NoError(t, tr.Papers(context.Background(), again))
+	assert.Equal(t, "Translated: Un método nuevo", again["a"].Abstract.FirstLine)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests), "cached translations are not requested again")
+}
+
+func TestTranslatorDeepL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "DeepL-Auth-Key secret", r.Header.Get("Authorization"))
+		var req struct {
+			Text       []string `json:"text"`
+			SourceLang string   `json:"source_lang"`
+			TargetLang string   `json:"target_lang"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "DE", req.SourceLang)
+		assert.Equal(t, "EN", req.TargetLang)
+		w.Write([]byte(`{"translations": [{"detected_source_language": "DE", "text": "A new method"}]}`))
+	}))
+	defer srv.Close()
+
+	tr, err := NewTranslator(TranslatorOptions{Endpoint: srv.URL, APIKey: "secret", Target: "en", Client: srv.Client()})
+	require.NoError(t, err)
+	tr.deepl = true // as of a URL on deepl.com
+
+	text, err := tr.translate(context.Background(), "Eine neue Methode", "de")
+	require.NoError(t, err)
+	assert.Equal(t, "A new method", text)
+}
+
+func TestNewTranslator(t *testing.T) {
+	tr, err := NewTranslator(TranslatorOptions{Endpoint: "deepl", Target: "en"})
+	require.NoError(t, err)
+	assert.Equal(t, DeepLURL, tr.opts.Endpoint)
+	assert.True(t, tr.deepl)
+
+	tr, err = NewTranslator(TranslatorOptions{Endpoint: "http://localhost:5000", Target: "en"})
+	require.NoError(t, err)
+	assert.False(t, tr.deepl)
+
+	_, err = NewTranslator(TranslatorOptions{Endpoint: "google", Target: "en"})
+	assert.Error(t, err)
+	_, err = NewTranslator(TranslatorOptions{Endpoint: "deepl"})
+	assert.Error(t, err, "no target language")
+}
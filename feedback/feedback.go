@@ -0,0 +1,68 @@
+// Package feedback keeps track of the papers, marked as interesting or not, to rank the future digests.
+package feedback
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/bzz/scholar-alert-digest/fileutils"
+	"github.com/bzz/scholar-alert-digest/papers"
+)
+
+// Label is a record of the paper, marked as interesting or not.
+type Label struct {
+	Title       string
+	URL         string `json:",omitempty"`
+	Text        string // title and abstract, the classifier is trained on
+	Interesting bool
+	Marked      time.Time
+}
+
+// Store is a persistent set of labeled papers, by the paper Key, saved as a JSON file.
+type Store struct {
+	path   string
+	Labels map[string]*Label
+}
+
+// Open reads the store from a given file. Missing file is an empty store.
+func Open(path string) (*Store, error) {
+	s := &Store{path, map[string]*Label{}}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(&s.Labels); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Mark records the paper as interesting or not at a given time, overriding the earlier mark.
+func (s *Store) Mark(p *papers.Paper, interesting bool, now time.Time) {
+	s.Labels[p.Key()] = &Label{p.Title, p.URL, papers.Text(p), interesting, now}
+}
+
+// Classifier returns a classifier, trained on all the labeled papers.
+func (s *Store) Classifier() *papers.Classifier {
+	c := papers.NewClassifier()
+	for _, l := range s.Labels {
+		c.Train(l.Text, l.Interesting)
+	}
+	return c
+}
+
+// Save writes the store to the file it was opened from.
+func (s *Store) Save() error {
+	return fileutils.AtomicWrite(s.path, 0600, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s.Labels)
+	})
+}
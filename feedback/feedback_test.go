@@ -0,0 +1,43 @@
+package feedback
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bzz/scholar-alert-digest/papers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "feedback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "feedback.json")
+	s, err := Open(path)
+	require.NoError(t, err, "missing file is an empty store")
+	assert.Empty(t, s.Labels)
+	assert.False(t, s.Classifier().Trained())
+
+	now := time.Date(2019, 12, 1, 0, 0, 0, 0, time.UTC)
+	s.Mark(&papers.Paper{Title: "Neural program synthesis from examples"}, true, now)
+	s.Mark(&papers.Paper{Title: "Learning to fix build errors with graph neural networks"}, true, now)
+	s.Mark(&papers.Paper{Title: "Crop yield estimation from satellite images"}, false, now)
+	s.Mark(&papers.Paper{Title: "Soil moisture in the crop fields"}, true, now)
+	s.Mark(&papers.Paper{Title: "Soil Moisture in the Crop Fields"}, false, now.AddDate(0, 0, 1))
+	require.NoError(t, s.Save())
+
+	s, err = Open(path)
+	require.NoError(t, err)
+	assert.Len(t, s.Labels, 4, "later mark overrides the earlier one")
+	assert.False(t, s.Labels["title:soil moisture in the crop fields"].Interesting)
+
+	c := s.Classifier()
+	require.True(t, c.Trained())
+	assert.True(t, c.Score(&papers.Paper{Title: "Graph neural networks for program synthesis"}) > 0.5)
+	assert.True(t, c.Score(&papers.Paper{Title: "Crop fields from satellite"}) < 0.5)
+}
@@ -0,0 +1,36 @@
+// Package fileutils has the helpers for the files of the state and the reports, shared by all the packages.
+package fileutils
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// AtomicWrite writes a file \w a given permission by a given function. The file is replaced atomically,
+// so it is never left half-written: the function writes a temporary file in the same directory, that is synced
+// and renamed to the path. On an error, the file is left as it was.
+func AtomicWrite(path string, perm os.FileMode, write func(io.Writer) error) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after the rename
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
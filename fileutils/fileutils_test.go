@@ -0,0 +1,44 @@
+package fileutils
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAtomicWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fileutils")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+
+	require.NoError(t, AtomicWrite(path, 0644, func(w io.Writer) error {
+		_, err := w.Write([]byte("new"))
+		return err
+	}))
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(b))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+
+	failed := errors.New("failed")
+	assert.Equal(t, failed, AtomicWrite(path, 0600, func(w io.Writer) error {
+		w.Write([]byte("half"))
+		return failed
+	}))
+	b, err = ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(b), "the file is left as it was")
+
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 1, "no temporary files are left")
+}
@@ -53,3 +53,23 @@ test("renders paper correctly in compact mode", () => {
   expect(queryByText(/first line/)).toBeTruthy()
   expect(queryByText(/rest of the abstract/)).toBeTruthy()
 })
+
+test("renders buttons to mark paper as interesting or not", () => {
+  const paper = {
+    Abstract: {
+      FirstLine: "first line",
+      Rest: "rest of the abstract",
+    },
+    URL: "https://url.co",
+    Title: "title",
+    Author: "author",
+    Refs: ["1"],
+  }
+
+  const {queryByTitle} = render(
+    <Paper paper={paper} mode="default" />,
+  )
+
+  expect(queryByTitle("Interesting")).toBeTruthy()
+  expect(queryByTitle("Not interesting")).toBeTruthy()
+})
@@ -4,6 +4,7 @@ import React from "react"
 import PropTypes from "prop-types"
 import {modes} from "constants"
 import {Maybe} from "utils"
+import {markPaper} from "effects"
 
 import "components/components.css"
 
@@ -26,6 +27,12 @@ const PaperTitle = ({paper}) => {
           </Maybe>
         </a>
       ))})
+      <button type="button" className="paper__mark" title="Interesting" onClick={markPaper(paper, true)}>
+        +
+      </button>
+      <button type="button" className="paper__mark" title="Not interesting" onClick={markPaper(paper, false)}>
+        -
+      </button>
     </>
   )
 }
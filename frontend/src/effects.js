@@ -23,6 +23,11 @@ export const getMessages = ({label, setPapers}) => {
     .catch(handleError)
 }
 
+export const markPaper = (paper, interesting) => _ => {
+  post("feedback", {paper, interesting})
+    .catch(handleError)
+}
+
 export const changeLabel = ({setView, setLabels}) => _ => {
   setView(views.labels)
   getLabels({setLabels})
@@ -0,0 +1,142 @@
+package gmailutils
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// MaxBatchSize is the max number of requests in a single batch, allowed by Gmail API.
+// Batches of more than 50 requests are likely to be rate limited.
+const MaxBatchSize = 100
+
+// batchURL is the Gmail API endpoint for batch requests.
+var batchURL = "https://www.googleapis.com/batch/gmail/v1"
+
+// getBatch fetches the given messages in a given format in a single batch HTTP request.
+// Messages that fail to be fetched are logged and skipped, as in FetchConcurent,
+// except for those rate limited or failed \w a server error, IDs of which are returned to be retried.
+func getBatch(ctx context.Context, client *http.Client, user string, msgIDs []string, format string) ([]*gmail.Message, []string, error) {
+	if len(msgIDs) > MaxBatchSize {
+		return nil, nil, fmt.Errorf("%d requests in a batch, more than %d", len(msgIDs), MaxBatchSize)
+	}
+
+	query := url.Values{"format": {format}}
+	if format == FormatMetadata {
+		query["metadataHeaders"] = MetadataHeaders
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for i, id := range msgIDs {
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Type", "application/http")
+		h.Set("Content-ID", fmt.Sprintf("<%d>", i))
+		pw, err := mw.CreatePart(h)
+		if err != nil {
+			return nil, nil, err
+		}
+		fmt.Fprintf(pw, "GET /gmail/v1/users/%s/messages/%s?%s HTTP/1.1\r\n\r\n", url.PathEscape(user), url.PathEscape(id), query.Encode())
+	}
+	if err := mw.Close(); err != nil {
+		return nil, nil, err
+	}
+
+	req, err := http.NewRequest("POST", batchURL, &body)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+	resp, err := client.Do(req.WithContext(withQuotaUnits(ctx, 5*len(msgIDs))))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, nil, fmt.Errorf("batch request failed: %s %s", resp.Status, b)
+	}
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		return nil, nil, fmt.Errorf("batch response is not multipart: %q", resp.Header.Get("Content-Type"))
+	}
+
+	var retry []string
+	msgs := make([]*gmail.Message, len(msgIDs))
+	mr := multipart.NewReader(resp.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("failed to read batch response: %v", err)
+		}
+
+		// Content-ID of the response is "<response-N>", for the request "<N>"
+		i, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(part.Header.Get("Content-ID"), "<response-"), ">"))
+		if err != nil || i < 0 || i >= len(msgIDs) {
+			log.Printf("Unexpected Content-ID %q in batch response", part.Header.Get("Content-ID"))
+			continue
+		}
+		msg, err := readBatchPart(part)
+		if se, ok := err.(*statusError); ok && retriableStatus(se.code) {
+			retry = append(retry, msgIDs[i])
+			continue
+		} else if err != nil {
+			log.Printf("Unable to fetch message by ID:%q - %v", msgIDs[i], err)
+			continue
+		}
+		msgs[i] = msg
+	}
+
+	fetched := msgs[:0]
+	for _, msg := range msgs {
+		if msg != nil {
+			fetched = append(fetched, msg)
+		}
+	}
+	return fetched, retry, nil
+}
+
+// readBatchPart reads a message from the HTTP response, embedded in a part of the batch response.
+func readBatchPart(part io.Reader) (*gmail.Message, error) {
+	resp, err := http.ReadResponse(bufio.NewReader(part), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &statusError{resp.StatusCode, resp.Status}
+	}
+	msg := &gmail.Message{}
+	if err := json.NewDecoder(resp.Body).Decode(msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// statusError is a failed response in a batch.
+type statusError struct {
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string {
+	return e.status
+}
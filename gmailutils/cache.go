@@ -0,0 +1,74 @@
+package gmailutils
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/bzz/scholar-alert-digest/fileutils"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// Cache is an on-disk cache of the full messages, fetched from Gmail, a JSON file per message ID.
+// Messages do not change, except for the labels, so the cached ones are never invalidated, but are kept \wo labels.
+type Cache struct {
+	dir string
+}
+
+// DefaultCacheDir returns the directory for the cache in the user cache directory
+// e.g ~/.cache/scholar-alert-digest on Linux, or "" if unknown.
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "scholar-alert-digest")
+}
+
+// NewCache returns a cache in a given directory, creating it if missing.
+func NewCache(dir string) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Cache{dir}, nil
+}
+
+// validID matches the message IDs, as returned by Gmail, safe to use as file names.
+var validID = regexp.MustCompile(`^[0-9a-zA-Z_-]+$`)
+
+// Get returns a cached message by ID, if any.
+func (c *Cache) Get(id string) (*gmail.Message, bool) {
+	if !validID.MatchString(id) {
+		return nil, false
+	}
+	b, err := ioutil.ReadFile(filepath.Join(c.dir, id+".json"))
+	if err != nil {
+		return nil, false
+	}
+	msg := &gmail.Message{}
+	if err := json.Unmarshal(b, msg); err != nil {
+		return nil, false
+	}
+	return msg, true
+}
+
+// Put saves the full message to the cache, \wo the labels, that are to be fetched again.
+func (c *Cache) Put(msg *gmail.Message) error {
+	if !validID.MatchString(msg.Id) {
+		return nil
+	}
+	unlabeled := *msg
+	unlabeled.LabelIds = nil
+	b, err := json.Marshal(&unlabeled)
+	if err != nil {
+		return err
+	}
+	return fileutils.AtomicWrite(filepath.Join(c.dir, msg.Id+".json"), 0600, func(w io.Writer) error {
+		_, err := w.Write(b)
+		return err
+	})
+}
@@ -0,0 +1,265 @@
+package gmailutils
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cheggaaa/pb/v3"
+	"google.golang.org/api/gmail/v1"
+)
+
+// Formats of the fetched messages.
+const (
+	FormatFull     = "full"
+	FormatMetadata = "metadata" // only headers, labels and the date
+	FormatMinimal  = "minimal"  // only labels, the date and the snippet
+)
+
+// MetadataHeaders are the headers of messages, fetched \w FormatMetadata.
+var MetadataHeaders = []string{"Subject", "From", "Date"}
+
+// Fetcher fetches messages from the Gmail, either in batches or one by one, concurrently.
+type Fetcher struct {
+	Srv         *gmail.Service
+	Client      *http.Client // authorized client, the Srv was created \w, used for batch requests
+	User        string
+	Concurrency int // number of concurrent requests, if fetching one by one
+	BatchSize   int // number of messages in a batch request, 0 to fetch one by one
+
+	// Cache, if set, keeps the full messages, so they are fetched only once.
+	Cache *Cache
+
+	// Keep, if set, is applied to the messages \w only metadata, fetched first.
+	// Full messages are fetched only for the kept ones.
+	Keep func(*gmail.Message) bool
+
+	// Max is the max number of messages to fetch, the oldest ones, 0 for no limit.
+	Max int
+
+	// Skip, if set, tells the messages not to fetch at all by the ID e.g from a SkipList.
+	Skip func(msgID string) bool
+}
+
+// Fetch fetches matching messages for a given query.
+func (f *Fetcher) Fetch(ctx context.Context, query string) ([]*gmail.Message, error) {
+	log.Printf("searching and fetching messages from Gmail: %q", query)
+	start := time.Now()
+	msgIDs, err := searchMessages(ctx, f.Srv, f.User, query)
+	if err != nil {
+		return nil, err
+	}
+
+	msgs, err := f.FetchIDs(ctx, f.selectIDs(msgIDs))
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("%d messages found&fetched (took %.0f sec)", len(msgs), time.Since(start).Seconds())
+	return msgs, nil
+}
+
+// Search returns IDs of all the messages, matching a query, the newest first, \wo fetching them.
+func (f *Fetcher) Search(ctx context.Context, query string) ([]string, error) {
+	return searchMessages(ctx, f.Srv, f.User, query)
+}
+
+// selectIDs returns the IDs of messages to fetch, \wo the skipped ones, at most Max of the oldest ones,
+// from the newest first, as listed by Gmail.
+func (f *Fetcher) selectIDs(msgIDs []string) []string {
+	if f.Skip != nil {
+		selected := make([]string, 0, len(msgIDs))
+		for _, id := range msgIDs {
+			if !f.Skip(id) {
+				selected = append(selected, id)
+			}
+		}
+		if n := len(msgIDs) - len(selected); n > 0 {
+			log.Printf("skipping %d messages from the skip-list", n)
+		}
+		msgIDs = selected
+	}
+	if f.Max <= 0 || len(msgIDs) <= f.Max {
+		return msgIDs
+	}
+	log.Printf("only fetching %d oldest of %d messages", f.Max, len(msgIDs))
+	return msgIDs[len(msgIDs)-f.Max:]
+}
+
+// FetchIDs fetches full messages by ID, only the kept ones, if Keep is set.
+func (f *Fetcher) FetchIDs(ctx context.Context, msgIDs []string) ([]*gmail.Message, error) {
+	if f.Keep != nil {
+		metas, err := f.get(ctx, msgIDs, FormatMetadata)
+		if err != nil {
+			return nil, err
+		}
+		msgIDs = make([]string, 0, len(metas))
+		for _, m := range metas {
+			if f.Keep(m) {
+				msgIDs = append(msgIDs, m.Id)
+			}
+		}
+		log.Printf("%d of %d messages kept by the metadata", len(msgIDs), len(metas))
+	}
+	return f.get(ctx, msgIDs, FormatFull)
+}
+
+// get fetches the messages by ID in a given format, or reads the full ones from the Cache, if any.
+// The current labels of the cached ones are fetched, in the minimal format. Messages are in order of the IDs.
+func (f *Fetcher) get(ctx context.Context, msgIDs []string, format string) ([]*gmail.Message, error) {
+	if f.Cache == nil {
+		return f.fetch(ctx, msgIDs, format)
+	}
+
+	cached := map[string]*gmail.Message{}
+	var missing []string
+	for _, id := range msgIDs {
+		if msg, ok := f.Cache.Get(id); ok {
+			cached[id] = msg
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	if len(cached) > 0 {
+		log.Printf("%d messages read from the cache", len(cached))
+		var ids []string
+		for _, id := range msgIDs {
+			if _, ok := cached[id]; ok {
+				ids = append(ids, id)
+			}
+		}
+		labeled, err := f.fetch(ctx, ids, FormatMinimal)
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range labeled {
+			if c, ok := cached[msg.Id]; ok {
+				c.LabelIds = msg.LabelIds
+			}
+		}
+	}
+
+	fetched, err := f.fetch(ctx, missing, format)
+	if err != nil {
+		return nil, err
+	}
+	for _, msg := range fetched {
+		if format == FormatFull {
+			if err := f.Cache.Put(msg); err != nil {
+				log.Printf("Unable to cache message ID:%q - %v", msg.Id, err)
+			}
+		}
+		cached[msg.Id] = msg
+	}
+
+	msgs := make([]*gmail.Message, 0, len(cached))
+	for _, id := range msgIDs {
+		if msg, ok := cached[id]; ok {
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs, nil
+}
+
+// fetch fetches the messages by ID in a given format. Messages that fail to be fetched are logged and skipped.
+func (f *Fetcher) fetch(ctx context.Context, msgIDs []string, format string) ([]*gmail.Message, error) {
+	if len(msgIDs) == 0 {
+		return nil, nil
+	}
+	start := time.Now()
+	bar := pb.Full.Start(len(msgIDs))
+	bar.SetMaxWidth(100)
+	defer bar.Finish()
+
+	if f.BatchSize <= 0 || f.Client == nil {
+		msgs := f.getConcurent(ctx, msgIDs, format, bar)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		log.Printf("%d messages fetched (took %.0f sec)", len(msgs), time.Since(start).Seconds())
+		return msgs, nil
+	}
+
+	batchSize := f.BatchSize
+	if batchSize > MaxBatchSize {
+		batchSize = MaxBatchSize
+	}
+	var msgs []*gmail.Message
+	batches := 0
+	for attempt := 0; len(msgIDs) > 0; attempt++ {
+		if attempt > 0 {
+			if attempt > MaxRetries {
+				log.Printf("Unable to fetch %d messages, rate limited after %d retries", len(msgIDs), MaxRetries)
+				break
+			}
+			wait := backoff(attempt - 1)
+			log.Printf("%d messages rate limited, retrying in %.1f sec", len(msgIDs), wait.Seconds())
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+
+		var retry []string
+		for i := 0; i < len(msgIDs); i += batchSize {
+			end := i + batchSize
+			if end > len(msgIDs) {
+				end = len(msgIDs)
+			}
+			batch, failed, err := getBatch(ctx, f.Client, f.User, msgIDs[i:end], format)
+			if err != nil {
+				return nil, err
+			}
+			batches++
+			msgs = append(msgs, batch...)
+			retry = append(retry, failed...)
+			bar.Add(end - i - len(failed))
+		}
+		msgIDs = retry
+	}
+	log.Printf("%d messages fetched in %d batches (took %.0f sec)", len(msgs), batches, time.Since(start).Seconds())
+	return msgs, nil
+}
+
+// getConcurent fetches the messages one by one, in concurrent requests.
+func (f *Fetcher) getConcurent(ctx context.Context, msgIDs []string, format string, bar *pb.ProgressBar) []*gmail.Message {
+	var (
+		throttle = make(chan int, f.Concurrency)
+		wg       sync.WaitGroup
+		msgs     = make([]*gmail.Message, len(msgIDs))
+	)
+	for i := range msgIDs {
+		i := i
+		wg.Add(1)
+		go func() {
+			throttle <- 1
+			defer func() { <-throttle; wg.Done() }()
+
+			bar.Increment()
+			if ctx.Err() != nil { // canceled, no need to log every message
+				return
+			}
+			call := f.Srv.Users.Messages.Get(f.User, msgIDs[i]).Format(format).Context(ctx)
+			if format == FormatMetadata {
+				call = call.MetadataHeaders(MetadataHeaders...)
+			}
+			msg, err := call.Do()
+			if err != nil { // already retried by WithRetries, if rate limited
+				log.Printf("Unable to fetch message by ID:%q - %v", msgIDs[i], err)
+				return
+			}
+			msgs[i] = msg
+		}()
+	}
+	wg.Wait()
+
+	fetched := msgs[:0]
+	for _, msg := range msgs {
+		if msg != nil {
+			fetched = append(fetched, msg)
+		}
+	}
+	return fetched
+}
@@ -0,0 +1,291 @@
+package gmailutils
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/gmail/v1"
+)
+
+// batchServer emulates Gmail API batch endpoint, responding \w a message per requested ID, except "missing".
+// Messages have the requested format as a snippet and the ID as a subject.
+// Message "flaky" is rate limited on the first request.
+// It also lists messages "a", "b" and "c" in 2 pages, of at most "maxResults" messages.
+func batchServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(batchHandler(t))
+}
+
+func batchHandler(t *testing.T) http.HandlerFunc {
+	limited := false
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			assert.Equal(t, "500", r.URL.Query().Get("maxResults"))
+			if r.URL.Query().Get("pageToken") == "" {
+				fmt.Fprint(w, `{"messages": [{"id": "a"}, {"id": "b"}], "nextPageToken": "2"}`)
+			} else {
+				fmt.Fprint(w, `{"messages": [{"id": "c"}]}`)
+			}
+			return
+		}
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		require.NoError(t, err)
+
+		mw := multipart.NewWriter(w)
+		w.Header().Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+		mr := multipart.NewReader(r.Body, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			req, err := http.ReadRequest(bufio.NewReader(part))
+			require.NoError(t, err)
+			id := req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:]
+
+			h := textproto.MIMEHeader{}
+			h.Set("Content-Type", "application/http")
+			h.Set("Content-ID", "<response-"+strings.Trim(part.Header.Get("Content-ID"), "<>")+">")
+			pw, _ := mw.CreatePart(h)
+			if id == "flaky" && !limited {
+				limited = true
+				fmt.Fprint(pw, "HTTP/1.1 429 Too Many Requests\r\nContent-Type: application/json\r\n\r\n{}")
+				continue
+			}
+			if id == "missing" {
+				fmt.Fprint(pw, "HTTP/1.1 404 Not Found\r\nContent-Type: application/json\r\n\r\n{}")
+				continue
+			}
+			body := fmt.Sprintf(`{"id": %q, "snippet": %q, "labelIds": ["L"], "payload": {"headers": [{"name": "Subject", "value": %q}]}}`,
+				id, req.URL.Query().Get("format"), id)
+			fmt.Fprintf(pw, "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: %d\r\n\r\n%s", len(body), body)
+		}
+		mw.Close()
+	}
+}
+
+func TestGetBatch(t *testing.T) {
+	srv := batchServer(t)
+	defer srv.Close()
+	defer func(u string) { batchURL = u }(batchURL)
+	batchURL = srv.URL
+
+	msgs, retry, err := getBatch(context.Background(), srv.Client(), "me", []string{"a", "missing", "c"}, FormatFull)
+	require.NoError(t, err)
+	assert.Empty(t, retry)
+	require.Len(t, msgs, 2, "missing message is skipped")
+	assert.Equal(t, "a", msgs[0].Id)
+	assert.Equal(t, "full", msgs[0].Snippet)
+	assert.Equal(t, "c", msgs[1].Id)
+
+	msgs, _, err = getBatch(context.Background(), srv.Client(), "me", []string{"a"}, FormatMetadata)
+	require.NoError(t, err)
+	assert.Equal(t, "metadata", msgs[0].Snippet)
+
+	_, _, err = getBatch(context.Background(), srv.Client(), "me", make([]string, MaxBatchSize+1), FormatFull)
+	assert.Error(t, err)
+}
+
+func TestFetcherKeep(t *testing.T) {
+	srv := batchServer(t)
+	defer srv.Close()
+	defer func(u string) { batchURL = u }(batchURL)
+	batchURL = srv.URL
+
+	gm, err := gmail.New(srv.Client())
+	require.NoError(t, err)
+	gm.BasePath = srv.URL + "/"
+
+	var kept []string
+	f := &Fetcher{Srv: gm, Client: srv.Client(), User: "me", BatchSize: 2,
+		Keep: func(m *gmail.Message) bool {
+			assert.Equal(t, FormatMetadata, m.Snippet)
+			kept = append(kept, m.Id)
+			return Subject(m.Payload) != "b"
+		},
+	}
+	msgs, err := f.Fetch(context.Background(), "label:x")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, kept)
+	require.Len(t, msgs, 2)
+	assert.Equal(t, "a", msgs[0].Id)
+	assert.Equal(t, FormatFull, msgs[0].Snippet)
+	assert.Equal(t, "c", msgs[1].Id)
+}
+
+func TestFetcherMax(t *testing.T) {
+	srv := batchServer(t)
+	defer srv.Close()
+	defer func(u string) { batchURL = u }(batchURL)
+	batchURL = srv.URL
+
+	gm, err := gmail.New(srv.Client())
+	require.NoError(t, err)
+	gm.BasePath = srv.URL + "/"
+
+	f := &Fetcher{Srv: gm, Client: srv.Client(), User: "me", BatchSize: 10, Max: 2}
+	msgs, err := f.Fetch(context.Background(), "label:x")
+	require.NoError(t, err)
+	require.Len(t, msgs, 2)
+	assert.Equal(t, "b", msgs[0].Id, "the oldest ones, listed last")
+	assert.Equal(t, "c", msgs[1].Id)
+}
+
+func TestFetcherRetriesBatch(t *testing.T) {
+	defer func(b time.Duration) { BaseBackoff = b }(BaseBackoff)
+	BaseBackoff = time.Millisecond
+	srv := batchServer(t)
+	defer srv.Close()
+	defer func(u string) { batchURL = u }(batchURL)
+	batchURL = srv.URL
+
+	f := &Fetcher{Client: srv.Client(), User: "me", BatchSize: 2}
+	msgs, err := f.get(context.Background(), []string{"a", "flaky", "missing"}, FormatFull)
+	require.NoError(t, err)
+	require.Len(t, msgs, 2)
+	assert.Equal(t, "a", msgs[0].Id)
+	assert.Equal(t, "flaky", msgs[1].Id, "rate limited message is fetched again")
+}
+
+func TestWithRetries(t *testing.T) {
+	defer func(b time.Duration) { BaseBackoff = b }(BaseBackoff)
+	BaseBackoff = time.Millisecond
+
+	var requests []string
+	failures := map[string][]int{
+		"/limited":   {http.StatusTooManyRequests, http.StatusServiceUnavailable},
+		"/forbidden": {http.StatusForbidden},
+		"/quota":     {http.StatusForbidden},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, r.URL.Path+" "+string(body))
+		if codes := failures[r.URL.Path]; len(codes) > 0 {
+			failures[r.URL.Path] = codes[1:]
+			w.WriteHeader(codes[0])
+			if r.URL.Path == "/quota" {
+				fmt.Fprint(w, `{"error": {"errors": [{"reason": "userRateLimitExceeded"}]}}`)
+			}
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer srv.Close()
+	client := WithRetries(srv.Client())
+
+	resp, err := client.Post(srv.URL+"/limited", "text/plain", strings.NewReader("body"))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"/limited body", "/limited body", "/limited body"}, requests, "body is re-sent")
+
+	resp, err = client.Get(srv.URL + "/forbidden")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode, "lack of permissions is not retried")
+
+	resp, err = client.Get(srv.URL + "/quota")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestWithTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(200 * time.Millisecond):
+			}
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer srv.Close()
+	client := WithTimeout(srv.Client(), 50*time.Millisecond)
+
+	resp, err := client.Get(srv.URL + "/fast")
+	require.NoError(t, err)
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err, "response is read before the timeout")
+	assert.Equal(t, "ok", string(b))
+
+	_, err = client.Get(srv.URL + "/slow")
+	assert.Error(t, err)
+
+	req, _ := http.NewRequest("GET", srv.URL+"/slow", nil)
+	resp, err = client.Do(req.WithContext(withCallTimeout(context.Background(), 0)))
+	require.NoError(t, err, "timeout is overridden by the request")
+	resp.Body.Close()
+}
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(1000)
+	start := time.Now()
+	require.NoError(t, l.Wait(context.Background(), 1000))
+	assert.True(t, time.Since(start) < 50*time.Millisecond, "burst of a second is not limited")
+
+	require.NoError(t, l.Wait(context.Background(), 100))
+	assert.True(t, time.Since(start) >= 90*time.Millisecond, "waits for the units to be restored")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, l.Wait(ctx, 1000))
+}
+
+func TestQuotaUnits(t *testing.T) {
+	for path, units := range map[string]int{
+		"/gmail/v1/users/me/messages":             5,
+		"/gmail/v1/users/me/messages/123":         5,
+		"/gmail/v1/users/me/messages/batchModify": 50,
+		"/gmail/v1/users/me/labels":               1,
+	} {
+		req := httptest.NewRequest("GET", path, nil)
+		assert.Equal(t, units, quotaUnits(req), path)
+	}
+
+	req := httptest.NewRequest("POST", "/batch/gmail/v1", nil)
+	assert.Equal(t, 50, quotaUnits(req.WithContext(withQuotaUnits(req.Context(), 50))))
+}
+
+func TestFetcherCache(t *testing.T) {
+	srv := batchServer(t)
+	defer srv.Close()
+	defer func(u string) { batchURL = u }(batchURL)
+	batchURL = srv.URL
+
+	dir, err := ioutil.TempDir("", "cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	cache, err := NewCache(dir)
+	require.NoError(t, err)
+	require.NoError(t, cache.Put(&gmail.Message{Id: "b", Snippet: "cached", LabelIds: []string{"OLD"}}))
+
+	f := &Fetcher{Client: srv.Client(), User: "me", BatchSize: 10, Cache: cache}
+	msgs, err := f.get(context.Background(), []string{"a", "b"}, FormatFull)
+	require.NoError(t, err)
+	require.Len(t, msgs, 2)
+	assert.Equal(t, FormatFull, msgs[0].Snippet)
+	assert.Equal(t, "cached", msgs[1].Snippet)
+	assert.Equal(t, []string{"L"}, msgs[1].LabelIds, "current labels of the cached message")
+
+	msg, ok := cache.Get("a")
+	require.True(t, ok, "fetched message is cached")
+	assert.Equal(t, "a", msg.Id)
+	assert.Nil(t, msg.LabelIds, "cached without labels")
+	assert.Equal(t, []string{"L"}, msgs[0].LabelIds, "labels of the fetched one are kept")
+
+	_, ok = cache.Get("../a")
+	assert.False(t, ok)
+}
@@ -26,17 +26,19 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"mime"
 	"net/http"
 	"os"
+	"regexp"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 	"unicode"
 	"unicode/utf8"
 
 	"github.com/bzz/scholar-alert-digest/gmailutils/token"
 
-	"github.com/cheggaaa/pb/v3"
+	"golang.org/x/net/html/charset"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/gmail/v1"
@@ -51,7 +53,8 @@ in oreder to:
 `
 
 // NewClient a client configured with OAuth using 'credentials.json' and a 'token.json'.
-func NewClient(needWriteAccess bool) *http.Client {
+// Extra scopes e.g PubSubScope are requested in addition to the Gmail ones, \w a separate token.
+func NewClient(needWriteAccess bool, extraScopes ...string) *http.Client {
 	b, err := ioutil.ReadFile("credentials.json")
 	if err != nil {
 		log.Fatalf("Unable to read client secret file: %v\n%s", err, Instructions)
@@ -64,6 +67,10 @@ func NewClient(needWriteAccess bool) *http.Client {
 		scopes = append(scopes, gmail.GmailModifyScope)
 		token = "token_rw.json"
 	}
+	if len(extraScopes) != 0 {
+		scopes = append(scopes, extraScopes...)
+		token = strings.TrimSuffix(token, ".json") + "_ext.json"
+	}
 
 	config, err := google.ConfigFromJSON(b, scopes...)
 	if err != nil {
@@ -82,7 +89,14 @@ func getClient(config *oauth2.Config, tokFile string) *http.Client {
 		tok = token.FromWeb(config)
 		token.Save(tokFile, tok)
 	}
-	return config.Client(context.Background(), tok)
+	client := config.Client(context.Background(), tok)
+	if CallTimeout > 0 {
+		client = WithTimeout(client, CallTimeout)
+	}
+	if Quota > 0 {
+		client = WithQuota(client, NewLimiter(Quota))
+	}
+	return WithRetries(client)
 }
 
 // FetchLabels fetches the list of labels, as returned by Gmail using authorized http Client.
@@ -97,7 +111,7 @@ func FetchLabels(ctx context.Context, client *http.Client) (
 	// Unable to retrieve all labels: Get https://www.googleapis.com/gmail/v1/users/me/labels?alt=json&prettyPrint=false: oauth2: token expired and refresh token is not set
 
 	// fetch from Gmail
-	labelsResp, err := srv.Users.Labels.List("me").Do()
+	labelsResp, err := srv.Users.Labels.List("me").Context(ctx).Do()
 	if err != nil {
 		return nil, err
 	}
@@ -105,9 +119,9 @@ func FetchLabels(ctx context.Context, client *http.Client) (
 }
 
 // PrintAllLabels prints all labels for a given user.
-func PrintAllLabels(srv *gmail.Service, user string) []*gmail.Label {
+func PrintAllLabels(ctx context.Context, srv *gmail.Service, user string) []*gmail.Label {
 	log.Printf("Listing all Gmail labels")
-	labelsResp, err := srv.Users.Labels.List(user).Do()
+	labelsResp, err := srv.Users.Labels.List(user).Context(ctx).Do()
 	if err != nil {
 		log.Fatalf("Unable to retrieve all labels: %v", err)
 	}
@@ -121,29 +135,29 @@ func PrintAllLabels(srv *gmail.Service, user string) []*gmail.Label {
 
 // FetchConcurent fetches matching messages for a given query in paralle from the Gmail.
 // It is blocking, but doing N concurrent fetche requests.
-// TODO(bzz): make it a method on the struct, that holds srv instance.
 func FetchConcurent(ctx context.Context, srv *gmail.Service, user, query string, concurentReq int) ([]*gmail.Message, error) {
-	log.Printf("searching and fetching messages from Gmail: %q", query)
-	start := time.Now()
-	msgs, err := searchAndFetchConcurent(ctx, srv, user, query, concurentReq)
-	if err != nil {
-		return nil, err
-	}
-	log.Printf("%d messages found&fetched with (took %.0f sec)", len(msgs), time.Since(start).Seconds())
-	return msgs, nil
+	f := &Fetcher{Srv: srv, User: user, Concurrency: concurentReq}
+	return f.Fetch(ctx, query)
 }
 
-// TODO(bzz): make it a method on the struct, that holds srv instance.
-func searchAndFetchConcurent(ctx context.Context, srv *gmail.Service, user, query string, concurentReq int) ([]*gmail.Message, error) {
+// listPageSize is the max number of messages in a page of the list response, allowed by Gmail API.
+const listPageSize = 500
+
+// searchMessages returns IDs of all the messages, matching a given query, following all the pages of the results.
+func searchMessages(ctx context.Context, srv *gmail.Service, user, query string) ([]string, error) {
 	log.Printf("searching messages from Gmail: %q", query)
 	start := time.Now()
 
-	// search
 	var msgIDs []string
-	err := srv.Users.Messages.List(user).Q(query).Pages(ctx, func(mr *gmail.ListMessagesResponse) error {
+	page := 0
+	err := srv.Users.Messages.List(user).Q(query).MaxResults(listPageSize).Pages(ctx, func(mr *gmail.ListMessagesResponse) error {
+		page++
 		for _, msg := range mr.Messages {
 			msgIDs = append(msgIDs, msg.Id)
 		}
+		if page > 1 || mr.NextPageToken != "" {
+			log.Printf("page %d: %d messages, %d found so far", page, len(mr.Messages), len(msgIDs))
+		}
 		return nil
 	})
 	if err != nil {
@@ -152,37 +166,63 @@ func searchAndFetchConcurent(ctx context.Context, srv *gmail.Service, user, quer
 	}
 
 	log.Printf("%d messages found (took %.0f sec)", len(msgIDs), time.Since(start).Seconds())
-	start = time.Now()
-
-	// parallel fetch
-	bar := pb.Full.Start(len(msgIDs))
-	bar.SetMaxWidth(100)
-	var (
-		throttle = make(chan int, concurentReq)
-		wg       sync.WaitGroup
-		msgs     []*gmail.Message
-	)
-	for i := range msgIDs {
-		msgID := msgIDs[i]
-		wg.Add(1)
-		go func() {
-			throttle <- 1
-			defer func() { <-throttle; wg.Done() }()
-
-			bar.Increment()
-			msg, err := srv.Users.Messages.Get(user, msgID).Do()
-			if err != nil { // TODO(bzz): retry
-				log.Printf("Unable to fetch message by ID:%q", msgID)
-			}
+	return msgIDs, nil
+}
+
+// newerThan is a relative age of messages in Gmail search, in days, months or years.
+var newerThan = regexp.MustCompile(`^[0-9]+[dmy]$`)
 
-			msgs = append(msgs, msg)
-		}()
+// DateQuery returns Gmail search terms for messages, received after and before the given dates e.g "2020-01-31",
+// and newer than a given age e.g "7d", "2m" or "1y". Empty ones are not limited.
+func DateQuery(after, before, newer string) (string, error) {
+	var terms []string
+	for _, d := range []struct{ op, date string }{{"after", after}, {"before", before}} {
+		if d.date == "" {
+			continue
+		}
+		t, err := time.Parse("2006-01-02", strings.ReplaceAll(d.date, "/", "-"))
+		if err != nil {
+			return "", fmt.Errorf("invalid date %q, not YYYY-MM-DD", d.date)
+		}
+		terms = append(terms, d.op+":"+t.Format("2006/01/02"))
+	}
+	if newer != "" {
+		if !newerThan.MatchString(newer) {
+			return "", fmt.Errorf("invalid age %q, not a number of days, months or years e.g 7d, 2m or 1y", newer)
+		}
+		terms = append(terms, "newer_than:"+newer)
+	}
+	return strings.Join(terms, " "), nil
+}
+
+// ParseAge parses the age of messages, in the format of DateQuery e.g "30d", "2m" or "1y",
+// counting a month as 30 days and a year as 365 days.
+func ParseAge(age string) (time.Duration, error) {
+	if !newerThan.MatchString(age) {
+		return 0, fmt.Errorf("invalid age %q, not a number of days, months or years e.g 7d, 2m or 1y", age)
+	}
+	n, err := strconv.Atoi(age[:len(age)-1])
+	if err != nil {
+		return 0, err
 	}
-	wg.Wait()
-	bar.Finish()
+	days := map[byte]int{'d': 1, 'm': 30, 'y': 365}[age[len(age)-1]]
+	return time.Duration(n*days) * 24 * time.Hour, nil
+}
+
+// StaleQuery returns a Gmail search query for the unread messages, matching the given terms e.g of the labels,
+// that were received before a cutoff time.
+func StaleQuery(terms []string, cutoff time.Time) string {
+	return strings.Join(append(terms[:len(terms):len(terms)], fmt.Sprintf("is:unread before:%d", cutoff.Unix())), " ")
+}
 
-	log.Printf("%d messages fetched (took %.0f sec)", len(msgIDs), time.Since(start).Seconds())
-	return msgs, nil
+// TrashQuery returns a Gmail search query for the read messages, matching the given terms, that were received
+// before a cutoff time. Unless they are of a label, only the alerts are matched, never all the old mail.
+func TrashQuery(terms []string, labeled bool, cutoff time.Time) string {
+	terms = terms[:len(terms):len(terms)]
+	if !labeled {
+		terms = append(terms, "from:"+AlertsFrom)
+	}
+	return strings.Join(append(terms, fmt.Sprintf("is:read before:%d", cutoff.Unix())), " ")
 }
 
 // ReadMsgFixturesJSON reads Gmail messages from a given JSON file.
@@ -215,20 +255,106 @@ func ReadLblFixturesJSON(name string) []*gmail.Label {
 
 // ModifyMsgsDelLabel batch-deletes a label from all the given messages.
 // TODO(bzz): move user to a const in this package
-func ModifyMsgsDelLabel(srv *gmail.Service, user string, messages []*gmail.Message, label string) {
-	var msgIds []string
+func ModifyMsgsDelLabel(ctx context.Context, srv *gmail.Service, user string, messages []*gmail.Message, label string) {
+	ModifyMsgsLabels(ctx, srv, user, messages, nil, []string{label})
+}
+
+// DryRun disables all the modifications in Gmail: of labels, messages and filters. They are only logged.
+var DryRun = false
+
+// MaxBatchModify is the max number of messages in a single BatchModify request, allowed by Gmail API.
+const MaxBatchModify = 1000
+
+// ModifyMsgsLabels batch-adds and deletes the labels of all the given messages, by ID e.g "UNREAD" or "INBOX".
+// Messages are modified in chunks of MaxBatchModify. A chunk that fails is split in halves and retried,
+// to tell exactly which messages could not be modified. IDs of those are logged and returned.
+func ModifyMsgsLabels(ctx context.Context, srv *gmail.Service, user string, messages []*gmail.Message, add, remove []string) []string {
+	if DryRun {
+		log.Printf("dry run: would batch-modify labels +%v -%v of %d messages", add, remove, len(messages))
+		return nil
+	}
+	var msgIDs []string
 	for _, msg := range messages {
-		msgIds = append(msgIds, msg.Id)
+		msgIDs = append(msgIDs, msg.Id)
+	}
+
+	var failed []string
+	for i := 0; i < len(msgIDs); i += MaxBatchModify {
+		end := i + MaxBatchModify
+		if end > len(msgIDs) {
+			end = len(msgIDs)
+		}
+		failed = append(failed, modifyLabels(ctx, srv, user, msgIDs[i:end], add, remove)...)
+	}
+	if len(failed) != 0 {
+		log.Printf("failed to batch-modify labels +%v -%v of %d messages: %s",
+			add, remove, len(failed), strings.Join(failed, ", "))
 	}
+	return failed
+}
 
+// modifyLabels modifies the labels of the messages in a single request or, if it fails, in two halves,
+// recursively. It returns IDs of the messages that could not be modified.
+func modifyLabels(ctx context.Context, srv *gmail.Service, user string, msgIDs []string, add, remove []string) []string {
 	err := srv.Users.Messages.BatchModify(user, &gmail.BatchModifyMessagesRequest{
-		Ids:            msgIds,
-		RemoveLabelIds: []string{label},
-	}).Do()
-	if err != nil {
-		log.Printf("failed to batch-delete label %s from %d messages: %s",
-			label, len(messages), err)
+		Ids:            msgIDs,
+		AddLabelIds:    add,
+		RemoveLabelIds: remove,
+	}).Context(ctx).Do()
+	if err == nil {
+		return nil
+	}
+	if len(msgIDs) == 1 || ctx.Err() != nil {
+		log.Printf("Unable to modify labels of %d messages - %v", len(msgIDs), err)
+		return msgIDs
+	}
+	half := len(msgIDs) / 2
+	return append(modifyLabels(ctx, srv, user, msgIDs[:half], add, remove),
+		modifyLabels(ctx, srv, user, msgIDs[half:], add, remove)...)
+}
+
+// TrashMsgs moves all the given messages to the trash, one request per message, as batch-modify can not add
+// the TRASH label. IDs of the messages that could not be moved are logged and returned.
+func TrashMsgs(ctx context.Context, srv *gmail.Service, user string, messages []*gmail.Message) []string {
+	return trashMsgs(ctx, "move to the trash", messages, func(id string) error {
+		_, err := srv.Users.Messages.Trash(user, id).Context(ctx).Do()
+		return err
+	})
+}
+
+// UntrashMsgs moves all the given messages out of the trash, reverting TrashMsgs, one request per message.
+// IDs of the messages that could not be moved are logged and returned.
+func UntrashMsgs(ctx context.Context, srv *gmail.Service, user string, messages []*gmail.Message) []string {
+	return trashMsgs(ctx, "restore from the trash", messages, func(id string) error {
+		_, err := srv.Users.Messages.Untrash(user, id).Context(ctx).Do()
+		return err
+	})
+}
+
+// trashMsgs calls move for every message, by ID, and returns IDs of the ones it failed for.
+// Once the context is done, all the remaining messages fail.
+func trashMsgs(ctx context.Context, action string, messages []*gmail.Message, move func(id string) error) []string {
+	if DryRun {
+		log.Printf("dry run: would %s %d messages", action, len(messages))
+		return nil
+	}
+	var failed []string
+	for i, msg := range messages {
+		if ctx.Err() != nil {
+			for _, m := range messages[i:] {
+				failed = append(failed, m.Id)
+			}
+			break
+		}
+		if err := move(msg.Id); err != nil {
+			log.Printf("Unable to %s message %s - %v", action, msg.Id, err)
+			failed = append(failed, msg.Id)
+		}
+	}
+	if len(failed) != 0 {
+		log.Printf("failed to %s %d messages: %s", action, len(failed), strings.Join(failed, ", "))
 	}
+	return failed
 }
 
 // FormatAsID formats human-readable lable as ID, consumable by Gmail API.
@@ -237,6 +363,11 @@ func FormatAsID(label string) string {
 	return strings.ToLower(strings.ReplaceAll(label, " ", "-"))
 }
 
+// SearchName formats a human-readable label as a term of the search queries, \w nested labels joined by "-".
+func SearchName(label string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "-", "/", "-").Replace(label))
+}
+
 // Subject returns the Subject header of a message
 func Subject(m *gmail.MessagePart) string {
 	if m == nil {
@@ -251,8 +382,17 @@ func Subject(m *gmail.MessagePart) string {
 	return ""
 }
 
+// forwardPrefix matches the prefixes, added to the subject of forwarded messages by email clients.
+var forwardPrefix = regexp.MustCompile(`^(?i)((fwd?|tr|wg|rv|enc|vs|пересл\.?|fw)\s*:\s*)+`)
+
+// UnwrapSubject returns the subject of the original message, if it was forwarded.
+func UnwrapSubject(subj string) string {
+	return forwardPrefix.ReplaceAllString(strings.TrimSpace(subj), "")
+}
+
 // NormalizeAndSplit normalizes subj format and split it to type/source.
 func NormalizeAndSplit(subj string) []string {
+	subj = UnwrapSubject(subj)
 	srcType, _ := splitOnDash(subj) // handles at least EN and FR locales
 	if len(srcType) != 2 {
 		srcType = splitOnRuLocale(subj)
@@ -281,6 +421,54 @@ var (
 	// }
 )
 
+// AlertType is a kind of Google Scholar alert email.
+type AlertType string
+
+// Types of Google Scholar alerts, as in the normalized subject.
+const (
+	NewResults      AlertType = "new results"          // a search query alert
+	NewCitations    AlertType = "new citations"        // citations of an article
+	NewArticles     AlertType = "new articles"         // articles of an author
+	RelatedResearch AlertType = "new related research" // research, related to the works of an author
+	UnknownAlert    AlertType = ""
+)
+
+// AlertTypes are all known types of alerts, in the order of report sections.
+var AlertTypes = []AlertType{NewCitations, NewArticles, RelatedResearch, NewResults}
+
+// alertTypeByLocale maps normalized subject types in other locales to the alert types.
+var alertTypeByLocale = map[string]AlertType{
+	"de nouveaux résultats sont disponibles": NewResults,
+	"nouvelles citations":                    NewCitations,
+	"nouveaux articles":                      NewArticles,
+	"nouveaux articles similaires":           RelatedResearch,
+}
+
+// Alert classifies a message subject by the type of the alert and returns it
+// together with the alert source: a search query, an author or a cited article.
+func Alert(subj string) (AlertType, string) {
+	subj = UnwrapSubject(subj)
+	if strings.EqualFold(subj, "New citations to my articles") {
+		return NewCitations, "me"
+	}
+
+	srcType := NormalizeAndSplit(subj)
+	if len(srcType) != 2 {
+		return UnknownAlert, ""
+	}
+
+	src, typ := srcType[0], strings.ToLower(strings.TrimSpace(srcType[1]))
+	if t, ok := alertTypeByLocale[typ]; ok {
+		return t, src
+	}
+	for _, t := range AlertTypes {
+		if strings.HasPrefix(typ, string(t)) {
+			return t, src
+		}
+	}
+	return UnknownAlert, src
+}
+
 // splitOnRuLocale normalizes subj from RU locale.
 func splitOnRuLocale(s string) []string {
 	var result []string
@@ -326,6 +514,15 @@ func MessageTextBody(payload *gmail.MessagePart) ([]byte, error) {
 	return body, err
 }
 
+// MessagePlainTextBody returns the plain text (if any) of a given message, for the emails \wo HTML.
+func MessagePlainTextBody(payload *gmail.MessagePart) ([]byte, error) {
+	body, _, err := recursiveDecodeParts(payload, "text/plain")
+	if body == nil {
+		return nil, errors.New("no message payload")
+	}
+	return body, err
+}
+
 func recursiveDecodeParts(part *gmail.MessagePart, mimeType string) ([]byte, string, error) {
 	if part == nil || part.Body == nil {
 		return nil, "", nil
@@ -351,7 +548,51 @@ func recursiveDecodeParts(part *gmail.MessagePart, mimeType string) ([]byte, str
 		if err != nil {
 			b, err = base64.URLEncoding.DecodeString(part.Body.Data)
 		}
+		if err != nil {
+			return b, "", err
+		}
+		b, err = toUTF8(b, partCharset(part), part.MimeType)
 		return b, "", err
 	}
 	return nil, "", gotError
 }
+
+// partCharset returns the charset parameter of the Content-Type header of a message part, if any.
+func partCharset(part *gmail.MessagePart) string {
+	for _, h := range part.Headers {
+		if strings.EqualFold(h.Name, "Content-Type") {
+			_, params, err := mime.ParseMediaType(h.Value)
+			if err != nil {
+				return ""
+			}
+			return params["charset"]
+		}
+	}
+	return ""
+}
+
+// toUTF8 transcodes the text of a given MIME type from the given charset e.g ISO-8859-1, Windows-1251 or GB2312
+// to UTF-8. If charset is not set, the one declared in the <meta> of HTML is used, if any. Text in an unknown charset
+// is returned as it is.
+func toUTF8(b []byte, label, mimeType string) ([]byte, error) {
+	if label == "" {
+		if !strings.HasPrefix(mimeType, "text/html") { // only HTML declares a charset in the text
+			return b, nil
+		}
+		enc, name, certain := charset.DetermineEncoding(b, mimeType)
+		if enc == nil || name == "utf-8" || !certain && name == "windows-1252" { // the default, if there is no <meta>
+			return b, nil
+		}
+		label = name
+	}
+
+	enc, name := charset.Lookup(label)
+	if enc == nil {
+		log.Printf("unknown charset %q, the text is used as it is", label)
+		return b, nil
+	}
+	if name == "utf-8" {
+		return b, nil
+	}
+	return enc.NewDecoder().Bytes(b)
+}
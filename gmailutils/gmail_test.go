@@ -1,9 +1,12 @@
 package gmailutils
 
 import (
+	"encoding/base64"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/gmail/v1"
 )
 
 func TestSubjSplit(t *testing.T) {
@@ -44,3 +47,115 @@ func TestSubjSplit(t *testing.T) {
 		assert.Equal(t, f.typee, srcType[1])
 	}
 }
+
+func TestAlert(t *testing.T) {
+	fixtures := []struct {
+		subj  string
+		typee AlertType
+		src   string
+	}{
+		{`"Learning to represent programs with graphs" - new citations`, NewCitations, `"Learning to represent programs with graphs"`},
+		{`Miltiadis Allamanis - new related research`, RelatedResearch, "Miltiadis Allamanis"},
+		{`Diomidis Spinellis - new articles`, NewArticles, "Diomidis Spinellis"},
+		{`"machine learning on code" - new results`, NewResults, `"machine learning on code"`},
+		{`"machine learning on code" – de nouveaux résultats sont disponibles`, NewResults, `"machine learning on code"`},
+		{`Новые ссылки на мои статьи`, NewCitations, "me"},
+		{`New citations to my articles`, NewCitations, "me"},
+		{`Новые статьи пользователя Diomidis Spinellis`, NewArticles, "Diomidis Spinellis"},
+		{`Fwd: Miltiadis Allamanis - new related research`, RelatedResearch, "Miltiadis Allamanis"},
+		{`FW: Fwd: "code2vec" - new citations`, NewCitations, `"code2vec"`},
+		{`TR: "machine learning on code" – de nouveaux résultats sont disponibles`, NewResults, `"machine learning on code"`},
+		{`Weekly newsletter`, UnknownAlert, ""},
+	}
+
+	for _, f := range fixtures {
+		typee, src := Alert(f.subj)
+		assert.Equal(t, f.typee, typee, f.subj)
+		assert.Equal(t, f.src, src, f.subj)
+	}
+}
+
+func TestMessageTextBodyCharset(t *testing.T) {
+	fixtures := []struct {
+		charset string
+		body    []byte
+	}{
+		{"ISO-8859-1", []byte("<h3>R\xe9seaux de neurones</h3>")},
+		{"windows-1251", []byte("<h3>\xcd\xe5\xe9\xf0\xee\xed\xed\xfb\xe5 \xf1\xe5\xf2\xe8</h3>")},
+		{"UTF-8", []byte("<h3>Réseaux de neurones</h3>")},
+		{"", []byte("<h3>Réseaux de neurones</h3>")},
+		{"utf-8-misspelled", []byte("<h3>Réseaux de neurones</h3>")},
+	}
+	expected := map[string]string{
+		"windows-1251": "<h3>Нейронные сети</h3>",
+	}
+
+	for _, f := range fixtures {
+		part := &gmail.MessagePart{
+			MimeType: "text/html",
+			Headers:  []*gmail.MessagePartHeader{{Name: "Content-Type", Value: `text/html; charset="` + f.charset + `"`}},
+			Body:     &gmail.MessagePartBody{Data: base64.URLEncoding.EncodeToString(f.body)},
+		}
+		body, err := MessageTextBody(&gmail.MessagePart{MimeType: "multipart/alternative", Body: &gmail.MessagePartBody{}, Parts: []*gmail.MessagePart{part}})
+		assert.NoError(t, err, f.charset)
+
+		want, ok := expected[f.charset]
+		if !ok {
+			want = "<h3>Réseaux de neurones</h3>"
+		}
+		assert.Equal(t, want, string(body), f.charset)
+	}
+
+	meta := []byte("<meta charset=\"windows-1251\">\xcd\xe5\xe9\xf0\xee\xed\xed\xfb\xe5")
+	b, err := toUTF8(meta, "", "text/html")
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "Нейронные")
+	b, err = toUTF8(meta, "", "text/plain")
+	assert.NoError(t, err)
+	assert.Equal(t, meta, b, "<meta> of plain text is not HTML")
+}
+
+func TestDateQuery(t *testing.T) {
+	q, err := DateQuery("2020-01-31", "2020/02/07", "7d")
+	assert.NoError(t, err)
+	assert.Equal(t, "after:2020/01/31 before:2020/02/07 newer_than:7d", q)
+
+	q, err = DateQuery("", "", "")
+	assert.NoError(t, err)
+	assert.Empty(t, q)
+
+	_, err = DateQuery("31.01.2020", "", "")
+	assert.Error(t, err)
+	_, err = DateQuery("", "", "7 days")
+	assert.Error(t, err)
+}
+
+func TestParseAge(t *testing.T) {
+	age, err := ParseAge("30d")
+	assert.NoError(t, err)
+	assert.Equal(t, 30*24*time.Hour, age)
+
+	age, err = ParseAge("1y")
+	assert.NoError(t, err)
+	assert.Equal(t, 365*24*time.Hour, age)
+
+	_, err = ParseAge("30")
+	assert.Error(t, err)
+}
+
+func TestStaleAndTrashQuery(t *testing.T) {
+	cutoff := time.Unix(1583150400, 0)
+	for _, tc := range []struct {
+		name, query, want string
+	}{
+		{"stale", StaleQuery(nil, cutoff), "is:unread before:1583150400"},
+		{"stale of a label", StaleQuery([]string{"label:scholar", "-label:ignored"}, cutoff),
+			"label:scholar -label:ignored is:unread before:1583150400"},
+		{"trash of a label", TrashQuery([]string{"label:scholar"}, true, cutoff), "label:scholar is:read before:1583150400"},
+		{"trash of alerts only", TrashQuery(nil, false, cutoff), "from:" + AlertsFrom + " is:read before:1583150400"},
+		{"trash of alerts with a query", TrashQuery([]string{"(subject:code)"}, false, cutoff),
+			"(subject:code) from:" + AlertsFrom + " is:read before:1583150400"},
+	} {
+		assert.Equal(t, tc.want, tc.query, tc.name)
+	}
+}
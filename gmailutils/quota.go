@@ -0,0 +1,104 @@
+package gmailutils
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultQuota is the per-user limit of Gmail API, in quota units per second.
+// See https://developers.google.com/gmail/api/reference/quota
+const DefaultQuota = 250
+
+// Quota is the limit of Gmail API requests of the clients, created by NewClient, in quota units per second.
+// Zero for no limit. Users \w elevated quotas can raise it.
+var Quota = DefaultQuota
+
+// Limiter is a token bucket of Gmail API quota units, shared by all the requests of a user.
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64 // units per second, also the max burst
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter returns a limiter of a given number of quota units per second.
+func NewLimiter(unitsPerSec int) *Limiter {
+	return &Limiter{rate: float64(unitsPerSec), tokens: float64(unitsPerSec), last: time.Now()}
+}
+
+// Wait blocks until there are enough quota units for a request, or the context is done.
+func (l *Limiter) Wait(ctx context.Context, units int) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	l.tokens -= float64(units) // reserve, even if in debt, so the concurrent requests queue up
+	wait := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(wait):
+		return nil
+	}
+}
+
+// WithQuota returns a client, that waits for the limiter before every request.
+func WithQuota(client *http.Client, l *Limiter) *http.Client {
+	c := *client
+	base := c.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	c.Transport = &quotaTransport{base, l}
+	return &c
+}
+
+type quotaTransport struct {
+	base    http.RoundTripper
+	limiter *Limiter
+}
+
+func (t *quotaTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(req.Context(), quotaUnits(req)); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
+
+type quotaKey struct{}
+
+// withQuotaUnits returns a context of the request, that costs a given number of quota units
+// e.g a batch request costs as much as all the requests in it.
+func withQuotaUnits(ctx context.Context, units int) context.Context {
+	return context.WithValue(ctx, quotaKey{}, units)
+}
+
+// quotaUnits returns the cost of the request in Gmail API quota units.
+func quotaUnits(req *http.Request) int {
+	if units, ok := req.Context().Value(quotaKey{}).(int); ok {
+		return units
+	}
+	path := req.URL.Path
+	switch {
+	case strings.HasSuffix(path, "/messages/batchModify"), strings.HasSuffix(path, "/messages/batchDelete"):
+		return 50
+	case strings.HasSuffix(path, "/watch"):
+		return 100
+	case strings.HasSuffix(path, "/history"):
+		return 2
+	case strings.Contains(path, "/labels"), strings.HasSuffix(path, "/profile"):
+		return 1
+	}
+	return 5 // messages.get, messages.list, messages.modify
+}
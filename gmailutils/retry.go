@@ -0,0 +1,105 @@
+package gmailutils
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Retries of the Gmail API requests, that failed \w a rate limit or a server error.
+var (
+	MaxRetries  = 5
+	BaseBackoff = 500 * time.Millisecond // doubles \w every retry, plus a random jitter
+)
+
+// WithRetries returns a client, retrying the requests that failed \w a rate limit (429, or 403 rate limit exceeded)
+// or a server error (5xx), \w jittered exponential backoff, or after the time in the Retry-After header.
+func WithRetries(client *http.Client) *http.Client {
+	c := *client
+	base := c.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	c.Transport = &retryTransport{base}
+	return &c
+}
+
+type retryTransport struct {
+	base http.RoundTripper
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req
+	for attempt := 0; ; attempt++ {
+		resp, err := t.base.RoundTrip(r)
+		if err != nil || attempt >= MaxRetries || !retriable(resp) {
+			return resp, err
+		}
+		if req.Body != nil && req.GetBody == nil { // the body can not be re-sent
+			return resp, err
+		}
+
+		wait := retryAfter(resp)
+		if wait == 0 {
+			wait = backoff(attempt)
+		}
+		log.Printf("%s %s: %s, retrying in %.1f sec", req.Method, req.URL.Path, resp.Status, wait.Seconds())
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+		if req.Body != nil { // a copy of the request \w a new body, as RoundTrip must not modify it
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r = new(http.Request)
+			*r = *req
+			r.Body = body
+		}
+	}
+}
+
+// retriable returns true if the request failed \w a rate limit or a server error.
+// Body of the 403 response is preserved, as it is read to tell a rate limit from the lack of permissions.
+func retriable(resp *http.Response) bool {
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true
+	case resp.StatusCode == http.StatusForbidden:
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+		return strings.Contains(strings.ToLower(string(b)), "ratelimitexceeded")
+	}
+	return false
+}
+
+// retriableStatus returns true if the status of a response, e.g in a batch, is a rate limit or a server error.
+func retriableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// retryAfter returns the time to wait, as requested by the server, or 0.
+func retryAfter(resp *http.Response) time.Duration {
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	return 0
+}
+
+// backoff returns an exponentially growing time to wait before a given retry, \w a random jitter.
+func backoff(attempt int) time.Duration {
+	d := BaseBackoff << uint(attempt)
+	return d + time.Duration(rand.Int63n(int64(d)+1))
+}
@@ -0,0 +1,95 @@
+package gmailutils
+
+import (
+	"context"
+	"log"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// AlertsFrom is the sender of Google Scholar alert emails.
+const AlertsFrom = "scholaralerts-noreply@google.com"
+
+// Setup creates a label \w a given name, unless there is one already, and a filter, that adds it to the new
+// Google Scholar alert emails. The label is also added to all the alerts, received before.
+func Setup(ctx context.Context, srv *gmail.Service, user, name string) (*gmail.Label, error) {
+	label, err := CreateLabel(ctx, srv, user, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := createFilter(ctx, srv, user, label.Id); err != nil {
+		return nil, err
+	}
+
+	msgIDs, err := searchMessages(ctx, srv, user, "from:"+AlertsFrom+" -label:"+SearchName(label.Name))
+	if err != nil {
+		return nil, err
+	}
+	msgs := make([]*gmail.Message, len(msgIDs))
+	for i, id := range msgIDs {
+		msgs[i] = &gmail.Message{Id: id}
+	}
+	failed := ModifyMsgsLabels(ctx, srv, user, msgs, []string{label.Id}, nil)
+	log.Printf("label %q added to %d earlier alerts", label.Name, len(msgIDs)-len(failed))
+	return label, nil
+}
+
+// CreateLabel creates a label \w a given name e.g "Scholar/Digested", unless there is one already, and returns it.
+// On DryRun, a missing label is not created and its ID is the name.
+func CreateLabel(ctx context.Context, srv *gmail.Service, user, name string) (*gmail.Label, error) {
+	labels, err := srv.Users.Labels.List(user).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	if label := findLabel(labels.Labels, FormatAsID(name)); label != nil {
+		return label, nil
+	}
+	if DryRun {
+		log.Printf("dry run: would create label %q", name)
+		return &gmail.Label{Id: name, Name: name}, nil
+	}
+
+	label, err := srv.Users.Labels.Create(user, &gmail.Label{
+		Name:                  name,
+		LabelListVisibility:   "labelShow",
+		MessageListVisibility: "show",
+	}).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("label %q created", label.Name)
+	return label, nil
+}
+
+// createFilter creates a filter, that adds a label to the alert emails, unless there is one already.
+func createFilter(ctx context.Context, srv *gmail.Service, user, labelID string) error {
+	filters, err := srv.Users.Settings.Filters.List(user).Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+	for _, f := range filters.Filter {
+		if f.Criteria == nil || f.Criteria.From != AlertsFrom || f.Action == nil {
+			continue
+		}
+		for _, id := range f.Action.AddLabelIds {
+			if id == labelID {
+				log.Printf("filter of the alerts already exists")
+				return nil
+			}
+		}
+	}
+
+	if DryRun {
+		log.Printf("dry run: would create a filter of the alerts from %s", AlertsFrom)
+		return nil
+	}
+	_, err = srv.Users.Settings.Filters.Create(user, &gmail.Filter{
+		Criteria: &gmail.FilterCriteria{From: AlertsFrom},
+		Action:   &gmail.FilterAction{AddLabelIds: []string{labelID}},
+	}).Context(ctx).Do()
+	if err == nil {
+		log.Printf("filter of the alerts from %s created", AlertsFrom)
+	}
+	return err
+}
@@ -0,0 +1,96 @@
+package gmailutils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/gmail/v1"
+)
+
+func TestSetup(t *testing.T) {
+	var requests []string
+	var modified gmail.BatchModifyMessagesRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch r.Method + " " + r.URL.Path {
+		case "GET /me/labels":
+			fmt.Fprint(w, `{"labels": [{"id": "INBOX", "name": "INBOX"}]}`)
+		case "POST /me/labels":
+			var l gmail.Label
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&l))
+			assert.Equal(t, "Scholar Alerts", l.Name)
+			fmt.Fprint(w, `{"id": "L", "name": "Scholar Alerts"}`)
+		case "GET /me/settings/filters":
+			fmt.Fprint(w, `{"filter": [{"criteria": {"from": "someone@example.com"}, "action": {"addLabelIds": ["L"]}}]}`)
+		case "POST /me/settings/filters":
+			var f gmail.Filter
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&f))
+			assert.Equal(t, AlertsFrom, f.Criteria.From)
+			assert.Equal(t, []string{"L"}, f.Action.AddLabelIds)
+			fmt.Fprint(w, `{"id": "F"}`)
+		case "GET /me/messages":
+			assert.Equal(t, "from:"+AlertsFrom+" -label:scholar-alerts", r.URL.Query().Get("q"))
+			fmt.Fprint(w, `{"messages": [{"id": "a"}, {"id": "b"}]}`)
+		case "POST /me/messages/batchModify":
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&modified))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	gm, err := gmail.New(srv.Client())
+	require.NoError(t, err)
+	gm.BasePath = srv.URL + "/"
+
+	label, err := Setup(context.Background(), gm, "me", "Scholar Alerts")
+	require.NoError(t, err)
+	assert.Equal(t, "L", label.Id)
+	assert.Contains(t, requests, "POST /me/labels")
+	assert.Contains(t, requests, "POST /me/settings/filters")
+	assert.Equal(t, []string{"a", "b"}, modified.Ids)
+	assert.Equal(t, []string{"L"}, modified.AddLabelIds)
+
+	defer func() { DryRun = false }()
+	DryRun = true
+	requests = nil
+	_, err = Setup(context.Background(), gm, "me", "Scholar Alerts")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"GET /me/labels", "GET /me/settings/filters", "GET /me/messages"}, requests)
+}
+
+func TestModifyMsgsLabels(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		var req gmail.BatchModifyMessagesRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.True(t, len(req.Ids) <= MaxBatchModify)
+		for _, id := range req.Ids {
+			if id == "bad" {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error": {"code": 400, "message": "Invalid id value"}}`)
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+	gm, err := gmail.New(srv.Client())
+	require.NoError(t, err)
+	gm.BasePath = srv.URL + "/"
+
+	msgs := make([]*gmail.Message, MaxBatchModify+1)
+	for i := range msgs {
+		msgs[i] = &gmail.Message{Id: fmt.Sprint(i)}
+	}
+	msgs[10].Id = "bad"
+
+	failed := ModifyMsgsLabels(context.Background(), gm, "me", msgs, nil, []string{"UNREAD"})
+	assert.Equal(t, []string{"bad"}, failed)
+	assert.True(t, requests < 30, "failed chunk is split in halves, %d requests", requests)
+}
@@ -0,0 +1,81 @@
+package gmailutils
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/bzz/scholar-alert-digest/fileutils"
+)
+
+// MaxFailures is the number of times a message may fail to be parsed, before it is skipped.
+var MaxFailures = 3
+
+// Skipped is a record of the message in a SkipList.
+type Skipped struct {
+	Failures int  `json:",omitempty"` // number of runs, the message failed to be parsed in
+	Excluded bool `json:",omitempty"` // explicitly, by the user
+}
+
+// SkipList is a persistent set of messages, that are not fetched any more, by the ID, saved as a JSON file.
+// Messages are skipped after MaxFailures to be parsed, or if excluded by the user.
+type SkipList struct {
+	path     string
+	Messages map[string]*Skipped
+}
+
+// OpenSkipList reads the list from a given file. Missing file is an empty list.
+func OpenSkipList(path string) (*SkipList, error) {
+	s := &SkipList{path, map[string]*Skipped{}}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(&s.Messages); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Skip returns true if the message should not be fetched.
+func (s *SkipList) Skip(msgID string) bool {
+	m, ok := s.Messages[msgID]
+	return ok && (m.Excluded || m.Failures >= MaxFailures)
+}
+
+// Fail records the failure to parse the messages.
+func (s *SkipList) Fail(msgIDs ...string) {
+	for _, id := range msgIDs {
+		s.get(id).Failures++
+	}
+}
+
+// Exclude adds the messages to the list.
+func (s *SkipList) Exclude(msgIDs ...string) {
+	for _, id := range msgIDs {
+		s.get(id).Excluded = true
+	}
+}
+
+func (s *SkipList) get(msgID string) *Skipped {
+	m, ok := s.Messages[msgID]
+	if !ok {
+		m = &Skipped{}
+		s.Messages[msgID] = m
+	}
+	return m
+}
+
+// Save writes the list to the file it was opened from.
+func (s *SkipList) Save() error {
+	return fileutils.AtomicWrite(s.path, 0600, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s.Messages)
+	})
+}
@@ -0,0 +1,36 @@
+package gmailutils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSkipList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "skip")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "skipped.json")
+
+	s, err := OpenSkipList(path)
+	require.NoError(t, err)
+	s.Exclude("a")
+	for i := 0; i < MaxFailures; i++ {
+		assert.False(t, s.Skip("b"), "failed %d times", i)
+		s.Fail("b", "c")
+	}
+	require.NoError(t, s.Save())
+
+	s, err = OpenSkipList(path)
+	require.NoError(t, err)
+	assert.True(t, s.Skip("a"), "excluded")
+	assert.True(t, s.Skip("b"), "failed too many times")
+	assert.False(t, s.Skip("d"))
+
+	f := &Fetcher{Skip: s.Skip, Max: 1}
+	assert.Equal(t, []string{"d"}, f.selectIDs([]string{"e", "d", "c", "b", "a"}), "the oldest, not skipped one")
+}
@@ -0,0 +1,271 @@
+package gmailutils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bzz/scholar-alert-digest/fileutils"
+
+	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// SyncState is the result of the last sync of the messages, matching a query.
+type SyncState struct {
+	HistoryID uint64   // of the mailbox at the last sync
+	MsgIDs    []string // of the messages, matching the query at the last sync, the newest first
+}
+
+// SyncStore is a persistent set of sync states, by the query, saved as a JSON file.
+type SyncStore struct {
+	path    string
+	Queries map[string]*SyncState
+}
+
+// OpenSyncStore reads the store from a given file. Missing file is an empty store.
+func OpenSyncStore(path string) (*SyncStore, error) {
+	s := &SyncStore{path, map[string]*SyncState{}}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(&s.Queries); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Save writes the store to the file it was opened from.
+func (s *SyncStore) Save() error {
+	return fileutils.AtomicWrite(s.path, 0600, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s.Queries)
+	})
+}
+
+// Sync fetches the messages, matching a query, as Fetch does. But after the first, full, sync
+// only the changes since the last sync are requested from the Gmail history, instead of listing all the messages.
+// The history is limited to a given label, and match tells if a message \w given labels matches the query.
+// Messages in the trash or spam never match, as in the search.
+// If the history is too old, the full sync is done again.
+func (f *Fetcher) Sync(ctx context.Context, store *SyncStore, query, labelID string, match func(labelIDs []string) bool) ([]*gmail.Message, error) {
+	start := time.Now()
+	st, synced := store.Queries[query]
+	if synced {
+		log.Printf("syncing messages from Gmail history: %q", query)
+		err := f.syncHistory(ctx, st, labelID, match)
+		if e, ok := err.(*googleapi.Error); ok && e.Code == http.StatusNotFound {
+			log.Printf("history %d is too old, doing a full sync", st.HistoryID)
+			synced = false
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if !synced {
+		// the history ID is taken before the listing, so no changes are missed in between
+		profile, err := f.Srv.Users.GetProfile(f.User).Context(ctx).Do()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the history ID: %v", err)
+		}
+		msgIDs, err := searchMessages(ctx, f.Srv, f.User, query)
+		if err != nil {
+			return nil, err
+		}
+		st = &SyncState{profile.HistoryId, msgIDs}
+	}
+	store.Queries[query] = st
+
+	msgs, err := f.FetchIDs(ctx, f.selectIDs(st.MsgIDs))
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("%d messages synced&fetched (took %.0f sec)", len(msgs), time.Since(start).Seconds())
+	return msgs, nil
+}
+
+// syncHistory updates the state \w the changes of the messages since its history ID.
+func (f *Fetcher) syncHistory(ctx context.Context, st *SyncState, labelID string, match func([]string) bool) error {
+	labels := map[string][]string{} // latest labels of the changed messages
+	deleted := map[string]bool{}
+	var changed []string
+	update := func(m *gmail.Message, del bool) {
+		if _, ok := labels[m.Id]; !ok {
+			changed = append(changed, m.Id)
+		}
+		labels[m.Id] = m.LabelIds
+		deleted[m.Id] = del
+	}
+
+	historyID := st.HistoryID
+	call := f.Srv.Users.History.List(f.User).StartHistoryId(st.HistoryID).MaxResults(listPageSize)
+	if labelID != "" {
+		call = call.LabelId(labelID)
+	}
+	err := call.Pages(ctx, func(hr *gmail.ListHistoryResponse) error {
+		for _, h := range hr.History {
+			for _, a := range h.MessagesAdded {
+				update(a.Message, false)
+			}
+			for _, a := range h.LabelsAdded {
+				update(a.Message, false)
+			}
+			for _, r := range h.LabelsRemoved {
+				update(r.Message, false)
+			}
+			for _, d := range h.MessagesDeleted {
+				update(d.Message, true)
+			}
+		}
+		historyID = hr.HistoryId
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	matches := func(id string) bool { return !deleted[id] && notHidden(labels[id]) && match(labels[id]) }
+	synced := map[string]bool{}
+	for _, id := range st.MsgIDs {
+		synced[id] = true
+	}
+	var msgIDs []string
+	for i := len(changed) - 1; i >= 0; i-- { // history is the oldest first
+		if id := changed[i]; !synced[id] && matches(id) {
+			msgIDs = append(msgIDs, id)
+		}
+	}
+	added, removed := len(msgIDs), 0
+	for _, id := range st.MsgIDs {
+		if _, ok := labels[id]; ok && !matches(id) {
+			removed++
+			continue
+		}
+		msgIDs = append(msgIDs, id)
+	}
+	st.MsgIDs = msgIDs
+	st.HistoryID = historyID
+	log.Printf("%d messages changed, %d added and %d removed since the last sync", len(changed), added, removed)
+	return nil
+}
+
+// notHidden matches the messages that are not in the trash or spam, as they are never found by the search of
+// a full sync, even though they keep all their labels.
+var notHidden = HasLabels(nil, "TRASH", "SPAM")
+
+// HasLabels returns a match for Sync, of the messages that have all the given labels and none of the excluded ones.
+func HasLabels(labels []string, excluded ...string) func([]string) bool {
+	return func(labelIDs []string) bool {
+		has := map[string]bool{}
+		for _, l := range labelIDs {
+			has[l] = true
+		}
+		for _, l := range labels {
+			if !has[l] {
+				return false
+			}
+		}
+		for _, l := range excluded {
+			if has[l] {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// HasAnyLabel returns a match for Sync, of the messages that have any of the given labels and are matched by match.
+func HasAnyLabel(labels []string, match func([]string) bool) func([]string) bool {
+	return func(labelIDs []string) bool {
+		for _, l := range labels {
+			if HasLabels([]string{l})(labelIDs) {
+				return match(labelIDs)
+			}
+		}
+		return false
+	}
+}
+
+// LabelID returns the ID of a label, by its name, formatted as ID, as in the search queries.
+func LabelID(ctx context.Context, srv *gmail.Service, user, name string) (string, error) {
+	labels, err := FindLabels(ctx, srv, user, name)
+	if err != nil {
+		return "", err
+	}
+	return labels[0].Id, nil
+}
+
+// FindLabels returns the labels by their names, formatted as ID, as in the search queries, in the same order.
+// A name may be a glob pattern e.g "scholar/*", where * matches any characters, even /, and ? a single one,
+// of all the matching labels, sorted by the name.
+func FindLabels(ctx context.Context, srv *gmail.Service, user string, names ...string) ([]*gmail.Label, error) {
+	resp, err := srv.Users.Labels.List(user).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+
+	var found []*gmail.Label
+	for _, name := range names {
+		var labels []*gmail.Label
+		if IsGlob(name) {
+			labels = matchLabels(resp.Labels, name)
+		} else if l := findLabel(resp.Labels, name); l != nil {
+			labels = []*gmail.Label{l}
+		}
+		if len(labels) == 0 {
+			var all []string
+			for _, l := range resp.Labels {
+				all = append(all, FormatAsID(l.Name))
+			}
+			sort.Strings(all)
+			return nil, fmt.Errorf("no label %q, not one of %v", name, all)
+		}
+		found = append(found, labels...)
+	}
+	return found, nil
+}
+
+// findLabel returns a label by its name, formatted as ID or as a search term, or its ID, or nil if there is none.
+func findLabel(labels []*gmail.Label, name string) *gmail.Label {
+	for _, l := range labels {
+		if FormatAsID(l.Name) == name || SearchName(l.Name) == name || l.Id == name {
+			return l
+		}
+	}
+	return nil
+}
+
+// IsGlob returns true if a label name is a glob pattern.
+func IsGlob(name string) bool {
+	return strings.ContainsAny(name, "*?")
+}
+
+// matchLabels returns the labels, matching a glob pattern, sorted by the name.
+func matchLabels(labels []*gmail.Label, pattern string) []*gmail.Label {
+	glob := regexp.QuoteMeta(pattern)
+	glob = strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(glob)
+	re := regexp.MustCompile("^" + glob + "$")
+
+	var matched []*gmail.Label
+	for _, l := range labels {
+		if re.MatchString(FormatAsID(l.Name)) || re.MatchString(SearchName(l.Name)) {
+			matched = append(matched, l)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].Name < matched[j].Name })
+	return matched
+}
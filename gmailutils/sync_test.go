@@ -0,0 +1,130 @@
+package gmailutils
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/gmail/v1"
+)
+
+func TestSync(t *testing.T) {
+	batch := batchHandler(t)
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		switch r.URL.Path {
+		case "/me/profile":
+			fmt.Fprint(w, `{"historyId": "100"}`)
+		case "/me/history":
+			assert.Equal(t, "L", r.URL.Query().Get("labelId"))
+			if r.URL.Query().Get("startHistoryId") != "100" {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"error": {"code": 404, "message": "Not Found"}}`)
+				return
+			}
+			fmt.Fprint(w, `{"historyId": "120", "history": [
+				{"messagesAdded": [{"message": {"id": "d", "labelIds": ["L", "UNREAD"]}}]},
+				{"messagesAdded": [{"message": {"id": "e", "labelIds": ["L", "UNREAD", "SPAM"]}}]},
+				{"labelsAdded": [{"message": {"id": "c", "labelIds": ["L", "UNREAD", "TRASH"]}, "labelIds": ["TRASH"]}]},
+				{"labelsRemoved": [{"message": {"id": "a", "labelIds": ["L"]}, "labelIds": ["UNREAD"]}]},
+				{"messagesDeleted": [{"message": {"id": "b"}}]}
+			]}`)
+		default:
+			batch(w, r)
+		}
+	}))
+	defer srv.Close()
+	defer func(u string) { batchURL = u }(batchURL)
+	batchURL = srv.URL
+
+	gm, err := gmail.New(srv.Client())
+	require.NoError(t, err)
+	gm.BasePath = srv.URL + "/"
+
+	dir, err := ioutil.TempDir("", "sync")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sync.json")
+	store, err := OpenSyncStore(path)
+	require.NoError(t, err)
+
+	f := &Fetcher{Srv: gm, Client: srv.Client(), User: "me", BatchSize: 10}
+	unread := HasLabels([]string{"L", "UNREAD"})
+	sync := func() []string {
+		requests = nil
+		msgs, err := f.Sync(context.Background(), store, "label:l is:unread", "L", unread)
+		require.NoError(t, err)
+		require.NoError(t, store.Save())
+		var ids []string
+		for _, m := range msgs {
+			ids = append(ids, m.Id)
+		}
+		return ids
+	}
+
+	assert.Equal(t, []string{"a", "b", "c"}, sync(), "first sync lists all the messages")
+	assert.Contains(t, requests, "/me/messages")
+
+	store, err = OpenSyncStore(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"d"}, sync(), "read, trashed and deleted messages are removed, new one is added, but not spam")
+	assert.NotContains(t, requests, "/me/messages")
+	assert.Equal(t, uint64(120), store.Queries["label:l is:unread"].HistoryID)
+
+	assert.Equal(t, []string{"a", "b", "c"}, sync(), "full sync, if the history is too old")
+	assert.Contains(t, requests, "/me/messages")
+}
+
+func TestHasLabels(t *testing.T) {
+	read := HasLabels([]string{"L"}, "UNREAD")
+	assert.True(t, read([]string{"INBOX", "L"}))
+	assert.False(t, read([]string{"L", "UNREAD"}))
+	assert.False(t, read(nil))
+}
+
+func TestHasAnyLabel(t *testing.T) {
+	unread := HasAnyLabel([]string{"A", "B"}, HasLabels([]string{"UNREAD"}))
+	assert.True(t, unread([]string{"B", "UNREAD"}))
+	assert.False(t, unread([]string{"B"}))
+	assert.False(t, unread([]string{"C", "UNREAD"}))
+}
+
+func TestFindLabels(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"labels": [
+			{"id": "INBOX", "name": "INBOX"},
+			{"id": "L1", "name": "Scholar/Program Repair"},
+			{"id": "L2", "name": "Scholar/Code/Search"},
+			{"id": "L3", "name": "Scholarships"}
+		]}`)
+	}))
+	defer srv.Close()
+	gm, err := gmail.New(srv.Client())
+	require.NoError(t, err)
+	gm.BasePath = srv.URL + "/"
+
+	ids := func(names ...string) []string {
+		labels, err := FindLabels(context.Background(), gm, "me", names...)
+		require.NoError(t, err)
+		var ids []string
+		for _, l := range labels {
+			ids = append(ids, l.Id)
+		}
+		return ids
+	}
+	assert.Equal(t, []string{"L1", "INBOX"}, ids("scholar/program-repair", "INBOX"))
+	assert.Equal(t, []string{"L1"}, ids("scholar-program-repair"), "search term")
+	assert.Equal(t, []string{"L2", "L1"}, ids("scholar/*"), "all nested labels, by name")
+	assert.Equal(t, []string{"L2", "L1", "L3"}, ids("scholar*"))
+
+	_, err = FindLabels(context.Background(), gm, "me", "other/*")
+	assert.Error(t, err)
+}
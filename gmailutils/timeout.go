@@ -0,0 +1,67 @@
+package gmailutils
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+// CallTimeout is the max duration of a single request of the clients, created by NewClient,
+// including reading the response. Every retry has its own. Zero for no limit.
+var CallTimeout = time.Minute
+
+// WithTimeout returns a client, that cancels every request after a given duration, unless it is set
+// to another one in the request context, e.g for the long polling of Pub/Sub.
+func WithTimeout(client *http.Client, d time.Duration) *http.Client {
+	c := *client
+	base := c.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	c.Transport = &timeoutTransport{base, d}
+	return &c
+}
+
+type timeoutTransport struct {
+	base    http.RoundTripper
+	timeout time.Duration
+}
+
+func (t *timeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	d := t.timeout
+	if v, ok := req.Context().Value(timeoutKey{}).(time.Duration); ok {
+		d = v
+	}
+	if d <= 0 {
+		return t.base.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), d)
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{resp.Body, cancel} // the response is read under the same timeout
+	return resp, nil
+}
+
+// cancelBody cancels the context of the request, when the response body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+type timeoutKey struct{}
+
+// withCallTimeout returns a context of the request, that overrides the timeout of the client, 0 for no limit.
+func withCallTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, timeoutKey{}, d)
+}
@@ -0,0 +1,174 @@
+package gmailutils
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bzz/scholar-alert-digest/fileutils"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// MaxUndo is the number of the last runs, the changes of which are kept in an UndoLog.
+var MaxUndo = 10
+
+// Change is a modification of the labels of the messages, or a move of the messages to the trash.
+type Change struct {
+	MsgIDs  []string
+	Added   []string `json:",omitempty"`
+	Removed []string `json:",omitempty"`
+	Trashed bool     `json:",omitempty"`
+}
+
+// Run is all the changes in Gmail, made by a single run.
+type Run struct {
+	Time    time.Time
+	Changes []Change
+}
+
+// Modify is ModifyMsgsLabels, that records the change of the messages that were modified. Only the labels,
+// that actually changed as of the LabelIds of the messages, are recorded, so undo does not e.g mark as unread
+// the messages that were read before. All the labels are recorded for the messages \wo any LabelIds.
+func (r *Run) Modify(ctx context.Context, srv *gmail.Service, user string, messages []*gmail.Message, add, remove []string) []string {
+	failed := ModifyMsgsLabels(ctx, srv, user, messages, add, remove)
+	var changes []Change // of the same labels, in the order of the messages
+	msgs := map[string][]*gmail.Message{}
+	for _, m := range messages {
+		change := labelChange(m, add, remove)
+		if len(change.Added) == 0 && len(change.Removed) == 0 {
+			continue
+		}
+		key := strings.Join(change.Added, ",") + "/" + strings.Join(change.Removed, ",")
+		if msgs[key] == nil {
+			changes = append(changes, change)
+		}
+		msgs[key] = append(msgs[key], m)
+	}
+	for _, c := range changes {
+		r.record(c, msgs[strings.Join(c.Added, ",")+"/"+strings.Join(c.Removed, ",")], failed)
+	}
+	return failed
+}
+
+// labelChange returns the change of the labels of the message, by adding and removing the given ones.
+func labelChange(m *gmail.Message, add, remove []string) Change {
+	if m.LabelIds == nil {
+		return Change{Added: add, Removed: remove}
+	}
+	had := map[string]bool{}
+	for _, l := range m.LabelIds {
+		had[l] = true
+	}
+	var change Change
+	for _, l := range add {
+		if !had[l] {
+			change.Added = append(change.Added, l)
+		}
+	}
+	for _, l := range remove {
+		if had[l] {
+			change.Removed = append(change.Removed, l)
+		}
+	}
+	return change
+}
+
+// Trash is TrashMsgs, that records the change of the messages that were moved to the trash.
+func (r *Run) Trash(ctx context.Context, srv *gmail.Service, user string, messages []*gmail.Message) []string {
+	failed := TrashMsgs(ctx, srv, user, messages)
+	r.record(Change{Trashed: true}, messages, failed)
+	return failed
+}
+
+// record adds the change of all the messages, but the failed ones, if any.
+func (r *Run) record(change Change, messages []*gmail.Message, failed []string) {
+	if DryRun {
+		return
+	}
+	skip := map[string]bool{}
+	for _, id := range failed {
+		skip[id] = true
+	}
+	for _, m := range messages {
+		if !skip[m.Id] {
+			change.MsgIDs = append(change.MsgIDs, m.Id)
+		}
+	}
+	if len(change.MsgIDs) != 0 {
+		r.Changes = append(r.Changes, change)
+	}
+}
+
+// Undo reverts all the changes of the run, the last one first, and returns IDs of the messages
+// that could not be reverted.
+func (r *Run) Undo(ctx context.Context, srv *gmail.Service, user string) []string {
+	var failed []string
+	for i := len(r.Changes) - 1; i >= 0; i-- {
+		c := r.Changes[i]
+		msgs := make([]*gmail.Message, len(c.MsgIDs))
+		for j, id := range c.MsgIDs {
+			msgs[j] = &gmail.Message{Id: id}
+		}
+		if c.Trashed {
+			failed = append(failed, UntrashMsgs(ctx, srv, user, msgs)...)
+			continue
+		}
+		failed = append(failed, ModifyMsgsLabels(ctx, srv, user, msgs, c.Removed, c.Added)...)
+	}
+	return failed
+}
+
+// UndoLog is a persistent list of the last MaxUndo runs, that changed anything in Gmail, saved as a JSON file.
+type UndoLog struct {
+	path string
+	Runs []*Run
+}
+
+// OpenUndoLog reads the log from a given file. Missing file is an empty log.
+func OpenUndoLog(path string) (*UndoLog, error) {
+	u := &UndoLog{path: path}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return u, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(&u.Runs); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// Add appends the run to the log, forgetting the oldest ones over MaxUndo.
+func (u *UndoLog) Add(run *Run) {
+	u.Runs = append(u.Runs, run)
+	if len(u.Runs) > MaxUndo {
+		u.Runs = u.Runs[len(u.Runs)-MaxUndo:]
+	}
+}
+
+// Pop removes the last run from the log and returns it, or nil if there are none.
+func (u *UndoLog) Pop() *Run {
+	if len(u.Runs) == 0 {
+		return nil
+	}
+	run := u.Runs[len(u.Runs)-1]
+	u.Runs = u.Runs[:len(u.Runs)-1]
+	return run
+}
+
+// Save writes the log to the file it was opened from.
+func (u *UndoLog) Save() error {
+	return fileutils.AtomicWrite(u.path, 0600, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(u.Runs)
+	})
+}
@@ -0,0 +1,142 @@
+package gmailutils
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/gmail/v1"
+)
+
+func TestUndo(t *testing.T) {
+	var requests []gmail.BatchModifyMessagesRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req gmail.BatchModifyMessagesRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		for _, id := range req.Ids {
+			if id == "bad" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		requests = append(requests, req)
+	}))
+	defer srv.Close()
+	gm, err := gmail.New(srv.Client())
+	require.NoError(t, err)
+	gm.BasePath = srv.URL + "/"
+	ctx := context.Background()
+
+	run := &Run{Time: time.Now()}
+	run.Modify(ctx, gm, "me", []*gmail.Message{{Id: "a"}, {Id: "bad"}}, nil, []string{"UNREAD"})
+	run.Modify(ctx, gm, "me", []*gmail.Message{{Id: "b"}}, []string{"L"}, nil)
+	assert.Equal(t, []Change{
+		{MsgIDs: []string{"a"}, Removed: []string{"UNREAD"}},
+		{MsgIDs: []string{"b"}, Added: []string{"L"}},
+	}, run.Changes, "failed messages are not recorded")
+
+	dir, err := ioutil.TempDir("", "undo")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "undo.json")
+
+	u, err := OpenUndoLog(path)
+	require.NoError(t, err)
+	for i := 0; i < MaxUndo; i++ {
+		u.Add(&Run{})
+	}
+	u.Add(run)
+	assert.Len(t, u.Runs, MaxUndo)
+	require.NoError(t, u.Save())
+
+	u, err = OpenUndoLog(path)
+	require.NoError(t, err)
+	last := u.Pop()
+	require.NotNil(t, last)
+	assert.Equal(t, run.Changes, last.Changes)
+	assert.Len(t, u.Runs, MaxUndo-1)
+
+	requests = nil
+	assert.Empty(t, last.Undo(ctx, gm, "me"))
+	assert.Equal(t, []gmail.BatchModifyMessagesRequest{
+		{Ids: []string{"b"}, RemoveLabelIds: []string{"L"}},
+		{Ids: []string{"a"}, AddLabelIds: []string{"UNREAD"}},
+	}, requests, "changes are reverted in reverse order")
+}
+
+func TestUndoOnlyChangedLabels(t *testing.T) {
+	var requests []gmail.BatchModifyMessagesRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req gmail.BatchModifyMessagesRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		requests = append(requests, req)
+	}))
+	defer srv.Close()
+	gm, err := gmail.New(srv.Client())
+	require.NoError(t, err)
+	gm.BasePath = srv.URL + "/"
+	ctx := context.Background()
+
+	run := &Run{Time: time.Now()}
+	run.Modify(ctx, gm, "me", []*gmail.Message{
+		{Id: "unread", LabelIds: []string{"UNREAD", "INBOX", "L"}},
+		{Id: "read", LabelIds: []string{"INBOX", "L"}},
+		{Id: "filtered", LabelIds: []string{"UNREAD", "L"}},
+		{Id: "done", LabelIds: []string{"L"}},
+		{Id: "unread-too", LabelIds: []string{"INBOX", "UNREAD"}},
+	}, nil, []string{"UNREAD", "INBOX"})
+	run.Modify(ctx, gm, "me", []*gmail.Message{{Id: "new", LabelIds: []string{"L"}}, {Id: "processed", LabelIds: []string{"P"}}},
+		[]string{"P"}, nil)
+	assert.Equal(t, []Change{
+		{MsgIDs: []string{"unread", "unread-too"}, Removed: []string{"UNREAD", "INBOX"}},
+		{MsgIDs: []string{"read"}, Removed: []string{"INBOX"}},
+		{MsgIDs: []string{"filtered"}, Removed: []string{"UNREAD"}},
+		{MsgIDs: []string{"new"}, Added: []string{"P"}},
+	}, run.Changes, "labels the messages had, or did not have, before are not recorded")
+
+	requests = nil
+	assert.Empty(t, run.Undo(ctx, gm, "me"))
+	assert.Equal(t, []gmail.BatchModifyMessagesRequest{
+		{Ids: []string{"new"}, RemoveLabelIds: []string{"P"}},
+		{Ids: []string{"filtered"}, AddLabelIds: []string{"UNREAD"}},
+		{Ids: []string{"read"}, AddLabelIds: []string{"INBOX"}},
+		{Ids: []string{"unread", "unread-too"}, AddLabelIds: []string{"UNREAD", "INBOX"}},
+	}, requests)
+}
+
+func TestUndoTrash(t *testing.T) {
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		if strings.Contains(r.URL.Path, "/bad/") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		parts := strings.Split(r.URL.Path, "/")
+		requests = append(requests, strings.Join(parts[len(parts)-2:], " "))
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+	gm, err := gmail.New(srv.Client())
+	require.NoError(t, err)
+	gm.BasePath = srv.URL + "/"
+	ctx := context.Background()
+
+	run := &Run{Time: time.Now()}
+	assert.Equal(t, []string{"bad"}, run.Trash(ctx, gm, "me", []*gmail.Message{{Id: "a"}, {Id: "bad"}, {Id: "b"}}))
+	assert.Equal(t, []string{"a trash", "b trash"}, requests, "a request per message, not a TRASH label")
+	assert.Equal(t, []Change{{MsgIDs: []string{"a", "b"}, Trashed: true}}, run.Changes)
+
+	requests = nil
+	assert.Empty(t, run.Undo(ctx, gm, "me"))
+	assert.Equal(t, []string{"a untrash", "b untrash"}, requests)
+}
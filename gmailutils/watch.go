@@ -0,0 +1,135 @@
+package gmailutils
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// PubSubScope is the OAuth scope, required to pull notifications from a Pub/Sub subscription.
+const PubSubScope = "https://www.googleapis.com/auth/pubsub"
+
+// pubSubURL is the Cloud Pub/Sub API endpoint.
+var pubSubURL = "https://pubsub.googleapis.com/v1/"
+
+// pullTimeout is the max duration of a pull, instead of the CallTimeout, as the server holds it until there are notifications.
+const pullTimeout = 5 * time.Minute
+
+// Watch registers push notifications about the changes of messages \w any of the given labels, or all of them
+// if there are none, published to a Pub/Sub topic e.g "projects/<project>/topics/<topic>".
+// Notifications stop at the returned expiration time, unless renewed.
+func Watch(ctx context.Context, srv *gmail.Service, user, topic string, labelIDs ...string) (time.Time, error) {
+	req := &gmail.WatchRequest{TopicName: topic}
+	if len(labelIDs) != 0 {
+		req.LabelIds = labelIDs
+		req.LabelFilterAction = "include"
+	}
+	resp, err := srv.Users.Watch(user, req).Context(ctx).Do()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, resp.Expiration*int64(time.Millisecond)), nil
+}
+
+// Notification is a Gmail push notification about a change in the mailbox.
+type Notification struct {
+	EmailAddress string `json:"emailAddress"`
+	HistoryID    uint64 `json:"historyId"`
+}
+
+// Since returns the notifications about the changes after a given history of the mailbox e.g the one,
+// reached by the own changes of the last digest, that are not to trigger a new one.
+func Since(ns []Notification, historyID uint64) []Notification {
+	var after []Notification
+	for _, n := range ns {
+		if n.HistoryID > historyID {
+			after = append(after, n)
+		}
+	}
+	return after
+}
+
+// HistoryID returns the current history of the mailbox.
+func HistoryID(ctx context.Context, srv *gmail.Service, user string) (uint64, error) {
+	profile, err := srv.Users.GetProfile(user).Context(ctx).Do()
+	if err != nil {
+		return 0, err
+	}
+	return profile.HistoryId, nil
+}
+
+// Subscription is a Cloud Pub/Sub pull subscription to the topic of Gmail push notifications,
+// e.g "projects/<project>/subscriptions/<subscription>".
+type Subscription struct {
+	Client *http.Client // authorized \w PubSubScope
+	Name   string
+}
+
+// Pull waits for the notifications and acknowledges them.
+func (s *Subscription) Pull(ctx context.Context) ([]Notification, error) {
+	var resp struct {
+		ReceivedMessages []struct {
+			AckID   string `json:"ackId"`
+			Message struct {
+				Data string `json:"data"`
+			} `json:"message"`
+		} `json:"receivedMessages"`
+	}
+	if err := s.call(withCallTimeout(ctx, pullTimeout), "pull", map[string]interface{}{"maxMessages": 100}, &resp); err != nil {
+		return nil, err
+	}
+
+	var ns []Notification
+	var ackIDs []string
+	for _, m := range resp.ReceivedMessages {
+		ackIDs = append(ackIDs, m.AckID)
+		data, err := base64.StdEncoding.DecodeString(m.Message.Data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode notification: %v", err)
+		}
+		var n Notification
+		if err := json.Unmarshal(data, &n); err != nil {
+			return nil, fmt.Errorf("failed to decode notification %q: %v", data, err)
+		}
+		ns = append(ns, n)
+	}
+	if len(ackIDs) == 0 {
+		return nil, nil
+	}
+	return ns, s.call(ctx, "acknowledge", map[string]interface{}{"ackIds": ackIDs}, nil)
+}
+
+// call calls a method of the subscription in Pub/Sub REST API, decoding the response to resp, if not nil.
+func (s *Subscription) call(ctx context.Context, method string, req, resp interface{}) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	r, err := http.NewRequest("POST", pubSubURL+s.Name+":"+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	res, err := s.Client.Do(r.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("Pub/Sub %s failed: %s %s", method, res.Status, b)
+	}
+	if resp == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(resp)
+}
@@ -0,0 +1,70 @@
+package gmailutils
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriptionPull(t *testing.T) {
+	var acked []string
+	pulls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/projects/p/subscriptions/s:pull":
+			pulls++
+			if pulls > 1 {
+				fmt.Fprint(w, `{}`)
+				return
+			}
+			data := base64.StdEncoding.EncodeToString([]byte(`{"emailAddress": "me@example.com", "historyId": 120}`))
+			fmt.Fprintf(w, `{"receivedMessages": [{"ackId": "x", "message": {"data": %q}}]}`, data)
+		case "/projects/p/subscriptions/s:acknowledge":
+			var req struct{ AckIDs []string }
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			acked = append(acked, req.AckIDs...)
+			fmt.Fprint(w, `{}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	defer func(u string) { pubSubURL = u }(pubSubURL)
+	pubSubURL = srv.URL + "/"
+
+	sub := &Subscription{srv.Client(), "projects/p/subscriptions/s"}
+	ns, err := sub.Pull(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []Notification{{"me@example.com", 120}}, ns)
+	assert.Equal(t, []string{"x"}, acked)
+
+	ns, err = sub.Pull(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, ns)
+
+	sub.Name = "projects/p/subscriptions/missing"
+	_, err = sub.Pull(context.Background())
+	assert.Error(t, err)
+}
+
+func TestSince(t *testing.T) {
+	ns := []Notification{{"me@example.com", 120}, {"me@example.com", 125}, {"me@example.com", 130}}
+	for _, tc := range []struct {
+		historyID uint64
+		want      []Notification
+	}{
+		{0, ns},
+		{120, ns[1:]},
+		{127, ns[2:]},
+		{130, nil},
+	} {
+		assert.Equal(t, tc.want, Since(ns, tc.historyID), tc.historyID)
+	}
+}
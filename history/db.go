@@ -0,0 +1,234 @@
+package history
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // SQLite driver, in pure Go
+
+	"github.com/bzz/scholar-alert-digest/papers"
+)
+
+// schema of the DB, that may be queried \w any SQLite client e.g
+//
+//	sqlite3 history.db "SELECT title, emails FROM papers ORDER BY emails DESC LIMIT 10"
+const schema = `
+CREATE TABLE IF NOT EXISTS papers (
+	key        TEXT PRIMARY KEY, -- DOI/arXiv ID or the normalized title
+	title      TEXT NOT NULL,
+	url        TEXT NOT NULL,
+	abstract   TEXT NOT NULL,
+	emails     INTEGER NOT NULL, -- distinct emails, mentioning the paper, in all the runs
+	runs       INTEGER NOT NULL, -- number of digests, the paper was aggregated in
+	first_seen DATETIME NOT NULL,
+	last_seen  DATETIME NOT NULL
+);
+CREATE TABLE IF NOT EXISTS sources (
+	paper_key TEXT NOT NULL REFERENCES papers(key),
+	msg_id    TEXT NOT NULL, -- of the Gmail message
+	date      DATETIME NOT NULL, -- of the message or, if unknown, of the run
+	PRIMARY KEY (paper_key, msg_id)
+);`
+
+// DB is a SQLite database of all the papers, aggregated by every run, and the emails they were found in.
+type DB struct {
+	db *sql.DB
+}
+
+// Record is a paper in the DB.
+type Record struct {
+	Key, Title, URL, Abstract string
+	Emails, Runs              int
+	FirstSeen, LastSeen       time.Time
+}
+
+// OpenDB opens a database file, creating it if missing.
+func OpenDB(path string) (*DB, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &DB{db}, nil
+}
+
+// Close closes the database.
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// Add records the papers as aggregated by a run at a given time e.g both unread and read ones,
+// in a single transaction. The time may be earlier than of the runs, recorded before e.g of an imported report.
+func (d *DB) Add(now time.Time, aggPapers ...papers.AggPapers) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // no-op after the commit
+
+	now = now.UTC()
+	added := map[string]bool{} // papers \w the same key are aggregated once per run
+	for _, ps := range aggPapers {
+		for _, p := range ps {
+			key := p.Key()
+			if !added[key] {
+				abstract := strings.TrimSpace(p.Abstract.FirstLine + " " + p.Abstract.Rest)
+				// the latest title, URL and abstract are kept, unless missing e.g in a report
+				if _, err := tx.Exec(`INSERT INTO papers VALUES (?, ?, ?, ?, 0, 1, ?, ?)
+					ON CONFLICT (key) DO UPDATE SET
+						title = CASE WHEN excluded.last_seen >= last_seen THEN excluded.title ELSE title END,
+						url = CASE WHEN excluded.last_seen >= last_seen THEN excluded.url ELSE url END,
+						abstract = CASE WHEN excluded.abstract != '' AND (excluded.last_seen >= last_seen OR abstract = '')
+							THEN excluded.abstract ELSE abstract END,
+						runs = runs + 1, first_seen = MIN(first_seen, excluded.first_seen),
+						last_seen = MAX(last_seen, excluded.last_seen)`,
+					key, p.Title, p.URL, abstract, now, now); err != nil {
+					return err
+				}
+				added[key] = true
+			}
+			for _, id := range p.MsgIDs() {
+				date := p.MsgDate(id).UTC()
+				if date.IsZero() {
+					date = now
+				}
+				if _, err := tx.Exec(`INSERT OR IGNORE INTO sources VALUES (?, ?, ?)`, key, id, date); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for key := range added {
+		if _, err := tx.Exec(`UPDATE papers SET emails = (SELECT COUNT(*) FROM sources WHERE paper_key = key)
+			WHERE key = ?`, key); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Papers returns all the papers in the DB, the first seen first.
+func (d *DB) Papers() ([]*Record, error) {
+	rows, err := d.db.Query(`SELECT key, title, url, abstract, emails, runs, first_seen, last_seen
+		FROM papers ORDER BY first_seen, key`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []*Record
+	for rows.Next() {
+		r := &Record{}
+		if err := rows.Scan(&r.Key, &r.Title, &r.URL, &r.Abstract, &r.Emails, &r.Runs, &r.FirstSeen, &r.LastSeen); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// Trend is a paper or a keyword, mentioned by the emails in several weeks.
+type Trend struct {
+	Title string
+	Weeks []int // number of emails, mentioning it, in every week, the earliest first
+}
+
+// weeks returns the number of weeks \w any mentions.
+func (t *Trend) weeks() int {
+	n := 0
+	for _, c := range t.Weeks {
+		if c != 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// total returns the number of mentions in all the weeks.
+func (t *Trend) total() int {
+	n := 0
+	for _, c := range t.Weeks {
+		n += c
+	}
+	return n
+}
+
+// Trends returns the papers and the keywords of their titles, mentioned by the emails in at least two of
+// a given number of the last weeks, ending \w the week of the given time. The ones mentioned in more weeks are first.
+// If keyphrases is not 0, the keywords are that many keyphrases of the title and abstract of every paper instead.
+func (d *DB) Trends(weeks, keyphrases int, now time.Time) (papersTrends, keywords []*Trend, err error) {
+	end := WeekStart(now).AddDate(0, 0, 7)
+	start := end.AddDate(0, 0, -7*weeks)
+	rows, err := d.db.Query(`SELECT p.key, p.title, p.abstract, s.date FROM sources s JOIN papers p ON p.key = s.paper_key
+		WHERE s.date >= ? AND s.date < ?`, start.UTC(), end.UTC())
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	byPaper, byTerm := map[string]*Trend{}, map[string]*Trend{}
+	termsOf := map[string][]string{}
+	count := func(trends map[string]*Trend, key, title string, week int) {
+		t, ok := trends[key]
+		if !ok {
+			t = &Trend{title, make([]int, weeks)}
+			trends[key] = t
+		}
+		t.Weeks[week]++
+	}
+	for rows.Next() {
+		var key, title, abstract string
+		var date time.Time
+		if err := rows.Scan(&key, &title, &abstract, &date); err != nil {
+			return nil, nil, err
+		}
+		week := int(WeekStart(date.In(now.Location())).Sub(start).Hours()+12) / (7 * 24) // DST-safe
+		count(byPaper, key, title, week)
+		terms, ok := termsOf[key] // a paper is in many emails
+		if !ok {
+			terms = papers.Terms(title)
+			if keyphrases != 0 {
+				terms = papers.Keyphrases(title+". "+abstract, keyphrases)
+			}
+			termsOf[key] = terms
+		}
+		for _, term := range terms {
+			count(byTerm, term, term, week)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	return trending(byPaper), trending(byTerm), nil
+}
+
+// trending returns the trends, mentioned in at least two weeks, the ones in more weeks and then \w more mentions first.
+func trending(trends map[string]*Trend) []*Trend {
+	var result []*Trend
+	for _, t := range trends {
+		if t.weeks() >= 2 {
+			result = append(result, t)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if wi, wj := result[i].weeks(), result[j].weeks(); wi != wj {
+			return wi > wj
+		}
+		if ti, tj := result[i].total(), result[j].total(); ti != tj {
+			return ti > tj
+		}
+		return result[i].Title < result[j].Title
+	})
+	return result
+}
+
+// WeekStart returns the start of the week (Monday) of a given time, in its location.
+func WeekStart(t time.Time) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+}
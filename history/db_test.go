@@ -0,0 +1,127 @@
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bzz/scholar-alert-digest/gmailutils"
+	"github.com/bzz/scholar-alert-digest/papers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/gmail/v1"
+)
+
+func TestDB(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history.db")
+
+	msgs := gmailutils.ReadMsgFixturesJSON("../fixtures/unread.json")
+	_, aggPapers := papers.ExtractAndAggPapersFromMsgs(msgs[:1], false, false)
+	require.NotEmpty(t, aggPapers)
+
+	db, err := OpenDB(path)
+	require.NoError(t, err)
+	first := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, db.Add(first, aggPapers))
+	require.NoError(t, db.Close())
+
+	db, err = OpenDB(path)
+	require.NoError(t, err)
+	defer db.Close()
+	_, aggPapers = papers.ExtractAndAggPapersFromMsgs(msgs[:2], false, false)
+	last := first.Add(24 * time.Hour)
+	require.NoError(t, db.Add(last, aggPapers, aggPapers), "same emails are aggregated again, as both read and unread")
+
+	records, err := db.Papers()
+	require.NoError(t, err)
+	require.Len(t, records, len(aggPapers))
+
+	again := 0
+	byKey := map[string]*Record{}
+	for _, r := range records {
+		byKey[r.Key] = r
+	}
+	for _, p := range aggPapers {
+		r := byKey[p.Key()]
+		require.NotNil(t, r, p.Title)
+		assert.Equal(t, p.Title, r.Title)
+		assert.Equal(t, p.URL, r.URL)
+		assert.Equal(t, p.Emails(), r.Emails, "distinct emails of %q", p.Title)
+		assert.True(t, r.LastSeen.Equal(last))
+		if r.Runs == 2 {
+			again++
+			assert.True(t, r.FirstSeen.Equal(first), "first seen is kept")
+		} else {
+			assert.True(t, r.FirstSeen.Equal(last))
+		}
+	}
+	assert.NotZero(t, again)
+
+	var p *papers.Paper // \w an ID, that is the same for another title
+	for _, p = range aggPapers {
+		if p.ID != "" {
+			break
+		}
+	}
+	require.NotEmpty(t, p.ID)
+	imported := first.AddDate(0, -1, 0)
+	require.NoError(t, db.Add(imported, papers.AggPapers{"": &papers.Paper{Title: "imported", URL: p.URL, ID: p.ID}}),
+		"papers of an earlier report, without the emails")
+	records, err = db.Papers()
+	require.NoError(t, err)
+	require.Len(t, records, len(aggPapers))
+	r := records[0]
+	assert.Equal(t, p.Key(), r.Key, "first seen first")
+	assert.True(t, r.FirstSeen.Equal(imported))
+	assert.True(t, r.LastSeen.Equal(last), "last seen is kept")
+	assert.Equal(t, p.Title, r.Title, "the latest title is kept")
+	assert.Equal(t, p.Emails(), r.Emails)
+	assert.NotEmpty(t, r.Abstract)
+}
+
+func TestTrends(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db, err := OpenDB(filepath.Join(dir, "history.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	now := time.Date(2020, 3, 11, 12, 0, 0, 0, time.UTC) // Wednesday
+	msgs := gmailutils.ReadMsgFixturesJSON("../fixtures/unread.json")
+	alert := func(id string, date time.Time) *gmail.Message {
+		m := *msgs[0]
+		m.Id, m.InternalDate = id, date.UnixNano()/int64(time.Millisecond)
+		return &m
+	}
+	_, aggPapers := papers.ExtractAndAggPapersFromMsgs([]*gmail.Message{
+		alert("a", now.AddDate(0, 0, -14)),
+		alert("b", now.AddDate(0, 0, -1)),
+		alert("c", now),
+		alert("d", now.AddDate(0, 0, -70)), // too old
+	}, false, false)
+	_, other := papers.ExtractAndAggPapersFromMsgs(msgs[1:2], false, false)
+	require.NoError(t, db.Add(now, aggPapers, other))
+
+	trends, keywords, err := db.Trends(4, 0, now)
+	require.NoError(t, err)
+	require.Len(t, trends, len(aggPapers), "only the papers in several weeks")
+	for _, tr := range trends {
+		assert.Equal(t, []int{0, 1, 0, 2}, tr.Weeks, tr.Title)
+	}
+	assert.NotEmpty(t, keywords)
+	for _, k := range keywords {
+		assert.True(t, k.weeks() >= 2, k.Title)
+	}
+
+	_, phrases, err := db.Trends(4, 3, now)
+	require.NoError(t, err)
+	assert.NotEmpty(t, phrases)
+	assert.NotEqual(t, keywords, phrases, "keyphrases of the titles and abstracts")
+}
@@ -0,0 +1,79 @@
+package history
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportHeader is the header of the CSV, the DB is exported to.
+var exportHeader = []string{"key", "title", "url", "abstract", "emails", "runs", "first_seen", "last_seen", "first_email", "last_email", "msg_ids"}
+
+// ExportCSV writes all the papers in the DB as CSV \w a header, one paper per row, the first seen first.
+// Besides the counts and the times of the runs, every row has the dates of the first and the last emails,
+// mentioning the paper, and the space-separated IDs of all of them. Times are in RFC 3339, UTC.
+func (d *DB) ExportCSV(out io.Writer) error {
+	records, err := d.Papers()
+	if err != nil {
+		return err
+	}
+	sources, err := d.sources()
+	if err != nil {
+		return err
+	}
+
+	w := csv.NewWriter(out)
+	w.Write(exportHeader)
+	for _, r := range records {
+		s, ok := sources[r.Key]
+		if !ok { // e.g of an imported report
+			s = &paperSources{}
+		}
+		var first, last string
+		if len(s.dates) != 0 {
+			first, last = formatTime(s.dates[0]), formatTime(s.dates[len(s.dates)-1])
+		}
+		w.Write([]string{r.Key, r.Title, r.URL, r.Abstract, strconv.Itoa(r.Emails), strconv.Itoa(r.Runs),
+			formatTime(r.FirstSeen), formatTime(r.LastSeen), first, last, strings.Join(s.msgIDs, " ")})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// paperSources are the emails, mentioning a paper, the earliest first.
+type paperSources struct {
+	msgIDs []string
+	dates  []time.Time
+}
+
+// sources returns the emails of all the papers, by the key.
+func (d *DB) sources() (map[string]*paperSources, error) {
+	rows, err := d.db.Query(`SELECT paper_key, msg_id, date FROM sources ORDER BY paper_key, date, msg_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sources := map[string]*paperSources{}
+	for rows.Next() {
+		var key, id string
+		var date time.Time
+		if err := rows.Scan(&key, &id, &date); err != nil {
+			return nil, err
+		}
+		s, ok := sources[key]
+		if !ok {
+			s = &paperSources{}
+			sources[key] = s
+		}
+		s.msgIDs = append(s.msgIDs, id)
+		s.dates = append(s.dates, date)
+	}
+	return sources, rows.Err()
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,55 @@
+package history
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bzz/scholar-alert-digest/gmailutils"
+	"github.com/bzz/scholar-alert-digest/papers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportCSV(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db, err := OpenDB(filepath.Join(dir, "history.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	msgs := gmailutils.ReadMsgFixturesJSON("../fixtures/unread.json")
+	_, aggPapers := papers.ExtractAndAggPapersFromMsgs(msgs, false, false)
+	now := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, db.Add(now, aggPapers))
+	require.NoError(t, db.Add(now.AddDate(0, -1, 0), papers.AggPapers{
+		"Imported": &papers.Paper{Title: "Imported", URL: "http://example.com/imported"},
+	}))
+
+	var out bytes.Buffer
+	require.NoError(t, db.ExportCSV(&out))
+	rows, err := csv.NewReader(&out).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 1+len(aggPapers)+1)
+	assert.Equal(t, exportHeader, rows[0])
+
+	imported := rows[1]
+	assert.Equal(t, []string{"title:imported", "Imported", "http://example.com/imported", "", "0", "1",
+		"2020-02-01T00:00:00Z", "2020-02-01T00:00:00Z", "", "", ""}, imported, "no emails, first seen first")
+
+	for _, row := range rows[2:] {
+		p := aggPapers[row[1]]
+		require.NotNil(t, p, row[1])
+		assert.Equal(t, p.Key(), row[0])
+		assert.ElementsMatch(t, p.MsgIDs(), strings.Fields(row[10]))
+		assert.NotEmpty(t, row[8])
+		assert.True(t, row[8] <= row[9], "first email %s is before the last %s", row[8], row[9])
+	}
+}
@@ -0,0 +1,90 @@
+// Package history keeps track of the papers, reported in earlier digests.
+package history
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/bzz/scholar-alert-digest/fileutils"
+	"github.com/bzz/scholar-alert-digest/papers"
+)
+
+// Paper is a record of the paper, reported in a digest.
+type Paper struct {
+	Title     string
+	URL       string
+	FirstSeen time.Time
+}
+
+// Store is a persistent set of reported papers, by the paper Key, saved as a JSON file.
+type Store struct {
+	path   string
+	Papers map[string]*Paper
+}
+
+// Open reads the store from a given file. Missing file is an empty store.
+func Open(path string) (*Store, error) {
+	s := &Store{path, map[string]*Paper{}}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(&s.Papers); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Seen returns true if the paper was already reported.
+func (s *Store) Seen(p *papers.Paper) bool {
+	_, ok := s.Papers[p.Key()]
+	return ok
+}
+
+// MarkSeen sets Seen of the papers that were already reported.
+func (s *Store) MarkSeen(aggPapers papers.AggPapers) {
+	for _, p := range aggPapers {
+		p.Seen = s.Seen(p)
+	}
+}
+
+// SkipSeen returns only the papers that were not reported yet.
+func (s *Store) SkipSeen(aggPapers papers.AggPapers) papers.AggPapers {
+	unseen := papers.AggPapers{}
+	for title, p := range aggPapers {
+		if !s.Seen(p) {
+			unseen[title] = p
+		}
+	}
+	return unseen
+}
+
+// Add records the papers as reported at a given time, keeping the time of the first report
+// e.g when earlier reports are imported later.
+func (s *Store) Add(aggPapers papers.AggPapers, now time.Time) {
+	for _, p := range aggPapers {
+		if seen, ok := s.Papers[p.Key()]; ok {
+			if now.Before(seen.FirstSeen) {
+				seen.FirstSeen = now
+			}
+			continue
+		}
+		s.Papers[p.Key()] = &Paper{p.Title, p.URL, now}
+	}
+}
+
+// Save writes the store to the file it was opened from.
+func (s *Store) Save() error {
+	return fileutils.AtomicWrite(s.path, 0600, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s.Papers)
+	})
+}
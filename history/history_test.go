@@ -0,0 +1,56 @@
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bzz/scholar-alert-digest/papers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "seen.json")
+	s, err := Open(path)
+	require.NoError(t, err, "missing file is an empty store")
+	assert.Empty(t, s.Papers)
+
+	first := time.Date(2019, 12, 1, 0, 0, 0, 0, time.UTC)
+	s.Add(papers.AggPapers{
+		"Learning to represent programs with graphs": &papers.Paper{
+			Title: "Learning to represent programs with graphs", URL: "https://arxiv.org/abs/1711.00740", ID: "arxiv:1711.00740",
+		},
+		"code2vec": &papers.Paper{Title: "code2vec", URL: "https://dl.acm.org/1"},
+	}, first)
+	require.NoError(t, s.Save())
+
+	s, err = Open(path)
+	require.NoError(t, err)
+	assert.Len(t, s.Papers, 2)
+
+	unseen := s.SkipSeen(papers.AggPapers{
+		"Learning to Represent Programs with Graphs": &papers.Paper{Title: "Learning to Represent Programs with Graphs", ID: "arxiv:1711.00740"},
+		"Code2Vec":           &papers.Paper{Title: "Code2Vec"},
+		"Neural code search": &papers.Paper{Title: "Neural code search"},
+	})
+	assert.Equal(t, []string{"Neural code search"}, papers.SortedKeys(unseen))
+
+	seen := papers.AggPapers{"Code2Vec": &papers.Paper{Title: "Code2Vec"}, "Neural code search": &papers.Paper{Title: "Neural code search"}}
+	s.MarkSeen(seen)
+	assert.True(t, seen["Code2Vec"].Seen)
+	assert.False(t, seen["Neural code search"].Seen)
+
+	s.Add(papers.AggPapers{"code2vec": &papers.Paper{Title: "code2vec"}}, first.AddDate(0, 0, 7))
+	assert.Equal(t, first, s.Papers["title:code2vec"].FirstSeen, "first report time is kept")
+
+	earlier := first.AddDate(0, -1, 0)
+	s.Add(papers.AggPapers{"code2vec": &papers.Paper{Title: "code2vec"}}, earlier)
+	assert.Equal(t, earlier, s.Papers["title:code2vec"].FirstSeen, "an earlier imported report")
+}
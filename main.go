@@ -23,17 +23,32 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
+	"text/tabwriter"
+	"time"
 
+	"github.com/bzz/scholar-alert-digest/enrich"
+	"github.com/bzz/scholar-alert-digest/feedback"
+	"github.com/bzz/scholar-alert-digest/fileutils"
 	"github.com/bzz/scholar-alert-digest/gmailutils"
+	"github.com/bzz/scholar-alert-digest/history"
 	"github.com/bzz/scholar-alert-digest/papers"
+	"github.com/bzz/scholar-alert-digest/polite"
 	"github.com/bzz/scholar-alert-digest/templates"
 
 	"google.golang.org/api/gmail/v1"
@@ -42,22 +57,183 @@ import (
 const (
 	labelName = "[-oss-]-_ml-in-se" // "[ OSS ]/_ML-in-SE" in the Web UI
 
-	usageMessage = `usage: go run [-labels | -subj] [-html | -json] [-compact] [-mark] [-read] [-authors] [-refs] [-l <your-gmail-label>] [-n]
+	usageMessage = `usage: go run main.go [-dry-run] setup [<label>]
+       go run main.go [-dry-run] [-undo-log <path>] undo
+       go run main.go -db <path> [-weeks <n>] [-keywords <n>] trends
+       go run main.go [-seen <path>] [-db <path>] import <report>...
+       go run main.go -db <path> [-o <path>] export
+       go run [-labels | -subj] [-l <your-gmail-labels>] [-exclude-label <labels>] [-by-label] [-query <gmail-search>] [-after <date>] [-before <date>] [-newer-than <age>] [-max-age <age> [-mark-stale]] [-trash <age>] [-format <md|html|json|jsonl|ris|csv|atom|epub|org|latex|text>] [-o <path>] [-width <n>] [-compact | -full | -template <path>] [-toc] [-by-type] [-window <week|month>] [-by-topic [-topics <n>] [-embeddings <openai|ollama|url> [-embedding-model <name>]]] [-alert-stats] [-title <title>] [-description <text>] [-fields <date,emails,papers,uniq>] [-mark] [-archive] [-processed <label>] [-star <n> [-star-label <label>]] [-confirm] [-dry-run] [-read | -all] [-authors] [-refs] [-title-case <sentence|title>] [-seed <path>] [-like <titles|path>] [-dislike <titles|path>] [-feedback <path>] [-rank <weights>] [-enrich <sources>] [-mailto <email>] [-resolve] [-download-pdfs <dir>] [-user-agent <name>] [-proxy <url>] [-enrich-concurrency <n>] [-enrich-timeout <duration>] [-enrich-ttl <duration>] [-summarize <openai|ollama|url> [-summary-model <name>] [-summary-batch <n>]] [-lang <code> [-translate <libretranslate|deepl|url>]] [-preview-len <n>] [-min-count <n>] [-include <terms>] [-exclude <terms>] [-keywords <n> [-match-keywords]] [-allow-authors <names|path>] [-deny-authors <names|path>] [-venues <names|path>] [-exclude-venues <names|path>] [-block-domains <domains|path>] [-demote-domains <domains|path>] [-selectors <path>] [-skip-seen | -by-seen] [-seen <path>] [-diff <path>] [-db <path>] [-skip <ids|path>] [-skipped <path>] [-undo-log <path>] [-n] [-batch <n>] [-max <n>] [-quota <units>] [-cache <dir>] [-sync <path>] [-watch <topic> -subscription <name>] [-subject <regexp>] [-timeout <duration>] [-call-timeout <duration>]
 
 Polls Gmail API for unread Google Scholar alert messaged under a given label,
 aggregates by paper title and prints a list of paper URLs in Markdown format.
 
-The -l flag sets the Gmail label to look for (overriden by 'SAD_LABEL' env variable).
+The setup command creates a Gmail label (default "Scholar") and a filter, that adds it to the Google Scholar
+alert emails, as well as to all the earlier ones, so there is no need to configure them in Gmail settings.
+The undo command reverts all the changes in Gmail of the last run e.g marks the emails as unread again, after -mark.
+Changes of the last 10 runs are kept in the -undo-log file (default "undo.json"), so it may be repeated.
+The trends command prints the papers and the keywords of their titles, mentioned by the emails in the -db database
+in several of the last -weeks (default 8), \w the number of emails in every week. It does not access Gmail.
+If -keywords is set, the keywords are the keyphrases of the titles and abstracts instead.
+The import command records the papers of earlier Markdown or HTML reports in the -seen file and, if set, the -db,
+as reported at the date in the file name e.g 'digest-2020-03-02.md' or, if none, the file modification time.
+The export command writes all the papers in the -db as CSV, \w the counts, the times of the runs and the dates
+and IDs of the emails, to stdout or the -o file, for the analysis in other tools e.g pandas or DuckDB.
+
+The -l flag sets the Gmail label to look for (overriden by 'SAD_LABEL' env variable), "" for any label.
+Comma-separated labels e.g 'scholar-code,scholar-ml' are aggregated in a single report. A label may be a pattern
+e.g 'scholar/*' of all the labels under 'Scholar', where * matches any characters and ? a single one.
+The -exclude-label flag will skip messages \w any of the given comma-separated labels e.g 'ignored,advisor-only'.
+The -by-label flag will split papers in report sections by the label, instead of the alert type.
+The -query flag sets a Gmail search query to select messages by, in addition to the label
+e.g 'from:scholaralerts-noreply@google.com newer_than:7d'. With -l "" it replaces the label, so no Gmail filter is needed.
+The -after and -before flags only select messages, received after or before a given date e.g '2020-01-31',
+the -newer-than flag only those newer than a given number of days, months or years e.g '7d', '2m' or '1y'.
+The -max-age flag ignores messages, older than a given age, in the same format e.g '30d', at the time of every digest.
+The -mark-stale flag will mark these unread older messages as read in Gmail.
+The -trash flag will move read messages, older than a given age e.g '1y', to the trash in Gmail, at every digest,
+so the label does not grow over the years. Without a -l label, only the alerts from Google Scholar are trashed.
 The -n flag sets the number of concurent requests to Gmail API.
+The -batch flag sets the number of messages fetched in a single batch request to Gmail API (default 50, max 100),
+0 to fetch messages one by one, in -n concurent requests.
+The -max flag limits the number of messages, fetched in a single run, to the given number of the oldest ones,
+so a large backlog can be digested in chunks, together \w -mark.
+The -quota flag limits requests to Gmail API to a given number of quota units per second (default 250,
+the per-user limit), for users \w elevated quotas, 0 for no limit.
+The -cache flag sets a directory to keep the fetched messages in, so they are downloaded from Gmail only once
+(default is 'scholar-alert-digest' in the user cache directory e.g ~/.cache), "" to disable. The responses of
+the external services e.g of -enrich are cached in its "http" subdirectory, and the results of -enrich
+in its "enrich.json" file.
+The -sync flag sets a path to the file \w the state of incremental sync e.g 'sync.json'. After the first run,
+only the changes since the last run are requested from the Gmail history, instead of listing all the messages.
+The -watch flag keeps running and makes a new digest as soon as new messages arrive under the label, instead of
+polling. It registers Gmail push notifications to a given Cloud Pub/Sub topic e.g 'projects/<project>/topics/<topic>'
+and pulls them from the -subscription e.g 'projects/<project>/subscriptions/<subscription>'.
+Failed digests are logged and retried on the next notification, changes by the digest itself e.g -mark do not trigger
+a new one, and the -o report is not replaced by an empty one.
+The -subject flag will only fetch the messages \w a subject, matching a given regular expression e.g '(?i)citations'.
+Subjects are checked on the message metadata, before the whole messages are fetched.
+The -timeout flag limits the time of a digest, from fetching to marking the messages e.g '10m', 0 for no limit.
+The -call-timeout flag limits the time of every single request to Gmail API (default 1m), 0 for no limit.
+Interrupting \w Ctrl-C cancels all the requests in flight.
 The -labels flag will only print all available labels for the current account.
 The -subj flag will only include email subjects in the report. Usefull for " | uniq -c | sort -dr".
-The -html flag will produce ouput report in HTML format.
-The -json flag will produce output in JSONL format, one paper object per line.
-The -compact flag will produce ouput report in compact format, usefull >100 papers.
-The -mark flag will mark all the aggregated emails as read in Gmail.
+The -format flag sets the output format: 'md' (default), 'html', 'json' for a single JSON document \w run metadata,
+'jsonl' for one paper object per line, 'ris' for importing papers to reference managers e.g EndNote, Zotero or Mendeley,
+'csv' for spreadsheets, 'atom' for a feed reader, 'epub' for an e-reader, 'org' for Emacs org-mode,
+'latex' for a PDF archive or 'text' for plain text emails and pagers.
+The -o flag writes the report to a given file, instead of the standard output. The file is replaced atomically.
+Emails are modified in Gmail e.g by -mark only after the report is written, so they are not lost if it fails.
+The -width flag sets the column at which 'text' format wraps the lines.
+The -compact flag will produce a short report \w only paper titles, links and counts e.g for Slack.
+The -full flag will produce a long report \w paper authors, venue, year and the whole abstract.
+The -template flag sets a path to the custom Markdown/HTML report template, see docs/ for the available data.
+The -toc flag will include a table of contents, grouped by paper frequency, in Markdown/HTML report.
+The -by-type flag will split papers in report sections by the alert type: new citations, articles, related research or search results.
+Citing papers are grouped under each of the cited works.
+The -window flag will split papers in report sections by the calendar 'week' or 'month' of the earliest email,
+mentioning them, the earliest first, e.g to catch up after a vacation or for a monthly newsletter.
+The -by-topic flag will split papers in report sections by topic: clusters of the similar papers by the title
+and abstract, labeled by their most specific terms, the biggest first. The -topics flag sets the number of the topics
+(default 0, about the square root of a half of the papers). Papers are similar by TF-IDF, unless the -embeddings flag
+sets an OpenAI-compatible API of the embeddings, as -summarize does, and the -embedding-model flag sets its model
+(default 'text-embedding-3-small' of 'openai' and 'nomic-embed-text' of 'ollama'). Embeddings are cached as
+the results of -enrich.
+The -alert-stats flag will add a table of the number of emails and papers of every alert e.g a search query,
+and of the papers no other alert found, to Markdown/HTML report, to prune the low-signal alerts.
+The -title flag sets the report title, the -description flag adds a line of description under it.
+The -fields flag sets which metadata is shown in the report header, comma-separated (empty for none).
+The -mark flag will mark all the aggregated emails as read in Gmail. Emails, papers failed to be extracted from,
+are left as they are, to be retried in the next run.
+The -archive flag will archive all the aggregated emails in Gmail i.e remove them from the inbox.
+The -processed flag will add a given label e.g 'scholar-digest/processed' to all the aggregated emails in Gmail,
+to tell which alerts already were in a report, regardless of them being read. The label is created, if missing.
+The -star flag will star the emails, mentioning any paper that is in at least a given number of distinct emails,
+so the most alerted papers are easy to find in Gmail after the digest. The -star-label flag sets another label
+to add instead e.g 'IMPORTANT' or 'scholar-digest/top', created if missing.
+The -confirm flag will show the number of emails and papers in them and ask for a confirmation, before
+the changes in Gmail by -mark, -archive, -processed, -star, -mark-stale or -trash.
+The -dry-run flag will only log all the changes in Gmail, e.g by -mark, -archive or setup, instead of making them.
+Papers are not saved as seen, nor the -skip and failed messages as skipped.
 The -read flag will include a new section in the report, aggregating all read emails.
+The -all flag will aggregate read emails together \w the unread ones e.g to rebuild a digest for -after a date.
 The -authors flag will include paper authors in the report.
 The -refs flag will add links to all email messages that mention each paper.
+The -preview-len flag sets the length of the abstract preview in a collapsed summary, 0 for the whole abstract.
+The -min-count flag will only keep papers, mentioned in at least a given number of distinct emails.
+The -include flag will only keep papers that mention any of the given comma-separated terms in the title or abstract.
+The -exclude flag will drop papers that mention any of the given comma-separated terms in the title or abstract.
+The -keywords flag will extract a given number of the most salient keyphrases e.g 'neural code search' from
+the title and abstract of every paper and show them as tags in the report. The -match-keywords flag will match
+the terms of -include and -exclude in these keyphrases only, not anywhere in the title and abstract.
+The -allow-authors flag will highlight papers by any of the given authors and always keep them in the report.
+The -deny-authors flag will always drop papers by any of the given authors. Both take comma-separated names
+e.g 'Miltiadis Allamanis,M Monperrus' or a path to a file \w one name per line, and imply -authors.
+The -venues flag will only keep papers published in any of the given venues e.g 'ICSE,FSE,arXiv'.
+The -exclude-venues flag will drop papers published in any of the given venues or by the given publishers.
+Both take comma-separated names or a path to a file \w one name per line, and imply -authors.
+The -block-domains flag will drop papers \w links to any of the given domains, or their subdomains.
+The -demote-domains flag will list papers \w links to any of the given domains after all the others.
+Both take comma-separated domains e.g 'researchgate.net,academia.edu' or a path to a file \w one domain per line.
+The -seed flag sets a path to a BibTeX file or a directory of .txt/.md/.bib files \w the papers you liked,
+to sort papers by the TF-IDF similarity of their title and abstract to these, before the frequency.
+The -like and -dislike flags mark papers as interesting or not, by comma-separated titles or URLs,
+or a path to a file \w one per line. Marks are kept in the -feedback file (default "feedback.json") and, once
+there are both interesting and uninteresting papers, the digest is sorted by the probability of a paper to be
+interesting, as judged by a classifier trained on all the marks, before the frequency.
+The -rank flag sorts papers by a weighted mean of the frequency, recency of the first email, number of citations,
+of influential ones and the attention score (if known from the enrichment) and relevance (from -seed or the feedback)
+e.g 'freq=1,recency=0.5,citations=0.2,influential=0.2,attention=0.1'.
+The -enrich flag adds metadata of the papers from the comma-separated external services, in order:
+'crossref' adds the DOI, the date of the publication, the journal, the publisher and the number of citations,
+by the DOI in the URL or the same title, 'arxiv' replaces the title, authors and the abstract of papers on arXiv
+\w the full ones, adds the categories and links to the abstract page instead of the PDF, 'semanticscholar' adds
+the number of citations, of influential ones and the TLDR, by the DOI, the arXiv ID or the same title
+(set SAD_S2_API_KEY env var to a Semantic Scholar API key, for a higher rate limit), 'openalex' adds the DOI,
+the venue, the date of the publication, the concepts, the open access status and the number of citations,
+by the DOI, the arXiv ID or the same title, 'altmetric' adds the attention score in the news and social media,
+by the DOI or the arXiv ID (set SAD_ALTMETRIC_KEY env var to an Altmetric API key, for a higher rate limit).
+The -mailto flag sets a contact email, sent to the services that ask for one e.g Crossref or OpenAlex.
+The -resolve flag follows the redirects of the paper URLs e.g by Google or the link resolvers of the publishers,
+by HEAD requests, to link to the final URLs and merge the papers \w the same final URL or DOI in it.
+The -download-pdfs flag sets a directory to download the freely available PDFs of the papers in the digest to,
+named by the title: of the papers on arXiv, of the open access copies (from -enrich openalex) and the linked PDFs.
+Papers, that already have a PDF there, are skipped.
+The -user-agent flag sets the User-Agent of the requests of -enrich, -resolve and -download-pdfs. These requests
+are rate limited per host (a request per 3s to arXiv and per 1s to Semantic Scholar, as they ask), cached in
+the -cache directory for a day, and the ones to the web sites (not the APIs) respect robots.txt.
+The -proxy flag sets the URL of an HTTP(S) or SOCKS5 proxy e.g 'socks5://localhost:1080' for all the requests,
+to Gmail and the external services, instead of the one from HTTP_PROXY, HTTPS_PROXY and NO_PROXY env vars.
+The -enrich-concurrency flag sets the number of the papers, enriched by every service of -enrich or resolved by
+-resolve at the same time (default 4), and the -enrich-timeout flag sets the max duration of a single request
+of these (default 30s), including the wait for the rate limit of the host, 0 for no limit.
+The -enrich-ttl flag sets how long the results of -enrich and -resolve are kept in the "enrich.json" file
+of the -cache directory, by the DOI, arXiv ID or the title of the paper, so the same papers in the next digests
+are not looked up again (default 168h, a week), 0 to disable.
+The -summarize flag adds a one-sentence summary on why every paper matters, by its title and abstract, from an LLM
+behind an OpenAI-compatible API: 'openai' (set SAD_LLM_API_KEY env var to the API key), 'ollama' for a local
+Ollama server, or the URL of any other one e.g 'http://localhost:8080/v1'. The -summary-model flag sets the model
+(default 'gpt-4o-mini' of 'openai' and 'llama3.2' of 'ollama', required for the others) and the -summary-batch flag
+sets the number of the papers, summarized by a single request (default 10). Summaries are cached as the results
+of -enrich.
+The -lang flag sets the language of the reader e.g 'en', papers \w abstracts in other languages are annotated
+by the original language e.g 'es' in Markdown/HTML report. The -translate flag will translate these abstracts
+to the -lang by a LibreTranslate API: 'libretranslate' (set SAD_TRANSLATE_API_KEY env var to the API key)
+or the URL of a self-hosted one e.g 'http://localhost:5000', or by 'deepl' (the key of the free plan) or the URL
+of another DeepL API e.g 'https://api.deepl.com/v2'. Translations are cached as the results of -enrich.
+The -title-case flag will convert paper titles to a consistent 'sentence' or 'title' case, for display.
+The -selectors flag sets a path to the JSON file \w XPath expressions, overriding the ones used to extract
+paper "title", "url", "authors" and "abstract" from the emails, in case Google changes the alert markup.
+The -skip-seen flag will not include papers that were already reported by earlier runs \w this flag,
+that are recorded in a file, set by the -seen flag.
+The -by-seen flag will split papers in Markdown/HTML report sections of the new ones and the ones, still unread
+but already reported by earlier runs, to focus on what changed since the last digest.
+The -diff flag sets a path to an earlier Markdown/HTML report, to only include the papers that were added since it
+and the ones that were removed, in two sections.
+The -db flag sets a path to the SQLite database, all the aggregated papers are recorded in at every run
+\w the number of emails and the time they were first and last seen, to be queried \w SQL.
+The -skip flag excludes messages by comma-separated IDs or a path to a file \w one ID per line, from this and
+all the future digests. They are kept in the -skipped file (default "skipped.json"), together \w the messages that
+failed to be parsed 3 times, that are not fetched any more either.
 The -upd-test flag will write emails to ./fixtures/emails.json and quit.
 `
 )
@@ -65,19 +241,104 @@ The -upd-test flag will write emails to ./fixtures/emails.json and quit.
 var (
 	user = "me" // TODO(bzz): move to const in gmailutils
 
-	gmailLabel = flag.String("l", labelName, "name of the Gmail label")
-	listLabels = flag.Bool("labels", false, "list all Gmail labels")
-	// TODO(bzz): a format flag \w validated md/html/json options would be better
-	outputHTML = flag.Bool("html", false, "output report in HTML (instead of default Markdown)")
-	outputJSON = flag.Bool("json", false, "output report data in JSON")
-	compact    = flag.Bool("compact", false, "output report in compact format (>100 papers)")
-	markRead   = flag.Bool("mark", false, "marks all aggregated emails as read")
-	read       = flag.Bool("read", false, "include read emails to a separate section of the report")
-	authors    = flag.Bool("authors", false, "include paper authors in the report")
-	refs       = flag.Bool("refs", false, "include orignin references to Gmail messages in report")
-	onlySubj   = flag.Bool("subj", false, "aggregate only email subjects")
-	concurReq  = flag.Int("n", 10, "number of concurent Gmail API requests")
-	updTest    = flag.Bool("upd-test", false, "save all emails to ./fixtures/*, to be used with the -test later")
+	dateTerms string        // Gmail search terms of the -after, -before and -newer-than dates
+	maxAge    time.Duration // messages, older than that, are ignored
+	trashAge  time.Duration // read messages, older than that, are trashed
+
+	gmailLabel  = flag.String("l", labelName, "name of the Gmail label, or comma-separated names")
+	exclLabels  = flag.String("exclude-label", "", "comma-separated names of Gmail labels, messages with which are skipped")
+	byLabel     = flag.Bool("by-label", false, "split papers in Markdown/HTML report sections by the Gmail label")
+	gmailQuery  = flag.String("query", "", "Gmail search query to select messages, in addition to the label")
+	after       = flag.String("after", "", "only select messages, received after a date YYYY-MM-DD")
+	before      = flag.String("before", "", "only select messages, received before a date YYYY-MM-DD")
+	maxAgeFlag  = flag.String("max-age", "", "ignore messages, older than a number of days, months or years e.g 30d")
+	markStale   = flag.Bool("mark-stale", false, "mark unread messages, older than the -max-age, as read")
+	trash       = flag.String("trash", "", "move read messages, older than a number of days, months or years e.g 1y, to the trash")
+	newer       = flag.String("newer-than", "", "only select messages, newer than a number of days, months or years e.g 7d")
+	listLabels  = flag.Bool("labels", false, "list all Gmail labels")
+	format      = flag.String("format", "md", "output format: "+strings.Join(templates.Formats(), ", "))
+	outFile     = flag.String("o", "", "path to a file to write the report to, instead of the standard output")
+	width       = flag.Int("width", 80, "wrap lines of plain text report at the given column")
+	compact     = flag.Bool("compact", false, "output only paper titles, links and counts")
+	full        = flag.Bool("full", false, "output all paper details: authors, venue, year and the whole abstract")
+	tmplFile    = flag.String("template", "", "path to a custom Markdown/HTML report template")
+	toc         = flag.Bool("toc", false, "include a table of contents in Markdown/HTML report")
+	byType      = flag.Bool("by-type", false, "split papers in Markdown/HTML report sections by the alert type")
+	byTopic     = flag.Bool("by-topic", false, "split papers in Markdown/HTML report sections by topic, the clusters of similar papers")
+	topics      = flag.Int("topics", 0, "number of the topics of -by-topic, 0 for the square root of a half of the papers")
+	embeddings  = flag.String("embeddings", "", "OpenAI-compatible API of the embeddings of -by-topic: openai, ollama or its URL, instead of TF-IDF")
+	embedModel  = flag.String("embedding-model", "", "model of the -embeddings API, the default one of openai and ollama if empty")
+	window      = flag.String("window", "", "split papers in Markdown/HTML report sections by the week or month: "+strings.Join(templates.Windows, ", "))
+	alertStats  = flag.Bool("alert-stats", false, "add a table of the papers by the alert to Markdown/HTML report")
+	title       = flag.String("title", templates.DefaultTitle, "report title")
+	descr       = flag.String("description", "", "report description, under the title")
+	fields      = flag.String("fields", strings.Join(templates.Fields, ","), "comma-separated metadata fields of the report header")
+	markRead    = flag.Bool("mark", false, "marks all successfully aggregated emails as read")
+	processed   = flag.String("processed", "", "name of a Gmail label to add to all aggregated emails")
+	archive     = flag.Bool("archive", false, "archives all aggregated emails, removing them from the inbox")
+	starMin     = flag.Int("star", 0, "star the emails of papers, mentioned in at least a given number of emails, 0 to disable")
+	starLabel   = flag.String("star-label", "STARRED", "name of a Gmail label to add by -star, instead of a star")
+	confirm     = flag.Bool("confirm", false, "ask for a confirmation before modifying the emails in Gmail")
+	dryRun      = flag.Bool("dry-run", false, "do not modify anything in Gmail, only log the changes")
+	allMsgs     = flag.Bool("all", false, "aggregate read messages together with the unread ones")
+	read        = flag.Bool("read", false, "include read emails to a separate section of the report")
+	authors     = flag.Bool("authors", false, "include paper authors in the report")
+	refs        = flag.Bool("refs", false, "include orignin references to Gmail messages in report")
+	previewLen  = flag.Int("preview-len", papers.PreviewLen, "approximate length of the abstract preview, in characters")
+	minCount    = flag.Int("min-count", 0, "only report papers, mentioned in at least a given number of distinct emails")
+	include     = flag.String("include", "", "comma-separated terms, only papers mentioning any of them are reported")
+	exclude     = flag.String("exclude", "", "comma-separated terms, papers mentioning any of them are not reported")
+	keywords    = flag.Int("keywords", 0, "number of the keyphrases of every paper, shown as tags in the report, 0 for none")
+	matchKeys   = flag.Bool("match-keywords", false, "match -include and -exclude terms in the -keywords of the papers only")
+	allowAuth   = flag.String("allow-authors", "", "comma-separated authors or a file, papers by them are highlighted and always reported")
+	denyAuth    = flag.String("deny-authors", "", "comma-separated authors or a file, papers by them are never reported")
+	venues      = flag.String("venues", "", "comma-separated venues or a file, only papers published in them are reported")
+	exclVenues  = flag.String("exclude-venues", "", "comma-separated venues/publishers or a file, papers published in them are not reported")
+	blockDoms   = flag.String("block-domains", "", "comma-separated domains or a file, papers linking to them are not reported")
+	demoteDoms  = flag.String("demote-domains", "", "comma-separated domains or a file, papers linking to them are listed last")
+	seed        = flag.String("seed", "", "path to a BibTeX file or a directory with liked papers, to sort papers by relevance to them")
+	like        = flag.String("like", "", "comma-separated titles/URLs or a file, marks papers as interesting")
+	dislike     = flag.String("dislike", "", "comma-separated titles/URLs or a file, marks papers as not interesting")
+	fbFile      = flag.String("feedback", "feedback.json", "path to a file with papers, marked as interesting or not")
+	rank        = flag.String("rank", "", "comma-separated weights of freq, recency, citations, influential, attention and relevance, to sort papers by")
+	enrichSrc   = flag.String("enrich", "", "comma-separated services to add metadata of the papers from: "+strings.Join(enrich.Sources(), ", "))
+	mailto      = flag.String("mailto", "", "contact email, sent to the services of -enrich that ask for one")
+	resolve     = flag.Bool("resolve", false, "follow redirects of the paper URLs to the final ones, merging the same papers")
+	pdfDir      = flag.String("download-pdfs", "", "directory to download the free PDFs of the papers in the digest to")
+	enrichConc  = flag.Int("enrich-concurrency", enrich.Concurrency, "number of the papers, enriched or resolved at the same time")
+	enrichTmout = flag.Duration("enrich-timeout", enrich.DefaultTimeout, "max duration of a request of -enrich, -resolve or -download-pdfs, 0 for no limit")
+	enrichTTL   = flag.Duration("enrich-ttl", enrich.DefaultCacheTTL, "max age of the cached results of -enrich and -resolve, 0 to disable")
+	summarize   = flag.String("summarize", "", "add LLM summaries of the papers from an OpenAI-compatible API: openai, ollama or its URL")
+	summModel   = flag.String("summary-model", "", "model of the -summarize API, the default one of openai and ollama if empty")
+	summBatch   = flag.Int("summary-batch", enrich.DefaultSummaryBatch, "number of the papers, summarized by a single request")
+	lang        = flag.String("lang", "", "ISO 639-1 code of the language of the reader e.g en, other abstracts are annotated by their language")
+	translate   = flag.String("translate", "", "translate the abstracts to the -lang by a translation API: libretranslate, deepl or its URL")
+	proxy       = flag.String("proxy", "", "URL of the HTTP(S) or SOCKS5 proxy of all the requests, instead of HTTP(S)_PROXY env vars")
+	userAgent   = flag.String("user-agent", polite.DefaultUserAgent, "User-Agent of the requests to the external services and web sites")
+	titleCase   = flag.String("title-case", "", "convert paper titles to a given case: "+strings.Join(papers.TitleCases, ", "))
+	selectors   = flag.String("selectors", "", "path to a JSON file with XPath overrides for paper extraction")
+	skipSeen    = flag.Bool("skip-seen", false, "skip papers, already reported in earlier digests")
+	bySeen      = flag.Bool("by-seen", false, "split papers in Markdown/HTML report sections of the new and already reported ones")
+	diffFile    = flag.String("diff", "", "path to an earlier Markdown/HTML report, to only include the added and removed papers")
+	seenFile    = flag.String("seen", "seen.json", "path to a file with papers, reported in earlier digests")
+	dbFile      = flag.String("db", "", "path to a SQLite database to record all the aggregated papers in")
+	weeks       = flag.Int("weeks", 8, "number of the last weeks, the trends command reports")
+	skipMsgs    = flag.String("skip", "", "comma-separated message IDs or a file, excludes the messages from all the future runs")
+	skipFile    = flag.String("skipped", "skipped.json", "path to a file with messages, excluded or failed to be parsed")
+	undoFile    = flag.String("undo-log", "undo.json", "path to a file with the changes in Gmail of the last runs, to undo")
+	onlySubj    = flag.Bool("subj", false, "aggregate only email subjects")
+	concurReq   = flag.Int("n", 10, "number of concurent Gmail API requests")
+	maxMsgs     = flag.Int("max", 0, "max number of messages to fetch, the oldest ones, 0 for no limit")
+	batchSize   = flag.Int("batch", 50, "number of messages in a Gmail API batch request, 0 to fetch one by one")
+	watchTopic  = flag.String("watch", "", "Pub/Sub topic for Gmail push notifications, to make a new digest on new messages")
+	watchSub    = flag.String("subscription", "", "Pub/Sub pull subscription to the -watch topic")
+	quota       = flag.Int("quota", gmailutils.DefaultQuota, "Gmail API quota units per second, 0 for no limit")
+	cacheDir    = flag.String("cache", gmailutils.DefaultCacheDir(), "directory to cache fetched messages and responses of the external services in, empty to disable")
+	syncFile    = flag.String("sync", "", "path to a file with the state of incremental sync, to only fetch the changes since the last run")
+	subject     = flag.String("subject", "", "regular expression, only messages with a matching subject are fetched")
+	timeout     = flag.Duration("timeout", 0, "max duration of a digest, 0 for no limit")
+	callTmout   = flag.Duration("call-timeout", gmailutils.CallTimeout, "max duration of a Gmail API request, 0 for no limit")
+	updTest     = flag.Bool("upd-test", false, "save all emails to ./fixtures/*, to be used with the -test later")
 )
 
 func usage() {
@@ -89,14 +350,231 @@ func main() {
 	flag.Usage = usage
 	flag.Parse()
 
-	client := gmailutils.NewClient(*markRead)
+	if *full || *allowAuth != "" || *denyAuth != "" || *venues != "" || *exclVenues != "" {
+		*authors = true
+	}
+	r := newRenderer()
+
+	papers.PreviewLen = *previewLen
+	if *selectors != "" {
+		s, err := papers.ReadSelectors(*selectors)
+		if err != nil {
+			log.Fatalf("Unable to read selectors: %v", err)
+		}
+		papers.UseSelectors(s)
+	}
+	var scorers []papers.Scorer
+	if *seed != "" {
+		corpus, err := papers.ReadCorpus(*seed)
+		if err != nil {
+			log.Fatalf("Unable to read seed papers: %v", err)
+		}
+		scorers = append(scorers, corpus)
+	}
+	var weights *papers.Weights
+	if *rank != "" {
+		w, err := papers.ParseWeights(*rank)
+		if err != nil {
+			log.Fatalf("Invalid -rank: %v", err)
+		}
+		weights = &w
+	}
+	if *proxy != "" {
+		if err := polite.SetProxy(*proxy); err != nil {
+			log.Fatalf("Invalid -proxy: %v", err)
+		}
+	}
+	// all the requests to the external services and web sites share the limits, robots.txt and the cache
+	politeOpts := polite.Options{UserAgent: *userAgent, Mailto: *mailto, Intervals: enrich.Intervals()}
+	if *cacheDir != "" {
+		politeOpts.CacheDir = filepath.Join(*cacheDir, "http")
+	}
+	web, err := polite.New(politeOpts)
+	if err != nil {
+		log.Fatalf("Unable to create a cache in %s: %v", politeOpts.CacheDir, err)
+	}
+	enrich.Concurrency = *enrichConc
+	apiClient := web.Client(&http.Client{Timeout: *enrichTmout})
+	crawlerClient := web.Crawler(&http.Client{Timeout: *enrichTmout})
+
+	var results *enrich.Cache
+	if *cacheDir != "" && *enrichTTL > 0 {
+		path := filepath.Join(*cacheDir, "enrich.json")
+		if results, err = enrich.OpenCache(path, *enrichTTL); err != nil {
+			log.Fatalf("Unable to read the cache of enrichments from %s: %v", path, err)
+		}
+	}
+
+	var enrichers []enrich.Enricher
+	if *enrichSrc != "" {
+		if enrichers, err = enrich.New(strings.Split(*enrichSrc, ","), enrich.Options{
+			Client:             apiClient,
+			Mailto:             *mailto,
+			Cache:              results,
+			SemanticScholarKey: os.Getenv("SAD_S2_API_KEY"),
+			AltmetricKey:       os.Getenv("SAD_ALTMETRIC_KEY"),
+		}); err != nil {
+			log.Fatalf("Invalid -enrich: %v", err)
+		}
+	}
+	var summarizer *enrich.Summarizer
+	if *summarize != "" {
+		if summarizer, err = enrich.NewSummarizer(enrich.LLMOptions{
+			Endpoint: *summarize,
+			Model:    *summModel,
+			APIKey:   os.Getenv("SAD_LLM_API_KEY"),
+			Batch:    *summBatch,
+			Client:   web.Client(&http.Client{Timeout: enrich.DefaultLLMTimeout}),
+			Cache:    results,
+		}); err != nil {
+			log.Fatalf("Invalid -summarize: %v", err)
+		}
+	}
+	var embedder *enrich.Embedder
+	if *embeddings != "" {
+		if embedder, err = enrich.NewEmbedder(enrich.LLMOptions{
+			Endpoint: *embeddings,
+			Model:    *embedModel,
+			APIKey:   os.Getenv("SAD_LLM_API_KEY"),
+			Client:   web.Client(&http.Client{Timeout: enrich.DefaultLLMTimeout}),
+			Cache:    results,
+		}); err != nil {
+			log.Fatalf("Invalid -embeddings: %v", err)
+		}
+	}
+	var translator *enrich.Translator
+	if *translate != "" {
+		if *lang == "" {
+			log.Fatalf("-translate requires a -lang to translate to")
+		}
+		if translator, err = enrich.NewTranslator(enrich.TranslatorOptions{
+			Endpoint: *translate,
+			APIKey:   os.Getenv("SAD_TRANSLATE_API_KEY"),
+			Target:   *lang,
+			Client:   apiClient,
+			Cache:    results,
+		}); err != nil {
+			log.Fatalf("Invalid -translate: %v", err)
+		}
+	}
+	var resolver *enrich.Resolver
+	if *resolve {
+		resolver = enrich.NewResolver(enrich.Options{Client: crawlerClient, Cache: results})
+	}
+	fb, err := feedback.Open(*fbFile)
+	if err != nil {
+		log.Fatalf("Unable to read feedback from %s: %v", *fbFile, err)
+	}
+	skipList, err := gmailutils.OpenSkipList(*skipFile)
+	if err != nil {
+		log.Fatalf("Unable to read skipped messages from %s: %v", *skipFile, err)
+	}
+	if *skipMsgs != "" { // saved only by the digest, below
+		skipList.Exclude(readList(*skipMsgs)...)
+	}
+
+	if flag.Arg(0) == "trends" {
+		if *dbFile == "" {
+			log.Fatalf("trends requires a -db to read the papers from")
+		}
+		if err := printTrends(*dbFile, *weeks, *keywords); err != nil {
+			log.Fatalf("Unable to read trends from %s: %v", *dbFile, err)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "export" {
+		if *dbFile == "" {
+			log.Fatalf("export requires a -db to read the papers from")
+		}
+		if err := exportHistory(*dbFile, *outFile); err != nil {
+			log.Fatalf("Unable to export papers from %s: %v", *dbFile, err)
+		}
+		return
+	}
+	if flag.Arg(0) == "import" {
+		if flag.NArg() < 2 {
+			log.Fatalf("import requires the paths of the reports")
+		}
+		if err := importReports(flag.Args()[1:]); err != nil {
+			log.Fatalf("Unable to import reports: %v", err)
+		}
+		return
+	}
+
+	ctx := interruptible(context.Background())
+	gmailutils.Quota = *quota
+	gmailutils.CallTimeout = *callTmout
+	gmailutils.DryRun = *dryRun
+	var extraScopes []string
+	setup, undo := flag.Arg(0) == "setup", flag.Arg(0) == "undo"
+	if setup && !*dryRun {
+		extraScopes = append(extraScopes, gmail.GmailSettingsBasicScope)
+	}
+	if *watchTopic != "" {
+		if *watchSub == "" {
+			log.Fatalf("-watch requires a -subscription to pull the notifications from")
+		}
+		extraScopes = append(extraScopes, gmailutils.PubSubScope)
+	}
+	client := gmailutils.NewClient(!*dryRun && (*markRead || *archive || *processed != "" || *starMin > 0 || *markStale || *trash != "" || setup || undo), extraScopes...)
 	srv, err := gmail.New(client)
 	if err != nil {
 		log.Fatalf("Unable to create a Gmail client: %v", err)
 	}
+	fetcher := &gmailutils.Fetcher{Srv: srv, Client: client, User: user, Concurrency: *concurReq, BatchSize: *batchSize, Max: *maxMsgs, Skip: skipList.Skip}
+	if *cacheDir != "" {
+		fetcher.Cache, err = gmailutils.NewCache(*cacheDir)
+		if err != nil {
+			log.Fatalf("Unable to create a cache in %s: %v", *cacheDir, err)
+		}
+	}
+	if *subject != "" {
+		re, err := regexp.Compile(*subject)
+		if err != nil {
+			log.Fatalf("Invalid -subject: %v", err)
+		}
+		fetcher.Keep = func(m *gmail.Message) bool {
+			return re.MatchString(gmailutils.Subject(m.Payload))
+		}
+	}
+
+	if setup {
+		name := "Scholar"
+		if flag.NArg() > 1 {
+			name = flag.Arg(1)
+		}
+		label, err := gmailutils.Setup(ctx, srv, user, name)
+		if err != nil {
+			log.Fatalf("Unable to set up the label: %v", err)
+		}
+		fmt.Printf("Done, use it with: go run main.go -l '%s'\n", gmailutils.SearchName(label.Name))
+		os.Exit(0)
+	}
+
+	undoLog, err := gmailutils.OpenUndoLog(*undoFile)
+	if err != nil {
+		log.Fatalf("Unable to read the changes to undo from %s: %v", *undoFile, err)
+	}
+	if undo {
+		run := undoLog.Pop()
+		if run == nil {
+			log.Fatalf("Nothing to undo in %s", *undoFile)
+		}
+		if failed := run.Undo(ctx, srv, user); len(failed) != 0 {
+			log.Fatalf("Unable to undo the changes of %d messages", len(failed))
+		}
+		if !*dryRun {
+			if err := undoLog.Save(); err != nil {
+				log.Fatalf("Unable to save the changes to undo to %s: %v", *undoFile, err)
+			}
+		}
+		fmt.Printf("Done, changes of the run at %s are reverted\n", run.Time.Format("2006-01-02 15:04"))
+		os.Exit(0)
+	}
 
 	if *listLabels {
-		labels := gmailutils.PrintAllLabels(srv, user)
+		labels := gmailutils.PrintAllLabels(ctx, srv, user)
 		if *updTest {
 			saveLabels("./fixtures/labels.json", labels)
 		}
@@ -107,15 +585,45 @@ func main() {
 	if envLabel, ok := os.LookupEnv("SAD_LABEL"); ok {
 		gmailLabel = &envLabel
 	}
+	if dateTerms, err = gmailutils.DateQuery(*after, *before, *newer); err != nil {
+		log.Fatalf("Invalid date range: %v", err)
+	}
+	if *maxAgeFlag != "" {
+		if maxAge, err = gmailutils.ParseAge(*maxAgeFlag); err != nil {
+			log.Fatalf("Invalid -max-age: %v", err)
+		}
+	} else if *markStale {
+		log.Fatalf("-mark-stale requires a -max-age")
+	}
+	if *matchKeys && *keywords <= 0 {
+		log.Fatalf("-match-keywords requires -keywords")
+	}
+	if *trash != "" {
+		if trashAge, err = gmailutils.ParseAge(*trash); err != nil {
+			log.Fatalf("Invalid -trash: %v", err)
+		}
+	}
+	if gmailutils.IsGlob(*gmailLabel) { // expand to all the matching labels
+		labels, err := gmailutils.FindLabels(ctx, srv, user, labelNames(*gmailLabel)...)
+		if err != nil {
+			log.Fatalf("Unable to find the label: %v", err)
+		}
+		var names []string
+		for _, l := range labels {
+			names = append(names, gmailutils.SearchName(l.Name))
+		}
+		log.Printf("%d labels found: %s", len(names), strings.Join(names, ", "))
+		*gmailLabel = strings.Join(names, ",")
+	}
 
 	if *onlySubj {
 		log.Print("only extracting the subjects from scholar emails")
-		query := fmt.Sprintf("label:%s from:scholaralerts-noreply is:unread", *gmailLabel)
-		if *read {
+		query := searchQuery("from:scholaralerts-noreply is:unread")
+		if *read || *allMsgs {
 			query = strings.TrimSuffix(query, " is:unread")
 		}
 
-		msgs, err := gmailutils.FetchConcurent(context.Background(), srv, user, query, *concurReq)
+		msgs, err := fetcher.Fetch(ctx, query)
 		if err != nil {
 			log.Fatalf("Failed to fetch messages from Gmail: %v", err)
 		}
@@ -124,58 +632,826 @@ func main() {
 		os.Exit(0)
 	}
 
+	if *skipMsgs != "" {
+		if *dryRun {
+			log.Printf("excluding the -skip messages from this run only, not saved to %s", *skipFile)
+		} else if err := skipList.Save(); err != nil {
+			log.Fatalf("Unable to save skipped messages to %s: %v", *skipFile, err)
+		}
+	}
+
 	// fetch messages, extract papers, aggregated by title
 	// TODO(bzz): FetchAsync returning chan *gmail.Message?
-	urMsgs, err := gmailutils.FetchConcurent(context.Background(), srv, user, fmt.Sprintf("label:%s is:unread", *gmailLabel), *concurReq)
+	var syncStore *gmailutils.SyncStore
+	var labels []*gmail.Label
+	var labelIDs, exclLabelIDs []string
+	if *syncFile != "" {
+		if *gmailQuery != "" || dateTerms != "" || maxAge != 0 || *gmailLabel == "" {
+			log.Fatalf("-sync only works with a -l label and without a -query or dates, as changes are tracked by labels")
+		}
+		if syncStore, err = gmailutils.OpenSyncStore(*syncFile); err != nil {
+			log.Fatalf("Unable to read sync state from %s: %v", *syncFile, err)
+		}
+	}
+	if (*syncFile != "" || *watchTopic != "" || *byLabel) && *gmailLabel != "" {
+		if labels, err = gmailutils.FindLabels(ctx, srv, user, labelNames(*gmailLabel)...); err != nil {
+			log.Fatalf("Unable to find the label: %v", err)
+		}
+		for _, l := range labels {
+			labelIDs = append(labelIDs, l.Id)
+		}
+	}
+	if *syncFile != "" && *exclLabels != "" {
+		excluded, err := gmailutils.FindLabels(ctx, srv, user, labelNames(*exclLabels)...)
+		if err != nil {
+			log.Fatalf("Unable to find the excluded label: %v", err)
+		}
+		for _, l := range excluded {
+			exclLabelIDs = append(exclLabelIDs, l.Id)
+		}
+	}
+	if *byLabel {
+		r = newRenderer(labels...)
+	}
+	historyLabelID := "" // history of all the labels, if there are many
+	if len(labelIDs) == 1 {
+		historyLabelID = labelIDs[0]
+	}
+	// fetch returns messages, matching the query, incrementally if -sync
+	fetch := func(ctx context.Context, query string, match func([]string) bool) ([]*gmail.Message, error) {
+		if syncStore == nil {
+			return fetcher.Fetch(ctx, query)
+		}
+		msgs, err := fetcher.Sync(ctx, syncStore, query, historyLabelID, match)
+		if err == nil {
+			err = syncStore.Save()
+		}
+		return msgs, err
+	}
+
+	var processedID string
+	if *processed != "" {
+		label, err := gmailutils.CreateLabel(ctx, srv, user, *processed)
+		if err != nil {
+			log.Fatalf("Unable to create the -processed label: %v", err)
+		}
+		processedID = label.Id
+	}
+	var starID string
+	if *starMin > 0 {
+		label, err := gmailutils.CreateLabel(ctx, srv, user, *starLabel)
+		if err != nil {
+			log.Fatalf("Unable to create the -star-label: %v", err)
+		}
+		starID = label.Id
+	}
+
+	// unread messages are aggregated, or all of them if -all
+	unread, unreadMatch := "is:unread", gmailutils.HasLabels([]string{"UNREAD"}, exclLabelIDs...)
+	if *allMsgs {
+		if *read {
+			log.Fatalf("Only one of -all or -read can be used")
+		}
+		unread, unreadMatch = "", gmailutils.HasLabels(nil, exclLabelIDs...)
+	}
+
+	// digest fetches messages, extracts papers and renders them, within the -timeout
+	digest := func(ctx context.Context) error {
+		if *timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, *timeout)
+			defer cancel()
+		}
+
+		// changes in Gmail, to undo, are saved right after they are made, as any later failure exits
+		run := &gmailutils.Run{Time: time.Now()}
+		if *markStale {
+			err := markStaleRead(ctx, fetcher, run, time.Now().Add(-maxAge))
+			saveRun(undoLog, run)
+			if err != nil {
+				return err
+			}
+		}
+		if trashAge != 0 {
+			err := trashOld(ctx, fetcher, run, time.Now().Add(-trashAge))
+			saveRun(undoLog, run)
+			if err != nil {
+				return err
+			}
+		}
+		urMsgs, err := fetch(ctx, searchQuery(unread), gmailutils.HasAnyLabel(labelIDs, unreadMatch))
+		if err != nil {
+			return fmt.Errorf("unable to fetch messages from Gmail: %v", err)
+		}
+		var rMsgs []*gmail.Message
+		if *read {
+			rMsgs, err = fetch(ctx, searchQuery("is:read"), gmailutils.HasAnyLabel(labelIDs, gmailutils.HasLabels(nil, append(exclLabelIDs, "UNREAD")...)))
+			if err != nil {
+				return fmt.Errorf("unable to fetch messages from Gmail: %v", err)
+			}
+		}
+		if *updTest { // as fetched, before any enrichment
+			saveEmails("./fixtures/unread.json", urMsgs)
+			saveEmails("./fixtures/read.json", rMsgs)
+			return nil
+		}
+		unreadStats, unreadPapers, err := papers.ExtractAndAggPapersContext(ctx, urMsgs, *authors, *refs)
+		if err != nil {
+			return fmt.Errorf("unable to extract papers: %v", err)
+		}
+		if resolver != nil {
+			if unreadPapers, err = resolver.URLs(ctx, unreadPapers); err != nil {
+				return fmt.Errorf("unable to resolve paper URLs: %v", err)
+			}
+		}
+		aggregated := []papers.AggPapers{unreadPapers} // before filtering, for the -db
+		unreadPapers = filterPapers(unreadPapers)
+
+		var seen *history.Store
+		if *skipSeen || *bySeen {
+			seen, err = history.Open(*seenFile)
+			if err != nil {
+				return fmt.Errorf("unable to read seen papers from %s: %v", *seenFile, err)
+			}
+		}
+		if *skipSeen {
+			n := len(unreadPapers)
+			unreadPapers = seen.SkipSeen(unreadPapers)
+			log.Printf("skipping %d papers, seen in earlier digests", n-len(unreadPapers))
+		} else if *bySeen {
+			seen.MarkSeen(unreadPapers)
+		}
+
+		readStats := &papers.Stats{}
+		var readPapers papers.AggPapers
+		if *read {
+			readStats, readPapers, err = papers.ExtractAndAggPapersContext(ctx, rMsgs, *authors, *refs)
+			if err != nil {
+				return fmt.Errorf("unable to extract papers: %v", err)
+			}
+			if resolver != nil {
+				if readPapers, err = resolver.URLs(ctx, readPapers); err != nil {
+					return fmt.Errorf("unable to resolve paper URLs: %v", err)
+				}
+			}
+			aggregated = append(aggregated, readPapers)
+			readPapers = filterPapers(readPapers)
+		}
+
+		if err := enrich.Papers(ctx, enrichers, unreadPapers, readPapers); err != nil {
+			return fmt.Errorf("unable to enrich papers: %v", err)
+		}
+		if *lang != "" { // after the enrichment, that may add the abstracts
+			papers.DetectLanguages(unreadPapers, *lang)
+			papers.DetectLanguages(readPapers, *lang)
+		}
+		if translator != nil { // before the summaries and keywords, to be in the same language
+			if err := translator.Papers(ctx, unreadPapers, readPapers); err != nil {
+				return fmt.Errorf("unable to translate abstracts: %v", err)
+			}
+		}
+		if summarizer != nil {
+			if err := summarizer.Papers(ctx, unreadPapers, readPapers); err != nil {
+				return fmt.Errorf("unable to summarize papers: %v", err)
+			}
+		}
+		if *keywords > 0 { // again, as the enrichment may add the abstracts
+			papers.ExtractKeywords(unreadPapers, *keywords)
+			papers.ExtractKeywords(readPapers, *keywords)
+		}
+		if *byTopic {
+			var vectors map[string][]float64 // of TF-IDF, unless set
+			if embedder != nil {
+				if vectors, err = embedder.Papers(ctx, unreadPapers); err != nil {
+					return fmt.Errorf("unable to embed papers: %v", err)
+				}
+			}
+			papers.Topics(unreadPapers, *topics, vectors)
+		}
+		if err := results.Save(); err != nil { // the cache is best effort
+			log.Printf("Unable to save the cache of enrichments: %v", err)
+		}
+		if *titleCase != "" { // after the enrichment, that may replace the titles
+			if err := papers.NormalizeCase(unreadPapers, *titleCase); err != nil {
+				return fmt.Errorf("invalid -title-case: %v", err)
+			}
+			papers.NormalizeCase(readPapers, *titleCase)
+		}
+		if *like != "" || *dislike != "" {
+			markFeedback(fb, unreadPapers, readPapers)
+		}
+		scorers := scorers[:len(scorers):len(scorers)] // classifier is re-trained on every digest
+		if c := fb.Classifier(); c.Trained() {
+			scorers = append(scorers, c)
+		}
+		papers.ScoreRelevance(unreadPapers, scorers...)
+		papers.ScoreRelevance(readPapers, scorers...)
+		if weights != nil {
+			now := time.Now()
+			papers.Rank(unreadPapers, *weights, now)
+			papers.Rank(readPapers, *weights, now)
+		}
+
+		if *diffFile != "" {
+			if unreadPapers, err = diffPapers(*diffFile, unreadPapers); err != nil {
+				return err
+			}
+		}
+		// render papers
+		log.Printf("rendering %d papers", len(unreadPapers)+len(readPapers))
+		var report bytes.Buffer
+		r.Render(&report, unreadStats, unreadPapers, readPapers)
+		// emails are only modified after the whole report is written
+		if *watchTopic != "" && len(unreadPapers)+len(readPapers) == 0 {
+			log.Print("no papers, the report is kept") // of the earlier digest, not replaced by an empty one
+		} else if err := writeReport(*outFile, report.Bytes()); err != nil {
+			return fmt.Errorf("unable to write the report: %v", err)
+		}
+
+		if *pdfDir != "" {
+			if err := enrich.NewDownloader(enrich.Options{Client: crawlerClient}).PDFs(ctx, *pdfDir, unreadPapers, readPapers); err != nil {
+				return fmt.Errorf("unable to download PDFs: %v", err)
+			}
+		}
+
+		if seen != nil && !*dryRun {
+			seen.Add(unreadPapers, time.Now())
+			if err := seen.Save(); err != nil {
+				return fmt.Errorf("unable to save seen papers to %s: %v", *seenFile, err)
+			}
+		}
+		if *dbFile != "" && !*dryRun {
+			if err := recordPapers(*dbFile, aggregated...); err != nil {
+				return fmt.Errorf("unable to record papers in %s: %v", *dbFile, err)
+			}
+		}
+
+		totalErrCnt := unreadStats.Errs + readStats.Errs
+		if totalErrCnt != 0 {
+			log.Printf("Errors: %d\n", totalErrCnt)
+		}
+		if totalErrCnt != 0 && !*dryRun {
+			skipList.Fail(append(unreadStats.Failed, readStats.Failed...)...)
+			if err := skipList.Save(); err != nil {
+				return fmt.Errorf("unable to save skipped messages to %s: %v", *skipFile, err)
+			}
+		}
+
+		var remove, actions []string
+		if *markRead {
+			// TODO(bzz): add a state
+			//  use existing report from FS \w a checkbox state set by the user
+			//  only mark email as "read" iff all the links are checked off
+			remove = append(remove, "UNREAD")
+			actions = append(actions, "mark as read")
+		}
+		if *archive {
+			remove = append(remove, "INBOX")
+			actions = append(actions, "archive")
+		}
+		if processedID != "" {
+			actions = append(actions, "label as "+*processed)
+		}
+		starred := starredMsgs(unreadPapers, *starMin, urMsgs)
+		if len(starred) != 0 {
+			actions = append(actions, fmt.Sprintf("star %d of them", len(starred)))
+		}
+		// failed emails are left unread, to be retried until skipped
+		urDigested, rDigested := digested(urMsgs, unreadStats.Failed), digested(rMsgs, readStats.Failed)
+		if *confirm && !*dryRun && len(actions) != 0 && !confirmed(fmt.Sprintf("Modify %d emails with %d papers in Gmail (%s)?",
+			len(urDigested), len(unreadPapers), strings.Join(actions, ", "))) {
+			log.Print("nothing is changed in Gmail")
+			return nil
+		}
+		if len(remove) != 0 {
+			run.Modify(ctx, srv, user, urDigested, nil, remove)
+		}
+		if processedID != "" {
+			run.Modify(ctx, srv, user, append(urDigested, rDigested...), []string{processedID}, nil)
+		}
+		if len(starred) != 0 {
+			run.Modify(ctx, srv, user, starred, []string{starID}, nil)
+		}
+		saveRun(undoLog, run)
+		return nil
+	}
+
+	if *watchTopic == "" {
+		if err := digest(ctx); err != nil {
+			log.Fatalf("Failed to make the digest: %v", err)
+		}
+		return
+	}
+	watch(ctx, client, srv, labelIDs, digest)
+}
+
+// searchQuery returns a Gmail search query for the messages under the -l label, \wo the -exclude-label, matching
+// the -query and the dates, if any, not older than the -max-age, and the given terms e.g "is:unread".
+func searchQuery(terms string) string {
+	q := labelQuery()
+	if dateTerms != "" {
+		q = append(q, dateTerms)
+	}
+	if maxAge != 0 {
+		q = append(q, fmt.Sprintf("after:%d", time.Now().Add(-maxAge).Unix()))
+	}
+	if terms != "" {
+		q = append(q, terms)
+	}
+	return strings.Join(q, " ")
+}
+
+// labelQuery returns the Gmail search terms for the messages under the -l label, \wo the -exclude-label,
+// matching the -query, if any.
+func labelQuery() []string {
+	var q []string
+	switch names := labelNames(*gmailLabel); len(names) {
+	case 0:
+	case 1:
+		q = append(q, "label:"+names[0])
+	default:
+		q = append(q, "{label:"+strings.Join(names, " label:")+"}") // any of the labels
+	}
+	for _, name := range labelNames(*exclLabels) {
+		q = append(q, "-label:"+name)
+	}
+	if *gmailQuery != "" {
+		q = append(q, "("+*gmailQuery+")")
+	}
+	return q
+}
+
+// markStaleRead marks unread messages, received before a cutoff time, as read, recording it in the run.
+func markStaleRead(ctx context.Context, f *gmailutils.Fetcher, run *gmailutils.Run, cutoff time.Time) error {
+	msgIDs, err := f.Search(ctx, gmailutils.StaleQuery(labelQuery(), cutoff))
+	if err != nil {
+		return fmt.Errorf("unable to search stale messages in Gmail: %v", err)
+	}
+	if len(msgIDs) == 0 {
+		return nil
+	}
+	if *confirm && !*dryRun && !confirmed(fmt.Sprintf("Mark %d unread emails, older than %s, as read in Gmail?",
+		len(msgIDs), cutoff.Format("2006-01-02"))) {
+		return nil
+	}
+	stale := make([]*gmail.Message, len(msgIDs))
+	for i, id := range msgIDs {
+		stale[i] = &gmail.Message{Id: id, LabelIds: []string{"UNREAD"}} // as searched
+	}
+	log.Printf("marking %d messages, older than %s, as read", len(stale), cutoff.Format("2006-01-02"))
+	run.Modify(ctx, f.Srv, user, stale, nil, []string{"UNREAD"})
+	return nil
+}
+
+// diffPapers returns the papers, added since an earlier report, and the ones removed from it, marked as Removed.
+func diffPapers(path string, aggPapers papers.AggPapers) (papers.AggPapers, error) {
+	previous, err := papers.ReadReport(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the report to -diff: %v", err)
+	}
+	changes, removed := papers.Changes(aggPapers, previous)
+	log.Printf("%d papers added and %d removed since %s", len(changes)-removed, removed, path)
+	return changes, nil
+}
+
+// recordPapers adds the papers, aggregated by the run, to the database.
+func recordPapers(path string, aggPapers ...papers.AggPapers) error {
+	db, err := history.OpenDB(path)
 	if err != nil {
-		log.Fatalf("Failed to fetch messages from Gmail: %v", err)
+		return err
 	}
-	unreadStats, unreadPapers := papers.ExtractAndAggPapersFromMsgs(urMsgs, *authors, *refs)
+	defer db.Close()
+	return db.Add(time.Now(), aggPapers...)
+}
+
+// exportHistory writes all the papers in the database as CSV to a given file, or stdout if empty.
+func exportHistory(path, out string) error {
+	db, err := history.OpenDB(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var csv bytes.Buffer
+	if err := db.ExportCSV(&csv); err != nil {
+		return err
+	}
+	return writeReport(out, csv.Bytes())
+}
+
+// reportDate matches the date in the file name of a report.
+var reportDate = regexp.MustCompile(`\d{4}-\d{2}-\d{2}`)
 
-	readStats := &papers.Stats{}
-	var rMsgs []*gmail.Message
-	var readPapers papers.AggPapers
-	if *read {
-		rMsgs, err = gmailutils.FetchConcurent(context.Background(), srv, user, fmt.Sprintf("label:%s is:read", *gmailLabel), *concurReq)
+// importReports records the papers of the reports in the -seen file and the -db, the earliest report first.
+// Nothing is recorded on -dry-run.
+func importReports(paths []string) error {
+	type report struct {
+		path      string
+		date      time.Time
+		aggPapers papers.AggPapers
+	}
+	var reports []report
+	for _, path := range paths {
+		aggPapers, err := papers.ReadReport(path)
+		if err != nil {
+			return err
+		}
+		date, err := time.ParseInLocation("2006-01-02", reportDate.FindString(filepath.Base(path)), time.Local)
 		if err != nil {
-			log.Fatal("Failed to fetch messages from Gmail")
+			fi, err := os.Stat(path)
+			if err != nil {
+				return err
+			}
+			date = fi.ModTime()
 		}
-		readStats, readPapers = papers.ExtractAndAggPapersFromMsgs(rMsgs, *authors, *refs)
+		log.Printf("%s: %d papers, reported at %s", path, len(aggPapers), date.Format("2006-01-02"))
+		reports = append(reports, report{path, date, aggPapers})
 	}
+	sort.SliceStable(reports, func(i, j int) bool { return reports[i].date.Before(reports[j].date) })
 
-	if *updTest {
-		saveEmails("./fixtures/unread.json", urMsgs)
-		saveEmails("./fixtures/read.json", rMsgs)
+	seen, err := history.Open(*seenFile)
+	if err != nil {
+		return err
+	}
+	var db *history.DB
+	if *dbFile != "" && !*dryRun {
+		if db, err = history.OpenDB(*dbFile); err != nil {
+			return err
+		}
+		defer db.Close()
+	}
+	for _, r := range reports {
+		seen.Add(r.aggPapers, r.date)
+		if db == nil {
+			continue
+		}
+		if err := db.Add(r.date, r.aggPapers); err != nil {
+			return fmt.Errorf("%s: %v", r.path, err)
+		}
+	}
+	log.Printf("%d papers seen in total", len(seen.Papers))
+	if *dryRun {
+		return nil
+	}
+	return seen.Save()
+}
+
+// maxTrends is the number of the papers and the keywords, printed by the trends command.
+const maxTrends = 20
+
+// printTrends prints the papers and the keywords, mentioned in several of the last weeks, as tables
+// of the number of emails in every week. The keywords are the given number of keyphrases of every paper, if not 0.
+func printTrends(path string, weeks, keyphrases int) error {
+	db, err := history.OpenDB(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	now := time.Now()
+	papersTrends, keywords, err := db.Trends(weeks, keyphrases, now)
+	if err != nil {
+		return err
+	}
+
+	// counts first, as titles differ in length
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	header := func(title string) {
+		start := history.WeekStart(now).AddDate(0, 0, -7*(weeks-1))
+		for i := 0; i < weeks; i++ {
+			fmt.Fprintf(w, "%s\t", start.AddDate(0, 0, 7*i).Format("01-02"))
+		}
+		fmt.Fprintf(w, "  %s\n", title)
+	}
+	table := func(trends []*history.Trend) {
+		if len(trends) > maxTrends {
+			trends = trends[:maxTrends]
+		}
+		for _, t := range trends {
+			for _, n := range t.Weeks {
+				fmt.Fprintf(w, "%d\t", n)
+			}
+			fmt.Fprintf(w, "  %s\n", t.Title)
+		}
+	}
+
+	header(fmt.Sprintf("Papers (%d)", len(papersTrends)))
+	table(papersTrends)
+	fmt.Fprintln(w)
+	header(fmt.Sprintf("Keywords (%d)", len(keywords)))
+	table(keywords)
+	return w.Flush()
+}
+
+// trashOld moves read messages, received before a cutoff time, to the trash, recording it in the run.
+func trashOld(ctx context.Context, f *gmailutils.Fetcher, run *gmailutils.Run, cutoff time.Time) error {
+	msgIDs, err := f.Search(ctx, gmailutils.TrashQuery(labelQuery(), *gmailLabel != "", cutoff))
+	if err != nil {
+		return fmt.Errorf("unable to search old messages in Gmail: %v", err)
+	}
+	if len(msgIDs) == 0 {
+		return nil
+	}
+	if *confirm && !*dryRun && !confirmed(fmt.Sprintf("Move %d read emails, older than %s, to the trash in Gmail?",
+		len(msgIDs), cutoff.Format("2006-01-02"))) {
+		return nil
+	}
+	old := make([]*gmail.Message, len(msgIDs))
+	for i, id := range msgIDs {
+		old[i] = &gmail.Message{Id: id}
+	}
+	log.Printf("moving %d read messages, older than %s, to the trash", len(old), cutoff.Format("2006-01-02"))
+	run.Trash(ctx, f.Srv, user, old)
+	return nil
+}
+
+// saveRun adds the run to the -undo-log, if it changed anything in Gmail, or saves its new changes
+// if it was already added.
+func saveRun(undoLog *gmailutils.UndoLog, run *gmailutils.Run) {
+	if len(run.Changes) == 0 {
 		return
 	}
-	// render papers
-	var r templates.Renderer
-	template, style := templates.MdTemplText, ""
+	if n := len(undoLog.Runs); n == 0 || undoLog.Runs[n-1] != run {
+		undoLog.Add(run)
+	}
+	if err := undoLog.Save(); err != nil {
+		log.Fatalf("Unable to save the changes to undo to %s: %v", *undoFile, err)
+	}
+}
+
+// labelNames returns the names of comma-separated labels.
+func labelNames(list string) []string {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// interruptible returns a context, that is canceled on the first interrupt (Ctrl-C).
+// The second one terminates the program, as usual.
+func interruptible(parent context.Context) context.Context {
+	ctx, cancel := context.WithCancel(parent)
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		log.Printf("interrupted, canceling the requests in flight")
+		signal.Stop(interrupt)
+		cancel()
+	}()
+	return ctx
+}
+
+// watch registers Gmail push notifications about the messages under the label and, on every notification
+// pulled from the -subscription, calls digest. The registration is renewed daily, as recommended by Gmail API.
+// It stops when the context is done.
+func watch(ctx context.Context, client *http.Client, srv *gmail.Service, labelIDs []string, digest func(context.Context) error) {
+	sub := &gmailutils.Subscription{Client: client, Name: *watchSub}
+	var renew time.Time
+	var done uint64 // history of the mailbox after the last digest and its own changes
+	for {
+		if time.Now().After(renew) {
+			expires, err := gmailutils.Watch(ctx, srv, user, *watchTopic, labelIDs...)
+			if err != nil {
+				log.Fatalf("Unable to watch the label: %v", err)
+			}
+			renew = time.Now().Add(24 * time.Hour)
+			log.Printf("watching the label for new messages, until %s", expires.Format(time.RFC3339))
+		}
+
+		ns, err := sub.Pull(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("Unable to pull notifications, retrying in a minute: %v", err)
+			sleep(ctx, time.Minute)
+			continue
+		}
+		if len(ns) == 0 {
+			sleep(ctx, time.Second)
+			continue
+		}
+		if ns = gmailutils.Since(ns, done); len(ns) == 0 {
+			log.Printf("notifications of the changes by the last digest, ignored")
+			continue
+		}
+		log.Printf("%d notifications, up to history %d, making a new digest", len(ns), ns[len(ns)-1].HistoryID)
+		if err := digest(ctx); err != nil {
+			log.Printf("Failed to make the digest, waiting for the next notification: %v", err)
+		}
+		if id, err := gmailutils.HistoryID(ctx, srv, user); err != nil {
+			log.Printf("Unable to get the history of the mailbox: %v", err)
+		} else {
+			done = id
+		}
+	}
+}
+
+// sleep waits for a given duration, or until the context is done.
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
+
+// newRenderer validates the -format and creates a Renderer for it, configured by the flags.
+// Papers are split in sections by the given labels, if any.
+func newRenderer(labels ...*gmail.Label) templates.Renderer {
+	if *compact && *full {
+		log.Fatalf("Only one of -compact or -full can be used")
+	}
+	if *byType && *byLabel || *bySeen && (*byType || *byLabel) {
+		log.Fatalf("Only one of -by-type, -by-label or -by-seen can be used")
+	}
+	if *diffFile != "" && (*byType || *byLabel || *bySeen) {
+		log.Fatalf("-diff can not be used with -by-type, -by-label or -by-seen")
+	}
+	if *window != "" && (*byType || *byLabel || *bySeen || *diffFile != "") {
+		log.Fatalf("-window can not be used with -by-type, -by-label, -by-seen or -diff")
+	}
+	if *byTopic && (*byType || *byLabel || *bySeen || *diffFile != "" || *window != "") {
+		log.Fatalf("-by-topic can not be used with -by-type, -by-label, -by-seen, -diff or -window")
+	}
+	if *bySeen && *skipSeen {
+		log.Fatalf("Only one of -skip-seen or -by-seen can be used")
+	}
+
+	template, style := "", "" // default ones, per format
 	if *compact {
 		template, style = templates.CompactMdTemplText, templates.CompatStyle
+	} else if *full {
+		template = templates.FullMdTemplText
+	}
+	if *tmplFile != "" {
+		b, err := ioutil.ReadFile(*tmplFile)
+		if err != nil {
+			log.Fatalf("Unable to read report template: %v", err)
+		}
+		template = string(b)
+	}
+
+	headerFields := []string{}
+	if *fields != "" {
+		headerFields = strings.Split(*fields, ",")
+	}
+
+	r, err := templates.NewRenderer(*format, templates.Options{
+		Template:    template,
+		Style:       style,
+		Width:       *width,
+		TOC:         *toc,
+		ByType:      *byType,
+		Labels:      labels,
+		BySeen:      *bySeen,
+		Diff:        *diffFile != "",
+		Window:      *window,
+		ByTopic:     *byTopic,
+		AlertStats:  *alertStats,
+		Title:       *title,
+		Description: *descr,
+		Fields:      headerFields,
+	})
+	if err != nil {
+		log.Fatalf("Invalid report configuration: %v", err)
+	}
+	return r
+}
+
+// filterPapers drops the papers, not matching the filters, configured by the flags.
+func filterPapers(aggPapers papers.AggPapers) papers.AggPapers {
+	filters := papers.Filters{
+		DenyAuthors:   readList(*denyAuth),
+		AllowAuthors:  readList(*allowAuth),
+		BlockDomains:  readList(*blockDoms),
+		DemoteDomains: readList(*demoteDoms),
+		MinEmails:     *minCount,
+		Include:       papers.SplitList(*include),
+		Exclude:       papers.SplitList(*exclude),
+		Venues:        readList(*venues),
+		ExcludeVenues: readList(*exclVenues),
+	}
+	if *matchKeys {
+		filters.Keyphrases = *keywords
+	}
+	n := len(aggPapers)
+	aggPapers = filters.Apply(aggPapers)
+	if dropped := n - len(aggPapers); dropped > 0 {
+		log.Printf("filtered out %d papers", dropped)
+	}
+	return aggPapers
+}
+
+// markFeedback marks the papers from -like and -dislike as interesting or not, and saves the feedback.
+// Papers that are not in the digest are marked by the title alone.
+func markFeedback(fb *feedback.Store, unread, read papers.AggPapers) {
+	now := time.Now()
+	for _, mark := range []struct {
+		list        string
+		interesting bool
+	}{{*like, true}, {*dislike, false}} {
+		if mark.list == "" {
+			continue
+		}
+		for _, item := range readList(mark.list) {
+			p := papers.Find(unread, item)
+			if p == nil {
+				p = papers.Find(read, item)
+			}
+			if p == nil {
+				log.Printf("%q is not in the digest, marking it by the title", item)
+				p = &papers.Paper{Title: item}
+			}
+			fb.Mark(p, mark.interesting, now)
+		}
+	}
+	if err := fb.Save(); err != nil {
+		log.Fatalf("Unable to save feedback to %s: %v", *fbFile, err)
 	}
+}
 
-	log.Printf("rendering %d papers", len(unreadPapers)+len(readPapers))
-	if *outputJSON {
-		r = templates.NewJSONLRenderer()
-	} else if *outputHTML {
-		r = templates.NewHTMLRenderer(template, style)
-	} else {
-		r = templates.NewMarkdownRenderer(template, templates.ReadMdTemplText)
+// writeReport writes the report to the standard output or, if the path is not empty, replaces the file atomically.
+func writeReport(path string, report []byte) error {
+	if path == "" {
+		_, err := os.Stdout.Write(report)
+		return err
 	}
-	r.Render(os.Stdout, unreadStats, unreadPapers, readPapers)
+	if err := fileutils.AtomicWrite(path, 0644, func(w io.Writer) error {
+		_, err := w.Write(report)
+		return err
+	}); err != nil {
+		return err
+	}
+	log.Printf("report written to %s", path)
+	return nil
+}
 
-	if *markRead {
-		// TODO(bzz): add a state
-		//  use existing report from FS \w a checkbox state set by the user
-		//  only mark email as "read" iff all the links are checked off
-		gmailutils.ModifyMsgsDelLabel(srv, user, urMsgs, "UNREAD")
+// confirmed asks a yes/no question on the terminal and returns true if the answer is yes.
+func confirmed(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// starredMsgs returns the emails, mentioning the papers that are in at least a given number of emails,
+// or none if it is 0. The fetched ones are returned as they are, \w their labels.
+func starredMsgs(aggPapers papers.AggPapers, minEmails int, fetched []*gmail.Message) []*gmail.Message {
+	if minEmails <= 0 {
+		return nil
+	}
+	byID := map[string]*gmail.Message{}
+	for _, m := range fetched {
+		byID[m.Id] = m
+	}
+	var msgs []*gmail.Message
+	seen := map[string]bool{}
+	for _, p := range papers.Filter(aggPapers, papers.ByMinEmails(minEmails)) {
+		for _, id := range p.MsgIDs() {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			if m, ok := byID[id]; ok {
+				msgs = append(msgs, m)
+			} else {
+				msgs = append(msgs, &gmail.Message{Id: id})
+			}
+		}
 	}
+	return msgs
+}
 
-	totalErrCnt := unreadStats.Errs + readStats.Errs
-	if totalErrCnt != 0 {
-		log.Printf("Errors: %d\n", totalErrCnt)
+// digested returns the messages, except the failed ones.
+func digested(msgs []*gmail.Message, failed []string) []*gmail.Message {
+	if len(failed) == 0 {
+		return msgs
+	}
+	skip := map[string]bool{}
+	for _, id := range failed {
+		skip[id] = true
+	}
+	var ok []*gmail.Message
+	for _, m := range msgs {
+		if !skip[m.Id] {
+			ok = append(ok, m)
+		}
+	}
+	log.Printf("%d emails failed to be parsed, leaving them as they are in Gmail", len(msgs)-len(ok))
+	return ok
+}
+
+// readList returns the items of a comma-separated list or, if it is a path to a file, the lines of it.
+func readList(list string) []string {
+	b, err := ioutil.ReadFile(list)
+	if err != nil {
+		return papers.SplitList(list)
 	}
+	return papers.SplitList(strings.ReplaceAll(string(b), "\n", ","))
 }
 
 func saveEmails(path string, emails []*gmail.Message) {
@@ -185,7 +1461,7 @@ func saveEmails(path string, emails []*gmail.Message) {
 		log.Fatalf("Unable to save email fixtures: %v", err)
 	}
 	defer f.Close()
-	json.NewEncoder(f).Encode(append(emails))
+	json.NewEncoder(f).Encode(emails)
 }
 
 func saveLabels(path string, labels []*gmail.Label) {
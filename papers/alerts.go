@@ -0,0 +1,70 @@
+package papers
+
+import (
+	"sort"
+
+	"github.com/bzz/scholar-alert-digest/gmailutils"
+)
+
+// AlertStats is a number of papers, a single Google Scholar alert contributed to the digest, to find
+// the low-signal ones e.g the alerts \w few papers, all of which are also found by the others.
+type AlertStats struct {
+	Type   gmailutils.AlertType `json:",omitempty"`
+	Query  string               // search query, author or cited article, as in the subject of the emails
+	Emails int                  // number of the emails of the alert
+	Papers int                  // number of distinct papers in the emails
+	Unique int                  // number of the papers, not found by any other alert
+}
+
+// alertKey is an alert of an email, as in its subject.
+type alertKey struct {
+	alert gmailutils.AlertType
+	query string
+}
+
+// alertStats returns the stats of every alert of the messages, the ones \w more papers first.
+func alertStats(msgAlerts map[string]alertKey, aggPapers AggPapers) []*AlertStats {
+	byKey := map[alertKey]*AlertStats{}
+	for _, a := range msgAlerts {
+		st, ok := byKey[a]
+		if !ok {
+			st = &AlertStats{Type: a.alert, Query: a.query}
+			byKey[a] = st
+		}
+		st.Emails++
+	}
+
+	for _, p := range aggPapers {
+		alerts := map[alertKey]bool{}
+		for _, id := range p.msgIDs {
+			if a, ok := msgAlerts[id]; ok {
+				alerts[a] = true
+			}
+		}
+		for a := range alerts {
+			byKey[a].Papers++
+			if len(alerts) == 1 {
+				byKey[a].Unique++
+			}
+		}
+	}
+
+	result := make([]*AlertStats, 0, len(byKey))
+	for _, st := range byKey {
+		result = append(result, st)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		ri, rj := result[i], result[j]
+		if ri.Papers != rj.Papers {
+			return ri.Papers > rj.Papers
+		}
+		if ri.Unique != rj.Unique {
+			return ri.Unique > rj.Unique
+		}
+		if ri.Query != rj.Query {
+			return ri.Query < rj.Query
+		}
+		return ri.Type < rj.Type
+	})
+	return result
+}
@@ -0,0 +1,37 @@
+package papers
+
+import (
+	"testing"
+
+	"github.com/bzz/scholar-alert-digest/gmailutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/gmail/v1"
+)
+
+func TestAlertStats(t *testing.T) {
+	msgs := gmailutils.ReadMsgFixturesJSON("../fixtures/unread.json")
+	require.Len(t, msgs, 2)
+
+	again := *msgs[0] // same alert, a week later
+	again.Id = "again"
+	search := *msgs[1] // same papers, from a search query
+	search.Id = "search"
+	payload := *search.Payload
+	payload.Headers = []*gmail.MessagePartHeader{{Name: "Subject", Value: "neural code - new results"}}
+	search.Payload = &payload
+
+	st, aggPapers := ExtractAndAggPapersFromMsgs(append(msgs, &again, &search), false, false)
+	require.Zero(t, st.Errs)
+	require.Len(t, aggPapers, 6)
+
+	var stats []AlertStats
+	for _, a := range st.Alerts {
+		stats = append(stats, *a)
+	}
+	assert.Equal(t, []AlertStats{
+		{Type: gmailutils.RelatedResearch, Query: "Miltiadis Allamanis", Emails: 2, Papers: 3, Unique: 3},
+		{Type: gmailutils.NewCitations, Query: "Uri Alon", Emails: 1, Papers: 3, Unique: 0},
+		{Type: gmailutils.NewResults, Query: "neural code", Emails: 1, Papers: 3, Unique: 0},
+	}, stats)
+}
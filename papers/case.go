@@ -0,0 +1,118 @@
+package papers
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TitleCases are the supported styles of title case normalization.
+var TitleCases = []string{"sentence", "title"}
+
+// smallWords are not capitalized in the "title" case, unless they start the title.
+var smallWords = map[string]bool{
+	"a": true, "an": true, "the": true, "and": true, "or": true, "nor": true, "but": true,
+	"of": true, "in": true, "on": true, "for": true, "to": true, "with": true, "by": true,
+	"at": true, "from": true, "via": true, "vs": true, "as": true,
+}
+
+// NormalizeCase converts paper titles to a given case, "sentence" or "title", for display.
+// The original title is kept in the RawTitle and as the key of aggregated papers.
+func NormalizeCase(aggPapers AggPapers, style string) error {
+	var convert func(string) string
+	switch style {
+	case "sentence":
+		convert = sentenceCase
+	case "title":
+		convert = titleCase
+	default:
+		return fmt.Errorf("unknown title case %q, must be one of: %s", style, strings.Join(TitleCases, ", "))
+	}
+
+	for _, p := range aggPapers {
+		if title := convert(p.Title); title != p.Title {
+			p.RawTitle, p.Title = p.Title, title
+		}
+	}
+	return nil
+}
+
+// sentenceCase capitalizes only the first word of the title and of the subtitle, after a colon.
+// Acronyms and words in mixed case e.g "BERT" or "GitHub" are kept as is, unless the whole title is in upper case.
+func sentenceCase(title string) string {
+	return convertWords(title, func(word string, first bool) string {
+		if first {
+			return capitalize(strings.ToLower(word))
+		}
+		return strings.ToLower(word)
+	})
+}
+
+// titleCase capitalizes every word, except the small ones e.g "of" or "the".
+// Acronyms and words in mixed case are kept as is, unless the whole title is in upper case.
+func titleCase(title string) string {
+	return convertWords(title, func(word string, first bool) string {
+		lower := strings.ToLower(word)
+		if !first && smallWords[lower] {
+			return lower
+		}
+		return capitalize(lower)
+	})
+}
+
+// convertWords converts each word of the title, that is not an acronym, by a given function.
+func convertWords(title string, convert func(word string, first bool) string) string {
+	shouting := isUpper(title)
+	words := strings.Split(title, " ")
+	first := true
+	for i, word := range words {
+		if word == "" {
+			continue
+		}
+		if shouting || !hasInnerUpper(word) {
+			words[i] = convert(word, first)
+		}
+		first = strings.HasSuffix(word, ":") || strings.HasSuffix(word, "?") || strings.HasSuffix(word, ".")
+	}
+	return strings.Join(words, " ")
+}
+
+// capitalize returns the word \w the first letter in upper case.
+func capitalize(word string) string {
+	i := strings.IndexFunc(word, unicode.IsLetter)
+	if i < 0 {
+		return word
+	}
+	r, size := utf8.DecodeRuneInString(word[i:])
+	return word[:i] + string(unicode.ToUpper(r)) + word[i+size:]
+}
+
+// hasInnerUpper returns true if the word has an upper case letter after the first one e.g "BERT" or "GitHub".
+func hasInnerUpper(word string) bool {
+	seenLetter := false
+	for _, r := range word {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		if seenLetter && unicode.IsUpper(r) {
+			return true
+		}
+		seenLetter = true
+	}
+	return false
+}
+
+// isUpper returns true if all letters of the text are in upper case.
+func isUpper(text string) bool {
+	hasLetters := false
+	for _, r := range text {
+		if unicode.IsLetter(r) {
+			hasLetters = true
+			if !unicode.IsUpper(r) && unicode.ToUpper(r) != r {
+				return false
+			}
+		}
+	}
+	return hasLetters
+}
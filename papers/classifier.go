@@ -0,0 +1,63 @@
+package papers
+
+import "math"
+
+// Classifier is a naive Bayes model of the interesting papers, trained on the feedback.
+type Classifier struct {
+	docs  [2]int                // number of documents in a class, uninteresting and interesting
+	terms [2]map[string]float64 // frequency of a term in a class
+	total [2]float64            // number of terms in a class
+	vocab map[string]bool
+}
+
+// NewClassifier returns an empty classifier.
+func NewClassifier() *Classifier {
+	return &Classifier{
+		terms: [2]map[string]float64{{}, {}},
+		vocab: map[string]bool{},
+	}
+}
+
+// Train adds a text of the paper, marked as interesting or not, to the model.
+func (c *Classifier) Train(text string, interesting bool) {
+	class := 0
+	if interesting {
+		class = 1
+	}
+	c.docs[class]++
+	for term, f := range termFreqs(text) {
+		c.terms[class][term] += f
+		c.total[class] += f
+		c.vocab[term] = true
+	}
+}
+
+// Trained returns true if there are examples of both interesting and uninteresting papers.
+func (c *Classifier) Trained() bool {
+	return c.docs[0] > 0 && c.docs[1] > 0
+}
+
+// Score returns a probability of the paper to be interesting, judging by its title and abstract.
+func (c *Classifier) Score(p *Paper) float64 {
+	if !c.Trained() {
+		return 0.5
+	}
+	var logP [2]float64
+	for class := range logP {
+		logP[class] = math.Log(float64(c.docs[class]) / float64(c.docs[0]+c.docs[1]))
+	}
+	for term, f := range termFreqs(Text(p)) {
+		if !c.vocab[term] {
+			continue
+		}
+		for class := range logP { // Laplace smoothing
+			logP[class] += f * math.Log((c.terms[class][term]+1)/(c.total[class]+float64(len(c.vocab))))
+		}
+	}
+	return 1 / (1 + math.Exp(logP[0]-logP[1]))
+}
+
+// Text returns the title and the abstract of the paper, its text used for relevance.
+func Text(p *Paper) string {
+	return p.Title + " " + p.Abstract.FirstLine + " " + p.Abstract.Rest
+}
@@ -0,0 +1,196 @@
+package papers
+
+import (
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// Filter returns only the papers, for which keep is true.
+func Filter(aggPapers AggPapers, keep func(*Paper) bool) AggPapers {
+	kept := AggPapers{}
+	for title, p := range aggPapers {
+		if keep(p) {
+			kept[title] = p
+		}
+	}
+	return kept
+}
+
+// Filters configure, which papers are kept by Apply. Empty ones keep all the papers.
+type Filters struct {
+	DenyAuthors   []string // papers of any of them are dropped
+	AllowAuthors  []string // papers of any of them are highlighted and kept, regardless of the other filters
+	BlockDomains  []string // papers at any of them are dropped
+	DemoteDomains []string // papers at any of them are demoted
+	MinEmails     int      // papers mentioned by fewer emails are dropped
+	Include       []string // terms, papers must mention any of, if there are any
+	Exclude       []string // terms, papers must mention none of
+	Keyphrases    int      // if > 0, the terms are matched in this many extracted keyphrases only, see ByKeyphrases
+	Venues        []string // papers must be published in any of them, if there are any
+	ExcludeVenues []string // papers published in any of them are dropped
+}
+
+// Apply returns the papers, kept by the filters, and marks them as Demoted or Highlight.
+func (f Filters) Apply(aggPapers AggPapers) AggPapers {
+	if len(f.DenyAuthors) != 0 {
+		aggPapers = Filter(aggPapers, Not(ByAuthors(f.DenyAuthors)))
+	}
+	if len(f.BlockDomains) != 0 {
+		aggPapers = Filter(aggPapers, Not(ByDomains(f.BlockDomains)))
+	}
+	if len(f.DemoteDomains) != 0 {
+		demoted := ByDomains(f.DemoteDomains)
+		for _, p := range aggPapers {
+			p.Demoted = demoted(p)
+		}
+	}
+	if len(f.AllowAuthors) != 0 {
+		allowed := ByAuthors(f.AllowAuthors)
+		for _, p := range aggPapers {
+			p.Highlight = allowed(p)
+		}
+	}
+
+	var filters []func(*Paper) bool
+	if f.MinEmails > 1 {
+		filters = append(filters, ByMinEmails(f.MinEmails))
+	}
+	if f.Keyphrases > 0 {
+		ExtractKeywords(aggPapers, f.Keyphrases)
+		filters = append(filters, ByKeyphrases(f.Include, f.Exclude))
+	} else if len(f.Include) != 0 || len(f.Exclude) != 0 {
+		filters = append(filters, Keywords(f.Include, f.Exclude))
+	}
+	if len(f.Venues) != 0 {
+		filters = append(filters, ByVenues(f.Venues))
+	}
+	if len(f.ExcludeVenues) != 0 {
+		filters = append(filters, Not(ByVenues(f.ExcludeVenues)))
+	}
+	return Filter(aggPapers, func(p *Paper) bool {
+		if p.Highlight {
+			return true
+		}
+		for _, keep := range filters {
+			if !keep(p) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// Keywords returns a filter, keeping papers that mention any of the include terms, if there are any,
+// and none of the exclude terms. Terms are matched as whole words in the title and abstract, ignoring case.
+func Keywords(include, exclude []string) func(*Paper) bool {
+	return func(p *Paper) bool {
+		text := " " + normalizeTitle(p.Title+" "+p.Abstract.FirstLine+" "+p.Abstract.Rest) + " "
+		return (len(include) == 0 || mentionsAny(text, include)) && !mentionsAny(text, exclude)
+	}
+}
+
+// ByKeyphrases returns a filter like Keywords, that matches the terms in the extracted Keywords of the papers only,
+// so papers that merely mention a term in passing are not kept.
+func ByKeyphrases(include, exclude []string) func(*Paper) bool {
+	return func(p *Paper) bool {
+		mentions := func(terms []string) bool {
+			for _, k := range p.Keywords {
+				if mentionsAny(" "+normalizeTitle(k)+" ", terms) {
+					return true
+				}
+			}
+			return false
+		}
+		return (len(include) == 0 || mentions(include)) && !mentions(exclude)
+	}
+}
+
+// mentionsAny returns true if the normalized text, padded by spaces, contains any of the terms as whole words.
+func mentionsAny(text string, terms []string) bool {
+	for _, term := range terms {
+		if t := normalizeTitle(term); t != "" && strings.Contains(text, " "+t+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// SplitList splits a comma-separated list, \wo the empty items.
+func SplitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// ByAuthors returns a filter, keeping papers by any of the given authors. Names are matched by the
+// first initial and the last name, ignoring case, as Google Scholar abbreviates the first names.
+func ByAuthors(names []string) func(*Paper) bool {
+	keys := map[string]bool{}
+	for _, name := range names {
+		keys[authorKey(name)] = true
+	}
+	return func(p *Paper) bool {
+		for _, author := range p.Authors {
+			if keys[authorKey(author)] {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// authorKey returns the first initial and the last name of the author e.g "m allamanis".
+func authorKey(name string) string {
+	parts := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '-' && r != '\''
+	})
+	if len(parts) == 0 {
+		return ""
+	}
+	first, last := []rune(parts[0]), parts[len(parts)-1]
+	if len(parts) == 1 {
+		return last
+	}
+	return string(first[0]) + " " + last
+}
+
+// ByVenues returns a filter, keeping papers published in any of the given venues. Venues are matched
+// as whole words in the publication source (venue, year and publisher), ignoring case e.g "ICSE" or "arXiv".
+func ByVenues(venues []string) func(*Paper) bool {
+	return func(p *Paper) bool {
+		return mentionsAny(" "+normalizeTitle(p.Source)+" ", venues)
+	}
+}
+
+// ByMinEmails returns a filter, keeping papers mentioned in at least n distinct emails.
+func ByMinEmails(n int) func(*Paper) bool {
+	return func(p *Paper) bool { return p.Emails() >= n }
+}
+
+// ByDomains returns a filter, keeping papers \w URL on any of the given domains or their subdomains.
+func ByDomains(domains []string) func(*Paper) bool {
+	return func(p *Paper) bool {
+		u, err := url.Parse(p.URL)
+		if err != nil {
+			return false
+		}
+		host := strings.ToLower(u.Hostname())
+		for _, d := range domains {
+			d = strings.TrimPrefix(strings.ToLower(d), "www.")
+			if d != "" && (host == d || strings.HasSuffix(host, "."+d)) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not returns a filter, keeping papers that the given filter drops.
+func Not(keep func(*Paper) bool) func(*Paper) bool {
+	return func(p *Paper) bool { return !keep(p) }
+}
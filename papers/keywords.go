@@ -0,0 +1,122 @@
+package papers
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// maxPhraseWords is the max number of the words in a keyphrase, longer candidates are dropped.
+const maxPhraseWords = 3
+
+// phraseStopWords split the text in the candidate keyphrases, as RAKE does: function words and the ones,
+// common to all the abstracts.
+var phraseStopWords = func() map[string]bool {
+	words := map[string]bool{}
+	for w := range stopWords {
+		words[w] = true
+	}
+	for _, w := range strings.Fields(`about above after again against all also although among another any
+		been before being below between both but cannot could did does doing done down during each either
+		else even ever every few first further had having her here hers herself him himself his how however
+		into itself just like made make makes many may more most much must neither nor not now often once
+		only other others ours ourselves out over own per rather same several shall she should since so some
+		such than then there thereby therefore thus they those though through too under until upon very via
+		was were what when where whether while who whom whose why will within without would yet you your
+		well still one two three new novel propose proposed proposes present presents presented study
+		studies work works method methods approaches result shows shown showed demonstrate demonstrates
+		provide provides use used uses able different various existing significantly respectively them main
+		basic idea recent recently current great important good better best high low large small`) {
+		words[w] = true
+	}
+	return words
+}()
+
+// Keyphrases returns at most n most salient keyphrases of the text e.g a title and an abstract, in lower case,
+// by RAKE: the candidates are the runs of the words between the stop words and punctuation, scored by the sum
+// of the degree-to-frequency ratios of their words, so words that occur in longer phrases score more.
+// See Rose et al., "Automatic keyword extraction from individual documents", 2010.
+func Keyphrases(text string, n int) []string {
+	var candidates [][]string
+	var phrase []string
+	flush := func() {
+		if len(phrase) != 0 && len(phrase) <= maxPhraseWords {
+			candidates = append(candidates, phrase)
+		}
+		phrase = nil
+	}
+	for _, token := range tokenize(strings.ToLower(norm.NFKC.String(text))) {
+		if token == "" || phraseStopWords[token] || len([]rune(token)) < 3 || strings.IndexFunc(token, unicode.IsLetter) < 0 {
+			flush()
+			continue
+		}
+		phrase = append(phrase, token)
+	}
+	flush()
+
+	freq, degree := map[string]float64{}, map[string]float64{}
+	for _, words := range candidates {
+		for _, w := range words {
+			freq[w]++
+			degree[w] += float64(len(words))
+		}
+	}
+	scores := map[string]float64{}
+	for _, words := range candidates {
+		score := 0.0
+		for _, w := range words {
+			score += degree[w] / freq[w]
+		}
+		scores[strings.Join(words, " ")] = score
+	}
+
+	var phrases []string
+	for p := range scores {
+		phrases = append(phrases, p)
+	}
+	sort.Slice(phrases, func(i, j int) bool {
+		if si, sj := scores[phrases[i]], scores[phrases[j]]; si != sj {
+			return si > sj
+		}
+		return phrases[i] < phrases[j]
+	})
+	if len(phrases) > n {
+		phrases = phrases[:n]
+	}
+	return phrases
+}
+
+// tokenize splits the text in the words, keeping the inner hyphens e.g "sequence-to-sequence".
+// Punctuation, other than the hyphens and the apostrophes, is an empty token, that ends a phrase.
+func tokenize(text string) []string {
+	var tokens []string
+	var word strings.Builder
+	end := func() {
+		if w := strings.Trim(word.String(), "-'"); w != "" {
+			tokens = append(tokens, w)
+		}
+		word.Reset()
+	}
+	for _, r := range text {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '\'':
+			word.WriteRune(r)
+		case unicode.IsSpace(r):
+			end()
+		default:
+			end()
+			tokens = append(tokens, "")
+		}
+	}
+	end()
+	return tokens
+}
+
+// ExtractKeywords sets the Keywords of every paper to at most n keyphrases of its title and abstract.
+func ExtractKeywords(aggPapers AggPapers, n int) {
+	for _, p := range aggPapers {
+		p.Keywords = Keyphrases(p.Title+". "+p.Abstract.FirstLine+" "+p.Abstract.Rest, n)
+	}
+}
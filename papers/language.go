@@ -0,0 +1,115 @@
+package papers
+
+import (
+	"strings"
+	"unicode"
+)
+
+// minLanguageWords is the min number of the function words of a language, for a text in Latin script
+// to be detected as written in it.
+const minLanguageWords = 3
+
+// languageWords are the most frequent function words of the languages in Latin script, by ISO 639-1 code.
+// Words, common to several languages e.g "de", count for all of them.
+var languageWords = func() map[string]map[string]bool {
+	languages := map[string]map[string]bool{}
+	for lang, words := range map[string]string{
+		"en": "the of and to in is that for with are on this we by from as an be which these it or our can",
+		"es": "el la los las de del que y en un una por para con es se al como más su sus este esta son lo entre",
+		"pt": "o os as de do da dos das que e em um uma para com não é se ao como mais seu sua este esta pelo pela são",
+		"fr": "le la les de des du et est un une pour dans que qui sur par au aux avec ce cette sont ou nous en",
+		"de": "der die das und ist von zu den mit sich des im dem für auf eine ein nicht werden wird auch als wir",
+		"it": "il lo la gli le di del della che e è un una per con nel nella sono dei delle da al questo questa",
+		"nl": "de het een en van is dat op te in voor met zijn die niet wordt ook aan door deze we",
+	} {
+		languages[lang] = map[string]bool{}
+		for _, w := range strings.Fields(words) {
+			languages[lang][w] = true
+		}
+	}
+	return languages
+}()
+
+// DetectLanguage returns the ISO 639-1 code of the language of the text e.g "en", "es" or "zh", or "" if unknown.
+// Languages of their own script are detected by it, the ones in Latin script by the most frequent function words
+// of English, Spanish, Portuguese, French, German, Italian and Dutch.
+func DetectLanguage(text string) string {
+	scripts := map[string]int{}
+	letters := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r):
+			scripts["ja"]++
+		case unicode.Is(unicode.Han, r):
+			scripts["zh"]++
+		case unicode.Is(unicode.Hangul, r):
+			scripts["ko"]++
+		case unicode.Is(unicode.Cyrillic, r):
+			if strings.ContainsRune("іїєґІЇЄҐ", r) {
+				scripts["uk"]++
+			}
+			scripts["ru"]++
+		case unicode.Is(unicode.Arabic, r):
+			scripts["ar"]++
+		case unicode.Is(unicode.Greek, r):
+			scripts["el"]++
+		case unicode.Is(unicode.Devanagari, r):
+			scripts["hi"]++
+		}
+	}
+	if letters == 0 {
+		return ""
+	}
+	switch {
+	case scripts["ja"] > 0 && 2*(scripts["ja"]+scripts["zh"]) > letters: // Japanese is also written in Han
+		return "ja"
+	case scripts["uk"] > 0 && 2*scripts["ru"] > letters:
+		return "uk"
+	}
+	for _, lang := range []string{"zh", "ko", "ru", "ar", "el", "hi"} {
+		if 2*scripts[lang] > letters {
+			return lang
+		}
+	}
+
+	counts := map[string]int{}
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		for lang, words := range languageWords {
+			if words[w] {
+				counts[lang]++
+			}
+		}
+	}
+	best, second := "", 0
+	for lang, n := range counts {
+		if n > counts[best] {
+			best, second = lang, counts[best]
+		} else if n > second {
+			second = n
+		}
+	}
+	if counts[best] < minLanguageWords || counts[best] == second { // too short or ambiguous
+		return ""
+	}
+	return best
+}
+
+// DetectLanguages sets the Language of every paper to the language of its abstract, or of the title if there
+// is no abstract, if it is not the given language of the reader e.g "en".
+func DetectLanguages(aggPapers AggPapers, reader string) {
+	for _, p := range aggPapers {
+		text := strings.TrimSpace(p.Abstract.FirstLine + " " + p.Abstract.Rest)
+		if text == "" {
+			text = p.Title
+		}
+		if lang := DetectLanguage(text); lang != reader {
+			p.Language = lang
+		} else {
+			p.Language = ""
+		}
+	}
+}
@@ -3,33 +3,129 @@ package papers
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"html"
 	"log"
 	"net/url"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 	"unicode"
 	"unicode/utf8"
 
 	"github.com/antchfx/htmlquery"
+	"golang.org/x/text/unicode/norm"
 	"google.golang.org/api/gmail/v1"
 
 	"github.com/bzz/scholar-alert-digest/gmailutils"
 )
 
-var scholarURLPrefix = regexp.MustCompile(`http(s)?://scholar\.google\.\p{L}+(\.\p{L}+)?/scholar_url\?url=`)
+var (
+	scholarURLPrefix = regexp.MustCompile(`http(s)?://scholar\.google\.\p{L}+(\.\p{L}+)?/scholar_url\?url=`)
+	sourceYear       = regexp.MustCompile(`(^|,\s*)((19|20)\d\d)$`)
+	kindPrefix       = regexp.MustCompile(`^\s*\[(PDF|HTML|BOOK|B|CITATION|C)\]\s*`)
+)
+
+// PreviewLen is an approximate length of the first line of the abstract, in runes,
+// shown in the collapsed summary of the reports. Zero for the whole abstract.
+var PreviewLen = 80
 
 // Paper is a map key, thus aggregation take into account all it's fields.
 type Paper struct {
 	Title    string
+	RawTitle string `json:",omitempty"` // title, as in the email, if the case was normalized
 	URL      string
-	Author   string `json:",omitempty"`
+	ID       string               `json:",omitempty"` // canonical "doi:<doi>" or "arxiv:<id>", if known
+	Author   string               `json:",omitempty"`
+	Authors  []string             `json:",omitempty"`
+	Source   string               `json:",omitempty"` // publication venue and year
+	Venue    string               `json:",omitempty"`
+	Year     int                  `json:",omitempty"`
+	Kind     Kind                 `json:",omitempty"` // type of the linked document, if marked
+	Alert    gmailutils.AlertType `json:",omitempty"` // type of the alert, the paper was first found in
+	Cites    []string             `json:",omitempty"` // titles of the cited works, from citation alerts
 	Abstract Abstract
 	Refs     []Ref `json:",omitempty"`
 	Freq     int
+
+	Highlight bool    `json:",omitempty"` // e.g by one of the followed authors
+	Demoted   bool    `json:",omitempty"` // e.g on one of the low quality domains, listed after all the others
+	Seen      bool    `json:",omitempty"` // already reported in an earlier digest
+	Removed   bool    `json:",omitempty"` // only in the earlier report, the digest is compared to
+	Score     float64 `json:",omitempty"` // relevance or rank, papers are sorted by, before the frequency
+	Citations int     `json:",omitempty"` // number of citations, if known from the enrichment
+
+	DOI        string   `json:",omitempty"` // from the enrichment, also if the ID is not a DOI
+	Published  string   `json:",omitempty"` // date of the publication from the enrichment e.g "2020-03-02", "2020-03" or "2020"
+	Publisher  string   `json:",omitempty"` // from the enrichment
+	Categories []string `json:",omitempty"` // subject classes e.g "cs.LG" from the enrichment, the primary first
+	TLDR       string   `json:",omitempty"` // a single sentence summary from the enrichment
+	Concepts   []string `json:",omitempty"` // topics of the paper e.g "Computer science" from the enrichment, the most relevant first
+	OpenAccess string   `json:",omitempty"` // status of the open access e.g "gold", "green" or "closed" from the enrichment
+
+	OpenAccessURL string `json:",omitempty"` // of a free copy of the paper, if any, from the enrichment
+
+	Attention    float64 `json:",omitempty"` // Altmetric attention score, in the news and social media, from the enrichment
+	AttentionURL string  `json:",omitempty"` // of the details of the attention score, from the enrichment
+
+	InfluentialCitations int `json:",omitempty"` // number of the citations, that build on the paper, from the enrichment
+
+	Summary string `json:",omitempty"` // a single sentence on why the paper matters, from the LLM summarization
+	Topic   string `json:",omitempty"` // label of the cluster of the similar papers in the digest, if clustered
+
+	Keywords []string `json:",omitempty"` // the most salient phrases of the title and abstract, if extracted
+
+	Language   string `json:",omitempty"` // ISO 639-1 code of the original language of the abstract, if not the reader's one
+	Translated bool   `json:",omitempty"` // the abstract is translated to the reader's language
+
+	msgIDs   []string             // distinct emails, mentioning the paper
+	msgDates map[string]time.Time // of the emails, by ID
+	labelIDs []string             // Gmail labels of the emails, mentioning the paper
+	date     time.Time            // of the earliest email, mentioning the paper
+}
+
+// Emails returns the number of distinct emails, mentioning the paper, or the Freq if unknown.
+func (p *Paper) Emails() int {
+	if len(p.msgIDs) == 0 {
+		return p.Freq
+	}
+	return len(p.msgIDs)
+}
+
+// MsgIDs returns IDs of the distinct emails, mentioning the paper.
+func (p *Paper) MsgIDs() []string {
+	return p.msgIDs
+}
+
+// MsgDate returns the time of the email \w a given ID, mentioning the paper, or zero time if unknown.
+func (p *Paper) MsgDate(msgID string) time.Time {
+	return p.msgDates[msgID]
 }
 
+// LabelIDs returns IDs of the Gmail labels of all the emails, mentioning the paper.
+func (p *Paper) LabelIDs() []string {
+	return p.labelIDs
+}
+
+// Date returns the time of the earliest email, mentioning the paper, or zero time if unknown.
+func (p *Paper) Date() time.Time {
+	return p.date
+}
+
+// Kind is a type of the document, the paper URL links to e.g a PDF, as marked by Google Scholar.
+type Kind string
+
+// Kinds of documents, marked in the alerts.
+const (
+	KindPDF      Kind = "PDF"
+	KindHTML     Kind = "HTML"
+	KindBook     Kind = "BOOK"
+	KindCitation Kind = "CITATION"
+)
+
 // Ref saves information about a source, referencing the paper.
 type Ref struct {
 	ID, Title string
@@ -40,12 +136,25 @@ type Abstract struct {
 	FirstLine, Rest string
 }
 
+// NewAbstract returns the abstract of a given text, \w the first line of about PreviewLen.
+func NewAbstract(text string) Abstract {
+	first, rest := separateFirstLine(text, PreviewLen, PreviewLen/8)
+	return Abstract{first, rest}
+}
+
+// len returns the length of the whole abstract, in runes.
+func (a Abstract) len() int {
+	return utf8.RuneCountInString(a.FirstLine) + utf8.RuneCountInString(a.Rest)
+}
+
 // AggPapers represents an aggregated collection of Papers.
 type AggPapers map[string]*Paper
 
 // Stats is a number of counters \w stats on paper extraction from gmail messages.
 type Stats struct {
 	Msgs, Titles, Errs int
+	Failed             []string      // IDs of the messages, papers failed to be extracted from
+	Alerts             []*AlertStats // papers by the alert, the most productive first
 }
 
 // Helpers for a Map, sorted by keys.
@@ -54,11 +163,20 @@ type sortedMap struct {
 	s []string
 }
 
-func (sm *sortedMap) Len() int           { return len(sm.m) }
-func (sm *sortedMap) Less(i, j int) bool { return sm.m[sm.s[i]].Freq > sm.m[sm.s[j]].Freq }
-func (sm *sortedMap) Swap(i, j int)      { sm.s[i], sm.s[j] = sm.s[j], sm.s[i] }
+func (sm *sortedMap) Len() int { return len(sm.m) }
+func (sm *sortedMap) Less(i, j int) bool {
+	pi, pj := sm.m[sm.s[i]], sm.m[sm.s[j]]
+	if pi.Demoted != pj.Demoted {
+		return pj.Demoted
+	}
+	if pi.Score != pj.Score {
+		return pi.Score > pj.Score
+	}
+	return pi.Freq > pj.Freq
+}
+func (sm *sortedMap) Swap(i, j int) { sm.s[i], sm.s[j] = sm.s[j], sm.s[i] }
 
-// SortedKeys sort the given map by key.
+// SortedKeys sort the given map by relevance score and frequency, demoted papers are the last.
 func SortedKeys(m AggPapers) []string {
 	sm := new(sortedMap)
 	sm.m = m
@@ -73,17 +191,32 @@ func SortedKeys(m AggPapers) []string {
 	return sm.s
 }
 
-// ExtractAndAggPapersFromMsgs parses mail messages and creates Papers, aggregated by title.
+// ExtractAndAggPapersFromMsgs parses mail messages and creates Papers, aggregated by
+// the DOI/arXiv ID in the paper URL or, if there is none, by the normalized title.
+// Aggregated papers are keyed by the title of the first one.
 func ExtractAndAggPapersFromMsgs(msgs []*gmail.Message, authors, refs bool) (*Stats, AggPapers) {
+	st, aggPapers, _ := ExtractAndAggPapersContext(context.Background(), msgs, authors, refs)
+	return st, aggPapers
+}
+
+// ExtractAndAggPapersContext is ExtractAndAggPapersFromMsgs, that stops \w an error once the context is done.
+func ExtractAndAggPapersContext(ctx context.Context, msgs []*gmail.Message, authors, refs bool) (*Stats, AggPapers, error) {
 	st := &Stats{Msgs: len(msgs)}
 	uniqTitles := AggPapers{}
+	keys := map[string]string{}        // paper ID or normalized title -> title in uniqTitles
+	msgAlerts := map[string]alertKey{} // message ID -> alert, the message is from
 
 	for _, m := range msgs {
-		papers, err := extractPapersFromMsg(m, authors)
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		papers, a, err := extractPapersFromMsg(m, authors)
 		if err != nil {
 			st.Errs++
+			st.Failed = append(st.Failed, m.Id)
 			continue
 		}
+		msgAlerts[m.Id] = a
 
 		// aggregate
 		st.Titles += len(papers)
@@ -92,27 +225,356 @@ func ExtractAndAggPapersFromMsgs(msgs []*gmail.Message, authors, refs bool) (*St
 				paper.Refs = nil
 			}
 
-			if p, ok := uniqTitles[paper.Title]; ok {
-				p.Freq += paper.Freq
-				p.Refs = append(p.Refs, paper.Refs...)
+			title, ok := keys[paper.ID]
+			if !ok || paper.ID == "" {
+				title, ok = keys[normalizeTitle(paper.Title)]
+			}
+			if ok {
+				uniqTitles[title].merge(paper)
 			} else {
-				uniqTitles[paper.Title] = paper
+				title = paper.Title
+				uniqTitles[title] = paper
 			}
+
+			if paper.ID != "" {
+				keys[paper.ID] = title
+			}
+			keys[normalizeTitle(paper.Title)] = title
 		}
 	}
 
-	return st, uniqTitles
+	aggPapers := mergeSameURLs(uniqTitles)
+	st.Alerts = alertStats(msgAlerts, aggPapers)
+	return st, aggPapers, nil
+}
+
+// MergeDuplicates merges papers \w the same ID or URL into the most frequent one, e.g once their URLs were
+// resolved. Papers \wo an ID get the one in the URL, if any.
+func MergeDuplicates(aggPapers AggPapers) AggPapers {
+	byID := map[string]*Paper{}
+	for _, title := range byFreq(aggPapers) {
+		p := aggPapers[title]
+		if p.ID == "" {
+			p.ID = paperID(p.URL)
+		}
+		if first, ok := byID[p.ID]; ok && p.ID != "" {
+			first.merge(p)
+			delete(aggPapers, title)
+			continue
+		}
+		byID[p.ID] = p
+	}
+	return mergeSameURLs(aggPapers)
 }
 
-func extractPapersFromMsg(m *gmail.Message, inclAuthors bool) ([]*Paper, error) {
+// mergeSameURLs merges papers \w different titles but the same URL into the most frequent one.
+func mergeSameURLs(aggPapers AggPapers) AggPapers {
+	byURL := map[string]*Paper{}
+	for _, title := range byFreq(aggPapers) {
+		p := aggPapers[title]
+		u := cleanURL(p.URL)
+		if first, ok := byURL[u]; ok && u != "" {
+			first.merge(p)
+			delete(aggPapers, title)
+			continue
+		}
+		byURL[u] = p
+	}
+	return aggPapers
+}
+
+// byFreq returns titles of the papers, the most frequent first, then alphabetically.
+func byFreq(aggPapers AggPapers) []string {
+	titles := make([]string, 0, len(aggPapers))
+	for title := range aggPapers {
+		titles = append(titles, title)
+	}
+	sort.Slice(titles, func(i, j int) bool {
+		pi, pj := aggPapers[titles[i]], aggPapers[titles[j]]
+		if pi.Freq != pj.Freq {
+			return pi.Freq > pj.Freq
+		}
+		return titles[i] < titles[j]
+	})
+	return titles
+}
+
+// cleanURL returns a URL \wo the scheme, "www.", fragment and trailing slash, for comparison.
+func cleanURL(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+	clean := host + strings.TrimSuffix(u.EscapedPath(), "/")
+	if u.RawQuery != "" {
+		clean += "?" + u.RawQuery
+	}
+	return clean
+}
+
+// Key returns an identity of the paper, stable across the runs: the ID, if known, or the normalized title.
+func (p *Paper) Key() string {
+	if p.ID != "" {
+		return p.ID
+	}
+	return "title:" + normalizeTitle(p.Title)
+}
+
+// SameTitle returns true if the titles are the same, ignoring case and punctuation.
+func SameTitle(a, b string) bool {
+	return normalizeTitle(a) == normalizeTitle(b)
+}
+
+// Find returns the paper \w a given title, ignoring case and punctuation, or URL. Nil if there is none.
+func Find(aggPapers AggPapers, titleOrURL string) *Paper {
+	title := normalizeTitle(titleOrURL)
+	for _, p := range aggPapers {
+		if p.URL == titleOrURL || normalizeTitle(p.Title) == title {
+			return p
+		}
+	}
+	return nil
+}
+
+// merge adds up the other, duplicate, paper.
+func (p *Paper) merge(other *Paper) {
+	p.Freq += other.Freq
+	p.Refs = append(p.Refs, other.Refs...)
+	if p.Kind == "" {
+		p.Kind = other.Kind
+	}
+	if p.ID == "" {
+		p.ID = other.ID
+	}
+	// alerts truncate abstracts at different lengths
+	if other.Abstract.len() > p.Abstract.len() {
+		p.Abstract = other.Abstract
+	}
+	p.Cites = appendUniq(p.Cites, other.Cites...)
+	p.msgIDs = appendUniq(p.msgIDs, other.msgIDs...)
+	if len(other.msgDates) != 0 && p.msgDates == nil {
+		p.msgDates = map[string]time.Time{}
+	}
+	for id, date := range other.msgDates {
+		p.msgDates[id] = date
+	}
+	p.labelIDs = appendUniq(p.labelIDs, other.labelIDs...)
+	if p.date.IsZero() || (!other.date.IsZero() && other.date.Before(p.date)) {
+		p.date = other.date
+	}
+	if other.Citations > p.Citations {
+		p.Citations = other.Citations
+	}
+}
+
+var (
+	doiInURL   = regexp.MustCompile(`(?i)\b(10\.\d{4,9}/[^\s?#&]+)`)
+	arXivInURL = regexp.MustCompile(`(?i)arxiv\.org/(?:abs|pdf)/(\d{4}\.\d{4,5}|[a-z\-]+(?:\.[a-z]{2})?/\d{7})`)
+	arXivDOI   = regexp.MustCompile(`(?i)^10\.48550/arxiv\.(.+)$`)
+)
+
+// paperID returns a canonical ID of the paper, "arxiv:<id>" or "doi:<doi>", if there is one in the URL.
+// Versions of arXiv papers are dropped, so all of them have the same ID.
+func paperID(paperURL string) string {
+	if m := arXivInURL.FindStringSubmatch(paperURL); m != nil {
+		return "arxiv:" + strings.ToLower(m[1])
+	}
+	if m := doiInURL.FindStringSubmatch(paperURL); m != nil {
+		doi := strings.ToLower(strings.TrimRight(m[1], "/."))
+		doi = strings.TrimSuffix(strings.TrimSuffix(doi, ".pdf"), "/full")
+		if a := arXivDOI.FindStringSubmatch(doi); a != nil {
+			return "arxiv:" + a[1]
+		}
+		return "doi:" + doi
+	}
+	return ""
+}
+
+// punctuationFolder replaces typographic quotes and dashes by the ASCII ones.
+var punctuationFolder = strings.NewReplacer(
+	"‘", "'", "’", "'", "‚", "'", "‛", "'", "′", "'",
+	"“", `"`, "”", `"`, "„", `"`, "‟", `"`, "″", `"`, "«", `"`, "»", `"`,
+	"‐", "-", "‑", "-", "‒", "-", "–", "-", "—", "-", "―", "-", "−", "-",
+)
+
+// cleanTitle returns a title in Unicode NFC, \w ASCII quotes and dashes and \wo repeated whitespace,
+// so the same titles, typed differently, are the same map key.
+func cleanTitle(title string) string {
+	title = punctuationFolder.Replace(norm.NFC.String(title))
+	return strings.Join(strings.Fields(title), " ")
+}
+
+// normalizeTitle returns a title in lower case and Unicode NFKC, \wo punctuation and repeated whitespace.
+func normalizeTitle(title string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(norm.NFKC.String(title)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// appendUniq appends to the slice only the strings that are not in it yet.
+func appendUniq(slice []string, strs ...string) []string {
+	for _, str := range strs {
+		found := false
+		for _, s := range slice {
+			if s == str {
+				found = true
+				break
+			}
+		}
+		if !found {
+			slice = append(slice, str)
+		}
+	}
+	return slice
+}
+
+// entry is a raw text of a single paper mention in an email, before the extraction of details.
+type entry struct {
+	heading     string // title, including the "[PDF]"-like markers
+	title       string
+	url         string // a scholar URL
+	publication string // authors, venue and year
+	abstract    string
+}
+
+// extractPapersFromMsg returns the papers in the email and the alert, it is from.
+func extractPapersFromMsg(m *gmail.Message, inclAuthors bool) ([]*Paper, alertKey, error) {
 	subj := gmailutils.Subject(m.Payload)
 
+	var entries []entry
 	body, err := gmailutils.MessageTextBody(m.Payload)
-	if err != nil {
-		e := fmt.Errorf("failed to get message text for ID %s - %s", m.Id, err)
-		return nil, e
+	if err == nil {
+		entries, err = extractEntriesFromHTML(body, subj)
+		if err != nil {
+			return nil, alertKey{}, err
+		}
+	} else { // no HTML, fallback to plain text
+		var errText error
+		body, errText = gmailutils.MessagePlainTextBody(m.Payload)
+		if errText != nil {
+			e := fmt.Errorf("failed to get message text for ID %s - %s", m.Id, err)
+			return nil, alertKey{}, e
+		}
+		entries = extractEntriesFromText(string(body))
+	}
+
+	var date time.Time
+	if m.InternalDate != 0 {
+		date = time.Unix(0, m.InternalDate*int64(time.Millisecond))
+	}
+
+	alert, src := gmailutils.Alert(subj)
+	if alert == gmailutils.UnknownAlert { // subject may be modified on forwarding
+		if fwdSubj := forwardedSubject(body); fwdSubj != "" {
+			alert, src = gmailutils.Alert(fwdSubj)
+		}
+	}
+	query := strings.TrimSpace(src)
+	if query == "" { // not an alert, as far as known
+		query = gmailutils.UnwrapSubject(subj)
 	}
+	mSrc := "" // only authors are used as a reference title
+	switch alert {
+	case gmailutils.NewArticles, gmailutils.RelatedResearch, gmailutils.NewCitations:
+		if !strings.Contains(src, `"`) {
+			mSrc = src
+		}
+	}
+
+	var cites []string
+	if alert == gmailutils.NewCitations && src != "me" {
+		cites = []string{strings.Trim(src, `"“”«» `)}
+	}
+
+	var papers []*Paper
+	var author, source, venue string
+	var authors []string
+	var year int
+	for _, e := range entries {
+		title := cleanTitle(kindPrefix.ReplaceAllString(sanitize(e.title), ""))
+		kind := extractPaperKind(e.heading)
+		abstract := sanitize(e.abstract)
+		if inclAuthors {
+			publication := sanitize(e.publication)
+			author = extractPaperAuthor(publication)
+			authors = splitAuthors(author)
+			source = extractPaperSource(publication)
+			venue, year = splitSource(source)
+		}
 
+		url, err := extractPaperURL(e.url)
+		if err != nil {
+			log.Printf("Skipping paper %q in %q: %s", title, subj, err)
+			continue
+		}
+
+		abs := NewAbstract(abstract)
+
+		papers = append(papers,
+			&Paper{
+				Title:    title,
+				URL:      url,
+				ID:       paperID(url),
+				Author:   author,
+				Authors:  authors,
+				Source:   source,
+				Venue:    venue,
+				Year:     year,
+				Kind:     kind,
+				Alert:    alert,
+				Cites:    cites,
+				Abstract: abs,
+				Refs:     []Ref{Ref{m.Id, mSrc}},
+				Freq:     1,
+				msgIDs:   []string{m.Id},
+				msgDates: map[string]time.Time{m.Id: date},
+				labelIDs: append([]string(nil), m.LabelIds...),
+				date:     date,
+			})
+	}
+	return papers, alertKey{alert, query}, nil
+}
+
+// htmlTags are the names of HTML elements, that are left in the texts of the papers, so text like "Optional<T>"
+// or "n<k and k>m" is not mistaken for a tag.
+const htmlTags = `a|abbr|b|big|blockquote|br|code|del|div|em|font|h[1-6]|hr|i|img|ins|kbd|li|mark|math|ol|p|pre|q|s|small|` +
+	`span|strike|strong|sub|sup|table|tbody|td|th|thead|tr|tt|u|ul`
+
+var (
+	htmlTag          = regexp.MustCompile(`<[^>]*>`)
+	leftoverTag      = regexp.MustCompile(`(?is)<(script|style)\b.*?</(script|style)\s*>|<!--.*?-->|</?(` + htmlTags + `)\b[^<>]*>`)
+	forwardedSubjRow = regexp.MustCompile(`(?mi)^[\s>*]*(?:subject|objet|betreff|asunto|assunto|oggetto|тема)\s*:\s*(.+?)\s*$`)
+)
+
+// sanitize returns a plain text, \wo leftover HTML tags and entities, possibly escaped multiple times
+// e.g in a plain text email or an abstract, quoting some HTML. Only the tags of the raw text are removed,
+// escaped ones e.g "Optional&lt;T&gt;" are text, that is escaped again when rendered.
+func sanitize(text string) string {
+	text = leftoverTag.ReplaceAllString(text, " ")
+	for i := 0; i < 3 && strings.Contains(text, "&"); i++ {
+		unescaped := html.UnescapeString(text)
+		if unescaped == text {
+			break
+		}
+		text = unescaped
+	}
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// forwardedSubject returns the subject of the original message from the header of a forwarded one, if any.
+// In case of multiple forwards, the innermost one is used.
+func forwardedSubject(body []byte) string {
+	text := html.UnescapeString(htmlTag.ReplaceAllString(string(body), "\n"))
+	subjs := forwardedSubjRow.FindAllStringSubmatch(text, -1)
+	if len(subjs) == 0 {
+		return ""
+	}
+	return subjs[len(subjs)-1][1]
+}
+
+// extractEntriesFromHTML returns paper entries from the HTML body of an email.
+func extractEntriesFromHTML(body []byte, subj string) ([]entry, error) {
 	doc, err := htmlquery.Parse(bytes.NewReader(body))
 	if err != nil {
 		e := fmt.Errorf("failed to parse HTML body of %q", subj)
@@ -120,14 +582,14 @@ func extractPapersFromMsg(m *gmail.Message, inclAuthors bool) ([]*Paper, error)
 	}
 
 	// paper titles, from a single email
-	xpTitle := "//h3/a"
+	xpTitle := selectors.Title
 	titles, err := htmlquery.QueryAll(doc, xpTitle)
 	if err != nil {
 		return nil, fmt.Errorf("title: not valid XPath expression %q", xpTitle)
 	}
 
 	// paper urls, from a single email
-	xpURL := "//h3/a/@href"
+	xpURL := selectors.URL
 	urls, err := htmlquery.QueryAll(doc, xpURL)
 	if err != nil {
 		return nil, fmt.Errorf("url: not valid XPath expression %q", xpURL)
@@ -139,58 +601,35 @@ func extractPapersFromMsg(m *gmail.Message, inclAuthors bool) ([]*Paper, error)
 	}
 
 	// paper authors & year
-	xpAuth := "//h3/following-sibling::div[1]"
+	xpAuth := selectors.Authors
 	auths, err := htmlquery.QueryAll(doc, xpAuth)
 	if err != nil {
 		return nil, fmt.Errorf("authors: not valid XPath expression %q", xpAuth)
 	}
 
 	// paper abstract
-	xpAbs := "//h3/following-sibling::div[2]"
+	xpAbs := selectors.Abstract
 	abss, err := htmlquery.QueryAll(doc, xpAbs)
 	if err != nil {
 		return nil, fmt.Errorf("abstract: not valid XPath expression %q", xpAbs)
 	}
 
-	var papers []*Paper
-	var author string
+	var entries []entry
 	for i, aTitle := range titles {
-		title := strings.TrimSpace(htmlquery.InnerText(aTitle))
-		abstract := strings.TrimSpace(htmlquery.InnerText(abss[i]))
-		if inclAuthors {
-			author = extractPaperAuthor(htmlquery.InnerText(auths[i]))
+		e := entry{
+			heading: htmlquery.InnerText(aTitle.Parent),
+			title:   htmlquery.InnerText(aTitle),
+			url:     htmlquery.InnerText(urls[i]),
 		}
-
-		url, err := extractPaperURL(htmlquery.InnerText(urls[i]))
-		if err != nil {
-			log.Printf("Skipping paper %q in %q: %s", title, subj, err)
-			continue
+		if i < len(auths) {
+			e.publication = htmlquery.InnerText(auths[i])
 		}
-
-		N, lookahead := 80, 10 // max number of runes to process
-		first, rest := separateFirstLine(abstract, N, lookahead)
-		abs := Abstract{first, rest}
-
-		mSrc := ""
-		if srcType := gmailutils.NormalizeAndSplit(subj); len(srcType) == 2 {
-			// FIXME(bzz): this is a hack, replace it by switch over
-			// some exported types e.g gmailutils.Citations
-			if (strings.Index(srcType[1], "articles") > 0 ||
-				strings.Index(srcType[1], "citations") > 0 ||
-				strings.Index(srcType[1], "research") > 0) &&
-				strings.Index(srcType[0], `"`) == -1 {
-				mSrc = srcType[0]
-			}
+		if i < len(abss) {
+			e.abstract = htmlquery.InnerText(abss[i])
 		}
-
-		papers = append(papers,
-			&Paper{
-				title, url, author, abs,
-				[]Ref{Ref{m.Id, mSrc}},
-				1,
-			})
+		entries = append(entries, e)
 	}
-	return papers, nil
+	return entries, nil
 }
 
 func extractPaperAuthor(publication string) string {
@@ -204,11 +643,70 @@ func extractPaperAuthor(publication string) string {
 	return strings.Title(strings.ToLower(auth))
 }
 
+// splitAuthors returns a list of individual authors, skipping the "…" of truncated lists.
+func splitAuthors(author string) []string {
+	var authors []string
+	for _, a := range strings.Split(author, ",") {
+		a = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(a), "…"))
+		if a != "" {
+			authors = append(authors, a)
+		}
+	}
+	return authors
+}
+
+// extractPaperSource returns the publication venue and year, following the authors and a dash.
+func extractPaperSource(publication string) string {
+	for i, r := range publication {
+		if unicode.In(r, unicode.Dash) {
+			return strings.TrimSpace(publication[i+utf8.RuneLen(r):])
+		}
+	}
+	return ""
+}
+
+// splitSource splits the publication source into the venue and the year, if any.
+// Source is formatted like "<venue>, <year> - <publisher>", where every part is optional.
+func splitSource(source string) (string, int) {
+	if i := strings.LastIndex(source, " - "); i >= 0 { // drop publisher
+		source = source[:i]
+	}
+	source = strings.TrimSuffix(strings.TrimSpace(source), "…")
+
+	loc := sourceYear.FindStringSubmatchIndex(source)
+	if loc == nil {
+		return strings.TrimSpace(source), 0
+	}
+	year, _ := strconv.Atoi(source[loc[4]:loc[5]])
+	return strings.TrimSpace(source[:loc[0]]), year
+}
+
+// extractPaperKind returns a kind of the document from the "[PDF]"-like marker, prefixing the title.
+func extractPaperKind(heading string) Kind {
+	m := kindPrefix.FindStringSubmatch(heading)
+	if m == nil {
+		return ""
+	}
+	switch m[1] {
+	case "B":
+		return KindBook
+	case "C":
+		return KindCitation
+	}
+	return Kind(m[1])
+}
+
 // extractPaperURL returns an actual paper URL from the given scholar link.
 // Does not validate URL format but extracts it ad-hoc by trimming sufix/prefix.
 func extractPaperURL(scholarURL string) (string, error) {
 	// drop scholarURLPrefix
 	prefixLoc := scholarURLPrefix.FindStringIndex(scholarURL)
+	if prefixLoc == nil { // may be escaped by the redirect of a forwarding email client
+		if unescaped, err := url.QueryUnescape(scholarURL); err == nil {
+			scholarURL = unescaped
+			prefixLoc = scholarURLPrefix.FindStringIndex(scholarURL)
+		}
+	}
 	if prefixLoc == nil {
 		return "", fmt.Errorf("url %q does not have prefix %q", scholarURL, scholarURLPrefix.String())
 	}
@@ -219,38 +717,80 @@ func extractPaperURL(scholarURL string) (string, error) {
 		longURL = longURL[:sufix]
 	}
 
-	return url.QueryUnescape(longURL)
+	paperURL, err := url.QueryUnescape(longURL)
+	if err != nil {
+		return "", err
+	}
+	return StripTracking(paperURL), nil
+}
+
+// trackingParams are the query parameters of the URLs, that only track the clicks, besides "utm_*" ones.
+var trackingParams = map[string]bool{
+	"casa_token": true, // ScienceDirect
+	"fbclid":     true,
+	"gclid":      true,
+	"dclid":      true,
+	"msclkid":    true,
+	"mc_cid":     true, // Mailchimp
+	"mc_eid":     true,
+	"_hsenc":     true, // HubSpot
+	"_hsmi":      true,
+	"mkt_tok":    true, // Marketo
+}
+
+// StripTracking returns the URL \wo the tracking query parameters e.g "utm_source" or "casa_token",
+// keeping the order of the rest.
+func StripTracking(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.RawQuery == "" {
+		return rawURL
+	}
+	var kept []string
+	for _, param := range strings.Split(u.RawQuery, "&") {
+		key := param
+		if i := strings.Index(param, "="); i >= 0 {
+			key = param[:i]
+		}
+		if k, err := url.QueryUnescape(key); err == nil {
+			key = strings.ToLower(k)
+		}
+		if param == "" || strings.HasPrefix(key, "utm_") || trackingParams[key] {
+			continue
+		}
+		kept = append(kept, param)
+	}
+	u.RawQuery = strings.Join(kept, "&")
+	u.ForceQuery = false
+	return u.String()
 }
 
 // separateFirstLine returns text, split into two parts: first short line and the rest.
-// N+lookehead is max length of the first. Split is done unicode whitespace,
-// if any around N +/-lookahead runes, or at Nth rune.
+// N+lookahead is max length of the first, in runes. Split is done on the last unicode
+// whitespace before it, if any, so words are never cut, or at N+lookahead rune otherwise.
 func separateFirstLine(text string, N, lookahead int) (string, string) {
 	text = strings.ReplaceAll(text, "\n", "")
-	if len(text) < N { // bytes, not code-points
+	if N <= 0 || utf8.RuneCountInString(text) <= N {
 		return text, ""
 	}
 
-	pos := 0
-	n, nPos, lastSpace, lastSpacePos := 0, 0, 0, 0
-	for len(text[pos:]) > 0 {
-		if n >= N+lookahead {
-			break
-		}
+	n, pos, lastSpacePos := 0, 0, 0
+	for pos < len(text) && n < N+lookahead {
 		char, width := utf8.DecodeRuneInString(text[pos:])
-		pos += width
-		if unicode.IsSpace(char) {
+		if unicode.IsSpace(char) && n > 0 {
 			lastSpacePos = pos
-			lastSpace = n
 		}
-		n, nPos = n+1, pos
+		pos += width
+		n++
+	}
+	if pos == len(text) { // all fits
+		return text, ""
 	}
 
-	cut := nPos
-	if abs(N-lastSpace) < lookahead { // whitespace in lookahead neighborhood of Nth rune
+	cut := pos
+	if lastSpacePos > 0 {
 		cut = lastSpacePos
 	}
-	return strings.TrimRightFunc(text[:cut], unicode.IsSpace), text[cut:]
+	return strings.TrimRightFunc(text[:cut], unicode.IsSpace), strings.TrimLeftFunc(text[cut:], unicode.IsSpace)
 }
 
 // abs returns the absolute value of x.
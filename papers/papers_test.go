@@ -1,14 +1,23 @@
 package papers
 
 import (
+	"context"
+	"encoding/base64"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"testing"
+	"time"
 	"unicode"
 	"unicode/utf8"
 
+	"github.com/bzz/scholar-alert-digest/gmailutils"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/api/gmail/v1"
 )
 
 // UnitTests for paper extraction.
@@ -48,6 +57,16 @@ func TestScholarURLExtraction(t *testing.T) {
 			"https://scholar.google.рф/scholar_url?url=http://www.test.com&hl=1",
 			"http://www.test.com", false,
 		},
+		{
+			"redirect of a forwarding client",
+			"https://nam01.safelinks.protection.outlook.com/?url=https%3A%2F%2Fscholar.google.com%2Fscholar_url%3Furl%3Dhttps%3A%2F%2Farxiv.org%2Fpdf%2F1911.12863%26hl%3Den&data=1",
+			"https://arxiv.org/pdf/1911.12863", false,
+		},
+		{
+			"tracking parameters",
+			"https://scholar.google.com/scholar_url?url=https://www.sciencedirect.com/science/article/pii/S0164121220300303%3Fcasa_token%3Dabc%26utm_source%3Dalert&hl=en",
+			"https://www.sciencedirect.com/science/article/pii/S0164121220300303", false,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -64,6 +83,725 @@ func TestScholarURLExtraction(t *testing.T) {
 	}
 }
 
+func TestPaperAuthorAndSource(t *testing.T) {
+	var testCases = []struct {
+		publication, author, source string
+	}{
+		{"M ALLAMANIS, M BROCKSCHMIDT - arXiv preprint arXiv:1711.00740, 2017", "M Allamanis, M Brockschmidt", "arXiv preprint arXiv:1711.00740, 2017"},
+		{"A Author – Proceedings of ICSE, 2019", "A Author", "Proceedings of ICSE, 2019"},
+		{"A Author", "A Author", ""},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.author, extractPaperAuthor(tc.publication))
+		assert.Equal(t, tc.source, extractPaperSource(tc.publication))
+	}
+}
+
+func TestSplitAuthors(t *testing.T) {
+	assert.Equal(t, []string{"Z Chen", "S Kommrusch", "M Monperrus"}, splitAuthors("Z Chen, S Kommrusch, M Monperrus"))
+	assert.Equal(t, []string{"A Author", "B Author"}, splitAuthors("A Author, B Author…"))
+	assert.Equal(t, []string{"A Author"}, splitAuthors("A Author, …"))
+	assert.Nil(t, splitAuthors(""))
+}
+
+func TestSplitSource(t *testing.T) {
+	var testCases = []struct {
+		source, venue string
+		year          int
+	}{
+		{"arXiv preprint arXiv:1912.02015, 2019", "arXiv preprint arXiv:1912.02015", 2019},
+		{"2019", "", 2019},
+		{"Empirical Software Engineering, 2020 - Springer", "Empirical Software Engineering", 2020},
+		{"Proceedings of the 42nd International Conference …, 2020 - dl.acm.org", "Proceedings of the 42nd International Conference …", 2020},
+		{"IEEE Access", "IEEE Access", 0},
+		{"", "", 0},
+	}
+
+	for _, tc := range testCases {
+		venue, year := splitSource(tc.source)
+		assert.Equal(t, tc.venue, venue, tc.source)
+		assert.Equal(t, tc.year, year, tc.source)
+	}
+}
+
+func TestPaperKind(t *testing.T) {
+	var testCases = []struct {
+		heading string
+		kind    Kind
+	}{
+		{"[PDF] Using Sequence-to-Sequence Learning", KindPDF},
+		{" [HTML]  Using Sequence-to-Sequence Learning", KindHTML},
+		{"[B] Using Sequence-to-Sequence Learning", KindBook},
+		{"[BOOK] Using Sequence-to-Sequence Learning", KindBook},
+		{"Using [PDF] Sequence-to-Sequence Learning", ""},
+		{"Using Sequence-to-Sequence Learning", ""},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.kind, extractPaperKind(tc.heading), tc.heading)
+	}
+}
+
+func TestPaperID(t *testing.T) {
+	var testCases = []struct {
+		url, id string
+	}{
+		{"https://arxiv.org/abs/1711.00740", "arxiv:1711.00740"},
+		{"https://arxiv.org/pdf/1711.00740v3.pdf", "arxiv:1711.00740"},
+		{"http://arxiv.org/abs/cs/0112017v1", "arxiv:cs/0112017"},
+		{"https://doi.org/10.48550/arXiv.1711.00740", "arxiv:1711.00740"},
+		{"https://dl.acm.org/doi/abs/10.1145/3290353", "doi:10.1145/3290353"},
+		{"https://dl.acm.org/doi/pdf/10.1145/3290353?download=true", "doi:10.1145/3290353"},
+		{"https://link.springer.com/chapter/10.1007/978-3-030-36808-1_42", "doi:10.1007/978-3-030-36808-1_42"},
+		{"https://ieeexplore.ieee.org/abstract/document/8919471/", ""},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.id, paperID(tc.url), tc.url)
+	}
+}
+
+func TestAggregateByID(t *testing.T) {
+	msgs := []*gmail.Message{
+		paperMsg("1", "Learning to represent programs with graphs", "https://arxiv.org/abs/1711.00740"),
+		paperMsg("2", "Learning to Represent Programs with Graphs.", "https://openreview.net/forum?id=BJOFETxR-"),
+		paperMsg("3", "Graphs for programs", "https://arxiv.org/pdf/1711.00740v3.pdf"),
+		paperMsg("4", "Neural code search", "https://arxiv.org/abs/1806.09999"),
+	}
+
+	_, aggPapers := ExtractAndAggPapersFromMsgs(msgs, false, false)
+	require.Len(t, aggPapers, 2)
+	p := aggPapers["Learning to represent programs with graphs"]
+	require.NotNil(t, p)
+	assert.Equal(t, 3, p.Freq)
+	assert.Equal(t, "arxiv:1711.00740", p.ID)
+}
+
+func TestExtractAndAggPapersContext(t *testing.T) {
+	msgs := []*gmail.Message{paperMsg("1", "Neural code search", "https://arxiv.org/abs/1806.09999")}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, aggPapers, err := ExtractAndAggPapersContext(ctx, msgs, false, false)
+	require.NoError(t, err)
+	assert.Len(t, aggPapers, 1)
+
+	cancel()
+	_, _, err = ExtractAndAggPapersContext(ctx, msgs, false, false)
+	assert.Equal(t, context.Canceled, err)
+}
+
+// paperMsg returns a message, mentioning a single paper.
+func paperMsg(id, title, url string) *gmail.Message {
+	body := `<h3><a href="https://scholar.google.com/scholar_url?url=` + url + `&amp;hl=en">` + title + `</a></h3>` +
+		`<div>A Author - arXiv, 2020</div><div>Abstract</div>`
+	return &gmail.Message{Id: id, Payload: &gmail.MessagePart{
+		MimeType: "text/html",
+		Headers:  []*gmail.MessagePartHeader{{Name: "Subject", Value: `"deep learning source code" - new results`}},
+		Body:     &gmail.MessagePartBody{Data: base64.URLEncoding.EncodeToString([]byte(body))},
+	}}
+}
+
+func TestCleanTitle(t *testing.T) {
+	var testCases = []struct {
+		title, clean string
+	}{
+		{"Learning to represent programs with graphs", "Learning to represent programs with graphs"},
+		{"Re\u0301seaux de neurones", "Réseaux de neurones"},
+		{"“Deep” learning – a survey", `"Deep" learning - a survey`},
+		{"Don’t  repeat\u00a0yourself", "Don't repeat yourself"},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.clean, cleanTitle(tc.title), tc.title)
+	}
+	assert.Equal(t, normalizeTitle("Eﬃcient code search"), normalizeTitle("Efficient Code Search"))
+
+	_, aggPapers := ExtractAndAggPapersFromMsgs([]*gmail.Message{
+		paperMsg("1", "Typing Optional&lt;T&gt; in Java", "https://arxiv.org/abs/1"),
+		paperMsg("2", "Bounds for n&lt;k and k&gt;m", "https://arxiv.org/abs/2"),
+	}, false, false)
+	assert.Equal(t, []string{"Bounds for n<k and k>m", "Typing Optional<T> in Java"}, sortedTitles(aggPapers))
+}
+
+func TestAggregateNormalizedTitles(t *testing.T) {
+	msgs := []*gmail.Message{
+		paperMsg("1", "Réseaux de neurones – a survey", "https://example.com/1"),
+		paperMsg("2", "Re\u0301seaux de neurones - a survey", "https://example.com/2"),
+	}
+
+	_, aggPapers := ExtractAndAggPapersFromMsgs(msgs, false, false)
+	require.Len(t, aggPapers, 1)
+	assert.Equal(t, 2, aggPapers["Réseaux de neurones - a survey"].Freq)
+}
+
+func TestCleanURL(t *testing.T) {
+	assert.Equal(t, "ieeexplore.ieee.org/abstract/document/8919471", cleanURL("https://ieeexplore.ieee.org/abstract/document/8919471/"))
+	assert.Equal(t, "ieeexplore.ieee.org/abstract/document/8919471", cleanURL("http://www.IEEEXplore.ieee.org/abstract/document/8919471#abstract"))
+	assert.Equal(t, "example.com/paper?id=1", cleanURL("https://example.com/paper/?id=1"))
+}
+
+func TestStripTracking(t *testing.T) {
+	assert.Equal(t, "https://example.com/paper?id=1&v=2#abstract",
+		StripTracking("https://example.com/paper?utm_source=scholar&id=1&UTM_Medium=email&v=2&fbclid=x#abstract"))
+	assert.Equal(t, "https://example.com/paper", StripTracking("https://example.com/paper?casa_token=abc:def"))
+	assert.Equal(t, "https://example.com/paper?b=2&a=1", StripTracking("https://example.com/paper?b=2&a=1"), "order is kept")
+	assert.Equal(t, "https://example.com/paper", StripTracking("https://example.com/paper"))
+}
+
+func TestAggregateSameURL(t *testing.T) {
+	msgs := []*gmail.Message{
+		paperMsg("1", "Code search: a survey", "https://ieeexplore.ieee.org/abstract/document/8919471/"),
+		paperMsg("2", "Code Search - A Survey of Techniques", "http://ieeexplore.ieee.org/abstract/document/8919471"),
+		paperMsg("3", "Code Search - A Survey of Techniques", "http://ieeexplore.ieee.org/abstract/document/8919471"),
+		paperMsg("4", "Neural code search", "https://ieeexplore.ieee.org/abstract/document/1"),
+		paperMsg("5", "Code search: a survey", "https://ieeexplore.ieee.org/abstract/document/8919471/?utm_campaign=alert"),
+	}
+
+	_, aggPapers := ExtractAndAggPapersFromMsgs(msgs, false, true)
+	require.Len(t, aggPapers, 2)
+	p := aggPapers["Code Search - A Survey of Techniques"]
+	require.NotNil(t, p, "the most frequent title is kept")
+	assert.Equal(t, 4, p.Freq)
+	assert.Len(t, p.Refs, 4)
+}
+
+func TestMergeDuplicates(t *testing.T) {
+	aggPapers := AggPapers{
+		"Code search: a survey":   &Paper{Title: "Code search: a survey", Freq: 1, URL: "https://doi.org/10.1109/tse.2019.1"},
+		"Code search, a survey":   &Paper{Title: "Code search, a survey", Freq: 2, URL: "https://ieeexplore.ieee.org/document/1", ID: "doi:10.1109/tse.2019.1"},
+		"Neural code search":      &Paper{Title: "Neural code search", Freq: 1, URL: "https://example.com/ncs"},
+		"Neural code search (v2)": &Paper{Title: "Neural code search (v2)", Freq: 1, URL: "https://www.example.com/ncs/"},
+	}
+
+	aggPapers = MergeDuplicates(aggPapers)
+	assert.Equal(t, []string{"Code search, a survey", "Neural code search"}, SortedKeys(aggPapers))
+	assert.Equal(t, 3, aggPapers["Code search, a survey"].Freq, "by the ID in the URL")
+	assert.Equal(t, 2, aggPapers["Neural code search"].Freq, "by the same URL")
+}
+
+func TestMergeLongestAbstract(t *testing.T) {
+	p := &Paper{Title: "a", Freq: 1, Abstract: Abstract{"Software vulnerabilities affect", ""}}
+	p.merge(&Paper{Title: "a", Freq: 1, Abstract: Abstract{"Software vulnerabilities affect all businesses", " and research…"}})
+	p.merge(&Paper{Title: "a", Freq: 1, Abstract: Abstract{"Software", ""}})
+
+	assert.Equal(t, 3, p.Freq)
+	assert.Equal(t, Abstract{"Software vulnerabilities affect all businesses", " and research…"}, p.Abstract)
+}
+
+func TestTitleCase(t *testing.T) {
+	var testCases = []struct {
+		title, sentence, title_ string
+	}{
+		{"LEARNING TO REPRESENT PROGRAMS WITH GRAPHS", "Learning to represent programs with graphs", "Learning to Represent Programs with Graphs"},
+		{"Learning To Represent Programs With Graphs", "Learning to represent programs with graphs", "Learning to Represent Programs with Graphs"},
+		{"Pre-trained BERT models for GitHub code: a survey", "Pre-trained BERT models for GitHub code: A survey", "Pre-trained BERT Models for GitHub Code: A Survey"},
+		{"the (in)effectiveness of code2vec", "The (in)effectiveness of code2vec", "The (In)effectiveness of Code2vec"},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.sentence, sentenceCase(tc.title), tc.title)
+		assert.Equal(t, tc.title_, titleCase(tc.title), tc.title)
+	}
+}
+
+func TestNormalizeCase(t *testing.T) {
+	aggPapers := AggPapers{
+		"LEARNING TO REPRESENT PROGRAMS WITH GRAPHS": &Paper{Title: "LEARNING TO REPRESENT PROGRAMS WITH GRAPHS"},
+		"Neural code search":                         &Paper{Title: "Neural code search"},
+	}
+	require.NoError(t, NormalizeCase(aggPapers, "sentence"))
+
+	p := aggPapers["LEARNING TO REPRESENT PROGRAMS WITH GRAPHS"]
+	assert.Equal(t, "Learning to represent programs with graphs", p.Title)
+	assert.Equal(t, "LEARNING TO REPRESENT PROGRAMS WITH GRAPHS", p.RawTitle)
+	assert.Equal(t, "", aggPapers["Neural code search"].RawTitle)
+
+	assert.Error(t, NormalizeCase(aggPapers, "upper"))
+}
+
+func TestSanitize(t *testing.T) {
+	var testCases = []struct {
+		text, clean string
+	}{
+		{"Learning tasks on source code", "Learning tasks on source code"},
+		{"Learning <b>tasks</b> on\n  source code", "Learning tasks on source code"},
+		{"Learning &lt;script&gt;alert(1)&lt;/script&gt; tasks", "Learning <script>alert(1)</script> tasks"},
+		{"Typing Optional&lt;T&gt; in Java", "Typing Optional<T> in Java"},
+		{"Bounds for n&lt;k and k&gt;m", "Bounds for n<k and k>m"},
+		{"Learning &amp;amp; tasks", "Learning & tasks"},
+		{"Learning <!-- x --> tasks &amp; a &lt; b", "Learning tasks & a < b"},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.clean, sanitize(tc.text), tc.text)
+	}
+}
+
+func TestKeywords(t *testing.T) {
+	aggPapers := AggPapers{
+		"Blockchain for code": &Paper{Title: "Blockchain for code"},
+		"Neural code search":  &Paper{Title: "Neural code search", Abstract: Abstract{"Using deep learning", " to search code"}},
+		"Learning to represent programs with graphs": &Paper{Title: "Learning to represent programs with graphs",
+			Abstract: Abstract{"Learning tasks on source code", " (deep-learning, GNN)"}},
+		"Smart contracts": &Paper{Title: "Smart contracts", Abstract: Abstract{"on the BLOCKCHAIN", ""}},
+	}
+
+	var testCases = []struct {
+		include, exclude []string
+		titles           []string
+	}{
+		{nil, nil, []string{"Blockchain for code", "Learning to represent programs with graphs", "Neural code search", "Smart contracts"}},
+		{nil, []string{"blockchain"}, []string{"Learning to represent programs with graphs", "Neural code search"}},
+		{[]string{"Deep Learning", "GNN"}, nil, []string{"Learning to represent programs with graphs", "Neural code search"}},
+		{[]string{"code"}, []string{"blockchain", "search"}, []string{"Learning to represent programs with graphs"}},
+		{[]string{"graph"}, nil, nil},
+	}
+
+	for _, tc := range testCases {
+		var titles []string
+		for title := range Filter(aggPapers, Keywords(tc.include, tc.exclude)) {
+			titles = append(titles, title)
+		}
+		sort.Strings(titles)
+		assert.Equal(t, tc.titles, titles, "include %v, exclude %v", tc.include, tc.exclude)
+	}
+}
+
+func TestKeyphrases(t *testing.T) {
+	text := "Neural code search. We present a neural code search tool, that uses deep learning to search code " +
+		"in large code bases, and evaluate the tool on the Stack Overflow questions."
+	assert.Equal(t, []string{"stack overflow questions", "neural code search", "search code"}, Keyphrases(text, 3))
+	assert.Empty(t, Keyphrases("On the use of it.", 3), "only stop words")
+
+	aggPapers := AggPapers{
+		"Neural code search": &Paper{Title: "Neural code search", Abstract: Abstract{"Using deep learning", " to search code"}},
+		"Smart contracts":    &Paper{Title: "Smart contracts", Abstract: Abstract{"A survey of smart contracts on the blockchain", ""}},
+	}
+	ExtractKeywords(aggPapers, 2)
+	assert.Equal(t, []string{"neural code search", "search code"}, aggPapers["Neural code search"].Keywords)
+
+	kept := Filter(aggPapers, ByKeyphrases([]string{"code", "blockchain"}, []string{"smart"}))
+	assert.Len(t, kept, 1)
+	assert.Contains(t, kept, "Neural code search")
+	assert.Len(t, Filter(aggPapers, ByKeyphrases([]string{"learning"}, nil)), 0, "not a keyphrase")
+}
+
+func TestDetectLanguage(t *testing.T) {
+	for text, lang := range map[string]string{
+		"We propose a new approach to the repair of programs, that is evaluated on the benchmark.":               "en",
+		"En este trabajo se presenta un método para la reparación automática de programas.":                      "es",
+		"Neste trabalho é apresentado um método para a reparação automática de programas, que não requer dados.": "pt",
+		"Dans cet article, nous présentons une méthode pour la réparation automatique des programmes.":           "fr",
+		"In dieser Arbeit stellen wir eine Methode für die automatische Reparatur von Programmen vor.":           "de",
+		"In questo lavoro presentiamo un metodo per la riparazione automatica dei programmi.":                    "it",
+		"本文提出了一种基于神经网络的程序自动修复方法。":                                                                                "zh",
+		"本論文では、ニューラルネットワークを用いたプログラムの自動修復手法を提案する。":                                                                "ja",
+		"В данной работе предлагается метод автоматического исправления программ.":                               "ru",
+		"Neural code search": "",
+		"":                   "",
+	} {
+		assert.Equal(t, lang, DetectLanguage(text), text)
+	}
+
+	aggPapers := AggPapers{
+		"Repair":                             &Paper{Title: "Repair", Abstract: NewAbstract("We propose a new approach to the repair of the programs.")},
+		"Reparación automática de programas": &Paper{Title: "Reparación automática de programas", Language: "en"},
+		"Reparar":                            &Paper{Title: "Reparar", Abstract: NewAbstract("Se presenta un método para la reparación de los programas.")},
+	}
+	DetectLanguages(aggPapers, "en")
+	assert.Empty(t, aggPapers["Repair"].Language, "in the language of the reader")
+	assert.Empty(t, aggPapers["Reparación automática de programas"].Language, "unknown")
+	assert.Equal(t, "es", aggPapers["Reparar"].Language)
+}
+
+func TestByAuthors(t *testing.T) {
+	byAllamanis := ByAuthors([]string{"Miltiadis Allamanis", "  "})
+	assert.True(t, byAllamanis(&Paper{Authors: []string{"M Brockschmidt", "M Allamanis"}}))
+	assert.True(t, byAllamanis(&Paper{Authors: []string{"m. allamanis"}}))
+	assert.False(t, byAllamanis(&Paper{Authors: []string{"A Allamanis"}}))
+	assert.False(t, byAllamanis(&Paper{}))
+
+	assert.True(t, ByAuthors([]string{"M Monperrus"})(&Paper{Authors: []string{"Martin Monperrus"}}))
+}
+
+func TestByVenues(t *testing.T) {
+	icse := &Paper{Source: "2020 IEEE/ACM 42nd International Conference on Software Engineering (ICSE), 2020 - ieeexplore.ieee.org"}
+	arXiv := &Paper{Source: "arXiv preprint arXiv:1912.02015, 2019"}
+	predatory := &Paper{Source: "International Journal of Everything, 2019 - Predatory Press"}
+
+	onlyConfs := ByVenues([]string{"icse", "FSE", "arXiv"})
+	assert.True(t, onlyConfs(icse))
+	assert.True(t, onlyConfs(arXiv))
+	assert.False(t, onlyConfs(predatory))
+	assert.False(t, onlyConfs(&Paper{}))
+
+	assert.True(t, ByVenues([]string{"Predatory Press"})(predatory))
+}
+
+func TestByMinEmails(t *testing.T) {
+	msgs := []*gmail.Message{
+		paperMsg("1", "Neural code search", "https://arxiv.org/abs/1"),
+		paperMsg("1", "Neural code search", "https://arxiv.org/abs/1"),
+		paperMsg("2", "code2vec", "https://arxiv.org/abs/2"),
+		paperMsg("3", "code2vec", "https://arxiv.org/abs/2"),
+	}
+	_, aggPapers := ExtractAndAggPapersFromMsgs(msgs, false, false)
+	assert.Equal(t, 1, aggPapers["Neural code search"].Emails())
+	assert.Equal(t, 2, aggPapers["code2vec"].Emails())
+	assert.Equal(t, []string{"2", "3"}, aggPapers["code2vec"].MsgIDs())
+
+	assert.Equal(t, []string{"code2vec"}, SortedKeys(Filter(aggPapers, ByMinEmails(2))))
+	assert.True(t, ByMinEmails(2)(&Paper{Freq: 2}), "Freq is used, if emails are unknown")
+}
+
+func TestByDomains(t *testing.T) {
+	blocked := ByDomains([]string{"www.researchgate.net", "content-farm.com"})
+	assert.True(t, blocked(&Paper{URL: "https://www.researchgate.net/publication/1"}))
+	assert.True(t, blocked(&Paper{URL: "http://papers.content-farm.com/1"}))
+	assert.False(t, blocked(&Paper{URL: "https://not-content-farm.com/1"}))
+	assert.False(t, blocked(&Paper{URL: "https://arxiv.org/abs/1"}))
+}
+
+func TestFilters(t *testing.T) {
+	newPapers := func() AggPapers {
+		return AggPapers{
+			"Neural code search": &Paper{Title: "Neural code search", URL: "https://arxiv.org/abs/1", Freq: 2,
+				Authors: []string{"M Allamanis"}, Source: "arXiv preprint arXiv:1, 2019"},
+			"Program repair": &Paper{Title: "Program repair", URL: "https://www.researchgate.net/publication/2", Freq: 1,
+				Authors: []string{"M Monperrus"}, Source: "ICSE, 2020"},
+			"Type inference": &Paper{Title: "Type inference", URL: "https://example.com/3", Freq: 1,
+				Authors: []string{"J Doe"}, Source: "International Journal of Everything, 2019"},
+		}
+	}
+	for _, tc := range []struct {
+		name        string
+		filters     Filters
+		kept        []string
+		highlighted []string
+		demoted     []string
+	}{
+		{"none", Filters{}, []string{"Neural code search", "Program repair", "Type inference"}, nil, nil},
+		{"deny authors", Filters{DenyAuthors: []string{"Martin Monperrus"}}, []string{"Neural code search", "Type inference"}, nil, nil},
+		{"block domains", Filters{BlockDomains: []string{"www.researchgate.net"}}, []string{"Neural code search", "Type inference"}, nil, nil},
+		{"demote domains", Filters{DemoteDomains: []string{"www.researchgate.net"}},
+			[]string{"Neural code search", "Program repair", "Type inference"}, nil, []string{"Program repair"}},
+		{"min emails", Filters{MinEmails: 2}, []string{"Neural code search"}, nil, nil},
+		{"allowed authors are kept", Filters{MinEmails: 2, AllowAuthors: []string{"J Doe"}},
+			[]string{"Neural code search", "Type inference"}, []string{"Type inference"}, nil},
+		{"include", Filters{Include: []string{"search", "repair"}}, []string{"Neural code search", "Program repair"}, nil, nil},
+		{"exclude", Filters{Exclude: []string{"search"}}, []string{"Program repair", "Type inference"}, nil, nil},
+		{"venues", Filters{Venues: []string{"ICSE", "arXiv"}}, []string{"Neural code search", "Program repair"}, nil, nil},
+		{"exclude venues", Filters{ExcludeVenues: []string{"International Journal of Everything"}},
+			[]string{"Neural code search", "Program repair"}, nil, nil},
+		{"all of them", Filters{Include: []string{"search", "repair", "inference"}, Venues: []string{"ICSE", "arXiv"},
+			BlockDomains: []string{"www.researchgate.net"}}, []string{"Neural code search"}, nil, nil},
+	} {
+		kept := tc.filters.Apply(newPapers())
+		assert.Equal(t, tc.kept, sortedTitles(kept), tc.name)
+		var highlighted, demoted []string
+		for _, title := range sortedTitles(kept) {
+			if kept[title].Highlight {
+				highlighted = append(highlighted, title)
+			}
+			if kept[title].Demoted {
+				demoted = append(demoted, title)
+			}
+		}
+		assert.Equal(t, tc.highlighted, highlighted, tc.name)
+		assert.Equal(t, tc.demoted, demoted, tc.name)
+	}
+}
+
+func TestSortedKeysDemoted(t *testing.T) {
+	aggPapers := AggPapers{
+		"a": &Paper{Title: "a", Freq: 3, Demoted: true},
+		"b": &Paper{Title: "b", Freq: 1},
+		"c": &Paper{Title: "c", Freq: 2},
+	}
+	assert.Equal(t, []string{"c", "b", "a"}, SortedKeys(aggPapers))
+}
+
+func TestCorpusScore(t *testing.T) {
+	corpus := NewCorpus(bibTexts(`
+@article{allamanis2018survey,
+  title = {A Survey of Machine Learning for {Big Code} and Naturalness},
+  author = {Allamanis, Miltiadis and others},
+  abstract = "Research at the intersection of machine learning and programming languages",
+}
+@inproceedings{gcc,
+  title={Compiler optimization of loops},
+}`))
+
+	relevant := &Paper{Title: "Machine learning on source code: naturalness of programming languages"}
+	other := &Paper{Title: "Protein folding in yeast"}
+	assert.True(t, corpus.Score(relevant) > 0.3)
+	assert.Equal(t, 0.0, corpus.Score(other))
+
+	aggPapers := AggPapers{relevant.Title: relevant, other.Title: other}
+	other.Freq = 2
+	ScoreRelevance(aggPapers, corpus)
+	assert.Equal(t, []string{relevant.Title, other.Title}, SortedKeys(aggPapers))
+}
+
+func TestBibTexts(t *testing.T) {
+	texts := bibTexts(`@misc{a, title = "Quoted {T}itle", note = {skipped}}
+@book{b, Title = {Nested {Braces}}, keywords = {ml, se}}
+@misc{c, author = {No One}}`)
+	assert.Equal(t, []string{"Quoted Title", "Nested Braces ml, se"}, texts)
+}
+
+func TestParseWeights(t *testing.T) {
+	w, err := ParseWeights("freq=1, recency=0.5,Citations=2,influential=1,attention=0.1")
+	require.NoError(t, err)
+	assert.Equal(t, Weights{Freq: 1, Recency: 0.5, Citations: 2, Influential: 1, Attention: 0.1}, w)
+
+	for _, invalid := range []string{"", "freq", "freq=-1", "freq=x", "age=1", "freq=0"} {
+		_, err := ParseWeights(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestRank(t *testing.T) {
+	now := time.Date(2019, 12, 8, 0, 0, 0, 0, time.UTC)
+	aggPapers := AggPapers{
+		"frequent": &Paper{Title: "frequent", Freq: 4, date: now.AddDate(0, 0, -14)},
+		"recent":   &Paper{Title: "recent", Freq: 1, date: now},
+		"cited":    &Paper{Title: "cited", Freq: 2, Citations: 100, date: now.AddDate(0, 0, -7)},
+		"built on": &Paper{Title: "built on", Freq: 3, Citations: 10, InfluentialCitations: 5, date: now.AddDate(0, 0, -21)},
+	}
+
+	Rank(aggPapers, Weights{Freq: 1}, now)
+	assert.Equal(t, []string{"frequent", "built on", "cited", "recent"}, SortedKeys(aggPapers))
+	assert.Equal(t, 1.0, aggPapers["frequent"].Score)
+
+	Rank(aggPapers, Weights{Recency: 1}, now)
+	assert.Equal(t, []string{"recent", "cited", "frequent", "built on"}, SortedKeys(aggPapers))
+	assert.Equal(t, 0.5, aggPapers["cited"].Score, "recency halves in a week")
+
+	Rank(aggPapers, Weights{Freq: 1, Citations: 1}, now)
+	assert.Equal(t, []string{"cited", "built on", "frequent", "recent"}, SortedKeys(aggPapers))
+
+	Rank(aggPapers, Weights{Freq: 1, Influential: 1}, now)
+	assert.Equal(t, []string{"built on", "frequent", "cited", "recent"}, SortedKeys(aggPapers))
+
+	aggPapers["recent"].Attention = 250
+	Rank(aggPapers, Weights{Attention: 1}, now)
+	assert.Equal(t, "recent", SortedKeys(aggPapers)[0])
+	assert.Equal(t, 1.0, aggPapers["recent"].Score)
+}
+
+func TestScoreAll(t *testing.T) {
+	aggPapers := AggPapers{
+		"a":   &Paper{Title: "a", Freq: 3},
+		"bb":  &Paper{Title: "bb", Freq: 1},
+		"ccc": &Paper{Title: "ccc", Freq: 2},
+	}
+	byLen := ScorerFunc(func(p *Paper) float64 { return float64(len(p.Title)) })
+	ScoreAll(aggPapers, byLen)
+	assert.Equal(t, []string{"ccc", "bb", "a"}, SortedKeys(aggPapers))
+
+	ScoreAll(aggPapers, Mean(byLen, ScorerFunc(func(p *Paper) float64 { return float64(p.Freq) })))
+	assert.Equal(t, 2.0, aggPapers["a"].Score)
+	assert.Equal(t, []string{"ccc", "a", "bb"}, SortedKeys(aggPapers))
+}
+
+func TestTopics(t *testing.T) {
+	aggPapers := AggPapers{}
+	for _, title := range []string{
+		"Neural code search", "Neural code completion", "Learning code embeddings of neural networks",
+		"Galaxy formation in dark matter halos", "Dark matter halos of dwarf galaxy clusters", "Galaxy rotation curves and dark matter",
+		"On nothing",
+	} {
+		aggPapers[title] = &Paper{Title: title}
+	}
+
+	Topics(aggPapers, 2, nil)
+	assert.Equal(t, "Code, neural", aggPapers["Neural code search"].Topic)
+	assert.Equal(t, aggPapers["Neural code search"].Topic, aggPapers["Learning code embeddings of neural networks"].Topic)
+	assert.Equal(t, "Dark, galaxy, matter", aggPapers["Galaxy formation in dark matter halos"].Topic)
+	assert.Equal(t, aggPapers["Galaxy formation in dark matter halos"].Topic, aggPapers["Galaxy rotation curves and dark matter"].Topic)
+	assert.Empty(t, aggPapers["On nothing"].Topic, "no terms, shared with other papers")
+
+	vectors := map[string][]float64{
+		"Neural code search": {1, 0}, "Neural code completion": {0.9, 0.1}, "On nothing": {0.95, 0.05},
+		"Galaxy formation in dark matter halos": {0, 1},
+	}
+	Topics(aggPapers, 0, vectors)
+	assert.Equal(t, aggPapers["Neural code search"].Topic, aggPapers["On nothing"].Topic, "by the given vectors")
+	assert.NotEqual(t, aggPapers["Neural code search"].Topic, aggPapers["Galaxy formation in dark matter halos"].Topic)
+	assert.Empty(t, aggPapers["Galaxy rotation curves and dark matter"].Topic, "no vector")
+}
+
+func TestSplitList(t *testing.T) {
+	assert.Equal(t, []string{"deep learning", "gnn"}, SplitList(" deep learning, gnn,,"))
+	assert.Nil(t, SplitList(""))
+}
+
+func TestAggregateCitations(t *testing.T) {
+	msgs := []*gmail.Message{
+		citationMsg("1", `"Learning to represent programs with graphs" - new citations`),
+		citationMsg("2", `"code2vec" - new citations`),
+		citationMsg("3", `"code2vec" - new citations`),
+	}
+
+	_, aggPapers := ExtractAndAggPapersFromMsgs(msgs, false, false)
+	require.Len(t, aggPapers, 1)
+	p := aggPapers["Neural code search"]
+	assert.Equal(t, 3, p.Freq)
+	assert.Equal(t, gmailutils.NewCitations, p.Alert)
+	assert.Equal(t, []string{"Learning to represent programs with graphs", "code2vec"}, p.Cites)
+}
+
+// citationMsg returns a message \w a given subject, citing a single paper.
+func citationMsg(id, subj string) *gmail.Message {
+	body := `<h3><a href="https://scholar.google.com/scholar_url?url=https://arxiv.org/abs/1&amp;hl=en">Neural code search</a></h3>` +
+		`<div>A Author - arXiv, 2020</div><div>Abstract</div>`
+	return &gmail.Message{Id: id, Payload: &gmail.MessagePart{
+		MimeType: "text/html",
+		Headers:  []*gmail.MessagePartHeader{{Name: "Subject", Value: subj}},
+		Body:     &gmail.MessagePartBody{Data: base64.URLEncoding.EncodeToString([]byte(body))},
+	}}
+}
+
+const plainTextAlert = `Scholar Alert: [ Miltiadis Allamanis ] new related research
+
+[PDF] Using Sequence-to-Sequence Learning for Repairing C Vulnerabilities
+<http://scholar.google.com/scholar_url?url=https://arxiv.org/pdf/1912.02015&hl=en&sa=X>
+Z Chen, S Kommrusch, M Monperrus - arXiv preprint arXiv:1912.02015, 2019
+Software vulnerabilities affect all businesses and research is being done
+to avoid, detect or repair them.
+
+Neural code search <http://scholar.google.com/scholar_url?url=https://arxiv.org/abs/1&hl=en>
+A Author - 2020
+
+This message was sent by Google Scholar because you're following new articles.
+`
+
+func TestExtractEntriesFromText(t *testing.T) {
+	entries := extractEntriesFromText(strings.ReplaceAll(plainTextAlert, "\n", "\r\n"))
+	require.Len(t, entries, 2)
+
+	assert.Equal(t, "[PDF] Using Sequence-to-Sequence Learning for Repairing C Vulnerabilities", entries[0].heading)
+	assert.Equal(t, "http://scholar.google.com/scholar_url?url=https://arxiv.org/pdf/1912.02015&hl=en&sa=X", entries[0].url)
+	assert.Equal(t, "Z Chen, S Kommrusch, M Monperrus - arXiv preprint arXiv:1912.02015, 2019", entries[0].publication)
+	assert.Equal(t, "Software vulnerabilities affect all businesses and research is being done to avoid, detect or repair them.", entries[0].abstract)
+
+	assert.Equal(t, "Neural code search", entries[1].title)
+	assert.Equal(t, "A Author - 2020", entries[1].publication)
+	assert.Equal(t, "", entries[1].abstract)
+}
+
+func TestExtractPapersFromPlainText(t *testing.T) {
+	msg := &gmail.Message{Id: "1", Payload: &gmail.MessagePart{
+		MimeType: "text/plain",
+		Headers:  []*gmail.MessagePartHeader{{Name: "Subject", Value: "Miltiadis Allamanis - new related research"}},
+		Body:     &gmail.MessagePartBody{Data: base64.URLEncoding.EncodeToString([]byte(plainTextAlert))},
+	}}
+
+	st, aggPapers := ExtractAndAggPapersFromMsgs([]*gmail.Message{msg}, true, false)
+	assert.Equal(t, 0, st.Errs)
+	require.Len(t, aggPapers, 2)
+
+	p := aggPapers["Using Sequence-to-Sequence Learning for Repairing C Vulnerabilities"]
+	require.NotNil(t, p)
+	assert.Equal(t, "https://arxiv.org/pdf/1912.02015", p.URL)
+	assert.Equal(t, KindPDF, p.Kind)
+	assert.Equal(t, 2019, p.Year)
+}
+
+func TestExtractPapersFromFixtures(t *testing.T) {
+	msgs := gmailutils.ReadMsgFixturesJSON("../fixtures/unread.json")
+	st, aggPapers := ExtractAndAggPapersFromMsgs(msgs, true, true)
+	require.Equal(t, 0, st.Errs)
+	require.NotEmpty(t, aggPapers)
+
+	p, ok := aggPapers["Using Sequence-to-Sequence Learning for Repairing C Vulnerabilities"]
+	require.True(t, ok)
+	assert.Equal(t, "https://arxiv.org/pdf/1912.02015", p.URL)
+	assert.Equal(t, []string{"Z Chen", "S Kommrusch", "M Monperrus"}, p.Authors)
+	assert.Equal(t, "arXiv preprint arXiv:1912.02015, 2019", p.Source)
+	assert.Equal(t, "arXiv preprint arXiv:1912.02015", p.Venue)
+	assert.Equal(t, 2019, p.Year)
+	assert.Equal(t, gmailutils.RelatedResearch, p.Alert)
+	assert.Equal(t, KindPDF, p.Kind)
+}
+
+func TestExtractPapersFromForwarded(t *testing.T) {
+	msg := gmailutils.ReadMsgFixturesJSON("../fixtures/unread.json")[0]
+	body, err := gmailutils.MessageTextBody(msg.Payload)
+	require.NoError(t, err)
+
+	fwd := `<div class="gmail_quote">---------- Forwarded message ---------<br>` +
+		`From: <b>Google Scholar Alerts</b> &lt;scholaralerts-noreply@google.com&gt;<br>` +
+		`Subject: Miltiadis Allamanis - new related research<br>To: &lt;me@example.com&gt;<br></div>` + string(body)
+	fwdMsg := &gmail.Message{Id: "fwd", Payload: &gmail.MessagePart{
+		MimeType: "text/html",
+		Headers:  []*gmail.MessagePartHeader{{Name: "Subject", Value: "Fwd: papers you might like"}},
+		Body:     &gmail.MessagePartBody{Data: base64.URLEncoding.EncodeToString([]byte(fwd))},
+	}}
+
+	st, aggPapers := ExtractAndAggPapersFromMsgs([]*gmail.Message{fwdMsg}, false, true)
+	require.Equal(t, 0, st.Errs)
+	p, ok := aggPapers["Using Sequence-to-Sequence Learning for Repairing C Vulnerabilities"]
+	require.True(t, ok)
+	assert.Equal(t, gmailutils.RelatedResearch, p.Alert)
+	assert.Equal(t, []Ref{{"fwd", "Miltiadis Allamanis"}}, p.Refs)
+}
+
+func TestExtractEntriesFromQuotedText(t *testing.T) {
+	quoted := "---------- Forwarded message ---------\nSubject: Miltiadis Allamanis - new related research\n\n" +
+		"> " + strings.ReplaceAll(plainTextAlert, "\n", "\n> ")
+	assert.Equal(t, extractEntriesFromText(plainTextAlert), extractEntriesFromText(quoted))
+	assert.Equal(t, "Miltiadis Allamanis - new related research", forwardedSubject([]byte(quoted)))
+}
+
+func TestReadSelectors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "selectors")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "selectors.json")
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"title": "//h4/a", "url": "//h4/a/@href"}`), 0600))
+	s, err := ReadSelectors(path)
+	require.NoError(t, err)
+	assert.Equal(t, "//h4/a", s.Title)
+	assert.Equal(t, "//h4/a/@href", s.URL)
+	assert.Equal(t, DefaultSelectors.Abstract, s.Abstract)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"abstract": "//div[@class="`+"`"+`}`), 0600))
+	_, err = ReadSelectors(path)
+	assert.Error(t, err, "invalid XPath")
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"titel": "//h4/a"}`), 0600))
+	_, err = ReadSelectors(path)
+	assert.Error(t, err, "unknown selector")
+}
+
+func TestUseSelectors(t *testing.T) {
+	defer UseSelectors(DefaultSelectors)
+
+	body := `<h4><a href="http://scholar.google.com/scholar_url?url=https://arxiv.org/abs/1">Neural code search</a></h4><p>A Author - 2020</p><p>Abstract</p>`
+	msg := &gmail.Message{Id: "1", Payload: &gmail.MessagePart{
+		MimeType: "text/html",
+		Body:     &gmail.MessagePartBody{Data: base64.URLEncoding.EncodeToString([]byte(body))},
+	}}
+
+	_, aggPapers := ExtractAndAggPapersFromMsgs([]*gmail.Message{msg}, true, false)
+	assert.Empty(t, aggPapers)
+
+	UseSelectors(Selectors{
+		Title:    "//h4/a",
+		URL:      "//h4/a/@href",
+		Authors:  "//h4/following-sibling::p[1]",
+		Abstract: "//h4/following-sibling::p[2]",
+	})
+	_, aggPapers = ExtractAndAggPapersFromMsgs([]*gmail.Message{msg}, true, false)
+	require.Len(t, aggPapers, 1)
+	assert.Equal(t, 2020, aggPapers["Neural code search"].Year)
+	assert.Equal(t, "Abstract", aggPapers["Neural code search"].Abstract.FirstLine)
+}
+
 var lineSplitCases = []struct {
 	text         string
 	n, lookahead int
@@ -81,8 +819,21 @@ var lineSplitCases = []struct {
 	},
 }
 
+// wordSplitCases are only handled by separateFirstLine, that never cuts words.
+var wordSplitCases = []struct {
+	text         string
+	n, lookahead int
+	first, rest  string
+}{
+	{"a bcdefgh", 2, 2, "a", "bcdefgh"},
+	{"abcdefgh ij", 2, 2, "abcd", "efgh ij"},
+	{"ab cd", 0, 0, "ab cd", ""},
+	{"Learning to represent programs with graphs", 12, 3, "Learning to", "represent programs with graphs"},
+	{"Представление программ графами", 12, 3, "Представление", "программ графами"},
+}
+
 func TestAbstractFirstLine(t *testing.T) {
-	for i, f := range lineSplitCases {
+	for i, f := range append(lineSplitCases, wordSplitCases...) {
 		first, rest := separateFirstLine(f.text, f.n, f.lookahead)
 		require.Equal(t, f.first, first, "case %d", i)
 		require.Equal(t, f.rest, rest, "case %d", i)
@@ -0,0 +1,122 @@
+package papers
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Weights of the components in a composite rank of the paper. Components are scaled to [0, 1].
+type Weights struct {
+	Freq        float64 // number of mentions, relative to the most frequent paper
+	Recency     float64 // how recently the paper first appeared, halving every RecencyHalfLife
+	Citations   float64 // number of citations in log scale, relative to the most cited paper
+	Influential float64 // number of influential citations, the same way, if known from the enrichment
+	Attention   float64 // Altmetric attention score, the same way, if known from the enrichment
+	Relevance   float64 // the Score, set by ScoreRelevance
+}
+
+// RecencyHalfLife is the age of the paper, at which its recency is a half of a just appeared one.
+var RecencyHalfLife = 7 * 24 * time.Hour
+
+// ParseWeights parses comma-separated weights e.g "freq=1,recency=0.5,citations=0.2,attention=0.1,relevance=2".
+// Missing components have zero weight.
+func ParseWeights(s string) (Weights, error) {
+	var w Weights
+	for _, item := range SplitList(s) {
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			return Weights{}, fmt.Errorf("%q is not a <component>=<weight>", item)
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+		if err != nil || weight < 0 {
+			return Weights{}, fmt.Errorf("%q is not a non-negative weight", kv[1])
+		}
+		switch strings.ToLower(strings.TrimSpace(kv[0])) {
+		case "freq":
+			w.Freq = weight
+		case "recency":
+			w.Recency = weight
+		case "citations":
+			w.Citations = weight
+		case "influential":
+			w.Influential = weight
+		case "attention":
+			w.Attention = weight
+		case "relevance":
+			w.Relevance = weight
+		default:
+			return Weights{}, fmt.Errorf("unknown component %q, not one of freq, recency, citations, influential, attention, relevance", kv[0])
+		}
+	}
+	if w.sum() == 0 {
+		return Weights{}, fmt.Errorf("all weights are zero")
+	}
+	return w, nil
+}
+
+// sum returns the sum of all the weights.
+func (w Weights) sum() float64 {
+	return w.Freq + w.Recency + w.Citations + w.Influential + w.Attention + w.Relevance
+}
+
+// Rank sets the Score of every paper to a weighted mean of its components at a given time.
+func Rank(aggPapers AggPapers, w Weights, now time.Time) {
+	ScoreAll(aggPapers, NewRanker(aggPapers, w, now))
+}
+
+// Ranker is a Scorer of the composite rank of the paper, relative to the other papers.
+type Ranker struct {
+	w                              Weights
+	now                            time.Time
+	maxFreq, maxCites, maxInfluent int
+	maxAttention                   float64
+}
+
+// NewRanker returns a Ranker of the given papers at a given time.
+func NewRanker(aggPapers AggPapers, w Weights, now time.Time) *Ranker {
+	r := &Ranker{w: w, now: now}
+	for _, p := range aggPapers {
+		if p.Freq > r.maxFreq {
+			r.maxFreq = p.Freq
+		}
+		if p.Citations > r.maxCites {
+			r.maxCites = p.Citations
+		}
+		if p.InfluentialCitations > r.maxInfluent {
+			r.maxInfluent = p.InfluentialCitations
+		}
+		if p.Attention > r.maxAttention {
+			r.maxAttention = p.Attention
+		}
+	}
+	return r
+}
+
+// Score returns a weighted mean of the components of the paper rank.
+func (r *Ranker) Score(p *Paper) float64 {
+	w := r.w
+	score := w.Relevance * p.Score
+	if r.maxFreq > 0 {
+		score += w.Freq * float64(p.Freq) / float64(r.maxFreq)
+	}
+	if !p.date.IsZero() {
+		age := r.now.Sub(p.date)
+		if age < 0 {
+			age = 0
+		}
+		score += w.Recency * math.Exp2(-float64(age)/float64(RecencyHalfLife))
+	}
+	if r.maxCites > 0 {
+		score += w.Citations * math.Log1p(float64(p.Citations)) / math.Log1p(float64(r.maxCites))
+	}
+	if r.maxInfluent > 0 {
+		score += w.Influential * math.Log1p(float64(p.InfluentialCitations)) / math.Log1p(float64(r.maxInfluent))
+	}
+	if r.maxAttention > 0 {
+		score += w.Attention * math.Log1p(p.Attention) / math.Log1p(r.maxAttention)
+	}
+	return score / w.sum()
+}
@@ -0,0 +1,219 @@
+package papers
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Corpus is a seed collection of liked papers, the incoming papers are scored against by TF-IDF similarity.
+type Corpus struct {
+	docs []map[string]float64 // TF-IDF vectors of the seed documents, normalized to unit length
+	df   map[string]int       // number of seed documents, containing a term
+	n    int                  // number of seed documents
+}
+
+// stopWords are not taken into account for relevance.
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "by": true,
+	"for": true, "from": true, "has": true, "have": true, "in": true, "is": true, "it": true, "its": true,
+	"of": true, "on": true, "or": true, "that": true, "the": true, "this": true, "to": true, "we": true,
+	"which": true, "with": true, "our": true, "can": true, "these": true, "their": true, "using": true,
+	"based": true, "paper": true, "show": true, "approach": true, "results": true,
+}
+
+// bibEntry is a start of the BibTeX entry e.g "@article{key,".
+var bibEntry = regexp.MustCompile(`(?m)^\s*@\w+\s*[{(]`)
+
+// bibField is a start of the BibTeX field, used for relevance e.g "title = {".
+var bibField = regexp.MustCompile(`(?i)\b(title|abstract|keywords)\s*=\s*`)
+
+// NewCorpus builds a seed corpus from the texts of liked papers, e.g titles and abstracts.
+func NewCorpus(texts []string) *Corpus {
+	c := &Corpus{df: map[string]int{}}
+	var tfs []map[string]float64
+	for _, text := range texts {
+		tf := termFreqs(text)
+		if len(tf) == 0 {
+			continue
+		}
+		for term := range tf {
+			c.df[term]++
+		}
+		tfs = append(tfs, tf)
+	}
+	c.n = len(tfs)
+	for _, tf := range tfs {
+		c.docs = append(c.docs, c.vector(tf))
+	}
+	return c
+}
+
+// ReadCorpus reads a seed corpus from a BibTeX file, where every entry is a document,
+// or from a directory of .txt, .md and .bib files, where every text file is a document.
+func ReadCorpus(path string) (*Corpus, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		texts, err := readSeeds(path)
+		if err != nil {
+			return nil, err
+		}
+		return NewCorpus(texts), nil
+	}
+
+	var texts []string
+	err = filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".txt", ".md", ".bib":
+			seeds, err := readSeeds(path)
+			texts = append(texts, seeds...)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return NewCorpus(texts), nil
+}
+
+// readSeeds returns texts of the documents in a file: the BibTeX entries or the whole text.
+func readSeeds(path string) ([]string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".bib") {
+		return bibTexts(string(b)), nil
+	}
+	return []string{string(b)}, nil
+}
+
+// bibTexts returns the title, abstract and keywords of every BibTeX entry.
+func bibTexts(bib string) []string {
+	var texts []string
+	starts := bibEntry.FindAllStringIndex(bib, -1)
+	for i, start := range starts {
+		end := len(bib)
+		if i+1 < len(starts) {
+			end = starts[i+1][0]
+		}
+		entry := bib[start[1]:end]
+
+		var fields []string
+		for _, m := range bibField.FindAllStringIndex(entry, -1) {
+			fields = append(fields, bibValue(entry[m[1]:]))
+		}
+		if text := strings.Join(fields, " "); strings.TrimSpace(text) != "" {
+			texts = append(texts, text)
+		}
+	}
+	return texts
+}
+
+// bibValue returns the value at the start of s, enclosed in (nested) braces or quotes, \wo them.
+func bibValue(s string) string {
+	if s == "" {
+		return ""
+	}
+	switch s[0] {
+	case '{':
+		depth := 0
+		for i, r := range s {
+			switch r {
+			case '{':
+				depth++
+			case '}':
+				depth--
+				if depth == 0 {
+					return strings.NewReplacer("{", "", "}", "").Replace(s[1:i])
+				}
+			}
+		}
+	case '"':
+		if end := strings.IndexByte(s[1:], '"'); end >= 0 {
+			return strings.NewReplacer("{", "", "}", "").Replace(s[1 : end+1])
+		}
+	}
+	return ""
+}
+
+// Score returns the relevance of the paper to the corpus in [0, 1]:
+// a highest cosine similarity of the title and abstract to any of the seed documents.
+func (c *Corpus) Score(p *Paper) float64 {
+	v := c.vector(termFreqs(Text(p)))
+	max := 0.0
+	for _, doc := range c.docs {
+		sim := 0.0
+		for term, w := range v {
+			sim += w * doc[term]
+		}
+		if sim > max {
+			max = sim
+		}
+	}
+	return max
+}
+
+// ScoreRelevance sets the Score of every paper to a mean of the given relevance scores,
+// e.g a similarity to the seed Corpus or a probability of being interesting by the Classifier.
+func ScoreRelevance(aggPapers AggPapers, scorers ...Scorer) {
+	if len(scorers) == 0 {
+		return
+	}
+	ScoreAll(aggPapers, Mean(scorers...))
+}
+
+// vector returns a unit TF-IDF vector of the term frequencies. Terms, unknown to the corpus, are dropped.
+func (c *Corpus) vector(tf map[string]float64) map[string]float64 {
+	v := map[string]float64{}
+	norm := 0.0
+	if c.n == 0 {
+		return v
+	}
+	for term, f := range tf {
+		df := c.df[term]
+		if df == 0 {
+			continue
+		}
+		w := (1 + math.Log(f)) * math.Log(1+float64(c.n+1)/float64(df))
+		v[term] = w
+		norm += w * w
+	}
+	norm = math.Sqrt(norm)
+	for term := range v {
+		v[term] /= norm
+	}
+	return v
+}
+
+// Terms returns the distinct terms of the text, in lower case, \wo punctuation and stop words.
+func Terms(text string) []string {
+	var terms []string
+	for term := range termFreqs(text) {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+	return terms
+}
+
+// termFreqs returns the number of occurrences of every term in the text, \wo stop words.
+func termFreqs(text string) map[string]float64 {
+	tf := map[string]float64{}
+	for _, term := range strings.Fields(normalizeTitle(text)) {
+		if len(term) > 2 && !stopWords[term] {
+			tf[term]++
+		}
+	}
+	return tf
+}
@@ -0,0 +1,72 @@
+package papers
+
+import (
+	"html"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// gmailURL is the prefix of the links to the emails, that are not papers.
+const gmailURL = "https://mail.google.com/"
+
+var (
+	mdLink    = regexp.MustCompile(`\[((?:[^\]\\]|\\.)+)\]\((https?://[^)\s]+)\)`)
+	htmlLink  = regexp.MustCompile(`<a href="(https?://[^"]+)">([^<]+)</a>`)
+	mdEscaped = regexp.MustCompile(`\\(.)`)
+)
+
+// ReadReport returns the papers, linked from a Markdown or HTML report e.g generated by an earlier run,
+// by the title. Only the Title, URL and ID of the papers are known.
+func ReadReport(path string) (AggPapers, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	aggPapers := AggPapers{}
+	add := func(title, url string) {
+		if strings.HasPrefix(url, gmailURL) {
+			return
+		}
+		title = cleanTitle(title)
+		aggPapers[title] = &Paper{Title: title, URL: url, ID: paperID(url), Freq: 1}
+	}
+	for _, m := range mdLink.FindAllStringSubmatch(string(b), -1) {
+		add(mdEscaped.ReplaceAllString(m[1], "$1"), m[2])
+	}
+	for _, m := range htmlLink.FindAllStringSubmatch(string(b), -1) {
+		add(html.UnescapeString(m[2]), html.UnescapeString(m[1]))
+	}
+	return aggPapers, nil
+}
+
+// Diff returns the papers, that are only in the current ones, and the ones that are only in the previous ones.
+// Papers are the same if they have the same ID, URL or the normalized title.
+func Diff(current, previous AggPapers) (added, removed AggPapers) {
+	return only(current, previous), only(previous, current)
+}
+
+// Changes returns the papers, that are only in the current ones, together \w the ones that are only in
+// the previous ones, marked as Removed, and the number of the removed ones.
+func Changes(current, previous AggPapers) (changes AggPapers, removed int) {
+	changes, gone := Diff(current, previous)
+	for title, p := range gone {
+		p.Removed = true
+		changes[title] = p
+	}
+	return changes, len(gone)
+}
+
+// only returns the papers, that are not in the other ones.
+func only(aggPapers, other AggPapers) AggPapers {
+	keys := map[string]bool{}
+	for _, p := range other {
+		keys[p.Key()] = true
+		keys[p.URL] = true
+		keys["title:"+normalizeTitle(p.Title)] = true
+	}
+	return Filter(aggPapers, func(p *Paper) bool {
+		return !keys[p.Key()] && !keys[p.URL] && !keys["title:"+normalizeTitle(p.Title)]
+	})
+}
@@ -0,0 +1,57 @@
+package papers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadReportDiff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "report")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "report.md")
+	report := `# Google Scholar Alert Digest
+
+## New papers
+
+ - [Learning to represent programs \[with\] graphs](https://arxiv.org/abs/1711.00740v2), <i>M Allamanis</i> <a target='_blank' href='https://mail.google.com/mail/#inbox/1'>1</a>
+ - [code2vec](https://dl.acm.org/doi/10.1145/3290353)
+<tr><td><a href="https://example.com/old">An old paper &amp; more</a></td></tr>
+`
+	require.NoError(t, ioutil.WriteFile(path, []byte(report), 0644))
+
+	previous, err := ReadReport(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"An old paper & more", "Learning to represent programs [with] graphs", "code2vec"}, sortedTitles(previous))
+	assert.Equal(t, "arxiv:1711.00740", previous["Learning to represent programs [with] graphs"].ID)
+
+	current := AggPapers{
+		"Learning to represent programs with graphs": &Paper{Title: "Learning to represent programs with graphs", URL: "https://arxiv.org/abs/1711.00740", ID: "arxiv:1711.00740"},
+		"Code2Vec":           &Paper{Title: "Code2Vec", URL: "https://example.com/code2vec"},
+		"Neural code search": &Paper{Title: "Neural code search", URL: "https://example.com/ncs"},
+	}
+	added, removed := Diff(current, previous)
+	assert.Equal(t, []string{"Neural code search"}, sortedTitles(added))
+	assert.Equal(t, []string{"An old paper & more"}, sortedTitles(removed))
+
+	changes, n := Changes(current, previous)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []string{"An old paper & more", "Neural code search"}, sortedTitles(changes))
+	assert.True(t, changes["An old paper & more"].Removed)
+	assert.False(t, changes["Neural code search"].Removed)
+}
+
+func sortedTitles(aggPapers AggPapers) []string {
+	var titles []string
+	for title := range aggPapers {
+		titles = append(titles, title)
+	}
+	sort.Strings(titles)
+	return titles
+}
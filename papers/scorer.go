@@ -0,0 +1,33 @@
+package papers
+
+// Scorer scores a paper e.g by relevance. Papers are sorted by the Score in descending order,
+// so a custom ranking only needs to set it \w ScoreAll, before the papers are rendered.
+type Scorer interface {
+	Score(p *Paper) float64
+}
+
+// ScorerFunc is an adapter to use an ordinary function as a Scorer.
+type ScorerFunc func(p *Paper) float64
+
+// Score returns f(p).
+func (f ScorerFunc) Score(p *Paper) float64 {
+	return f(p)
+}
+
+// Mean returns a Scorer, scoring a paper by the mean of the given scores.
+func Mean(scorers ...Scorer) Scorer {
+	return ScorerFunc(func(p *Paper) float64 {
+		sum := 0.0
+		for _, s := range scorers {
+			sum += s.Score(p)
+		}
+		return sum / float64(len(scorers))
+	})
+}
+
+// ScoreAll sets the Score of every paper, which SortedKeys sorts them by.
+func ScoreAll(aggPapers AggPapers, s Scorer) {
+	for _, p := range aggPapers {
+		p.Score = s.Score(p)
+	}
+}
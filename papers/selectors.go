@@ -0,0 +1,59 @@
+package papers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/antchfx/xpath"
+)
+
+// Selectors are XPath expressions, locating paper details in the HTML body of an alert email.
+// Matches of every expression are paired by their order in the email.
+type Selectors struct {
+	Title    string `json:"title"`
+	URL      string `json:"url"`
+	Authors  string `json:"authors"` // authors, venue and year
+	Abstract string `json:"abstract"`
+}
+
+// DefaultSelectors match the current markup of Google Scholar alerts.
+var DefaultSelectors = Selectors{
+	Title:    "//h3/a",
+	URL:      "//h3/a/@href",
+	Authors:  "//h3/following-sibling::div[1]",
+	Abstract: "//h3/following-sibling::div[2]",
+}
+
+// selectors are used for extraction of papers from all emails.
+var selectors = DefaultSelectors
+
+// UseSelectors overrides the selectors, used for extraction of papers.
+func UseSelectors(s Selectors) {
+	selectors = s
+}
+
+// ReadSelectors reads selector overrides from a JSON file. Missing ones are set to the DefaultSelectors.
+func ReadSelectors(path string) (Selectors, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Selectors{}, err
+	}
+	defer f.Close()
+
+	s := DefaultSelectors
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&s); err != nil {
+		return Selectors{}, fmt.Errorf("failed to parse selectors in %s: %v", path, err)
+	}
+
+	for name, expr := range map[string]string{
+		"title": s.Title, "url": s.URL, "authors": s.Authors, "abstract": s.Abstract,
+	} {
+		if _, err := xpath.Compile(expr); err != nil {
+			return Selectors{}, fmt.Errorf("%s: not valid XPath expression %q: %v", name, expr, err)
+		}
+	}
+	return s, nil
+}
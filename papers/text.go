@@ -0,0 +1,88 @@
+package papers
+
+import (
+	"regexp"
+	"strings"
+)
+
+// scholarURLInText matches a scholar link in the plain text, \w or \wo the surrounding "<>".
+var scholarURLInText = regexp.MustCompile(`<?(https?://scholar\.google\.\p{L}+(\.\p{L}+)?/scholar_url\?url=[^\s<>\]]+)>?`)
+
+// quoteMarker matches "> " markers of the quoted text e.g in forwarded messages.
+var quoteMarker = regexp.MustCompile(`^(\s*>)+ ?`)
+
+// extractEntriesFromText returns paper entries from the plain text body of an email.
+//
+// Each paper is expected to be a block of lines, where a title is followed by a scholar
+// link (on the same or the next line), then by the authors and the abstract:
+//
+//	[PDF] Title
+//	<http://scholar.google.com/scholar_url?url=...>
+//	A Author, B Author - Venue, 2019
+//	Abstract
+func extractEntriesFromText(text string) []entry {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = quoteMarker.ReplaceAllString(line, "")
+	}
+
+	type link struct{ line, titleLine int }
+	var links []link
+	for i, line := range lines {
+		loc := scholarURLInText.FindStringIndex(line)
+		if loc == nil {
+			continue
+		}
+		titleLine := i
+		if strings.TrimSpace(line[:loc[0]]) == "" { // title is on the previous line
+			titleLine = -1
+			for j := i - 1; j >= 0 && (len(links) == 0 || j > links[len(links)-1].line); j-- {
+				if strings.TrimSpace(lines[j]) != "" {
+					titleLine = j
+					break
+				}
+			}
+		}
+		if titleLine >= 0 {
+			links = append(links, link{i, titleLine})
+		}
+	}
+
+	var entries []entry
+	for n, l := range links {
+		end := len(lines) // of the current entry
+		if n+1 < len(links) {
+			end = links[n+1].titleLine
+		}
+
+		var e entry
+		line := lines[l.line]
+		m := scholarURLInText.FindStringSubmatchIndex(line)
+		e.url = line[m[2]:m[3]]
+		if l.titleLine == l.line {
+			e.heading = strings.TrimRight(line[:m[0]], " \t([")
+		} else {
+			e.heading = lines[l.titleLine]
+		}
+		e.heading = strings.TrimSpace(e.heading)
+		e.title = e.heading
+
+		var abstract []string
+		for i := l.line + 1; i < end; i++ {
+			text := strings.TrimSpace(lines[i])
+			switch {
+			case text == "" && e.publication == "":
+				continue
+			case text == "":
+				i = end // abstract ends on a blank line
+			case e.publication == "":
+				e.publication = text
+			default:
+				abstract = append(abstract, text)
+			}
+		}
+		e.abstract = strings.Join(abstract, " ")
+		entries = append(entries, e)
+	}
+	return entries
+}
@@ -0,0 +1,257 @@
+package papers
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+const (
+	// maxTopics is the max number of the topics, if not set explicitly.
+	maxTopics = 12
+	// topicIterations is the max number of the iterations of k-means.
+	topicIterations = 20
+	// topicLabelTerms is the number of the terms in the label of a topic.
+	topicLabelTerms = 3
+)
+
+// Topics sets the Topic of every paper to the label of its cluster of similar papers, one of k clusters,
+// or of about sqrt(n/2) clusters of n papers, if k is 0. Papers are clustered by the given vectors e.g
+// embeddings of the title and abstract, by title, or by TF-IDF of their titles and abstracts, if nil.
+// Papers \wo a vector, or \w a zero one, have no Topic. Labels are the terms of the titles and abstracts,
+// the most specific to the cluster, e.g "Code, programs, graph".
+func Topics(aggPapers AggPapers, k int, vectors map[string][]float64) {
+	if vectors == nil {
+		vectors = tfidfVectors(aggPapers)
+	}
+	var all []string
+	for title, p := range aggPapers {
+		p.Topic = ""
+		all = append(all, title)
+	}
+	sort.Strings(all) // for the same clusters on every run
+
+	var titles []string
+	var vs [][]float64
+	for _, title := range all {
+		if v := unit(vectors[title]); dot(v, v) > 0 {
+			titles = append(titles, title)
+			vs = append(vs, v)
+		}
+	}
+	if len(vs) == 0 {
+		return
+	}
+	if k <= 0 {
+		k = int(math.Round(math.Sqrt(float64(len(vs)) / 2)))
+		if k < 2 {
+			k = 2
+		} else if k > maxTopics {
+			k = maxTopics
+		}
+	}
+	if k > len(vs) {
+		k = len(vs)
+	}
+
+	clusters := make([]AggPapers, k)
+	for i, c := range kMeans(vs, k) {
+		if clusters[c] == nil {
+			clusters[c] = AggPapers{}
+		}
+		clusters[c][titles[i]] = aggPapers[titles[i]]
+	}
+	labels := topicLabels(clusters)
+	for i, cluster := range clusters {
+		for _, p := range cluster {
+			p.Topic = labels[i]
+		}
+	}
+}
+
+// kMeans returns the cluster of every unit vector, one of k, by the cosine similarity to the centroids.
+// Centroids are seeded by k-means++ \w a fixed seed, so the same papers are always clustered the same.
+func kMeans(vs [][]float64, k int) []int {
+	rnd := rand.New(rand.NewSource(1))
+	centroids := [][]float64{vs[0]}
+	for len(centroids) < k {
+		// the next centroid is a vector, far from the chosen ones, by the probability of the squared distance
+		dists, sum := make([]float64, len(vs)), 0.0
+		for i, v := range vs {
+			_, sim := nearest(v, centroids)
+			dists[i] = (1 - sim) * (1 - sim)
+			sum += dists[i]
+		}
+		next := len(centroids) % len(vs) // all the vectors are the same
+		if sum > 0 {
+			r := rnd.Float64() * sum
+			for i, d := range dists {
+				if r -= d; r <= 0 {
+					next = i
+					break
+				}
+			}
+		}
+		centroids = append(centroids, vs[next])
+	}
+
+	assigned := make([]int, len(vs))
+	for i := range assigned {
+		assigned[i] = -1
+	}
+	for iter := 0; iter < topicIterations; iter++ {
+		changed := false
+		for i, v := range vs {
+			if c, _ := nearest(v, centroids); c != assigned[i] {
+				assigned[i] = c
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+		for c := range centroids {
+			var mean []float64
+			for i, v := range vs {
+				if assigned[i] != c {
+					continue
+				}
+				if mean == nil {
+					mean = make([]float64, len(v))
+				}
+				for j, x := range v {
+					mean[j] += x
+				}
+			}
+			if mean != nil { // empty clusters keep the centroid
+				centroids[c] = unit(mean)
+			}
+		}
+	}
+	return assigned
+}
+
+// nearest returns the index of the centroid, most similar to the vector, and the cosine similarity to it.
+func nearest(v []float64, centroids [][]float64) (int, float64) {
+	best, max := 0, math.Inf(-1)
+	for c, centroid := range centroids {
+		if sim := dot(v, centroid); sim > max {
+			best, max = c, sim
+		}
+	}
+	return best, max
+}
+
+func dot(a, b []float64) float64 {
+	sum := 0.0
+	for i := range a {
+		if i < len(b) {
+			sum += a[i] * b[i]
+		}
+	}
+	return sum
+}
+
+// unit returns a copy of the vector of length 1, or the vector itself if it is zero.
+func unit(v []float64) []float64 {
+	norm := math.Sqrt(dot(v, v))
+	if norm == 0 {
+		return v
+	}
+	u := make([]float64, len(v))
+	for i, x := range v {
+		u[i] = x / norm
+	}
+	return u
+}
+
+// tfidfVectors returns the TF-IDF vectors of the titles and abstracts of the papers, by title, \w the IDF
+// of the papers themselves. Terms of a single paper are dropped, as they make no papers similar.
+func tfidfVectors(aggPapers AggPapers) map[string][]float64 {
+	tfs := map[string]map[string]float64{}
+	df := map[string]int{}
+	for title, p := range aggPapers {
+		tfs[title] = termFreqs(Text(p))
+		for term := range tfs[title] {
+			df[term]++
+		}
+	}
+	var vocabulary []string
+	for term, n := range df {
+		if n > 1 {
+			vocabulary = append(vocabulary, term)
+		}
+	}
+	sort.Strings(vocabulary)
+
+	vectors := map[string][]float64{}
+	for title, tf := range tfs {
+		v := make([]float64, len(vocabulary))
+		for i, term := range vocabulary {
+			if f := tf[term]; f > 0 {
+				v[i] = (1 + math.Log(f)) * math.Log(float64(len(aggPapers))/float64(df[term]))
+			}
+		}
+		vectors[title] = v
+	}
+	return vectors
+}
+
+// topicLabels returns the label of every cluster: the terms, that are in the most of its papers and in the fewest
+// of the others, the most specific first.
+func topicLabels(clusters []AggPapers) []string {
+	df := map[string]int{}                       // number of all the papers \w a term
+	dfs := make([]map[string]int, len(clusters)) // of the papers in every cluster
+	n := 0
+	for i, cluster := range clusters {
+		dfs[i] = map[string]int{}
+		for _, p := range cluster {
+			for term := range termFreqs(Text(p)) {
+				dfs[i][term]++
+				df[term]++
+			}
+			n++
+		}
+	}
+
+	labels := make([]string, len(clusters))
+	used := map[string]int{}
+	for i, cluster := range clusters {
+		type scored struct {
+			term  string
+			score float64
+		}
+		var terms []scored
+		for term, in := range dfs[i] {
+			if in < 2 && len(cluster) > 1 {
+				continue
+			}
+			terms = append(terms, scored{term, float64(in) / float64(len(cluster)) * math.Log(1+float64(n)/float64(df[term]))})
+		}
+		sort.Slice(terms, func(a, b int) bool {
+			if terms[a].score != terms[b].score {
+				return terms[a].score > terms[b].score
+			}
+			return terms[a].term < terms[b].term
+		})
+		var words []string
+		for _, t := range terms {
+			if len(words) == topicLabelTerms {
+				break
+			}
+			words = append(words, t.term)
+		}
+		label := "Miscellaneous"
+		if len(words) != 0 {
+			words[0] = capitalize(words[0])
+			label = strings.Join(words, ", ")
+		}
+		if used[label]++; used[label] > 1 { // labels must be distinct, to be the sections of the report
+			label += fmt.Sprintf(" (%d)", used[label])
+		}
+		labels[i] = label
+	}
+	return labels
+}
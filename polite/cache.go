@@ -0,0 +1,107 @@
+package polite
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bzz/scholar-alert-digest/fileutils"
+)
+
+// cacheable are the statuses of the responses, that are cached.
+var cacheable = map[int]bool{
+	http.StatusOK:                true,
+	http.StatusMovedPermanently:  true,
+	http.StatusPermanentRedirect: true,
+	http.StatusNotFound:          true,
+	http.StatusGone:              true,
+}
+
+// maxCachedSize is the max size of a cached response, bigger ones e.g PDFs are not cached.
+const maxCachedSize = 1 << 20
+
+// Cache is an on-disk cache of the responses to GET and HEAD requests, a file per request.
+// Responses expire after the TTL, or are not cached at all, if the server asks for it by "Cache-Control: no-store",
+// or they are too big.
+type Cache struct {
+	dir string
+	ttl time.Duration
+}
+
+// NewCache returns a cache in a given directory, creating it if missing.
+func NewCache(dir string, ttl time.Duration) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Cache{dir, ttl}, nil
+}
+
+// path returns the file of the cached response to a given request.
+func (c *Cache) path(req *http.Request) string {
+	sum := sha1.Sum([]byte(req.Method + " " + req.URL.String()))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
+
+// Get returns the cached response to a given request, if any and not expired.
+func (c *Cache) Get(req *http.Request) (*http.Response, bool) {
+	path := c.path(req)
+	fi, err := os.Stat(path)
+	if err != nil || time.Since(fi.ModTime()) > c.ttl {
+		return nil, false
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(b)), req)
+	if err != nil {
+		return nil, false
+	}
+	return resp, true
+}
+
+// Put saves the response to a given request, if cacheable, and returns the response \w the body to read again.
+func (c *Cache) Put(req *http.Request, resp *http.Response) (*http.Response, error) {
+	if !cacheable[resp.StatusCode] || strings.Contains(resp.Header.Get("Cache-Control"), "no-store") ||
+		resp.ContentLength > maxCachedSize || resp.Header.Get("Content-Type") == "application/pdf" {
+		return resp, nil
+	}
+	b, err := httputil.DumpResponse(resp, true) // also replaces the body by a copy
+	if err != nil {
+		return nil, err
+	}
+
+	fileutils.AtomicWrite(c.path(req), 0600, func(w io.Writer) error { // the cache is best effort
+		_, err := w.Write(b)
+		return err
+	})
+	return resp, nil
+}
+
+type cacheTransport struct {
+	base  http.RoundTripper
+	cache *Cache
+}
+
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return t.base.RoundTrip(req)
+	}
+	if resp, ok := t.cache.Get(req); ok {
+		return resp, nil
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	return t.cache.Put(req, resp)
+}
@@ -0,0 +1,193 @@
+// Package polite is a well-behaved HTTP client of the external services and web sites, shared by all the
+// enrichers: it identifies itself by the User-Agent, limits the rate of the requests to every host,
+// respects robots.txt of the web sites and caches the responses on disk.
+package polite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultUserAgent identifies the requests of this tool.
+const DefaultUserAgent = "scholar-alert-digest/1.0 (+https://github.com/bzz/scholar-alert-digest)"
+
+// Defaults of the Options.
+const (
+	DefaultInterval = 100 * time.Millisecond
+	DefaultCacheTTL = 24 * time.Hour
+)
+
+// ErrDisallowed is returned by the crawler clients for the URLs, disallowed by robots.txt of the host.
+var ErrDisallowed = errors.New("disallowed by robots.txt")
+
+// Options configures the Fetcher.
+type Options struct {
+	UserAgent string                   // DefaultUserAgent, if empty
+	Mailto    string                   // contact email, added to the User-Agent, as some services ask for
+	Interval  time.Duration            // min time between the requests to the same host, DefaultInterval if zero
+	Intervals map[string]time.Duration // longer ones of the hosts, by name e.g of the APIs \w documented limits
+	CacheDir  string                   // directory to cache the responses in, empty to disable
+	CacheTTL  time.Duration            // max age of the cached responses, DefaultCacheTTL if zero
+}
+
+// Fetcher makes HTTP clients, that share the limits of the requests to every host, robots.txt and the cache.
+type Fetcher struct {
+	opts  Options
+	cache *Cache
+
+	mu    sync.Mutex
+	hosts map[string]*host
+}
+
+// host is the state of the requests to a single host.
+type host struct {
+	mu       sync.Mutex
+	next     time.Time     // of the next request
+	interval time.Duration // between the requests, raised by the Crawl-delay of robots.txt
+
+	robotsOnce sync.Once
+	robots     *Robots
+}
+
+// New returns a Fetcher, creating the cache directory if missing.
+func New(opts Options) (*Fetcher, error) {
+	if opts.UserAgent == "" {
+		opts.UserAgent = DefaultUserAgent
+	}
+	if opts.Mailto != "" {
+		opts.UserAgent += " (mailto:" + opts.Mailto + ")"
+	}
+	if opts.Interval == 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.CacheTTL == 0 {
+		opts.CacheTTL = DefaultCacheTTL
+	}
+	f := &Fetcher{opts: opts, hosts: map[string]*host{}}
+	if opts.CacheDir != "" {
+		var err error
+		if f.cache, err = NewCache(opts.CacheDir, opts.CacheTTL); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// Client returns a copy of the client for the APIs, that sets the User-Agent, waits for the limit
+// of the host before every request and caches the responses.
+func (f *Fetcher) Client(client *http.Client) *http.Client {
+	c := *client
+	base := c.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	c.Transport = f.transport(base)
+	return &c
+}
+
+// Crawler returns a copy of the client for the web sites, that is the Client, which also checks robots.txt
+// of the host before every request, including the redirects. Disallowed requests fail \w ErrDisallowed.
+func (f *Fetcher) Crawler(client *http.Client) *http.Client {
+	c := f.Client(client)
+	c.Transport = &robotsTransport{c.Transport, f}
+	return c
+}
+
+// transport returns the transport of the Client: cache, then the rate limit, then the User-Agent.
+func (f *Fetcher) transport(base http.RoundTripper) http.RoundTripper {
+	var t http.RoundTripper = &limitTransport{&userAgentTransport{base, f.opts.UserAgent}, f}
+	if f.cache != nil {
+		t = &cacheTransport{t, f.cache}
+	}
+	return t
+}
+
+// host returns the state of the requests to a given host.
+func (f *Fetcher) host(name string) *host {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	name = strings.ToLower(name)
+	h, ok := f.hosts[name]
+	if !ok {
+		h = &host{interval: f.opts.Interval}
+		if d := f.opts.Intervals[name]; d > h.interval {
+			h.interval = d
+		}
+		f.hosts[name] = h
+	}
+	return h
+}
+
+// wait blocks until the next request to the host is allowed, or the context is done.
+func (h *host) wait(ctx context.Context) error {
+	h.mu.Lock()
+	now := time.Now()
+	at := h.next
+	if at.Before(now) {
+		at = now
+	}
+	h.next = at.Add(h.interval) // reserve, so the concurrent requests queue up
+	h.mu.Unlock()
+
+	wait := at.Sub(now)
+	if wait <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(wait):
+		return nil
+	}
+}
+
+type userAgentTransport struct {
+	base      http.RoundTripper
+	userAgent string
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context()) // RoundTrip must not modify the request
+	r.Header.Set("User-Agent", t.userAgent)
+	return t.base.RoundTrip(r)
+}
+
+type limitTransport struct {
+	base    http.RoundTripper
+	fetcher *Fetcher
+}
+
+func (t *limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.fetcher.host(req.URL.Host).wait(req.Context()); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
+
+// proxySchemes are the schemes of the supported proxy URLs.
+var proxySchemes = map[string]bool{"http": true, "https": true, "socks5": true, "socks5h": true}
+
+// SetProxy sends all the requests of http.DefaultTransport, that all the clients use unless set otherwise,
+// including the ones to Gmail, through a given HTTP(S) or SOCKS5 proxy e.g "socks5://localhost:1080",
+// instead of the one from the HTTP_PROXY, HTTPS_PROXY and NO_PROXY env vars.
+func SetProxy(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if !proxySchemes[u.Scheme] || u.Host == "" {
+		return fmt.Errorf("unsupported proxy %q, must be e.g http://host:port or socks5://host:port", rawURL)
+	}
+	t, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return fmt.Errorf("unable to set the proxy of %T", http.DefaultTransport)
+	}
+	t.Proxy = http.ProxyURL(u)
+	return nil
+}
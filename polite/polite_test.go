@@ -0,0 +1,150 @@
+package polite
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRobots(t *testing.T) {
+	robotsTxt := `# comment
+User-agent: Googlebot
+Disallow: /
+
+User-agent: *
+Disallow: /search
+Allow: /search/about
+Disallow: /*.pdf$
+Crawl-delay: 2
+
+User-agent: scholar-alert-digest
+User-agent: other
+Disallow: /private # only for us
+Disallow:
+`
+	r := ParseRobots(strings.NewReader(robotsTxt), DefaultUserAgent)
+	assert.False(t, r.Allowed("/private/1"))
+	assert.True(t, r.Allowed("/search"), "rules for any agent are ignored, if there are own ones")
+	assert.Zero(t, r.CrawlDelay)
+
+	r = ParseRobots(strings.NewReader(robotsTxt), "curl/7.0")
+	assert.True(t, r.Allowed("/"))
+	assert.False(t, r.Allowed("/search?q=code"))
+	assert.True(t, r.Allowed("/search/about"), "the longest match wins")
+	assert.False(t, r.Allowed("/papers/1.pdf"))
+	assert.True(t, r.Allowed("/papers/1.pdf?download=1"), "$ matches the end")
+	assert.Equal(t, 2*time.Second, r.CrawlDelay)
+
+	assert.True(t, ParseRobots(strings.NewReader(""), DefaultUserAgent).Allowed("/"))
+}
+
+func TestFetcher(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		assert.Equal(t, DefaultUserAgent+" (mailto:me@example.com)", r.UserAgent())
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+		case "/fresh":
+			w.Header().Set("Cache-Control", "no-store")
+			w.Write([]byte("fresh"))
+		case "/moved":
+			http.Redirect(w, r, "/private/1", http.StatusFound)
+		default:
+			w.Write([]byte("page " + r.URL.Path))
+		}
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "polite")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	f, err := New(Options{Mailto: "me@example.com", Interval: 50 * time.Millisecond, CacheDir: dir})
+	require.NoError(t, err)
+	api, crawler := f.Client(srv.Client()), f.Crawler(srv.Client())
+
+	get := func(c *http.Client, path string) (string, error) {
+		resp, err := c.Get(srv.URL + path)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		return string(b), err
+	}
+
+	start := time.Now()
+	body, err := get(api, "/private/1")
+	require.NoError(t, err)
+	assert.Equal(t, "page /private/1", body, "APIs do not check robots.txt")
+
+	_, err = get(crawler, "/private/2")
+	assert.Contains(t, err.Error(), ErrDisallowed.Error())
+	_, err = get(crawler, "/moved")
+	assert.Contains(t, err.Error(), ErrDisallowed.Error(), "redirects are checked too")
+
+	_, err = get(crawler, "/private/1")
+	assert.Error(t, err, "even if cached")
+	body, err = get(api, "/private/1")
+	require.NoError(t, err)
+	assert.Equal(t, "page /private/1", body)
+
+	for i := 0; i < 2; i++ {
+		body, err = get(crawler, "/fresh")
+		require.NoError(t, err)
+		assert.Equal(t, "fresh", body)
+	}
+
+	assert.Equal(t, []string{"/private/1", "/robots.txt", "/moved", "/fresh", "/fresh"}, paths)
+	assert.True(t, time.Since(start) >= 4*50*time.Millisecond, "requests to the host are rate limited")
+}
+
+func TestFetcherIntervals(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	f, err := New(Options{Interval: time.Millisecond, Intervals: map[string]time.Duration{u.Host: 100 * time.Millisecond}})
+	require.NoError(t, err)
+	c := f.Client(srv.Client())
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		resp, err := c.Get(srv.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	assert.True(t, time.Since(start) >= 2*100*time.Millisecond, "the interval of the host")
+	assert.Equal(t, time.Millisecond, f.host("other.example.com").interval)
+}
+
+func TestSetProxy(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("via proxy to " + r.URL.String()))
+	}))
+	defer proxy.Close()
+
+	t.Cleanup(func() { http.DefaultTransport.(*http.Transport).Proxy = http.ProxyFromEnvironment })
+	require.NoError(t, SetProxy(proxy.URL))
+
+	resp, err := http.Get("http://example.invalid/paper")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "via proxy to http://example.invalid/paper", string(b))
+
+	assert.NoError(t, SetProxy("socks5://localhost:1080"))
+	assert.Error(t, SetProxy("ftp://localhost:21"))
+	assert.Error(t, SetProxy("localhost:8080"))
+}
@@ -0,0 +1,170 @@
+package polite
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRobotsSize is the max size of robots.txt, the rest is ignored.
+const maxRobotsSize = 500 << 10
+
+// Robots are the rules of robots.txt for a single user agent. See https://www.rfc-editor.org/rfc/rfc9309
+type Robots struct {
+	rules      []rule
+	CrawlDelay time.Duration
+}
+
+type rule struct {
+	allow bool
+	path  string         // may have "*" wildcards and a "$" at the end
+	re    *regexp.Regexp // of the path
+}
+
+// newRule returns a rule for a given path pattern, matching the paths, that start \w it,
+// or are equal to it, if it ends \w "$".
+func newRule(allow bool, path string) rule {
+	re := "^" + strings.Replace(regexp.QuoteMeta(strings.TrimSuffix(path, "$")), `\*`, ".*", -1)
+	if strings.HasSuffix(path, "$") {
+		re += "$"
+	}
+	return rule{allow, path, regexp.MustCompile(re)}
+}
+
+// ParseRobots returns the rules of robots.txt for the user agent, by the product token of it e.g "scholar-alert-digest",
+// or for any ("*"), if there are none specifically for it.
+func ParseRobots(r io.Reader, userAgent string) *Robots {
+	token := strings.ToLower(userAgent)
+	if i := strings.IndexAny(token, "/ "); i >= 0 {
+		token = token[:i]
+	}
+
+	var own, any *Robots
+	var group []*Robots // of the consecutive User-agent lines
+	inAgents := false
+	s := bufio.NewScanner(io.LimitReader(r, maxRobotsSize))
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key, value := strings.ToLower(strings.TrimSpace(kv[0])), strings.TrimSpace(kv[1])
+
+		if key == "user-agent" {
+			if !inAgents {
+				group = nil
+			}
+			inAgents = true
+			switch agent := strings.ToLower(value); {
+			case agent == "*":
+				if any == nil {
+					any = &Robots{}
+				}
+				group = append(group, any)
+			case agent == token:
+				if own == nil {
+					own = &Robots{}
+				}
+				group = append(group, own)
+			}
+			continue
+		}
+		inAgents = false
+		for _, robots := range group {
+			switch key {
+			case "allow", "disallow":
+				if value != "" { // empty Disallow allows all
+					robots.rules = append(robots.rules, newRule(key == "allow", value))
+				}
+			case "crawl-delay":
+				if sec, err := strconv.ParseFloat(value, 64); err == nil && sec > 0 {
+					robots.CrawlDelay = time.Duration(sec * float64(time.Second))
+				}
+			}
+		}
+	}
+
+	switch {
+	case own != nil:
+		return own
+	case any != nil:
+		return any
+	}
+	return &Robots{}
+}
+
+// Allowed returns true if the rules allow a given path \w the query e.g "/search?q=1".
+// The longest matching rule wins, Allow if both match equally.
+func (r *Robots) Allowed(path string) bool {
+	allowed, longest := true, -1
+	for _, rule := range r.rules {
+		if !rule.re.MatchString(path) {
+			continue
+		}
+		if len(rule.path) > longest || (len(rule.path) == longest && rule.allow) {
+			allowed, longest = rule.allow, len(rule.path)
+		}
+	}
+	return allowed
+}
+
+type robotsTransport struct {
+	base    http.RoundTripper
+	fetcher *Fetcher
+}
+
+func (t *robotsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Path == "/robots.txt" {
+		return t.base.RoundTrip(req)
+	}
+	h := t.fetcher.host(req.URL.Host)
+	h.robotsOnce.Do(func() {
+		h.robots = t.fetch(req)
+		if h.robots.CrawlDelay > 0 {
+			h.mu.Lock()
+			if h.robots.CrawlDelay > h.interval {
+				h.interval = h.robots.CrawlDelay
+			}
+			h.mu.Unlock()
+		}
+	})
+	if !h.robots.Allowed(req.URL.EscapedPath() + queryOf(req.URL)) {
+		return nil, ErrDisallowed
+	}
+	return t.base.RoundTrip(req)
+}
+
+// fetch returns the rules of robots.txt of the host of the request. Hosts \wo one, or failed to return it,
+// allow all.
+func (t *robotsTransport) fetch(req *http.Request) *Robots {
+	u := url.URL{Scheme: req.URL.Scheme, Host: req.URL.Host, Path: "/robots.txt"}
+	r, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return &Robots{}
+	}
+	resp, err := t.base.RoundTrip(r.WithContext(req.Context()))
+	if err != nil {
+		return &Robots{}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &Robots{}
+	}
+	return ParseRobots(resp.Body, t.fetcher.opts.UserAgent)
+}
+
+func queryOf(u *url.URL) string {
+	if u.RawQuery == "" {
+		return ""
+	}
+	return "?" + u.RawQuery
+}
@@ -0,0 +1,102 @@
+package templates
+
+import (
+	"crypto/sha1"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bzz/scholar-alert-digest/papers"
+)
+
+const atomNS = "http://www.w3.org/2005/Atom"
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	NS      string      `xml:"xmlns,attr"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	ID      string       `xml:"id"`
+	Title   string       `xml:"title"`
+	Link    atomLink     `xml:"link"`
+	Updated string       `xml:"updated"`
+	Authors []atomAuthor `xml:"author"`
+	Summary string       `xml:"summary,omitempty"`
+	Source  *atomSource  `xml:"source,omitempty"`
+}
+
+// atomSource is the publication venue and year of a paper.
+type atomSource struct {
+	Title string `xml:"title"`
+}
+
+// AtomRenderer outputs unread papers as an Atom feed, one entry per unique paper.
+type AtomRenderer struct {
+	title string
+}
+
+// NewAtomRenderer factory for Renderer in Atom format.
+func NewAtomRenderer(opts Options) Renderer {
+	return &AtomRenderer{orDefault(opts.Title, DefaultTitle)}
+}
+
+// Render papers as an Atom feed. Read papers are not included.
+func (r *AtomRenderer) Render(out io.Writer, st *papers.Stats, unread, read papers.AggPapers) {
+	log.Print("formatting gmail messages as Atom feed")
+	now := time.Now().Format(time.RFC3339)
+	feed := atomFeed{
+		NS:      atomNS,
+		ID:      guid("scholar-alert-digest"),
+		Title:   r.title,
+		Updated: now,
+		Author:  atomAuthor{"Google Scholar Alerts"},
+	}
+
+	for _, title := range papers.SortedKeys(unread) {
+		p := unread[title]
+		entry := atomEntry{
+			ID:      guid(p.URL),
+			Title:   p.Title,
+			Link:    atomLink{p.URL},
+			Updated: now,
+			Summary: strings.TrimSpace(p.Abstract.FirstLine + " " + p.Abstract.Rest),
+		}
+		if p.Source != "" {
+			entry.Source = &atomSource{p.Source}
+		}
+		for _, author := range p.Authors {
+			entry.Authors = append(entry.Authors, atomAuthor{author})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	io.WriteString(out, xml.Header)
+	enc := xml.NewEncoder(out)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		log.Fatalf("failed to encode Atom feed: %s", err)
+	}
+	io.WriteString(out, "\n")
+}
+
+// guid returns a stable ID for a given paper URL, that does not change across runs.
+func guid(url string) string {
+	return fmt.Sprintf("urn:sha1:%x", sha1.Sum([]byte(url)))
+}
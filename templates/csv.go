@@ -0,0 +1,42 @@
+package templates
+
+import (
+	"encoding/csv"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/bzz/scholar-alert-digest/papers"
+)
+
+// CSVRenderer outputs papers in CSV, one paper per row.
+type CSVRenderer struct{}
+
+// NewCSVRenderer factory for Renderer in CSV format.
+func NewCSVRenderer() Renderer {
+	return &CSVRenderer{}
+}
+
+// Render papers as CSV rows with a header, unread first.
+func (r *CSVRenderer) Render(out io.Writer, st *papers.Stats, unread, read papers.AggPapers) {
+	log.Print("formatting gmail messages in CSV")
+	w := csv.NewWriter(out)
+	w.Write([]string{"title", "url", "abstract", "count", "authors", "venue", "year", "doi", "published", "publisher"})
+	for _, aggPapers := range []papers.AggPapers{unread, read} {
+		for _, title := range papers.SortedKeys(aggPapers) {
+			p := aggPapers[title]
+			abs := strings.TrimSpace(p.Abstract.FirstLine + " " + p.Abstract.Rest)
+			year := ""
+			if p.Year != 0 {
+				year = strconv.Itoa(p.Year)
+			}
+			w.Write([]string{p.Title, p.URL, abs, strconv.Itoa(p.Freq), strings.Join(p.Authors, "; "), p.Venue, year,
+				p.DOI, p.Published, p.Publisher})
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		log.Fatalf("failed to write CSV: %s", err)
+	}
+}
@@ -0,0 +1,174 @@
+package templates
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"text/template"
+	"time"
+
+	"github.com/bzz/scholar-alert-digest/papers"
+)
+
+var epubFuncs = template.FuncMap{
+	"x": func(s string) string {
+		var buf bytes.Buffer
+		xml.EscapeText(&buf, []byte(s))
+		return buf.String()
+	},
+	"inc": func(i int) int { return i + 1 },
+}
+
+var (
+	epubContainer = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+	epubPackage = template.Must(template.New("content.opf").Funcs(epubFuncs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="uid">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="uid">{{ x .ID }}</dc:identifier>
+    <dc:title>{{ x .Title }}</dc:title>
+    <dc:language>en</dc:language>
+    <meta property="dcterms:modified">{{ .Modified }}</meta>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+    <item id="digest" href="digest.xhtml" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine toc="ncx">
+    <itemref idref="nav"/>
+    <itemref idref="digest"/>
+  </spine>
+</package>
+`))
+
+	epubNav = template.Must(template.New("nav.xhtml").Funcs(epubFuncs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head><title>Contents</title></head>
+<body>
+  <nav epub:type="toc" id="toc">
+    <h1>Contents</h1>
+    <ol>
+{{- range $i, $p := .Papers }}
+      <li><a href="digest.xhtml#paper-{{ $i }}">{{ x $p.Title }}</a></li>
+{{- end }}
+    </ol>
+  </nav>
+</body>
+</html>
+`))
+
+	epubNCX = template.Must(template.New("toc.ncx").Funcs(epubFuncs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+  <head><meta name="dtb:uid" content="{{ x .ID }}"/></head>
+  <docTitle><text>{{ x .Title }}</text></docTitle>
+  <navMap>
+{{- range $i, $p := .Papers }}
+    <navPoint id="nav-{{ $i }}" playOrder="{{ inc $i }}">
+      <navLabel><text>{{ x $p.Title }}</text></navLabel>
+      <content src="digest.xhtml#paper-{{ $i }}"/>
+    </navPoint>
+{{- end }}
+  </navMap>
+</ncx>
+`))
+
+	epubDigest = template.Must(template.New("digest.xhtml").Funcs(epubFuncs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head><title>{{ x .Title }}</title></head>
+<body>
+  <h1>{{ x .Title }}</h1>
+  {{- if .Description }}
+  <p><i>{{ x .Description }}</i></p>
+  {{- end }}
+  <p>{{ .Date }}, {{ len .Papers }} papers</p>
+{{- range $i, $p := .Papers }}
+  <section id="paper-{{ $i }}">
+    <h2>{{ x $p.Title }}</h2>
+    {{- if $p.Author }}
+    <p><i>{{ x $p.Author }}</i>{{ if $p.Source }} - {{ x $p.Source }}{{ end }}</p>
+    {{- end }}
+    <p><a href="{{ x $p.URL }}">{{ x $p.URL }}</a> ({{ $p.Freq }})</p>
+    <p>{{ x $p.Abstract.FirstLine }} {{ x $p.Abstract.Rest }}</p>
+  </section>
+{{- end }}
+</body>
+</html>
+`))
+)
+
+// EPUBRenderer outputs unread papers as an EPUB book, one section per paper.
+type EPUBRenderer struct {
+	title, description string
+}
+
+// NewEPUBRenderer factory for Renderer in EPUB format.
+func NewEPUBRenderer(opts Options) Renderer {
+	return &EPUBRenderer{orDefault(opts.Title, DefaultTitle), opts.Description}
+}
+
+// Render papers as EPUB 3 (\w EPUB 2 toc.ncx for older e-readers). Read papers are not included.
+func (r *EPUBRenderer) Render(out io.Writer, st *papers.Stats, unread, read papers.AggPapers) {
+	log.Print("formatting gmail messages as EPUB")
+	now := time.Now()
+	data := struct {
+		ID, Title, Description, Date, Modified string
+		Papers                                 []*papers.Paper
+	}{
+		ID:          guid(fmt.Sprintf("scholar-alert-digest-%d", now.Unix())),
+		Title:       r.title,
+		Description: r.description,
+		Date:        now.Format("2006-01-02"),
+		Modified:    now.UTC().Format("2006-01-02T15:04:05Z"),
+	}
+	for _, title := range papers.SortedKeys(unread) {
+		data.Papers = append(data.Papers, unread[title])
+	}
+
+	z := zip.NewWriter(out)
+	// mimetype must go first and uncompressed
+	w, err := z.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		log.Fatalf("failed to write EPUB: %s", err)
+	}
+	io.WriteString(w, "application/epub+zip")
+
+	files := []struct {
+		name string
+		tmpl *template.Template
+	}{
+		{"OEBPS/content.opf", epubPackage},
+		{"OEBPS/nav.xhtml", epubNav},
+		{"OEBPS/toc.ncx", epubNCX},
+		{"OEBPS/digest.xhtml", epubDigest},
+	}
+
+	w, err = z.Create("META-INF/container.xml")
+	if err != nil {
+		log.Fatalf("failed to write EPUB: %s", err)
+	}
+	io.WriteString(w, epubContainer)
+
+	for _, f := range files {
+		w, err := z.Create(f.name)
+		if err != nil {
+			log.Fatalf("failed to write EPUB: %s", err)
+		}
+		if err := f.tmpl.Execute(w, data); err != nil {
+			log.Fatalf("template %q execution failed: %s", f.name, err)
+		}
+	}
+
+	if err := z.Close(); err != nil {
+		log.Fatalf("failed to write EPUB: %s", err)
+	}
+}
@@ -0,0 +1,107 @@
+package templates
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// DefaultTitle is a title of the report, unless configured otherwise.
+const DefaultTitle = "Google Scholar Alert Digest"
+
+// Fields are names of all metadata fields of the report header.
+var Fields = []string{"date", "emails", "papers", "uniq"}
+
+// Options configures a Renderer, created by NewRenderer.
+// Not every option is used by every output format.
+type Options struct {
+	Template    string         // Markdown report template text, for 'md' and 'html', empty for the default one
+	Style       string         // CSS, for 'html'
+	Width       int            // max line width, for 'text'
+	TOC         bool           // include the table of contents, for 'md' and 'html'
+	ByType      bool           // split papers in sections by the alert type, for 'md' and 'html'
+	Labels      []*gmail.Label // split papers in sections by these Gmail labels, instead of the type, for 'md' and 'html'
+	BySeen      bool           // split papers in sections of the new and already reported ones, for 'md' and 'html'
+	Diff        bool           // split papers in sections of the added and Removed ones, for 'md' and 'html'
+	Window      string         // split papers in sections by the week or month of the earliest email, for 'md' and 'html'
+	ByTopic     bool           // split papers in sections by the Topic, for 'md' and 'html'
+	AlertStats  bool           // include a table of the papers by the alert e.g a search query, for 'md' and 'html'
+	Title       string         // report title, empty for DefaultTitle
+	Description string         // optional description line, under the title
+	Fields      []string       // metadata fields to show in the report header, nil for all Fields
+}
+
+// renderers are factories of Renderer for each supported output format.
+var renderers = map[string]func(Options) Renderer{
+	"md": func(o Options) Renderer {
+		return newMarkdownRenderer(orDefault(o.Template, MdTemplText), ReadMdTemplText, o)
+	},
+	"html": func(o Options) Renderer {
+		return newHTMLRenderer(orDefault(o.Template, TableHTMLTemplText), o)
+	},
+	"json":  func(Options) Renderer { return NewJSONRenderer() },
+	"jsonl": func(Options) Renderer { return NewJSONLRenderer() },
+	"ris":   func(Options) Renderer { return NewRISRenderer() },
+	"csv":   func(Options) Renderer { return NewCSVRenderer() },
+	"atom":  func(o Options) Renderer { return NewAtomRenderer(o) },
+	"epub":  func(o Options) Renderer { return NewEPUBRenderer(o) },
+	"org":   func(o Options) Renderer { return NewOrgRenderer(o) },
+	"latex": func(o Options) Renderer { return NewLaTeXRenderer(o) },
+	"text":  func(o Options) Renderer { return NewTextRenderer(o) },
+}
+
+// Register adds a factory of Renderer for a new output format, or replaces an existing one.
+func Register(format string, factory func(Options) Renderer) {
+	renderers[format] = factory
+}
+
+// Formats returns names of all supported output formats, sorted.
+func Formats() []string {
+	var formats []string
+	for f := range renderers {
+		formats = append(formats, f)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// NewRenderer returns a Renderer for a given output format.
+func NewRenderer(format string, opts Options) (Renderer, error) {
+	factory, ok := renderers[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown output format %q, must be one of: %s",
+			format, strings.Join(Formats(), ", "))
+	}
+	for _, f := range opts.Fields {
+		if !showField(nil, f) {
+			return nil, fmt.Errorf("unknown header field %q, must be one of: %s",
+				f, strings.Join(Fields, ", "))
+		}
+	}
+	if opts.Window != "" && windowStart[opts.Window] == nil {
+		return nil, fmt.Errorf("unknown window %q, must be one of: %s", opts.Window, strings.Join(Windows, ", "))
+	}
+	return factory(opts), nil
+}
+
+// showField returns true if the field is one of the given fields, or one of all Fields if nil.
+func showField(fields []string, field string) bool {
+	if fields == nil {
+		fields = Fields
+	}
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+func orDefault(template, defaultTemplate string) string {
+	if template == "" {
+		return defaultTemplate
+	}
+	return template
+}
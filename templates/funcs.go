@@ -0,0 +1,266 @@
+package templates
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"html/template"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bzz/scholar-alert-digest/papers"
+)
+
+// helpers are functions, available to all Markdown/HTML report templates.
+var helpers = template.FuncMap{
+	"anchor":         anchor,
+	"sectionAnchor":  sectionAnchor,
+	"tocAnchor":      tocAnchor,
+	"md":             mdEscape,
+	"freqGroups":     freqGroups,
+	"domainGroups":   domainGroups,
+	"letterGroups":   letterGroups,
+	"venueGroups":    venueGroups,
+	"domain":         domain,
+	"truncate":       truncate,
+	"formatDate":     formatDate,
+	"firstSeen":      firstSeen,
+	"sparkline":      sparkline,
+	"sparklineSVG":   sparklineSVG,
+	"sparklineTitle": sparklineTitle,
+	"urlEscape":      url.QueryEscape,
+	"pathEscape":     url.PathEscape,
+}
+
+// FreqGroup is a group of paper titles with the same frequency.
+type FreqGroup struct {
+	Freq   int
+	Titles []string
+}
+
+// Group is a group of paper titles that share the same Key.
+type Group struct {
+	Key    string
+	Titles []string
+}
+
+// freqGroups groups paper titles by frequency, most frequent first, titles sorted.
+func freqGroups(aggPapers papers.AggPapers) []FreqGroup {
+	byFreq := map[int][]string{}
+	for title, p := range aggPapers {
+		byFreq[p.Freq] = append(byFreq[p.Freq], title)
+	}
+
+	var groups []FreqGroup
+	for freq, titles := range byFreq {
+		sort.Strings(titles)
+		groups = append(groups, FreqGroup{freq, titles})
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Freq > groups[j].Freq })
+	return groups
+}
+
+// domainGroups groups paper titles by the domain of the paper URL.
+func domainGroups(aggPapers papers.AggPapers) []Group {
+	return groupBy(aggPapers, func(p *papers.Paper) string { return domain(p.URL) })
+}
+
+// letterGroups groups paper titles by the first letter of the title, in upper case.
+func letterGroups(aggPapers papers.AggPapers) []Group {
+	return groupBy(aggPapers, func(p *papers.Paper) string {
+		r, _ := utf8.DecodeRuneInString(strings.TrimLeftFunc(p.Title, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}))
+		if r == utf8.RuneError {
+			return ""
+		}
+		return string(unicode.ToUpper(r))
+	})
+}
+
+// venueGroups groups paper titles by the publication venue, only available \w -authors.
+func venueGroups(aggPapers papers.AggPapers) []Group {
+	return groupBy(aggPapers, func(p *papers.Paper) string { return p.Venue })
+}
+
+// groupBy groups paper titles by a given key, both groups and titles are sorted.
+func groupBy(aggPapers papers.AggPapers, key func(*papers.Paper) string) []Group {
+	byKey := map[string][]string{}
+	for title, p := range aggPapers {
+		k := key(p)
+		byKey[k] = append(byKey[k], title)
+	}
+
+	var groups []Group
+	for k, titles := range byKey {
+		sort.Strings(titles)
+		groups = append(groups, Group{k, titles})
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Key < groups[j].Key })
+	return groups
+}
+
+// mdEscaper escapes characters, significant in Markdown inline text.
+var mdEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`, "|", `\|`, "~", `\~`,
+)
+
+// mdEscape escapes a text for Markdown, so it is rendered as is.
+// Must not be used inside raw HTML blocks e.g <details>, where Markdown is not processed.
+func mdEscape(text string) string {
+	return mdEscaper.Replace(text)
+}
+
+// domain returns the host of a given URL, \wo the "www." prefix.
+func domain(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(u.Hostname(), "www.")
+}
+
+// truncate shortens text to at most n runes, cutting on the last whitespace, if any, and adding "…".
+func truncate(n int, text string) string {
+	if utf8.RuneCountInString(text) <= n {
+		return text
+	}
+
+	runes := []rune(text)[:n]
+	cut := len(runes)
+	for i := len(runes) - 1; i > 0; i-- {
+		if unicode.IsSpace(runes[i]) {
+			cut = i
+			break
+		}
+	}
+	return strings.TrimRightFunc(string(runes[:cut]), unicode.IsSpace) + "…"
+}
+
+// formatDate re-formats RFC3339 date, as in the report .Date, using the given Go time layout.
+func formatDate(layout, date string) string {
+	t, err := time.Parse(time.RFC3339, date)
+	if err != nil {
+		return date
+	}
+	return t.Format(layout)
+}
+
+// firstSeen returns the date of the earliest email, mentioning the paper e.g "2020-03-02", or "" if unknown.
+func firstSeen(p *papers.Paper) string {
+	if p.Date().IsZero() {
+		return ""
+	}
+	return p.Date().Format("2006-01-02")
+}
+
+// maxSparkline is the max number of bars in a sparkline, longer periods are grouped by several days.
+const maxSparkline = 30
+
+// occurrences returns the number of emails, mentioning the paper, per bar of a given number of days, from the day
+// of the first email to the last one. It is nil, unless there are emails on different days.
+func occurrences(p *papers.Paper) (counts []int, perBar int) {
+	var days []time.Time
+	for _, id := range p.MsgIDs() {
+		if date := p.MsgDate(id); !date.IsZero() {
+			days = append(days, time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location()))
+		}
+	}
+	if len(days) < 2 {
+		return nil, 0
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+
+	day := func(t time.Time) int { return int(t.Sub(days[0]).Hours()+12) / 24 } // DST-safe
+	n := day(days[len(days)-1]) + 1
+	if n < 2 {
+		return nil, 0
+	}
+	perBar = (n + maxSparkline - 1) / maxSparkline
+	counts = make([]int, (n+perBar-1)/perBar)
+	for _, d := range days {
+		counts[day(d)/perBar]++
+	}
+	return counts, perBar
+}
+
+// sparklineTitle returns the description of the sparkline of the paper e.g "Emails per 2 days", or "".
+func sparklineTitle(p *papers.Paper) string {
+	switch _, perBar := occurrences(p); perBar {
+	case 0:
+		return ""
+	case 1:
+		return "Emails per day"
+	default:
+		return fmt.Sprintf("Emails per %d days", perBar)
+	}
+}
+
+// sparkBlocks are the bars of a sparkline, from the lowest one for no emails to the highest.
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline returns a sparkline of the emails, mentioning the paper, over time e.g "█▁▁▄", or "" if there are
+// no emails on different days.
+func sparkline(p *papers.Paper) string {
+	counts, _ := occurrences(p)
+	max := maxCount(counts)
+	var b strings.Builder
+	for _, c := range counts {
+		b.WriteRune(sparkBlocks[c*(len(sparkBlocks)-1)/max])
+	}
+	return b.String()
+}
+
+// sparklineSVG returns the sparkline as an inline SVG image of a single line, or "".
+func sparklineSVG(p *papers.Paper) template.HTML {
+	counts, _ := occurrences(p)
+	if counts == nil {
+		return ""
+	}
+	const barWidth, height = 3, 12
+	max := maxCount(counts)
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg class="spark" width="%d" height="%d" viewBox="0 0 %[1]d %[2]d" role="img">`, len(counts)*barWidth, height)
+	fmt.Fprintf(&b, `<title>%s, since %s</title>`, sparklineTitle(p), firstSeen(p))
+	for i, c := range counts {
+		h := 1 + c*(height-1)/max
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d"/>`, i*barWidth, height-h, barWidth-1, h)
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+// maxCount returns the max of the counts, or 1 if there are none.
+func maxCount(counts []int) int {
+	max := 1
+	for _, c := range counts {
+		if c > max {
+			max = c
+		}
+	}
+	return max
+}
+
+// anchor returns a stable HTML element ID for a given paper title.
+func anchor(title string) string {
+	return fmt.Sprintf("paper-%x", sha1.Sum([]byte(title)))[:14]
+}
+
+// sectionAnchor returns a HTML element ID for a given paper title in the i-th section of the report,
+// as the same paper may be in several sections e.g of different labels.
+func sectionAnchor(i int, title string) string {
+	return fmt.Sprintf("s%d-%s", i, anchor(title))
+}
+
+// tocAnchor returns the HTML element ID of a given paper title in the first section it is in.
+func tocAnchor(sections []Section, title string) string {
+	for i, s := range sections {
+		if _, ok := s.Papers[title]; ok {
+			return sectionAnchor(i, title)
+		}
+	}
+	return anchor(title)
+}
@@ -0,0 +1,106 @@
+package templates
+
+import (
+	"io"
+	"log"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/bzz/scholar-alert-digest/papers"
+)
+
+// LaTeXTemplText is a LaTeX report template, compilable by pdflatex.
+// It uses [[ ]] delimiters, as {{ }} clash with LaTeX groups.
+var LaTeXTemplText = `\documentclass{article}
+\usepackage[utf8]{inputenc}
+\usepackage[T1]{fontenc}
+\usepackage{hyperref}
+
+\title{[[ tex .Title ]]}
+\date{[[ if .Show "date" ]][[ .Date ]][[ end ]]}
+
+\begin{document}
+\maketitle
+[[ if .Description ]]
+\begin{abstract}
+[[ tex .Description ]]
+\end{abstract}
+[[ end ]]
+[[- if or (.Show "emails") (.Show "papers") (.Show "uniq") ]]
+\begin{description}
+[[- if .Show "emails" ]]
+  \item[Unread emails] [[ .UnreadEmails ]]
+[[- end ]]
+[[- if .Show "papers" ]]
+  \item[Paper titles] [[ .TotalPapers ]]
+[[- end ]]
+[[- if .Show "uniq" ]]
+  \item[Uniq paper titles] [[ len .Unread ]]
+[[- end ]]
+\end{description}
+[[ end ]]
+\section*{New papers}
+[[ template "papers" .Unread ]]
+[[- if .Read ]]
+\section*{Old papers}
+[[ template "papers" .Read ]]
+[[- end ]]
+\end{document}
+[[ define "papers" ]]
+[[- if . ]]\begin{itemize}
+[[- range $title := sortedKeys . ]][[ $paper := index $ . ]]
+  \item \href{[[ texURL $paper.URL ]]}{[[ tex $paper.Title ]]} ([[ $paper.Freq ]])
+  [[- if $paper.Author ]]\\ \textit{[[ tex $paper.Author ]]}[[ end ]]
+  [[- if $paper.Source ]], [[ tex $paper.Source ]][[ end ]]
+  [[- if $paper.Abstract.FirstLine ]]\\ [[ tex $paper.Abstract.FirstLine ]] [[ tex $paper.Abstract.Rest ]][[ end ]]
+[[- end ]]
+\end{itemize}[[ end ]]
+[[- end ]]`
+
+var (
+	texEscaper = strings.NewReplacer(
+		`\`, `\textbackslash{}`,
+		`&`, `\&`, `%`, `\%`, `$`, `\$`, `#`, `\#`, `_`, `\_`,
+		`{`, `\{`, `}`, `\}`,
+		`~`, `\textasciitilde{}`, `^`, `\textasciicircum{}`,
+		"\n", " ",
+	)
+	texURLEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `#`, `\#`, `{`, `\{`, `}`, `\}`)
+)
+
+// LaTeXRenderer outputs a standalone LaTeX document.
+type LaTeXRenderer struct {
+	tmpl *template.Template
+	opts Options
+}
+
+// NewLaTeXRenderer factory for Renderer in LaTeX format.
+func NewLaTeXRenderer(opts Options) Renderer {
+	return &LaTeXRenderer{
+		template.Must(template.New("latex").Delims("[[", "]]").Funcs(template.FuncMap{
+			"sortedKeys": papers.SortedKeys,
+			"tex":        texEscaper.Replace,
+			"texURL":     texURLEscaper.Replace,
+		}).Parse(LaTeXTemplText)),
+		opts,
+	}
+}
+
+// Render papers as an itemized list in LaTeX document.
+func (r *LaTeXRenderer) Render(out io.Writer, st *papers.Stats, unread, read papers.AggPapers) {
+	log.Print("formatting gmail messages in LaTeX")
+	err := r.tmpl.Execute(out, textReport{
+		Title:        orDefault(r.opts.Title, DefaultTitle),
+		Description:  r.opts.Description,
+		Date:         time.Now().Format("2006-01-02"),
+		UnreadEmails: st.Msgs,
+		TotalPapers:  st.Titles,
+		Unread:       unread,
+		Read:         read,
+		fields:       r.opts.Fields,
+	})
+	if err != nil {
+		log.Fatalf("template %q execution failed: %s", "latex", err)
+	}
+}
@@ -0,0 +1,102 @@
+package templates
+
+import (
+	"io"
+	"log"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/bzz/scholar-alert-digest/papers"
+)
+
+// OrgTemplText is an Emacs org-mode report template.
+var OrgTemplText = `#+TITLE: {{ oneLine .Title }}
+{{- if .Show "date" }}
+#+DATE: {{ .Date }}
+{{- end }}
+{{ if .Description }}
+{{ oneLine .Description }}
+{{ end }}
+{{- if .Show "emails" }}
+Unread emails: {{ .UnreadEmails }}
+{{- end }}
+{{- if .Show "papers" }}
+Paper titles: {{ .TotalPapers }}
+{{- end }}
+{{- if .Show "uniq" }}
+Uniq paper titles: {{ len .Unread }}
+{{- end }}
+
+* New papers
+{{ range $title := sortedKeys .Unread }}{{ template "paper" index $.Unread . }}{{ end }}
+{{- if .Read }}
+* Old papers
+{{ range $title := sortedKeys .Read }}{{ template "paper" index $.Read . }}{{ end }}
+{{- end }}
+{{- define "paper" }}** {{ oneLine .Title }}{{ if .Kind }} :{{ .Kind }}:{{ end }}
+:PROPERTIES:
+:URL: {{ .URL }}
+:COUNT: {{ .Freq }}
+{{- if .Author }}
+:AUTHOR: {{ oneLine .Author }}
+{{- end }}
+{{- if .Venue }}
+:VENUE: {{ oneLine .Venue }}
+{{- end }}
+{{- if .Year }}
+:YEAR: {{ .Year }}
+{{- end }}
+:END:
+{{- if .Abstract.FirstLine }}
+{{ oneLine .Abstract.FirstLine }} {{ oneLine .Abstract.Rest }}
+{{- end }}
+{{ end }}`
+
+// OrgRenderer outputs Emacs org-mode, one headline per paper.
+type OrgRenderer struct {
+	tmpl *template.Template
+	opts Options
+}
+
+// NewOrgRenderer factory for Renderer in org-mode format.
+func NewOrgRenderer(opts Options) Renderer {
+	return &OrgRenderer{
+		template.Must(template.New("org").Funcs(template.FuncMap{
+			"sortedKeys": papers.SortedKeys,
+			"oneLine":    func(s string) string { return strings.Join(strings.Fields(s), " ") },
+		}).Parse(OrgTemplText)),
+		opts,
+	}
+}
+
+// Render papers as org-mode headlines.
+func (r *OrgRenderer) Render(out io.Writer, st *papers.Stats, unread, read papers.AggPapers) {
+	log.Print("formatting gmail messages in org-mode")
+	err := r.tmpl.Execute(out, textReport{
+		Title:        orDefault(r.opts.Title, DefaultTitle),
+		Description:  r.opts.Description,
+		Date:         time.Now().Format("2006-01-02 Mon"),
+		UnreadEmails: st.Msgs,
+		TotalPapers:  st.Titles,
+		Unread:       unread,
+		Read:         read,
+		fields:       r.opts.Fields,
+	})
+	if err != nil {
+		log.Fatalf("template %q execution failed: %s", "org", err)
+	}
+}
+
+// textReport is the data for org-mode and LaTeX report templates.
+type textReport struct {
+	Title, Description, Date  string
+	UnreadEmails, TotalPapers int
+	Unread, Read              papers.AggPapers
+	fields                    []string
+}
+
+// Show returns true if a given metadata field is configured to be shown in the report header.
+func (r textReport) Show(field string) bool {
+	return showField(r.fields, field)
+}
@@ -0,0 +1,77 @@
+package templates
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/bzz/scholar-alert-digest/papers"
+)
+
+// RISRenderer outputs papers in RIS format, importable by EndNote/Zotero/Mendeley.
+type RISRenderer struct{}
+
+// NewRISRenderer factory for Renderer in RIS format.
+func NewRISRenderer() Renderer {
+	return &RISRenderer{}
+}
+
+// Render papers as RIS records, unread first.
+func (r *RISRenderer) Render(out io.Writer, st *papers.Stats, unread, read papers.AggPapers) {
+	log.Print("formatting gmail messages in RIS")
+	w := bufio.NewWriter(out)
+	for _, title := range papers.SortedKeys(unread) {
+		writeRISRecord(w, unread[title])
+	}
+	for _, title := range papers.SortedKeys(read) {
+		writeRISRecord(w, read[title])
+	}
+	if err := w.Flush(); err != nil {
+		log.Fatalf("failed to write RIS: %s", err)
+	}
+}
+
+// writeRISRecord writes a single paper as a RIS record of a generic (GEN) type.
+func writeRISRecord(w io.Writer, p *papers.Paper) {
+	risTag(w, "TY", "GEN")
+	risTag(w, "TI", p.Title)
+	for _, author := range p.Authors {
+		risTag(w, "AU", author)
+	}
+	if p.Venue != "" {
+		risTag(w, "T2", p.Venue)
+	}
+	if p.Year != 0 {
+		risTag(w, "PY", strconv.Itoa(p.Year))
+	}
+	if p.Published != "" { // RIS dates are "YYYY/MM/DD/"
+		risTag(w, "DA", strings.Replace(p.Published, "-", "/", -1)+"/")
+	}
+	if p.Publisher != "" {
+		risTag(w, "PB", p.Publisher)
+	}
+	if p.DOI != "" {
+		risTag(w, "DO", p.DOI)
+	}
+	for _, c := range p.Categories {
+		risTag(w, "KW", c)
+	}
+	for _, c := range p.Concepts {
+		risTag(w, "KW", c)
+	}
+	risTag(w, "UR", p.URL)
+	if abs := strings.TrimSpace(p.Abstract.FirstLine + " " + p.Abstract.Rest); abs != "" {
+		risTag(w, "AB", abs)
+	}
+	risTag(w, "N1", fmt.Sprintf("Google Scholar alerts: %d", p.Freq))
+	fmt.Fprint(w, "ER  - \r\n\r\n")
+}
+
+// risTag writes a single "TAG  - value" line, RIS values are single-line.
+func risTag(w io.Writer, tag, value string) {
+	value = strings.Join(strings.Fields(value), " ")
+	fmt.Fprintf(w, "%s  - %s\r\n", tag, value)
+}
@@ -9,11 +9,15 @@ import (
 	"html/template"
 	"io"
 	"log"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/bzz/scholar-alert-digest/gmailutils"
 	"github.com/bzz/scholar-alert-digest/papers"
 	"gitlab.com/golang-commonmark/markdown"
+	"google.golang.org/api/gmail/v1"
 )
 
 var (
@@ -22,26 +26,32 @@ var (
 <html lang="en">
 <head>
   <meta charset="UTF-8">
-  <link rel="icon" href="http://emojipedia-us.s3.dualstack.us-west-1.amazonaws.com/thumbs/240/apple/232/page-with-curl_1f4c3.png">
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <link rel="icon" href="data:image/svg+xml,<svg xmlns='http://www.w3.org/2000/svg' viewBox='0 0 100 100'><text y='.9em' font-size='90'>📃</text></svg>">
   <base target="_blank">
-  <title>{{ template "title" }}</title>
-  <style>{{ template "style" }}</style>
+  <title>{{ template "title" . }}</title>
+  <style>{{ template "style" . }}</style>
 </head>
 <body>{{ template "body" . }}</body>
 </html>
 `))
 
-	MdTemplText = `# Google Scholar Alert Digest
-
-**Date**: {{.Date}}
-**Unread emails**: {{.UnreadEmails}}
-**Paper titles**: {{.TotalPapers}}
-**Uniq paper titles**: {{.UniqPapers}}
-
-## New papers
+	MdTemplText = `{{ template "header" . -}}
+{{ if .TOC }}{{ template "toc" . }}{{ end }}
+{{- range $i, $section := .Sections }}
+## {{ .Title }}
 {{ range $title := sortedKeys .Papers }}
    {{ $paper := index $.Papers . }}
- - [{{ $paper.Title }}]({{ $paper.URL }}){{if $paper.Author}}, <i>{{ $paper.Author }}</i>{{end}} {{ template "refs" $paper }}
+ - {{ if $.TOC }}<a id="{{ sectionAnchor $i $paper.Title }}"></a>{{ end }}{{ template "badges" $paper }}[{{ md $paper.Title }}]({{ $paper.URL }}){{if $paper.Author}}, <i>{{ md $paper.Author }}</i>{{end}}{{ template "doi" $paper }}{{ template "cited" $paper }}{{ template "attention" $paper }}{{ template "lang" $paper }} {{ template "refs" $paper }}
+   {{- with $paper.TLDR }}
+   <p class="tldr"><b>TL;DR</b> {{ . }}</p>
+   {{- end }}
+   {{- with $paper.Summary }}
+   <p class="summary"><b>Why it matters</b> {{ . }}</p>
+   {{- end }}
+   {{- with $paper.Keywords }}
+   {{ template "keywords" . }}
+   {{- end }}
    {{- if $paper.Abstract.FirstLine }}
    <details>
      <summary>{{ $paper.Abstract.FirstLine }}</summary>
@@ -49,40 +59,204 @@ var (
    </details>
    {{ end }}
 {{ end }}
+{{- end }}
+{{ template "alerts" . }}`
+	// headerMdTemplateText is a report title, description and stats, configured by Options.
+	headerMdTemplateText = `
+{{ define "header" -}}
+# {{ md .Title }}
+{{ if .Description }}
+> {{ md .Description }}
+{{ end }}
+{{ if .Show "date" }}**Date**: {{.Date}}
+{{ end }}
+{{- if .Show "emails" }}**Unread emails**: {{.UnreadEmails}}
+{{ end }}
+{{- if .Show "papers" }}**Paper titles**: {{.TotalPapers}}
+{{ end }}
+{{- if .Show "uniq" }}**Uniq paper titles**: {{.UniqPapers}}
+{{ end }}
+{{- end }}
 `
+
+	// alertsMdTemplateText is a table of the papers by the alert, if configured by Options.
+	alertsMdTemplateText = `
+{{ define "alerts" }}{{ with .Alerts }}
+## Alerts
+
+| Alert | Type | Emails | Papers | Only here |
+|-------|------|-------:|-------:|----------:|
+{{ range . }}| {{ md .Query }} | {{ .Type }} | {{ .Emails }} | {{ .Papers }} | {{ .Unique }} |
+{{ end }}{{ end }}{{ end }}
+`
+
 	refsMdTemplateText = `
 {{ define "refs" -}}
-({{ if eq (len .Refs) 0}}{{ .Freq }}{{end}}
+<span class="count">({{ if eq (len .Refs) 0}}{{ .Freq }}{{end}}
 {{- if gt (len .Refs) 1}}{{ .Freq }}: {{end}}
 {{- range $i, $ref := .Refs}}
 	{{- if $i}}, {{end}}
 	{{- anchorHTML $ref.ID $ref.Title $i -}}
-{{- end}})
+{{- end}})</span>
+{{- with firstSeen . }} <span class="seen" title="Earliest alert email">first seen {{ . }}</span>{{ end }}
+{{- template "spark" . }}
 {{- end}}
 `
 
-	CompactMdTemplText = `# Google Scholar Alert Digest
+	// sparkMdTemplateText is a sparkline of the emails, mentioning a paper, over time, if on different days.
+	sparkMdTemplateText = `
+{{ define "spark" }}{{ with sparkline . }} <span class="spark" title="{{ sparklineTitle $ }}">{{ . }}</span>{{ end }}{{ end }}
+`
 
-**Date**: {{.Date}}
-**Unread emails**: {{.UnreadEmails}}
-**Paper titles**: {{.TotalPapers}}
-**Uniq paper titles**: {{.UniqPapers}}
+	// sparkHTMLTemplateText is the same sparkline, as an inline SVG image.
+	sparkHTMLTemplateText = `
+{{ define "spark" }}{{ with sparklineSVG . }} {{ . }}{{ end }}{{ end }}
+`
 
-## New papers
-{{ range $title := sortedKeys .Papers }}
-   {{ $paper := index $.Papers . }}
- - <details onclick="document.activeElement.blur();">
-	 <summary><a href="{{ $paper.URL }}">{{ $paper.Title }}</a>, <i>{{ $paper.Author }}</i> {{ template "refs" $paper }}</summary>
-	 <div class="wide">
-     {{- if $paper.Abstract.FirstLine }}
-	   <div>{{$paper.Abstract.FirstLine}} {{$paper.Abstract.Rest}}</div>
-	 {{- end }}
-	 </div>
-   </details>
+	// badgesMdTemplateText marks a paper, followed by a space, if there are any marks,
+	// and links to its open access copy, if known from the enrichment.
+	badgesMdTemplateText = `
+{{ define "badges" -}}
+{{ if .Highlight }}<span class="highlight" title="Followed author">★</span> {{ end -}}
+{{ if .Kind }}<span class="kind">{{ .Kind }}</span> {{ end -}}
+{{ with .OpenAccessURL }}<a class="kind" href="{{ . }}" title="Free copy of the paper">OA</a> {{ end -}}
+{{- end }}
+`
+
+	// doiMdTemplateText links to the DOI of a paper, preceded by a space, if known from the enrichment.
+	doiMdTemplateText = `
+{{ define "doi" }}{{ with .DOI }} <a class="doi" href="https://doi.org/{{ . }}">doi:{{ . }}</a>{{ end }}{{ end }}
+`
+
+	// citedMdTemplateText is the number of citations of a paper, preceded by a space, if known from the enrichment.
+	citedMdTemplateText = `
+{{ define "cited" }}{{ if .Citations }} <span class="cited" title="Citations{{ if .InfluentialCitations }}, influential ones built on the paper{{ end }}">cited by {{ .Citations }}
+{{- with .InfluentialCitations }} ({{ . }} influential){{ end }}</span>{{ end }}{{ end }}
+`
+
+	// attentionMdTemplateText is the Altmetric attention score of a paper, preceded by a space, if known from the enrichment.
+	attentionMdTemplateText = `
+{{ define "attention" }}{{ if .Attention }} {{ if .AttentionURL }}<a class="attention" href="{{ .AttentionURL }}" title="Altmetric attention score">
+{{- else }}<span class="attention" title="Altmetric attention score">{{ end }}◉ {{ printf "%.0f" .Attention }}
+{{- if .AttentionURL }}</a>{{ else }}</span>{{ end }}{{ end }}{{ end }}
+`
+
+	// langMdTemplateText is the original language of the abstract of a paper, preceded by a space, if detected
+	// to be not the reader's one.
+	langMdTemplateText = `
+{{ define "lang" }}{{ with .Language }} <span class="lang" title="Original language of the abstract">
+{{- if $.Translated }}translated from {{ end }}{{ . }}</span>{{ end }}{{ end }}
+`
+
+	// keywordsMdTemplateText is the extracted keyphrases of a paper, as tags.
+	keywordsMdTemplateText = `
+{{ define "keywords" }}<p class="keywords">{{ range $i, $k := . }}{{ if $i }} {{ end }}<span class="tag">{{ $k }}</span>{{ end }}</p>{{ end }}
+`
+
+	// tocMdTemplateText is a table of contents, grouping paper titles by frequency, linked to the first section of each.
+	// Links have explicit target, to override the <base target="_blank"> of HTML report.
+	tocMdTemplateText = `
+{{ define "toc" }}
+## Contents
+{{ range freqGroups .Papers }}
+**Mentioned {{ .Freq }} time{{ if gt .Freq 1 }}s{{ end }}**
+{{ range .Titles }}
+ - <a href="#{{ tocAnchor $.Sections . }}" target="_self">{{ md . }}</a>
+{{- end }}
 {{ end }}
+{{- end }}
 `
+
+	// CompactMdTemplText renders only titles, links and counts, for a quick skim or a chat message.
+	CompactMdTemplText = `{{ template "header" . -}}
+{{ if .TOC }}{{ template "toc" . }}{{ end }}
+{{- range $i, $section := .Sections }}
+## {{ .Title }}
+{{ range $title := sortedKeys .Papers }}{{ $paper := index $.Papers . }}
+ - {{ if $.TOC }}<a id="{{ sectionAnchor $i $paper.Title }}"></a>{{ end }}{{ template "badges" $paper }}[{{ md $paper.Title }}]({{ $paper.URL }}) ({{ $paper.Freq }})
+{{- end }}
+{{ end }}
+{{ template "alerts" . }}`
+	// FullMdTemplText renders all the details of every paper: authors, venue and year, and the whole abstract.
+	FullMdTemplText = `{{ template "header" . -}}
+{{ if .TOC }}{{ template "toc" . }}{{ end }}
+{{- range $i, $section := .Sections }}
+## {{ .Title }}
+{{ range $title := sortedKeys .Papers }}{{ $paper := index $.Papers . }}
+### {{ if $.TOC }}<a id="{{ sectionAnchor $i $paper.Title }}"></a>{{ end }}{{ template "badges" $paper }}[{{ md $paper.Title }}]({{ $paper.URL }}) {{ template "refs" $paper }}
+{{ if $paper.Author }}
+<i>{{ md $paper.Author }}</i>{{ if $paper.Venue }} - {{ md $paper.Venue }}{{ end }}{{ if $paper.Published }}, {{ $paper.Published }}{{ else if $paper.Year }}, {{ $paper.Year }}{{ end }}{{ template "doi" $paper }}{{ template "cited" $paper }}{{ template "attention" $paper }}{{ template "lang" $paper }}
+{{ else if or $paper.DOI $paper.Citations $paper.Attention $paper.Language }}
+{{ template "doi" $paper }}{{ template "cited" $paper }}{{ template "attention" $paper }}{{ template "lang" $paper }}
+{{ end }}
+{{- with $paper.Concepts }}
+<span class="concepts">{{ range $i, $c := . }}{{ if $i }} · {{ end }}{{ md $c }}{{ end }}</span>
+{{ end }}
+{{- with $paper.TLDR }}
+**TL;DR** {{ md . }}
+{{ end }}
+{{- with $paper.Summary }}
+**Why it matters** {{ md . }}
+{{ end }}
+{{- with $paper.Keywords }}
+{{ template "keywords" . }}
+{{ end }}
+{{- if $paper.Abstract.FirstLine }}
+{{ md $paper.Abstract.FirstLine }} {{ md $paper.Abstract.Rest }}
+{{ end }}
+{{- end }}
+{{- end }}
+{{ template "alerts" . }}`
+
 	// TODO(bzz): add configurable template for individual li
 
+	// TableHTMLTemplText renders new papers in a HTML table, sortable and filterable in browser.
+	// There must be no blank lines inside the <table>, for it to stay a single raw HTML block in Markdown.
+	TableHTMLTemplText = `{{ template "header" . -}}
+{{ if .TOC }}{{ template "toc" . }}{{ end }}
+## New papers
+
+<input id="filter" type="search" placeholder="Filter papers..." oninput="filterPapers(this.value)">
+
+<table id="papers">
+<thead><tr><th class="sortable" onclick="sortPapers(0, true)">Count</th><th class="sortable" onclick="sortPapers(1, false)">Paper</th>{{ if .ByType }}<th class="sortable" onclick="sortPapers(2, false)">Alert</th>{{ else if .ByLabel }}<th class="sortable" onclick="sortPapers(2, false)">Label</th>{{ else if .BySeen }}<th class="sortable" onclick="sortPapers(2, false)">Seen</th>{{ else if .Diff }}<th class="sortable" onclick="sortPapers(2, false)">Change</th>{{ else if .Window }}<th class="sortable" onclick="sortPapers(2, false)">Period</th>{{ else if .ByTopic }}<th class="sortable" onclick="sortPapers(2, false)">Topic</th>{{ end }}</tr></thead>
+<tbody>
+{{- range $i, $section := .Sections }}
+{{- range $title := sortedKeys .Papers }}{{ $paper := index $.Papers . }}
+<tr id="{{ sectionAnchor $i $paper.Title }}"><td data-sort="{{ $paper.Freq }}">{{ template "refs" $paper }}</td><td data-sort="{{ $paper.Title }}">{{ template "badges" $paper }}<a href="{{ $paper.URL }}">{{ $paper.Title }}</a>{{if $paper.Author}}, <i>{{ $paper.Author }}</i>{{end}}{{ template "doi" $paper }}{{ template "cited" $paper }}{{ template "attention" $paper }}{{ template "lang" $paper }}
+{{- with $paper.TLDR }}<p class="tldr"><b>TL;DR</b> {{ . }}</p>{{ end }}
+{{- with $paper.Summary }}<p class="summary"><b>Why it matters</b> {{ . }}</p>{{ end }}
+{{- with $paper.Keywords }}{{ template "keywords" . }}{{ end }}
+{{- if $paper.Abstract.FirstLine }}<details><summary>{{ $paper.Abstract.FirstLine }}</summary><div>{{ $paper.Abstract.Rest }}</div></details>{{ end }}</td>
+{{- if or $.ByType $.ByLabel $.BySeen $.Diff $.Window $.ByTopic }}<td data-sort="{{ $section.Title }}">{{ $section.Title }}</td>{{ end }}</tr>
+{{- end }}
+{{- end }}
+</tbody>
+</table>
+{{ template "alerts" . }}
+
+<script>
+function filterPapers(query) {
+  query = query.toLowerCase();
+  document.querySelectorAll("#papers tbody tr").forEach(function (tr) {
+    tr.style.display = tr.textContent.toLowerCase().indexOf(query) >= 0 ? "" : "none";
+  });
+}
+
+var sortOrder = {};
+function sortPapers(col, numeric) {
+  var tbody = document.querySelector("#papers tbody");
+  var rows = Array.prototype.slice.call(tbody.rows);
+  var order = sortOrder[col] = -(sortOrder[col] || -1);
+  rows.sort(function (a, b) {
+    var x = a.cells[col].dataset.sort, y = b.cells[col].dataset.sort;
+    return order * (numeric ? x - y : x.localeCompare(y));
+  });
+  rows.forEach(function (tr) { tbody.appendChild(tr); });
+}
+</script>
+`
+
 	ReadMdTemplText = `## Old papers
 
 <details id="archive">
@@ -90,7 +264,7 @@ var (
 
 {{ range $title := sortedKeys . }}
   {{ $paper := index $ . }}
-  - [{{ $paper.Title }}]({{ $paper.URL }})
+  - [{{ md $paper.Title }}]({{ $paper.URL }})
     {{- if $paper.Abstract.FirstLine }}
     <details>
       <summary>{{$paper.Abstract.FirstLine}}</summary>{{$paper.Abstract.Rest}}
@@ -98,15 +272,380 @@ var (
     {{ end }}
 {{ end }}
 </details>
+`
+
+	// HTMLStyle is a default style of HTML report, embedded so it has no external dependencies.
+	HTMLStyle = `
+:root { --fg: #24292e; --bg: #fff; --muted: #586069; --link: #0366d6;
+  --border: #e1e4e8; --light-border: #eaecef; --box: #f6f8fa; --badge: #6a737d; }
+:root.dark { --fg: #c9d1d9; --bg: #0d1117; --muted: #8b949e; --link: #58a6ff;
+  --border: #30363d; --light-border: #21262d; --box: #161b22; --badge: #484f58; }
+@media (prefers-color-scheme: dark) {
+  :root:not(.light) { --fg: #c9d1d9; --bg: #0d1117; --muted: #8b949e; --link: #58a6ff;
+    --border: #30363d; --light-border: #21262d; --box: #161b22; --badge: #484f58; }
+}
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; line-height: 1.5;
+  color: var(--fg); background: var(--bg); max-width: 60em; margin: 0 auto; padding: 1em 2em; }
+a { color: var(--link); text-decoration: none; }
+a:hover { text-decoration: underline; }
+h1 { border-bottom: 1px solid var(--light-border); padding-bottom: .3em; }
+h1 + p, h1 + blockquote + p { background: var(--box); border: 1px solid var(--border); border-radius: 6px; padding: .8em 1em; white-space: pre-line; }
+h1 + blockquote { margin: 0; color: var(--muted); }
+h2 { margin-top: 1.5em; }
+li { margin: .4em 0; }
+details { margin: .2em 0 .4em 0; color: var(--muted); }
+details > summary { cursor: pointer; }
+details > div { padding: .3em 0 0 1em; }
+.count { display: inline-block; font-size: 75%; font-weight: 600; line-height: 1.6; color: #fff;
+  background: var(--badge); border-radius: 1em; padding: 0 .6em; vertical-align: middle; }
+.count a { color: inherit !important; }
+.highlight { color: #e3b341; }
+.seen { font-size: 75%; color: var(--muted); white-space: nowrap; }
+.doi { font-size: 75%; white-space: nowrap; }
+.cited { font-size: 75%; color: var(--muted); white-space: nowrap; }
+.attention { font-size: 75%; color: #d9534f !important; white-space: nowrap; }
+.tldr, .summary { margin: .2em 0; color: var(--muted); }
+.concepts { font-size: 75%; color: var(--muted); }
+.keywords { margin: .2em 0; }
+.lang { font-size: 75%; color: var(--muted); white-space: nowrap; }
+.tag { display: inline-block; font-size: 75%; color: var(--link); border: 1px solid var(--border); border-radius: 1em;
+  padding: 0 .5em; }
+.spark { color: var(--link); fill: currentColor; vertical-align: baseline; white-space: nowrap; }
+.kind { font-size: 70%; font-weight: 600; color: var(--link); border: 1px solid var(--link); border-radius: 3px;
+  padding: 0 .3em; vertical-align: middle; }
+#theme-toggle { position: fixed; top: 1em; right: 1em; cursor: pointer; font-size: 120%;
+  color: var(--fg); background: var(--box); border: 1px solid var(--border); border-radius: 6px; }
+#filter { width: 100%; box-sizing: border-box; padding: .4em .6em; margin-bottom: .8em; font-size: 100%;
+  color: var(--fg); background: var(--bg); border: 1px solid var(--border); border-radius: 6px; }
+table { border-collapse: collapse; }
+th, td { padding: .2em .6em; border-bottom: 1px solid var(--light-border); }
+#papers { border-collapse: collapse; width: 100%; }
+#papers th { text-align: left; border-bottom: 2px solid var(--border); padding: .4em; }
+#papers th.sortable { cursor: pointer; user-select: none; }
+#papers th.sortable:after { content: " \2195"; color: var(--muted); }
+#papers td { vertical-align: top; border-bottom: 1px solid var(--light-border); padding: .4em; }
+#papers td:first-child { white-space: nowrap; }
+`
+
+	// htmlPageTemplText fills the RootLayout \w the htmlPage, so the title and the body are data, not template source.
+	htmlPageTemplText = `{{ define "title" }}{{ .Title }}{{ end }}{{ define "style" }}{{ .Style }}{{ end }}{{ define "body" }}{{ .Body }}{{ end }}`
+
+	// themeToggle is a button, switching between light and dark styles, that overrides the
+	// prefers-color-scheme of the browser. User choice is saved in the localStorage.
+	themeToggle = `<button id="theme-toggle" title="Toggle dark mode" onclick="toggleTheme()">&#x1F313;</button>
+<script>
+(function () {
+  try {
+    var theme = localStorage.getItem("theme");
+    if (theme) { document.documentElement.classList.add(theme); }
+  } catch (e) {}
+})();
+
+function toggleTheme() {
+  var root = document.documentElement;
+  var dark = root.classList.contains("dark") ||
+    (!root.classList.contains("light") && window.matchMedia("(prefers-color-scheme: dark)").matches);
+  root.classList.toggle("dark", !dark);
+  root.classList.toggle("light", dark);
+  try { localStorage.setItem("theme", dark ? "light" : "dark"); } catch (e) {}
+}
+</script>
 `
 
 	CompatStyle = `
 ul { list-style-type: none; margin: 0; padding: 0 0 0 20px; }
+li { margin: .1em 0; }
 #archive>ul {list-style-type: circle; }
-.wide { max-width:60%; margin-left: 1em; padding: 0.2em 0 0.5em 0; }
 `
 )
 
+// Report is the data, available to the Markdown/HTML report templates.
+type Report struct {
+	Title        string               // report title
+	Description  string               // optional description line, under the title
+	Date         string               // RFC3339 time of the report generation
+	UnreadEmails int                  // number of unread emails
+	TotalPapers  int                  // number of paper titles in unread emails
+	UniqPapers   int                  // number of unique paper titles in unread emails
+	Errors       int                  // number of emails that papers failed to be extracted from
+	Papers       papers.AggPapers     // unread papers, by title
+	Read         papers.AggPapers     // read papers, by title, only if -read is set
+	TOC          bool                 // include the table of contents
+	ByType       bool                 // papers are split in sections by the alert type
+	ByLabel      bool                 // papers are split in sections by the Gmail label
+	BySeen       bool                 // papers are split in sections of the new and already reported ones
+	Diff         bool                 // papers are split in sections of the added and removed ones
+	Window       string               // papers are split in sections by the "week" or "month", if set
+	ByTopic      bool                 // papers are split in sections by the topic
+	Sections     []Section            // unread papers, in report sections
+	Alerts       []*papers.AlertStats // papers by the alert of the unread emails, only if configured
+	fields       []string
+}
+
+// Section is a part of the report \w a title and the papers in it.
+type Section struct {
+	Title  string
+	Alert  gmailutils.AlertType
+	Papers papers.AggPapers
+}
+
+// sections splits papers by the Gmail labels, if there are any, by the alert type or in new and seen ones,
+// as set in the options, or returns a single section \w all of them. Citation alerts are further split by the cited work.
+func sections(aggPapers papers.AggPapers, opts Options) []Section {
+	if len(opts.Labels) != 0 {
+		return labelSections(aggPapers, opts.Labels)
+	}
+	if opts.BySeen {
+		return seenSections(aggPapers)
+	}
+	if opts.Diff {
+		return diffSections(aggPapers)
+	}
+	if opts.Window != "" {
+		return windowSections(aggPapers, opts.Window)
+	}
+	if opts.ByTopic {
+		return topicSections(aggPapers)
+	}
+	if !opts.ByType {
+		return []Section{{"New papers", gmailutils.UnknownAlert, aggPapers}}
+	}
+
+	byAlert := map[gmailutils.AlertType]papers.AggPapers{}
+	for title, p := range aggPapers {
+		if byAlert[p.Alert] == nil {
+			byAlert[p.Alert] = papers.AggPapers{}
+		}
+		byAlert[p.Alert][title] = p
+	}
+
+	var result []Section
+	for _, alert := range append(gmailutils.AlertTypes, gmailutils.UnknownAlert) {
+		ps, ok := byAlert[alert]
+		if !ok {
+			continue
+		}
+		if alert == gmailutils.NewCitations {
+			result = append(result, citedSections(ps)...)
+			continue
+		}
+		result = append(result, Section{sectionTitle(alert), alert, ps})
+	}
+	return result
+}
+
+// seenSections splits papers in the new ones and the ones, already reported in an earlier digest.
+func seenSections(aggPapers papers.AggPapers) []Section {
+	unseen, seen := papers.AggPapers{}, papers.AggPapers{}
+	for title, p := range aggPapers {
+		if p.Seen {
+			seen[title] = p
+		} else {
+			unseen[title] = p
+		}
+	}
+
+	var result []Section
+	if len(unseen) != 0 {
+		result = append(result, Section{"New papers", gmailutils.UnknownAlert, unseen})
+	}
+	if len(seen) != 0 {
+		result = append(result, Section{"Previously seen (still unread)", gmailutils.UnknownAlert, seen})
+	}
+	return result
+}
+
+// diffSections splits papers in the added and the removed ones, since an earlier report.
+func diffSections(aggPapers papers.AggPapers) []Section {
+	added, removed := papers.AggPapers{}, papers.AggPapers{}
+	for title, p := range aggPapers {
+		if p.Removed {
+			removed[title] = p
+		} else {
+			added[title] = p
+		}
+	}
+
+	var result []Section
+	if len(added) != 0 {
+		result = append(result, Section{"Added papers", gmailutils.UnknownAlert, added})
+	}
+	if len(removed) != 0 {
+		result = append(result, Section{"Removed papers", gmailutils.UnknownAlert, removed})
+	}
+	return result
+}
+
+// Windows are the calendar periods, papers may be split in report sections by.
+var Windows = []string{"week", "month"}
+
+// windowStart returns the start of the period of a given time, and its title, by the window.
+var windowStart = map[string]func(time.Time) (time.Time, string){
+	"week": func(t time.Time) (time.Time, string) {
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		monday := day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+		return monday, "Week of " + monday.Format("2006-01-02")
+	},
+	"month": func(t time.Time) (time.Time, string) {
+		first := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+		return first, first.Format("January 2006")
+	},
+}
+
+// windowSections splits papers by the week or month of the earliest email, mentioning them, the earliest first.
+// Papers \wo a known date are in the last section.
+func windowSections(aggPapers papers.AggPapers, window string) []Section {
+	byStart := map[int64]papers.AggPapers{}
+	titles := map[int64]string{}
+	undated := papers.AggPapers{}
+	for title, p := range aggPapers {
+		if p.Date().IsZero() {
+			undated[title] = p
+			continue
+		}
+		start, periodTitle := windowStart[window](p.Date())
+		if byStart[start.Unix()] == nil {
+			byStart[start.Unix()] = papers.AggPapers{}
+			titles[start.Unix()] = periodTitle
+		}
+		byStart[start.Unix()][title] = p
+	}
+
+	var starts []int64
+	for start := range byStart {
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+
+	var result []Section
+	for _, start := range starts {
+		result = append(result, Section{titles[start], gmailutils.UnknownAlert, byStart[start]})
+	}
+	if len(undated) != 0 {
+		result = append(result, Section{"Undated papers", gmailutils.UnknownAlert, undated})
+	}
+	return result
+}
+
+// topicSections splits papers by the Topic, the biggest topics first. Papers \wo a topic are in the last section.
+func topicSections(aggPapers papers.AggPapers) []Section {
+	byTopic := map[string]papers.AggPapers{}
+	for title, p := range aggPapers {
+		if byTopic[p.Topic] == nil {
+			byTopic[p.Topic] = papers.AggPapers{}
+		}
+		byTopic[p.Topic][title] = p
+	}
+
+	var topics []string
+	for topic := range byTopic {
+		if topic != "" {
+			topics = append(topics, topic)
+		}
+	}
+	sort.Slice(topics, func(i, j int) bool {
+		if a, b := len(byTopic[topics[i]]), len(byTopic[topics[j]]); a != b {
+			return a > b
+		}
+		return topics[i] < topics[j]
+	})
+
+	var result []Section
+	for _, topic := range topics {
+		result = append(result, Section{topic, gmailutils.UnknownAlert, byTopic[topic]})
+	}
+	if ps, ok := byTopic[""]; ok {
+		result = append(result, Section{"Other papers", gmailutils.UnknownAlert, ps})
+	}
+	return result
+}
+
+// labelSections groups papers under each of the Gmail labels of the emails, mentioning them, in the order of labels.
+// Papers \wo any of the labels are the last.
+func labelSections(aggPapers papers.AggPapers, labels []*gmail.Label) []Section {
+	byLabel := map[string]papers.AggPapers{}
+	for title, p := range aggPapers {
+		found := false
+		for _, l := range labels {
+			for _, id := range p.LabelIDs() {
+				if id != l.Id {
+					continue
+				}
+				if byLabel[id] == nil {
+					byLabel[id] = papers.AggPapers{}
+				}
+				byLabel[id][title] = p
+				found = true
+			}
+		}
+		if !found {
+			if byLabel[""] == nil {
+				byLabel[""] = papers.AggPapers{}
+			}
+			byLabel[""][title] = p
+		}
+	}
+
+	var result []Section
+	for _, l := range labels {
+		if ps, ok := byLabel[l.Id]; ok {
+			result = append(result, Section{l.Name, gmailutils.UnknownAlert, ps})
+		}
+	}
+	if ps, ok := byLabel[""]; ok {
+		result = append(result, Section{sectionTitle(gmailutils.UnknownAlert), gmailutils.UnknownAlert, ps})
+	}
+	return result
+}
+
+// citedSections groups citing papers under each of the cited works, sorted by its title.
+// Citing papers of an unknown work e.g from "new citations to my articles" are the last.
+func citedSections(aggPapers papers.AggPapers) []Section {
+	byCited := map[string]papers.AggPapers{}
+	for title, p := range aggPapers {
+		cites := p.Cites
+		if len(cites) == 0 {
+			cites = []string{""}
+		}
+		for _, cited := range cites {
+			if byCited[cited] == nil {
+				byCited[cited] = papers.AggPapers{}
+			}
+			byCited[cited][title] = p
+		}
+	}
+
+	var works []string
+	for cited := range byCited {
+		if cited != "" {
+			works = append(works, cited)
+		}
+	}
+	sort.Strings(works)
+
+	var result []Section
+	for _, cited := range works {
+		result = append(result, Section{fmt.Sprintf("New citations of %q", cited), gmailutils.NewCitations, byCited[cited]})
+	}
+	if ps, ok := byCited[""]; ok {
+		result = append(result, Section{sectionTitle(gmailutils.NewCitations), gmailutils.NewCitations, ps})
+	}
+	return result
+}
+
+// sectionTitle returns a capitalized alert type, as a title of the report section.
+func sectionTitle(alert gmailutils.AlertType) string {
+	if alert == gmailutils.UnknownAlert {
+		return "Other papers"
+	}
+	return strings.ToUpper(string(alert[:1])) + string(alert[1:])
+}
+
+// Show returns true if a given metadata field is configured to be shown in the report header.
+func (r Report) Show(field string) bool {
+	return showField(r.fields, field)
+}
+
 // Renderer renders papers in one of the supported output formats: Markdown/HTML/JSON/JSONL.
 type Renderer interface {
 	Render(out io.Writer, st *papers.Stats, unread, read papers.AggPapers)
@@ -148,6 +687,9 @@ func NewJSONRenderer() Renderer {
 						"time":     time.Now().Format(time.RFC3339),
 						"messages": st.Msgs,
 						"papers":   st.Titles,
+						"uniq":     len(unread),
+						"errors":   st.Errs,
+						"alerts":   st.Alerts,
 					},
 				},
 			}
@@ -179,9 +721,15 @@ type MarkdownRenderer struct {
 	layout     *template.Template
 	template   string
 	oldTempate string
+	spark      string // template of the sparklines, Markdown or HTML
+	opts       Options
 }
 
 func NewMarkdownRenderer(templateText, oldTemplateText string) Renderer {
+	return newMarkdownRenderer(templateText, oldTemplateText, Options{})
+}
+
+func newMarkdownRenderer(templateText, oldTemplateText string, opts Options) *MarkdownRenderer {
 	return &MarkdownRenderer{
 		template.New("papers").Funcs(template.FuncMap{
 			"sortedKeys": papers.SortedKeys,
@@ -199,36 +747,60 @@ func NewMarkdownRenderer(templateText, oldTemplateText string) Renderer {
 					),
 				)
 			},
-		}),
+		}).Funcs(helpers),
 		templateText,
 		oldTemplateText,
+		sparkMdTemplateText,
+		opts,
 	}
 }
 
 func (r *MarkdownRenderer) Render(out io.Writer, st *papers.Stats, unread, read papers.AggPapers) {
-	r.newMdReport(out, st, unread)
+	r.newMdReport(out, st, unread, read)
 	if read != nil {
 		r.oldMdReport(out, read)
 	}
 }
 
 // newMdReport renderes tmplText \w email msg stats (for new, unread papers).
-func (r *MarkdownRenderer) newMdReport(out io.Writer, st *papers.Stats, agrPapers papers.AggPapers) {
+func (r *MarkdownRenderer) newMdReport(out io.Writer, st *papers.Stats, agrPapers, read papers.AggPapers) {
 	layout := template.Must(r.layout.Clone())
-	tmpl := template.Must(layout.Parse(r.template))
+	tmpl := template.Must(layout.Parse(headerMdTemplateText))
 	tmpl = template.Must(tmpl.Parse(refsMdTemplateText))
-	err := tmpl.Execute(out, struct {
-		Date         string
-		UnreadEmails int
-		TotalPapers  int
-		UniqPapers   int
-		Papers       papers.AggPapers
-	}{
-		time.Now().Format(time.RFC3339),
-		st.Msgs,
-		st.Titles,
-		len(agrPapers),
-		agrPapers,
+	tmpl = template.Must(tmpl.Parse(r.spark))
+	tmpl = template.Must(tmpl.Parse(badgesMdTemplateText))
+	tmpl = template.Must(tmpl.Parse(doiMdTemplateText))
+	tmpl = template.Must(tmpl.Parse(citedMdTemplateText))
+	tmpl = template.Must(tmpl.Parse(attentionMdTemplateText))
+	tmpl = template.Must(tmpl.Parse(langMdTemplateText))
+	tmpl = template.Must(tmpl.Parse(keywordsMdTemplateText))
+	tmpl = template.Must(tmpl.Parse(tocMdTemplateText))
+	tmpl = template.Must(tmpl.Parse(alertsMdTemplateText))
+	tmpl = template.Must(tmpl.Parse(r.template))
+	var alerts []*papers.AlertStats
+	if r.opts.AlertStats {
+		alerts = st.Alerts
+	}
+	err := tmpl.Execute(out, Report{
+		Title:        orDefault(r.opts.Title, DefaultTitle),
+		Description:  r.opts.Description,
+		Date:         time.Now().Format(time.RFC3339),
+		UnreadEmails: st.Msgs,
+		TotalPapers:  st.Titles,
+		UniqPapers:   len(agrPapers),
+		Errors:       st.Errs,
+		Papers:       agrPapers,
+		Read:         read,
+		TOC:          r.opts.TOC,
+		ByType:       r.opts.ByType,
+		ByLabel:      len(r.opts.Labels) != 0,
+		BySeen:       r.opts.BySeen,
+		Diff:         r.opts.Diff,
+		Window:       r.opts.Window,
+		ByTopic:      r.opts.ByTopic,
+		Sections:     sections(agrPapers, r.opts),
+		Alerts:       alerts,
+		fields:       r.opts.Fields,
 	})
 	if err != nil {
 		log.Fatalf("template %q execution failed: %s", r.template, err)
@@ -245,15 +817,30 @@ func (r *MarkdownRenderer) oldMdReport(out io.Writer, agrPapers papers.AggPapers
 	}
 }
 
-// HTMLRenderer outputs HTML from template in Markdown.
+// HTMLRenderer outputs self-contained HTML from template in Markdown, \w embedded style.
 type HTMLRenderer struct {
 	Renderer
-	layout *template.Template
-	style  string
+	page  *template.Template
+	style string
+	opts  Options
+}
+
+// htmlPage is the data of the HTML report page.
+type htmlPage struct {
+	Title string
+	Style template.CSS
+	Body  template.HTML // rendered from Markdown
 }
 
 func NewHTMLRenderer(templateText, style string) Renderer {
-	return &HTMLRenderer{NewMarkdownRenderer(templateText, ReadMdTemplText), RootLayout, style}
+	return newHTMLRenderer(templateText, Options{Style: style})
+}
+
+func newHTMLRenderer(templateText string, opts Options) *HTMLRenderer {
+	md := newMarkdownRenderer(templateText, ReadMdTemplText, opts)
+	md.spark = sparkHTMLTemplateText
+	page := template.Must(template.Must(RootLayout.Clone()).Parse(htmlPageTemplText))
+	return &HTMLRenderer{md, page, HTMLStyle + opts.Style, opts}
 }
 
 func (r *HTMLRenderer) Render(out io.Writer, st *papers.Stats, unread, read papers.AggPapers) {
@@ -264,19 +851,11 @@ func (r *HTMLRenderer) Render(out io.Writer, st *papers.Stats, unread, read pape
 	md := markdown.New(markdown.XHTMLOutput(true), markdown.HTML(true))
 	md.Render(&htmlBuf, mdBuf.Bytes())
 
-	// rootLayout requires 3 sub-templates
-	title := `{{ define "title" }}scholar alert digest{{ end }}`
-	style := fmt.Sprintf(`{{ define "style" }}%s{{ end }}`, r.style)
-	body := fmt.Sprintf(`{{ define "body" }}%s{{ end }}`, htmlBuf.String())
-
-	// TODO(bzz): move tmpl construction out of .Render(), so there is either:
-	// - only one .Clone() + .Parese() for dynamic "body" template, generated from MD
-	// - or change "body" template to recive HTML generated from MD as a data (better)
-	tmpl := template.Must(r.layout.Clone())
-	tmpl = template.Must(tmpl.Parse(title))
-	tmpl = template.Must(tmpl.Parse(style))
-	tmpl = template.Must(tmpl.Parse(body))
-	err := tmpl.Execute(out, nil)
+	err := r.page.Execute(out, htmlPage{
+		Title: orDefault(r.opts.Title, DefaultTitle),
+		Style: template.CSS(r.style),
+		Body:  template.HTML(themeToggle + htmlBuf.String()),
+	})
 	if err != nil {
 		log.Fatalf("template execution failed: %s", err)
 	}
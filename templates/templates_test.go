@@ -0,0 +1,623 @@
+package templates
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bzz/scholar-alert-digest/gmailutils"
+	"github.com/bzz/scholar-alert-digest/papers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/gmail/v1"
+)
+
+var testPapers = papers.AggPapers{
+	"Learning to represent programs with graphs": &papers.Paper{
+		Title:    "Learning to represent programs with graphs",
+		URL:      "https://arxiv.org/abs/1711.00740",
+		Author:   "M Allamanis, M Brockschmidt",
+		Authors:  []string{"M Allamanis", "M Brockschmidt"},
+		Abstract: papers.Abstract{FirstLine: "Learning tasks on source code", Rest: "have received\nlittle attention"},
+		Freq:     2,
+	},
+}
+
+func TestRISRenderer(t *testing.T) {
+	var out bytes.Buffer
+	NewRISRenderer().Render(&out, &papers.Stats{}, testPapers, nil)
+
+	expected := "TY  - GEN\r\n" +
+		"TI  - Learning to represent programs with graphs\r\n" +
+		"AU  - M Allamanis\r\n" +
+		"AU  - M Brockschmidt\r\n" +
+		"UR  - https://arxiv.org/abs/1711.00740\r\n" +
+		"AB  - Learning tasks on source code have received little attention\r\n" +
+		"N1  - Google Scholar alerts: 2\r\n" +
+		"ER  - \r\n\r\n"
+	assert.Equal(t, expected, out.String())
+}
+
+func TestEnrichedMetadata(t *testing.T) {
+	aggPapers := papers.AggPapers{"code2vec": &papers.Paper{
+		Title: "code2vec", URL: "https://dl.acm.org/1", Freq: 1, Venue: "POPL", Year: 2019,
+		DOI: "10.1145/3290353", Published: "2019-01-02", Publisher: "ACM", Categories: []string{"cs.LG", "cs.PL"},
+		Citations: 700, InfluentialCitations: 80, TLDR: "Code is embedded as a vector.",
+		Attention: 42.5, AttentionURL: "https://www.altmetric.com/details.php?citation_id=1",
+		Concepts: []string{"Computer science"}, OpenAccess: "bronze", OpenAccessURL: "https://dl.acm.org/doi/pdf/10.1145/3290353",
+		Summary: "Learned code embeddings enable method name prediction.", Keywords: []string{"code embeddings", "method names"},
+		Language: "es", Translated: true,
+	}}
+
+	var out bytes.Buffer
+	NewRISRenderer().Render(&out, &papers.Stats{}, aggPapers, nil)
+	assert.Contains(t, out.String(), "PY  - 2019\r\nDA  - 2019/01/02/\r\nPB  - ACM\r\nDO  - 10.1145/3290353\r\nKW  - cs.LG\r\nKW  - cs.PL\r\nKW  - Computer science\r\nUR  - ")
+
+	out.Reset()
+	NewCSVRenderer().Render(&out, &papers.Stats{}, aggPapers, nil)
+	assert.Contains(t, out.String(), ",POPL,2019,10.1145/3290353,2019-01-02,ACM\n")
+
+	for _, format := range []string{"md", "html"} {
+		r, err := NewRenderer(format, Options{})
+		require.NoError(t, err)
+		out.Reset()
+		r.Render(&out, &papers.Stats{}, aggPapers, nil)
+		assert.Contains(t, out.String(), `<a class="doi" href="https://doi.org/10.1145/3290353">doi:10.1145/3290353</a>`, format)
+		assert.Contains(t, out.String(), `>cited by 700 (80 influential)</span> <a class="attention" href="https://www.altmetric.com/details.php?citation_id=1" title="Altmetric attention score">◉ 42</a> <span class="lang" title="Original language of the abstract">translated from es</span>`, format)
+		assert.Contains(t, out.String(), `<p class="tldr"><b>TL;DR</b> Code is embedded as a vector.</p>`, format)
+		assert.Contains(t, out.String(), `<p class="summary"><b>Why it matters</b> Learned code embeddings enable method name prediction.</p>`, format)
+		assert.Contains(t, out.String(), `<p class="keywords"><span class="tag">code embeddings</span> <span class="tag">method names</span></p>`, format)
+		assert.Contains(t, out.String(), `<a class="kind" href="https://dl.acm.org/doi/pdf/10.1145/3290353" title="Free copy of the paper">OA</a> `, format)
+	}
+
+	r, err := NewRenderer("md", Options{Template: FullMdTemplText})
+	require.NoError(t, err)
+	out.Reset()
+	r.Render(&out, &papers.Stats{}, aggPapers, nil)
+	assert.Contains(t, out.String(), "\n<span class=\"concepts\">Computer science</span>\n")
+	assert.Contains(t, out.String(), "\n**Why it matters** Learned code embeddings enable method name prediction.\n")
+	assert.Contains(t, out.String(), "\n<p class=\"keywords\"><span class=\"tag\">code embeddings</span>")
+}
+
+func TestCSVRenderer(t *testing.T) {
+	var out bytes.Buffer
+	NewCSVRenderer().Render(&out, &papers.Stats{}, testPapers, nil)
+
+	expected := "title,url,abstract,count,authors,venue,year,doi,published,publisher\n" +
+		"Learning to represent programs with graphs,https://arxiv.org/abs/1711.00740,\"Learning tasks on source code have received\nlittle attention\",2,M Allamanis; M Brockschmidt,,,,,\n"
+	assert.Equal(t, expected, out.String())
+}
+
+func TestAtomRendererStableIDs(t *testing.T) {
+	var first, second bytes.Buffer
+	NewAtomRenderer(Options{}).Render(&first, &papers.Stats{}, testPapers, nil)
+	NewAtomRenderer(Options{}).Render(&second, &papers.Stats{}, testPapers, nil)
+
+	id := guid("https://arxiv.org/abs/1711.00740")
+	assert.Contains(t, first.String(), "<id>"+id+"</id>")
+	assert.Contains(t, second.String(), "<id>"+id+"</id>")
+	assert.Contains(t, first.String(), `<link href="https://arxiv.org/abs/1711.00740"></link>`)
+}
+
+func TestEPUBRenderer(t *testing.T) {
+	var out bytes.Buffer
+	NewEPUBRenderer(Options{}).Render(&out, &papers.Stats{}, testPapers, nil)
+
+	z, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	require.NoError(t, err)
+	require.NotEmpty(t, z.File)
+	assert.Equal(t, "mimetype", z.File[0].Name)
+	assert.Equal(t, zip.Store, z.File[0].Method)
+
+	var names []string
+	for _, f := range z.File {
+		names = append(names, f.Name)
+	}
+	assert.Contains(t, names, "META-INF/container.xml")
+	assert.Contains(t, names, "OEBPS/digest.xhtml")
+}
+
+func TestOrgRenderer(t *testing.T) {
+	var out bytes.Buffer
+	NewOrgRenderer(Options{}).Render(&out, &papers.Stats{Msgs: 1, Titles: 2}, testPapers, nil)
+
+	assert.Contains(t, out.String(), `* New papers
+** Learning to represent programs with graphs
+:PROPERTIES:
+:URL: https://arxiv.org/abs/1711.00740
+:COUNT: 2
+:AUTHOR: M Allamanis, M Brockschmidt
+:END:
+Learning tasks on source code have received little attention
+`)
+	assert.NotContains(t, out.String(), "* Old papers")
+}
+
+func TestLaTeXEscaping(t *testing.T) {
+	assert.Equal(t, `50\% of \$x\_1\$ \& \{y\}`, texEscaper.Replace("50% of $x_1$ & {y}"))
+	assert.Equal(t, `\textbackslash{}cite`, texEscaper.Replace(`\cite`))
+	assert.Equal(t, `https://example.com/a\%20b\#c`, texURLEscaper.Replace("https://example.com/a%20b#c"))
+}
+
+func TestLaTeXRenderer(t *testing.T) {
+	var out bytes.Buffer
+	NewLaTeXRenderer(Options{}).Render(&out, &papers.Stats{}, testPapers, nil)
+
+	assert.Contains(t, out.String(), `\item \href{https://arxiv.org/abs/1711.00740}{Learning to represent programs with graphs} (2)`)
+	assert.Contains(t, out.String(), `\end{document}`)
+	assert.NotContains(t, out.String(), "Old papers")
+}
+
+func TestWrap(t *testing.T) {
+	var testCases = []struct {
+		text, indent string
+		width        int
+		expected     string
+	}{
+		{"", "", 10, ""},
+		{"short", "", 10, "short"},
+		{"a b c d e f", "", 5, "a b c\nd e f"},
+		{"a b c d e f", "  ", 5, "a b\n  c d\n  e f"},
+		{"verylongword b", "", 4, "verylongword\nb"},
+		{"a  b\nc", "", 0, "a b c"},
+		{"пример текста тут", "", 13, "пример текста\nтут"},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, wrap(tc.text, tc.width, tc.indent), "%q", tc.text)
+	}
+}
+
+func TestMarkdownRendererCustomTemplate(t *testing.T) {
+	tmpl := `{{ .UniqPapers }}/{{ .Errors }}{{ range sortedKeys .Papers }}{{ $paper := index $.Papers . }}
+ - [{{ $paper.Title }}]({{ $paper.URL }}) ({{ $paper.Freq }})
+{{- end }}`
+
+	var out bytes.Buffer
+	NewMarkdownRenderer(tmpl, ReadMdTemplText).Render(&out, &papers.Stats{Errs: 3}, testPapers, nil)
+
+	assert.Equal(t, "1/3\n - [Learning to represent programs with graphs](https://arxiv.org/abs/1711.00740) (2)", out.String())
+}
+
+func TestNewRenderer(t *testing.T) {
+	for _, format := range Formats() {
+		r, err := NewRenderer(format, Options{Template: MdTemplText})
+		assert.NoError(t, err, format)
+		assert.NotNil(t, r, format)
+	}
+
+	_, err := NewRenderer("docx", Options{})
+	assert.EqualError(t, err, `unknown output format "docx", must be one of: `+
+		"atom, csv, epub, html, json, jsonl, latex, md, org, ris, text")
+}
+
+func TestHTMLRendererSelfContained(t *testing.T) {
+	var out bytes.Buffer
+	NewHTMLRenderer(MdTemplText, "").Render(&out, &papers.Stats{}, testPapers, nil)
+
+	assert.Contains(t, out.String(), `<span class="count">`)
+	assert.Contains(t, out.String(), ".count {")
+	assert.NotContains(t, out.String(), `href="http://emojipedia`)
+	assert.NotContains(t, out.String(), `<script src=`)
+	assert.NotContains(t, out.String(), `<link rel="stylesheet"`)
+}
+
+func TestHTMLRendererTemplateActions(t *testing.T) {
+	r, err := NewRenderer("html", Options{Title: "Digest {{ .Papers }} <b>"})
+	require.NoError(t, err)
+	aggPapers := papers.AggPapers{"On {{ template }}": {Title: "On {{ template }}", URL: "https://example.com",
+		Freq: 1, Abstract: papers.NewAbstract("Where {{ end }} is not an action")}}
+
+	var out bytes.Buffer
+	assert.NotPanics(t, func() { r.Render(&out, &papers.Stats{}, aggPapers, nil) })
+	assert.Contains(t, out.String(), "<title>Digest {{ .Papers }} &lt;b&gt;</title>", "title is data")
+	assert.Contains(t, out.String(), "On {{ template }}")
+	assert.Contains(t, out.String(), "Where {{ end }} is not an action")
+}
+
+func TestHTMLRendererTable(t *testing.T) {
+	r, err := NewRenderer("html", Options{})
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	r.Render(&out, &papers.Stats{}, testPapers, nil)
+
+	assert.Contains(t, out.String(), `<table id="papers">`)
+	assert.Contains(t, out.String(), `<td data-sort="2"><span class="count">(2)</span></td>`)
+	assert.Contains(t, out.String(), "function sortPapers(col, numeric)")
+	assert.NotContains(t, out.String(), "<p><tr>", "table must be a single HTML block")
+}
+
+func TestHTMLRendererDarkMode(t *testing.T) {
+	var out bytes.Buffer
+	NewHTMLRenderer(MdTemplText, "").Render(&out, &papers.Stats{}, testPapers, nil)
+
+	assert.Contains(t, out.String(), "@media (prefers-color-scheme: dark)")
+	assert.Contains(t, out.String(), `<button id="theme-toggle"`)
+	assert.Contains(t, out.String(), "function toggleTheme()")
+}
+
+func TestFreqGroups(t *testing.T) {
+	aggPapers := papers.AggPapers{
+		"b": &papers.Paper{Title: "b", Freq: 1},
+		"c": &papers.Paper{Title: "c", Freq: 3},
+		"a": &papers.Paper{Title: "a", Freq: 1},
+	}
+	assert.Equal(t, []FreqGroup{{3, []string{"c"}}, {1, []string{"a", "b"}}}, freqGroups(aggPapers))
+}
+
+func TestMarkdownRendererTOC(t *testing.T) {
+	r, err := NewRenderer("md", Options{TOC: true})
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	r.Render(&out, &papers.Stats{}, testPapers, nil)
+
+	id := sectionAnchor(0, "Learning to represent programs with graphs")
+	assert.Contains(t, out.String(), "## Contents")
+	assert.Contains(t, out.String(), "**Mentioned 2 times**")
+	assert.Contains(t, out.String(), `<a href="#`+id+`" target="_self">Learning to represent programs with graphs</a>`)
+	assert.Contains(t, out.String(), `<a id="`+id+`"></a>[Learning to represent programs with graphs]`)
+}
+
+func TestMarkdownRendererHeader(t *testing.T) {
+	r, err := NewRenderer("md", Options{Title: "ML on Code", Description: "weekly", Fields: []string{"emails", "uniq"}})
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	r.Render(&out, &papers.Stats{Msgs: 3}, testPapers, nil)
+
+	assert.Contains(t, out.String(), "# ML on Code\n\n> weekly\n\n**Unread emails**: 3\n**Uniq paper titles**: 1\n\n## New papers")
+	assert.NotContains(t, out.String(), "**Date**")
+
+	_, err = NewRenderer("md", Options{Fields: []string{"emails", "authors"}})
+	assert.EqualError(t, err, `unknown header field "authors", must be one of: date, emails, papers, uniq`)
+}
+
+func TestAlertsTable(t *testing.T) {
+	st := &papers.Stats{Alerts: []*papers.AlertStats{
+		{Type: gmailutils.NewResults, Query: "neural code", Emails: 2, Papers: 5, Unique: 4},
+		{Type: gmailutils.NewCitations, Query: "me", Emails: 1, Papers: 1},
+	}}
+
+	for _, format := range []string{"md", "html"} {
+		r, err := NewRenderer(format, Options{})
+		require.NoError(t, err)
+		var out bytes.Buffer
+		r.Render(&out, st, testPapers, nil)
+		assert.NotContains(t, out.String(), "Alerts", "%s: only if configured", format)
+	}
+
+	r, err := NewRenderer("md", Options{AlertStats: true})
+	require.NoError(t, err)
+	var out bytes.Buffer
+	r.Render(&out, st, testPapers, nil)
+	assert.Contains(t, out.String(), "## Alerts\n\n| Alert | Type | Emails | Papers | Only here |\n")
+	assert.Contains(t, out.String(), "| neural code | new results | 2 | 5 | 4 |\n| me | new citations | 1 | 1 | 0 |\n")
+
+	r, err = NewRenderer("html", Options{AlertStats: true})
+	require.NoError(t, err)
+	out.Reset()
+	r.Render(&out, st, testPapers, nil)
+	assert.Contains(t, out.String(), `<td>neural code</td>`)
+}
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "short", truncate(10, "short"))
+	assert.Equal(t, "a long…", truncate(9, "a long sentence"))
+	assert.Equal(t, "abcd…", truncate(4, "abcdefgh"))
+	assert.Equal(t, "пример…", truncate(10, "пример текста"))
+}
+
+func TestGroups(t *testing.T) {
+	aggPapers := papers.AggPapers{
+		"Bert":     &papers.Paper{Title: "Bert", URL: "https://www.arxiv.org/abs/1", Venue: "NAACL"},
+		"\"attn\"": &papers.Paper{Title: "\"attn\"", URL: "https://arxiv.org/abs/2", Venue: "NeurIPS"},
+		"code2vec": &papers.Paper{Title: "code2vec", URL: "https://dl.acm.org/1", Venue: "NAACL"},
+	}
+	assert.Equal(t, []Group{
+		{"arxiv.org", []string{"\"attn\"", "Bert"}},
+		{"dl.acm.org", []string{"code2vec"}},
+	}, domainGroups(aggPapers))
+	assert.Equal(t, []Group{
+		{"A", []string{"\"attn\""}},
+		{"B", []string{"Bert"}},
+		{"C", []string{"code2vec"}},
+	}, letterGroups(aggPapers))
+	assert.Equal(t, []Group{
+		{"NAACL", []string{"Bert", "code2vec"}},
+		{"NeurIPS", []string{"\"attn\""}},
+	}, venueGroups(aggPapers))
+}
+
+func TestFormatDate(t *testing.T) {
+	assert.Equal(t, "Dec 1, 2019", formatDate("Jan 2, 2006", "2019-12-01T10:00:00Z"))
+	assert.Equal(t, "not a date", formatDate("Jan 2, 2006", "not a date"))
+}
+
+func TestCompactRenderer(t *testing.T) {
+	r, err := NewRenderer("md", Options{Template: CompactMdTemplText, Fields: []string{}})
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	r.Render(&out, &papers.Stats{}, testPapers, nil)
+
+	assert.Contains(t, out.String(), "## New papers\n\n"+
+		" - [Learning to represent programs with graphs](https://arxiv.org/abs/1711.00740) (2)\n")
+	assert.NotContains(t, out.String(), "<details>")
+	assert.NotContains(t, out.String(), "Learning tasks on source code")
+}
+
+func TestFullRenderer(t *testing.T) {
+	r, err := NewRenderer("md", Options{Template: FullMdTemplText})
+	require.NoError(t, err)
+
+	aggPapers := papers.AggPapers{}
+	for title, p := range testPapers {
+		full := *p
+		full.Source = "arXiv preprint, 2017"
+		full.Venue, full.Year = "arXiv preprint", 2017
+		aggPapers[title] = &full
+	}
+
+	var out bytes.Buffer
+	r.Render(&out, &papers.Stats{}, aggPapers, nil)
+
+	assert.Contains(t, out.String(), "### [Learning to represent programs with graphs](https://arxiv.org/abs/1711.00740)")
+	assert.Contains(t, out.String(), "<i>M Allamanis, M Brockschmidt</i> - arXiv preprint, 2017")
+	assert.Contains(t, out.String(), "Learning tasks on source code have received")
+}
+
+func TestSections(t *testing.T) {
+	aggPapers := papers.AggPapers{
+		"a": &papers.Paper{Title: "a", Alert: gmailutils.NewResults},
+		"b": &papers.Paper{Title: "b"},
+		"c": &papers.Paper{Title: "c", Alert: gmailutils.NewCitations},
+	}
+	assert.Equal(t, []Section{{"New papers", gmailutils.UnknownAlert, aggPapers}}, sections(aggPapers, Options{}))
+
+	aggPapers["b"].Seen = true
+	secs := sections(aggPapers, Options{BySeen: true})
+	require.Len(t, secs, 2)
+	assert.Equal(t, "New papers", secs[0].Title)
+	assert.Len(t, secs[0].Papers, 2)
+	assert.Equal(t, "Previously seen (still unread)", secs[1].Title)
+	assert.Contains(t, secs[1].Papers, "b")
+	aggPapers["b"].Seen, aggPapers["b"].Removed = false, true
+	secs = sections(aggPapers, Options{Diff: true})
+	require.Len(t, secs, 2)
+	assert.Equal(t, "Removed papers", secs[1].Title)
+	assert.Contains(t, secs[1].Papers, "b")
+	aggPapers["b"].Removed = false
+
+	var titles []string
+	for _, s := range sections(aggPapers, Options{ByType: true}) {
+		titles = append(titles, s.Title)
+	}
+	assert.Equal(t, []string{"New citations", "New results", "Other papers"}, titles)
+}
+
+func TestLabelSections(t *testing.T) {
+	msg := func(id, title string, labelIDs ...string) *gmail.Message {
+		body := `<h3><a href="https://scholar.google.com/scholar_url?url=https://example.com/` + id + `">` + title + `</a></h3>`
+		return &gmail.Message{Id: id, LabelIds: labelIDs, Payload: &gmail.MessagePart{
+			MimeType: "text/html",
+			Body:     &gmail.MessagePartBody{Data: base64.URLEncoding.EncodeToString([]byte(body))},
+		}}
+	}
+	_, aggPapers := papers.ExtractAndAggPapersFromMsgs([]*gmail.Message{
+		msg("1", "Code search", "L1", "UNREAD"),
+		msg("2", "Code search", "L2"),
+		msg("3", "Program repair", "L2"),
+		msg("4", "Type inference", "INBOX"),
+	}, false, false)
+	labels := []*gmail.Label{{Id: "L1", Name: "Scholar/Search"}, {Id: "L2", Name: "Scholar/Repair"}}
+
+	secs := sections(aggPapers, Options{ByType: true, Labels: labels})
+	require.Len(t, secs, 3)
+	assert.Equal(t, "Scholar/Search", secs[0].Title)
+	assert.Len(t, secs[0].Papers, 1)
+	assert.Equal(t, "Scholar/Repair", secs[1].Title)
+	assert.Len(t, secs[1].Papers, 2, "papers are in sections of all their labels")
+	assert.Equal(t, "Other papers", secs[2].Title)
+	assert.Contains(t, secs[2].Papers, "Type inference")
+
+	r, err := NewRenderer("html", Options{Labels: labels, TOC: true})
+	require.NoError(t, err)
+	var out bytes.Buffer
+	r.Render(&out, &papers.Stats{}, aggPapers, nil)
+	id := anchor("Code search")
+	assert.Equal(t, 1, strings.Count(out.String(), `<tr id="s0-`+id+`">`))
+	assert.Equal(t, 1, strings.Count(out.String(), `<tr id="s1-`+id+`">`), "IDs are unique in all the sections")
+	assert.Contains(t, out.String(), `<a href="#s0-`+id+`" target="_self">`, "linked to the first section")
+}
+
+func TestFirstSeen(t *testing.T) {
+	body := `<h3><a href="https://scholar.google.com/scholar_url?url=https://example.com/1">Code search</a></h3>`
+	msg := func(id string, date time.Time) *gmail.Message {
+		return &gmail.Message{Id: id, InternalDate: date.UnixNano() / int64(time.Millisecond), Payload: &gmail.MessagePart{
+			MimeType: "text/html",
+			Body:     &gmail.MessagePartBody{Data: base64.URLEncoding.EncodeToString([]byte(body))},
+		}}
+	}
+	first := time.Date(2020, 3, 2, 12, 0, 0, 0, time.Local)
+	_, aggPapers := papers.ExtractAndAggPapersFromMsgs([]*gmail.Message{
+		msg("2", first.AddDate(0, 0, 7)),
+		msg("1", first),
+	}, false, false)
+
+	var out bytes.Buffer
+	NewMarkdownRenderer(MdTemplText, ReadMdTemplText).Render(&out, &papers.Stats{}, aggPapers, nil)
+	assert.Contains(t, out.String(), `<span class="seen" title="Earliest alert email">first seen 2020-03-02</span>`)
+
+	out.Reset()
+	NewTextRenderer(Options{}).Render(&out, &papers.Stats{}, aggPapers, nil)
+	assert.Contains(t, out.String(), "Code search (2, first seen 2020-03-02)")
+
+	assert.Empty(t, firstSeen(&papers.Paper{}))
+
+	_, aggPapers = papers.ExtractAndAggPapersFromMsgs([]*gmail.Message{msg("1", first)}, false, false)
+	aggPapers["Undated"] = &papers.Paper{Title: "Undated"}
+	_, later := papers.ExtractAndAggPapersFromMsgs([]*gmail.Message{msg("3", first.AddDate(0, 1, 0))}, false, false)
+	for _, p := range later {
+		aggPapers["Later"] = p
+	}
+	var titles []string
+	for _, s := range sections(aggPapers, Options{Window: "week"}) {
+		titles = append(titles, s.Title)
+	}
+	assert.Equal(t, []string{"Week of 2020-03-02", "Week of 2020-03-30", "Undated papers"}, titles)
+	titles = nil
+	for _, s := range sections(aggPapers, Options{Window: "month"}) {
+		titles = append(titles, s.Title)
+	}
+	assert.Equal(t, []string{"March 2020", "April 2020", "Undated papers"}, titles)
+
+	_, err := NewRenderer("md", Options{Window: "year"})
+	assert.Error(t, err)
+}
+
+func TestTopicSections(t *testing.T) {
+	aggPapers := papers.AggPapers{
+		"Code search":     {Title: "Code search", Topic: "Code, neural", Freq: 1},
+		"Code completion": {Title: "Code completion", Topic: "Code, neural", Freq: 1},
+		"Dark matter":     {Title: "Dark matter", Topic: "Dark, galaxy", Freq: 2},
+		"On nothing":      {Title: "On nothing", Freq: 3},
+	}
+	var titles []string
+	for _, s := range sections(aggPapers, Options{ByTopic: true}) {
+		titles = append(titles, fmt.Sprintf("%s (%d)", s.Title, len(s.Papers)))
+	}
+	assert.Equal(t, []string{"Code, neural (2)", "Dark, galaxy (1)", "Other papers (1)"}, titles)
+
+	r, err := NewRenderer("html", Options{ByTopic: true})
+	require.NoError(t, err)
+	var out bytes.Buffer
+	r.Render(&out, &papers.Stats{}, aggPapers, nil)
+	assert.Contains(t, out.String(), `<td data-sort="Dark, galaxy">Dark, galaxy</td>`)
+}
+
+func TestSparkline(t *testing.T) {
+	body := `<h3><a href="https://scholar.google.com/scholar_url?url=https://example.com/1">Code search</a></h3>`
+	msg := func(id string, date time.Time) *gmail.Message {
+		return &gmail.Message{Id: id, InternalDate: date.UnixNano() / int64(time.Millisecond), Payload: &gmail.MessagePart{
+			MimeType: "text/html",
+			Body:     &gmail.MessagePartBody{Data: base64.URLEncoding.EncodeToString([]byte(body))},
+		}}
+	}
+	first := time.Date(2020, 3, 2, 12, 0, 0, 0, time.Local)
+	paper := func(msgs ...*gmail.Message) *papers.Paper {
+		_, aggPapers := papers.ExtractAndAggPapersFromMsgs(msgs, false, false)
+		require.Len(t, aggPapers, 1)
+		return aggPapers["Code search"]
+	}
+
+	p := paper(msg("1", first), msg("2", first.Add(time.Hour)))
+	counts, _ := occurrences(p)
+	assert.Nil(t, counts, "same day")
+	assert.Empty(t, sparkline(p))
+	assert.Empty(t, sparklineSVG(p))
+
+	p = paper(msg("1", first), msg("2", first.AddDate(0, 0, 3)), msg("3", first.AddDate(0, 0, 3)), msg("4", first.AddDate(0, 0, 1)))
+	counts, perBar := occurrences(p)
+	assert.Equal(t, []int{1, 1, 0, 2}, counts)
+	assert.Equal(t, 1, perBar)
+	assert.Equal(t, "▄▄▁█", sparkline(p))
+	svg := string(sparklineSVG(p))
+	assert.True(t, strings.HasPrefix(svg, `<svg class="spark" width="12" height="12"`), svg)
+	assert.Contains(t, svg, `<rect x="9" y="0" width="2" height="12"/>`)
+	assert.Contains(t, svg, `<title>Emails per day, since 2020-03-02</title>`)
+
+	p = paper(msg("1", first), msg("2", first.AddDate(0, 0, 59)))
+	counts, perBar = occurrences(p)
+	assert.Equal(t, maxSparkline, len(counts))
+	assert.Equal(t, 2, perBar)
+	assert.Equal(t, "Emails per 2 days", sparklineTitle(p))
+	assert.Contains(t, string(sparklineSVG(p)), `<title>Emails per 2 days, since 2020-03-02</title>`)
+
+	aggPapers := papers.AggPapers{"Code search": paper(msg("1", first), msg("2", first.AddDate(0, 0, 1)))}
+	var out bytes.Buffer
+	NewMarkdownRenderer(MdTemplText, ReadMdTemplText).Render(&out, &papers.Stats{}, aggPapers, nil)
+	assert.Contains(t, out.String(), `first seen 2020-03-02</span> <span class="spark" title="Emails per day">██</span>`)
+
+	out.Reset()
+	r, err := NewRenderer("html", Options{})
+	require.NoError(t, err)
+	r.Render(&out, &papers.Stats{}, aggPapers, nil)
+	assert.Contains(t, out.String(), `first seen 2020-03-02</span> <svg class="spark"`)
+	assert.NotContains(t, out.String(), "██")
+}
+
+func TestCitedSections(t *testing.T) {
+	aggPapers := papers.AggPapers{
+		"a": &papers.Paper{Title: "a", Alert: gmailutils.NewCitations, Cites: []string{"code2vec"}},
+		"b": &papers.Paper{Title: "b", Alert: gmailutils.NewCitations, Cites: []string{"code2vec", "Bert"}},
+		"c": &papers.Paper{Title: "c", Alert: gmailutils.NewCitations},
+	}
+
+	secs := citedSections(aggPapers)
+	require.Len(t, secs, 3)
+	assert.Equal(t, `New citations of "Bert"`, secs[0].Title)
+	assert.Equal(t, papers.AggPapers{"b": aggPapers["b"]}, secs[0].Papers)
+	assert.Equal(t, `New citations of "code2vec"`, secs[1].Title)
+	assert.Len(t, secs[1].Papers, 2)
+	assert.Equal(t, "New citations", secs[2].Title)
+	assert.Equal(t, papers.AggPapers{"c": aggPapers["c"]}, secs[2].Papers)
+}
+
+func TestMarkdownRendererByType(t *testing.T) {
+	r, err := NewRenderer("md", Options{ByType: true, Fields: []string{}})
+	require.NoError(t, err)
+
+	cited := *testPapers["Learning to represent programs with graphs"]
+	cited.Alert = gmailutils.NewCitations
+
+	var out bytes.Buffer
+	r.Render(&out, &papers.Stats{}, papers.AggPapers{cited.Title: &cited}, nil)
+
+	assert.Contains(t, out.String(), "## New citations\n")
+	assert.NotContains(t, out.String(), "## New papers")
+}
+
+func TestKindBadge(t *testing.T) {
+	pdf := *testPapers["Learning to represent programs with graphs"]
+	pdf.Kind = papers.KindPDF
+
+	var out bytes.Buffer
+	NewMarkdownRenderer(MdTemplText, ReadMdTemplText).Render(&out, &papers.Stats{}, papers.AggPapers{pdf.Title: &pdf}, nil)
+	assert.Contains(t, out.String(), `<span class="kind">PDF</span> [Learning to represent programs with graphs]`)
+
+	out.Reset()
+	pdf.Highlight = true
+	NewMarkdownRenderer(CompactMdTemplText, ReadMdTemplText).Render(&out, &papers.Stats{}, papers.AggPapers{pdf.Title: &pdf}, nil)
+	assert.Contains(t, out.String(), `★</span> <span class="kind">PDF</span> [Learning to represent programs with graphs]`)
+
+	out.Reset()
+	NewTextRenderer(Options{}).Render(&out, &papers.Stats{}, papers.AggPapers{pdf.Title: &pdf}, nil)
+	assert.Contains(t, out.String(), "[PDF] Learning to represent programs with graphs (2)")
+}
+
+func TestMarkdownEscaping(t *testing.T) {
+	title := "*Learning* to [represent] programs_with_graphs | code"
+	p := papers.Paper{Title: title, URL: "https://arxiv.org/abs/1711.00740", Freq: 1,
+		Abstract: papers.Abstract{FirstLine: "Learning *tasks*", Rest: " on source code"}}
+	aggPapers := papers.AggPapers{title: &p}
+
+	var out bytes.Buffer
+	NewMarkdownRenderer(MdTemplText, ReadMdTemplText).Render(&out, &papers.Stats{}, aggPapers, nil)
+	assert.Contains(t, out.String(), `[\*Learning\* to \[represent\] programs\_with\_graphs \| code](https://arxiv.org/abs/1711.00740)`)
+	assert.Contains(t, out.String(), "<summary>Learning *tasks*</summary>", "no escaping in HTML blocks")
+
+	out.Reset()
+	NewHTMLRenderer(MdTemplText, "").Render(&out, &papers.Stats{}, aggPapers, nil)
+	assert.Contains(t, out.String(), `>*Learning* to [represent] programs_with_graphs | code</a>`)
+	assert.NotContains(t, out.String(), "<em>")
+
+	out.Reset()
+	NewJSONLRenderer().Render(&out, &papers.Stats{}, aggPapers, nil)
+	assert.Contains(t, out.String(), title, "no escaping outside of Markdown")
+}
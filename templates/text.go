@@ -0,0 +1,112 @@
+package templates
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bzz/scholar-alert-digest/papers"
+)
+
+// TextRenderer outputs plain text, wrapped at a given width.
+type TextRenderer struct {
+	width int
+	opts  Options
+}
+
+// NewTextRenderer factory for Renderer in plain text format, wrapped at opts.Width columns.
+func NewTextRenderer(opts Options) Renderer {
+	return &TextRenderer{opts.Width, opts}
+}
+
+// Render papers as a plain text \wo any markup.
+func (r *TextRenderer) Render(out io.Writer, st *papers.Stats, unread, read papers.AggPapers) {
+	log.Print("formatting gmail messages in plain text")
+	w := bufio.NewWriter(out)
+
+	fmt.Fprintf(w, "%s\n\n", orDefault(r.opts.Title, DefaultTitle))
+	if r.opts.Description != "" {
+		fmt.Fprintf(w, "%s\n\n", wrap(r.opts.Description, r.width, ""))
+	}
+	if showField(r.opts.Fields, "date") {
+		fmt.Fprintf(w, "Date: %s\n", time.Now().Format(time.RFC3339))
+	}
+	if showField(r.opts.Fields, "emails") {
+		fmt.Fprintf(w, "Unread emails: %d\n", st.Msgs)
+	}
+	if showField(r.opts.Fields, "papers") {
+		fmt.Fprintf(w, "Paper titles: %d\n", st.Titles)
+	}
+	if showField(r.opts.Fields, "uniq") {
+		fmt.Fprintf(w, "Uniq paper titles: %d\n", len(unread))
+	}
+
+	r.section(w, "New papers", unread)
+	if read != nil {
+		r.section(w, "Old papers", read)
+	}
+
+	if err := w.Flush(); err != nil {
+		log.Fatalf("failed to write plain text: %s", err)
+	}
+}
+
+func (r *TextRenderer) section(w io.Writer, name string, aggPapers papers.AggPapers) {
+	fmt.Fprintf(w, "\n%s\n%s\n", name, strings.Repeat("=", utf8.RuneCountInString(name)))
+	for i, title := range papers.SortedKeys(aggPapers) {
+		p := aggPapers[title]
+		num := fmt.Sprintf("%d. ", i+1)
+		indent := strings.Repeat(" ", len(num))
+
+		title := p.Title
+		if p.Kind != "" {
+			title = fmt.Sprintf("[%s] %s", p.Kind, title)
+		}
+		if p.Highlight {
+			title = "★ " + title
+		}
+		count := fmt.Sprint(p.Freq)
+		if !p.Date().IsZero() {
+			count += ", first seen " + p.Date().Format("2006-01-02")
+		}
+		fmt.Fprintf(w, "\n%s%s\n", num, wrap(fmt.Sprintf("%s (%s)", title, count), r.width, indent))
+		if p.Author != "" {
+			fmt.Fprintf(w, "%s%s\n", indent, wrap(p.Author, r.width, indent))
+		}
+		if p.Source != "" {
+			fmt.Fprintf(w, "%s%s\n", indent, wrap(p.Source, r.width, indent))
+		}
+		fmt.Fprintf(w, "%s%s\n", indent, p.URL)
+		if abs := strings.TrimSpace(p.Abstract.FirstLine + " " + p.Abstract.Rest); abs != "" {
+			fmt.Fprintf(w, "\n%s%s\n", indent, wrap(abs, r.width, indent))
+		}
+	}
+}
+
+// wrap breaks text on whitespace into lines of at most width runes, including the indent.
+// The indent is prepended to every line but the first one, which is expected to be
+// already prefixed by the caller. Words longer than a line are not split.
+func wrap(text string, width int, indent string) string {
+	var sb strings.Builder
+	lineLen := utf8.RuneCountInString(indent)
+	for i, word := range strings.Fields(text) {
+		wordLen := utf8.RuneCountInString(word)
+		switch {
+		case i == 0:
+			lineLen += wordLen
+		case width > 0 && lineLen+1+wordLen > width:
+			sb.WriteString("\n")
+			sb.WriteString(indent)
+			lineLen = utf8.RuneCountInString(indent) + wordLen
+		default:
+			sb.WriteString(" ")
+			lineLen += 1 + wordLen
+		}
+		sb.WriteString(word)
+	}
+	return sb.String()
+}